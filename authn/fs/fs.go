@@ -1,17 +1,26 @@
 package fs
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"github.com/advancedlogic/easy/commons"
+	"github.com/advancedlogic/easy/factory"
 	"github.com/advancedlogic/easy/interfaces"
 	"github.com/pkg/errors"
 	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
 	"time"
 )
 
 type FS struct {
+	sync.Mutex
 	folder string
+	policy commons.PasswordPolicy
 }
 
 type User struct {
@@ -20,6 +29,8 @@ type User struct {
 	Timestamp int64    `json:"timestamp"`
 	Groups    []string `json:"groups"`
 	Enabled   bool     `json:"enabled"`
+	//PasswordChanged is when the password was last reset, in nanoseconds
+	PasswordChanged int64 `json:"password_changed,omitempty"`
 }
 
 func NewUser(username, password string) (*User, error) {
@@ -50,9 +61,58 @@ func WithFolder(folder string) interfaces.AuthNOption {
 	}
 }
 
+//WithPasswordPolicy set what a new password must satisfy, 8 characters by default
+func WithPasswordPolicy(policy commons.PasswordPolicy) interfaces.AuthNOption {
+	return func(a interfaces.AuthN) error {
+		if policy.MinLength < 1 {
+			return errors.New("password min length must be positive")
+		}
+		fs := a.(*FS)
+		fs.policy = policy
+		return nil
+	}
+}
+
+//FromEnv configure the authn from the EASY_FS_* variables: FOLDER,
+//PASSWORD_MIN_LENGTH, PASSWORD_UPPER, PASSWORD_LOWER, PASSWORD_DIGIT and
+//PASSWORD_SYMBOL
+func FromEnv() interfaces.AuthNOption {
+	return func(a interfaces.AuthN) error {
+		if err := commons.EnvString("fs", "folder", func(folder string) error {
+			return WithFolder(folder)(a)
+		}); err != nil {
+			return err
+		}
+		fs := a.(*FS)
+		policy := fs.policy
+		if err := commons.EnvInt("fs", "password_min_length", func(length int) error {
+			policy.MinLength = length
+			return nil
+		}); err != nil {
+			return err
+		}
+		for setting, required := range map[string]*bool{
+			"password_upper":  &policy.RequireUpper,
+			"password_lower":  &policy.RequireLower,
+			"password_digit":  &policy.RequireDigit,
+			"password_symbol": &policy.RequireSymbol,
+		} {
+			required := required
+			if err := commons.EnvBool("fs", setting, func(b bool) error {
+				*required = b
+				return nil
+			}); err != nil {
+				return err
+			}
+		}
+		return WithPasswordPolicy(policy)(a)
+	}
+}
+
 func New(options ...interfaces.AuthNOption) (*FS, error) {
 	fs := &FS{
 		folder: "fs",
+		policy: commons.DefaultPasswordPolicy,
 	}
 	for _, option := range options {
 		if err := option(fs); err != nil {
@@ -62,61 +122,383 @@ func New(options ...interfaces.AuthNOption) (*FS, error) {
 	return fs, nil
 }
 
+//Health check that the users folder is available
+func (f *FS) Health(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	info, err := os.Stat(f.folder)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%s is not a folder", f.folder)
+	}
+	return nil
+}
+
 func (f *FS) Register(username, password string) (interface{}, error) {
-	if username != "" && password != "" {
-		user, err := NewUser(username, password)
-		if err != nil {
-			return nil, err
-		}
-		jsonUser, err := json.Marshal(user)
-		if err != nil {
-			return nil, err
+	return f.RegisterContext(context.Background(), username, password)
+}
+
+//RegisterContext create a user in the group user, or fail with
+//interfaces.ErrUserExists when the username is taken
+func (f *FS) RegisterContext(ctx context.Context, username, password string) (interface{}, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if username == "" || password == "" {
+		return nil, errors.New("username and password cannot be empty")
+	}
+	if err := commons.ValidateUsername(username); err != nil {
+		return nil, err
+	}
+	if err := f.policy.Validate(password); err != nil {
+		return nil, err
+	}
+	user, err := NewUser(username, password)
+	if err != nil {
+		return nil, err
+	}
+	f.Lock()
+	defer f.Unlock()
+	if err := f.write(user, false); err != nil {
+		return nil, err
+	}
+	user.Password = ""
+	return user, nil
+}
+
+func (f *FS) Login(username, password string) (interface{}, error) {
+	return f.LoginContext(context.Background(), username, password)
+}
+
+//LoginContext return the user, without password, when password is right and
+//the user is enabled
+func (f *FS) LoginContext(ctx context.Context, username, password string) (interface{}, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if username == "" || password == "" {
+		return nil, errors.New("username and password cannot be empty")
+	}
+	user, err := f.read(username)
+	if err == interfaces.ErrUserNotFound {
+		// an unknown user is told apart from a wrong password by nobody, not
+		// even by the time a bcrypt comparison takes
+		commons.CompareDummyPassword([]byte(password))
+		return nil, interfaces.ErrWrongCredentials
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !commons.ComparePasswords(user.Password, []byte(password)) {
+		return nil, interfaces.ErrWrongCredentials
+	}
+	if !user.Enabled {
+		return nil, interfaces.ErrUserDisabled
+	}
+	user.Password = ""
+	return *user, nil
+}
+
+//GroupsContext return the groups of a user
+func (f *FS) GroupsContext(ctx context.Context, username string) ([]string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if username == "" {
+		return nil, errors.New("username cannot be empty")
+	}
+	user, err := f.read(username)
+	if err != nil {
+		return nil, err
+	}
+	return user.Groups, nil
+}
+
+func (f *FS) Logout(username string) error {
+	return f.LogoutContext(context.Background(), username)
+}
+
+//LogoutContext check that the user exists, the sessions are ended by the authz
+func (f *FS) LogoutContext(ctx context.Context, username string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if username == "" {
+		return errors.New("username cannot be empty")
+	}
+	_, err := f.read(username)
+	return err
+}
+
+func (f *FS) Delete(username string) error {
+	return f.DeleteContext(context.Background(), username)
+}
+
+//DeleteContext remove the file of a user
+func (f *FS) DeleteContext(ctx context.Context, username string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if username == "" {
+		return errors.New("username cannot be empty")
+	}
+	if err := commons.ValidateUsername(username); err != nil {
+		return err
+	}
+	f.Lock()
+	defer f.Unlock()
+	err := os.Remove(f.path(username))
+	if os.IsNotExist(err) {
+		return interfaces.ErrUserNotFound
+	}
+	return err
+}
+
+func (f *FS) Reset(username, password string) (interface{}, error) {
+	return f.ResetContext(context.Background(), username, password)
+}
+
+//ResetContext replace the password of a user, keeping its groups and state
+func (f *FS) ResetContext(ctx context.Context, username, password string) (interface{}, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if username == "" || password == "" {
+		return nil, errors.New("username and password cannot be empty")
+	}
+	if err := f.policy.Validate(password); err != nil {
+		return nil, err
+	}
+	epassword, err := commons.HashAndSalt(password)
+	if err != nil {
+		return nil, err
+	}
+	return f.update(username, func(user *User) {
+		user.Password = epassword
+		user.PasswordChanged = time.Now().UnixNano()
+	})
+}
+
+//UsersContext return every user, sorted by username and without password
+func (f *FS) UsersContext(ctx context.Context) (interface{}, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	files, err := filepath.Glob(filepath.Join(f.folder, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	users := make([]User, 0, len(files))
+	for _, file := range files {
+		username := strings.TrimSuffix(filepath.Base(file), ".json")
+		user, err := f.read(username)
+		if err == interfaces.ErrUserNotFound {
+			continue
 		}
-		err = ioutil.WriteFile(fmt.Sprintf("%s/%s.json", f.folder, username), jsonUser, 0644)
 		if err != nil {
 			return nil, err
 		}
 		user.Password = ""
-		return user, nil
+		users = append(users, *user)
 	}
-	return nil, errors.New("username and password cannot be empty")
+	sort.Slice(users, func(i, j int) bool {
+		return users[i].Username < users[j].Username
+	})
+	return users, nil
 }
 
-func (f *FS) Login(username, password string) (interface{}, error) {
-	if username != "" && password != "" {
-		jsonUser, err := ioutil.ReadFile(fmt.Sprintf("%s/%s.json", f.folder, username))
-		if err != nil {
-			return nil, err
-		}
-		var user User
-		err = json.Unmarshal(jsonUser, &user)
-		if err != nil {
-			return nil, err
+//UserContext return a user without password
+func (f *FS) UserContext(ctx context.Context, username string) (interface{}, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	user, err := f.read(username)
+	if err != nil {
+		return nil, err
+	}
+	user.Password = ""
+	return *user, nil
+}
+
+//SetEnabledContext enable or disable a user, a disabled user cannot log in
+func (f *FS) SetEnabledContext(ctx context.Context, username string, enabled bool) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	_, err := f.update(username, func(user *User) {
+		user.Enabled = enabled
+	})
+	return err
+}
+
+//EnabledContext tell whether a user is enabled
+func (f *FS) EnabledContext(ctx context.Context, username string) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	user, err := f.read(username)
+	if err != nil {
+		return false, err
+	}
+	return user.Enabled, nil
+}
+
+//PasswordChangedContext tell when the password of a user was last reset
+func (f *FS) PasswordChangedContext(ctx context.Context, username string) (time.Time, error) {
+	if err := ctx.Err(); err != nil {
+		return time.Time{}, err
+	}
+	user, err := f.read(username)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if user.PasswordChanged == 0 {
+		return time.Time{}, nil
+	}
+	return time.Unix(0, user.PasswordChanged), nil
+}
+
+//AddGroupsContext add groups to a user and return its groups
+func (f *FS) AddGroupsContext(ctx context.Context, username string, groups ...string) ([]string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	user, err := f.update(username, func(user *User) {
+		for _, group := range groups {
+			if group != "" && !contains(user.Groups, group) {
+				user.Groups = append(user.Groups, group)
+			}
 		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return user.Groups, nil
+}
 
-		if !commons.ComparePasswords(user.Password, []byte(password)) {
-			return nil, errors.New("wrong username or password")
+//RemoveGroupsContext remove groups from a user and return its groups
+func (f *FS) RemoveGroupsContext(ctx context.Context, username string, groups ...string) ([]string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	user, err := f.update(username, func(user *User) {
+		kept := make([]string, 0, len(user.Groups))
+		for _, group := range user.Groups {
+			if !contains(groups, group) {
+				kept = append(kept, group)
+			}
 		}
-		user.Password = ""
-		return user, nil
+		user.Groups = kept
+	})
+	if err != nil {
+		return nil, err
 	}
-	return nil, errors.New("username and password cannot be empty")
+	return user.Groups, nil
 }
 
-func (f *FS) Logout(username string) error {
-	if username != "" {
-		return nil
+//update change a user with fn and save it
+func (f *FS) update(username string, fn func(*User)) (*User, error) {
+	f.Lock()
+	defer f.Unlock()
+	user, err := f.read(username)
+	if err != nil {
+		return nil, err
+	}
+	fn(user)
+	if err := f.write(user, true); err != nil {
+		return nil, err
 	}
-	return errors.New("username cannot be empty")
+	user.Password = ""
+	return user, nil
 }
 
-func (f *FS) Delete(username string) error {
-	if username != "" {
-		return nil
+func (f *FS) path(username string) string {
+	return filepath.Join(f.folder, username+".json")
+}
+
+func (f *FS) read(username string) (*User, error) {
+	if err := commons.ValidateUsername(username); err != nil {
+		return nil, err
 	}
-	return errors.New("username cannot be empty")
+	jsonUser, err := ioutil.ReadFile(f.path(username))
+	if os.IsNotExist(err) {
+		return nil, interfaces.ErrUserNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	var user User
+	if err := json.Unmarshal(jsonUser, &user); err != nil {
+		return nil, err
+	}
+	return &user, nil
 }
 
-func (f *FS) Reset(username, password string) (interface{}, error) {
-	return f.Register(username, password)
+//write save user in a file readable by the owner only. The file is written
+//aside and moved in place, a crash never leaves half a user; without replace
+//an existing user is kept and interfaces.ErrUserExists returned
+func (f *FS) write(user *User, replace bool) error {
+	jsonUser, err := json.Marshal(user)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(f.folder, 0700); err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(f.folder, "."+user.Username+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(jsonUser); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if replace {
+		return os.Rename(tmp.Name(), f.path(user.Username))
+	}
+	// a link fails when the user exists, even if another process created it
+	if err := os.Link(tmp.Name(), f.path(user.Username)); err != nil {
+		if os.IsExist(err) {
+			return interfaces.ErrUserExists
+		}
+		return err
+	}
+	return nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func init() {
+	factory.Register(factory.AuthN, "fs", func(settings interfaces.Configuration) (interface{}, error) {
+		options := make([]interfaces.AuthNOption, 0)
+		if folder := settings.GetStringOrDefault("folder", ""); folder != "" {
+			options = append(options, WithFolder(folder))
+		}
+		policy := commons.DefaultPasswordPolicy
+		policy.MinLength = settings.GetIntOrDefault("password_min_length", policy.MinLength)
+		policy.RequireUpper = settings.GetBoolOrDefault("password_upper", false)
+		policy.RequireLower = settings.GetBoolOrDefault("password_lower", false)
+		policy.RequireDigit = settings.GetBoolOrDefault("password_digit", false)
+		policy.RequireSymbol = settings.GetBoolOrDefault("password_symbol", false)
+		options = append(options, WithPasswordPolicy(policy))
+		return New(append(options, FromEnv())...)
+	})
 }
@@ -0,0 +1,116 @@
+package fs
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/advancedlogic/easy/commons"
+	"github.com/advancedlogic/easy/interfaces"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFS(t *testing.T) {
+	folder, _ := ioutil.TempDir("", "fs")
+	defer os.RemoveAll(folder)
+	users := filepath.Join(folder, "users")
+	f, err := New(WithFolder(users))
+	assert.Nil(t, err)
+	ctx := context.Background()
+
+	_, err = f.Register("ada", "short")
+	assert.NotNil(t, err)
+	_, err = f.Register("../ada", "long enough")
+	assert.NotNil(t, err)
+	_, err = f.Register("ada", "long enough")
+	assert.Nil(t, err)
+	_, err = f.Register("ada", "another one")
+	assert.Equal(t, interfaces.ErrUserExists, err)
+	info, err := os.Stat(filepath.Join(users, "ada.json"))
+	assert.Nil(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+	files, _ := ioutil.ReadDir(users)
+	assert.Len(t, files, 1)
+
+	_, err = f.Login("ada", "another one")
+	assert.Equal(t, interfaces.ErrWrongCredentials, err)
+	_, err = f.Login("bob", "long enough")
+	assert.Equal(t, interfaces.ErrWrongCredentials, err)
+	user, err := f.Login("ada", "long enough")
+	assert.Nil(t, err)
+	assert.Equal(t, "", user.(User).Password)
+
+	groups, err := f.AddGroupsContext(ctx, "ada", "staff", "user", "admin")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"user", "staff", "admin"}, groups)
+	groups, err = f.RemoveGroupsContext(ctx, "ada", "admin")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"user", "staff"}, groups)
+	_, err = f.AddGroupsContext(ctx, "bob", "staff")
+	assert.Equal(t, interfaces.ErrUserNotFound, err)
+
+	// a reset keep the groups
+	_, err = f.Reset("ada", "short")
+	assert.NotNil(t, err)
+	_, err = f.Reset("ada", "a new password")
+	assert.Nil(t, err)
+	_, err = f.Login("ada", "long enough")
+	assert.Equal(t, interfaces.ErrWrongCredentials, err)
+	user, err = f.Login("ada", "a new password")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"user", "staff"}, user.(User).Groups)
+	assert.NotZero(t, user.(User).PasswordChanged)
+	changed, err := f.PasswordChangedContext(ctx, "ada")
+	assert.Nil(t, err)
+	assert.Equal(t, user.(User).PasswordChanged, changed.UnixNano())
+
+	assert.Nil(t, f.SetEnabledContext(ctx, "ada", false))
+	enabled, err := f.EnabledContext(ctx, "ada")
+	assert.Nil(t, err)
+	assert.False(t, enabled)
+	_, err = f.Login("ada", "a new password")
+	assert.Equal(t, interfaces.ErrUserDisabled, err)
+	assert.Nil(t, f.SetEnabledContext(ctx, "ada", true))
+	_, err = f.Login("ada", "a new password")
+	assert.Nil(t, err)
+
+	_, err = f.Register("bob", "long enough")
+	assert.Nil(t, err)
+	list, err := f.UsersContext(ctx)
+	assert.Nil(t, err)
+	assert.Len(t, list, 2)
+	assert.Equal(t, "ada", list.([]User)[0].Username)
+	assert.Equal(t, "", list.([]User)[0].Password)
+
+	assert.Nil(t, f.Logout("bob"))
+	assert.Nil(t, f.Delete("bob"))
+	assert.Equal(t, interfaces.ErrUserNotFound, f.Delete("bob"))
+	assert.Equal(t, interfaces.ErrUserNotFound, f.Logout("bob"))
+	_, err = f.UserContext(ctx, "bob")
+	assert.Equal(t, interfaces.ErrUserNotFound, err)
+}
+
+func TestFS_PasswordPolicy(t *testing.T) {
+	_, err := New(WithPasswordPolicy(commons.PasswordPolicy{}))
+	assert.NotNil(t, err)
+	folder, _ := ioutil.TempDir("", "fs")
+	defer os.RemoveAll(folder)
+	f, err := New(WithFolder(folder), WithPasswordPolicy(commons.PasswordPolicy{
+		MinLength: 10, RequireUpper: true, RequireDigit: true, RequireSymbol: true,
+	}))
+	assert.Nil(t, err)
+	_, err = f.Register("ada", "password")
+	assert.EqualError(t, err, "password must contain at least 10 characters, an uppercase letter, a digit, a symbol")
+	assert.IsType(t, &commons.PolicyError{}, err)
+	_, err = f.Register("ada", "Password-2020")
+	assert.Nil(t, err)
+
+	os.Setenv("EASY_FS_PASSWORD_MIN_LENGTH", "20")
+	defer os.Unsetenv("EASY_FS_PASSWORD_MIN_LENGTH")
+	f, err = New(WithFolder(folder), FromEnv())
+	assert.Nil(t, err)
+	_, err = f.Register("bob", "Password-2020")
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,539 @@
+// Package lockout slow down and lock out the logins guessing passwords. The
+// failed logins of every username and of every client IP are counted in a
+// cache shared by the instances of a service: each failure is answered later
+// than the previous one and, past the limit, the username or the IP is locked
+// out for a while
+package lockout
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/advancedlogic/easy/interfaces"
+	"github.com/advancedlogic/easy/logging"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	//User is the kind of the failures counted per username
+	User = "user"
+	//IP is the kind of the failures counted per client IP
+	IP = "ip"
+)
+
+//ErrLocked is returned for a username or a client IP locked out
+var ErrLocked = errors.New("too many failed logins")
+
+type Option func(*Guard) error
+
+//LockedError is the error of a username or a client IP locked out, it tells
+//when a login can be tried again
+type LockedError struct {
+	Kind       string
+	Key        string
+	RetryAfter time.Duration
+}
+
+func (l *LockedError) Error() string {
+	return fmt.Sprintf("%s, retry after %s", ErrLocked, l.RetryAfter)
+}
+
+//Is make errors.Is(err, ErrLocked) true
+func (l *LockedError) Is(target error) bool {
+	return target == ErrLocked
+}
+
+//Event tell that a username or a client IP got locked out
+type Event struct {
+	Kind     string    `json:"kind"`
+	Key      string    `json:"key"`
+	Failures int64     `json:"failures"`
+	Until    time.Time `json:"until"`
+}
+
+//Status describe the failed logins of a username or a client IP
+type Status struct {
+	Kind        string     `json:"kind"`
+	Key         string     `json:"key"`
+	Failures    int64      `json:"failures"`
+	LockedUntil *time.Time `json:"locked_until,omitempty"`
+}
+
+// count is the failure counter of a cache unable to count atomically
+type count struct {
+	Count   int64 `json:"count"`
+	Expires int64 `json:"expires"`
+}
+
+// Guard count the failed logins and lock out the usernames and IPs past the limit
+type Guard struct {
+	cache      interfaces.Cache
+	prefix     string
+	attempts   int64
+	ipAttempts int64
+	window     time.Duration
+	duration   time.Duration
+	delay      time.Duration
+	maxDelay   time.Duration
+	proxies    []*net.IPNet
+	notify     func(context.Context, Event)
+	now        func() time.Time
+	interfaces.Logger
+}
+
+//WithCache count the failures in cache, shared by every instance of the service
+func WithCache(cache interfaces.Cache) Option {
+	return func(g *Guard) error {
+		return g.WithCache(cache)
+	}
+}
+
+//WithPrefix set the prefix of the cache keys, "lockout" by default
+func WithPrefix(prefix string) Option {
+	return func(g *Guard) error {
+		if prefix != "" {
+			g.prefix = strings.TrimSuffix(prefix, ":")
+			return nil
+		}
+		return errors.New("prefix cannot be empty")
+	}
+}
+
+//WithMaxAttempts lock out a username after attempts failed logins, 5 by default
+func WithMaxAttempts(attempts int) Option {
+	return func(g *Guard) error {
+		if attempts > 0 {
+			g.attempts = int64(attempts)
+			return nil
+		}
+		return errors.New("max attempts must be > 0")
+	}
+}
+
+//WithIPMaxAttempts lock out a client IP after attempts failed logins, 20 by
+//default as many users can share an IP. 0 does not count the IPs
+func WithIPMaxAttempts(attempts int) Option {
+	return func(g *Guard) error {
+		if attempts >= 0 {
+			g.ipAttempts = int64(attempts)
+			return nil
+		}
+		return errors.New("ip max attempts cannot be negative")
+	}
+}
+
+//WithWindow set how long a failure is counted, 15 minutes by default
+func WithWindow(window time.Duration) Option {
+	return func(g *Guard) error {
+		if window > 0 {
+			g.window = window
+			return nil
+		}
+		return errors.New("window must be > 0")
+	}
+}
+
+//WithDuration set how long a lockout lasts, 15 minutes by default
+func WithDuration(duration time.Duration) Option {
+	return func(g *Guard) error {
+		if duration > 0 {
+			g.duration = duration
+			return nil
+		}
+		return errors.New("duration must be > 0")
+	}
+}
+
+//WithDelay delay the answer to the first failure by delay and double it for
+//every next one, up to max. 500ms and 8s by default, 0 for no delay
+func WithDelay(delay, max time.Duration) Option {
+	return func(g *Guard) error {
+		if delay < 0 || max < delay {
+			return errors.New("delay cannot be negative nor above max")
+		}
+		g.delay = delay
+		g.maxDelay = max
+		return nil
+	}
+}
+
+//WithTrustedProxies trust the X-Forwarded-For header of the requests coming
+//from proxies, IPs or CIDRs. Without it the client IP is the peer of the
+//connection: the header is set by the client and could dodge the IP limit
+func WithTrustedProxies(proxies ...string) Option {
+	return func(g *Guard) error {
+		if len(proxies) == 0 {
+			return errors.New("at least one proxy must be provided")
+		}
+		for _, proxy := range proxies {
+			if !strings.Contains(proxy, "/") {
+				if ip := net.ParseIP(proxy); ip != nil && ip.To4() != nil {
+					proxy += "/32"
+				} else {
+					proxy += "/128"
+				}
+			}
+			_, network, err := net.ParseCIDR(proxy)
+			if err != nil {
+				return fmt.Errorf("invalid proxy %q", proxy)
+			}
+			g.proxies = append(g.proxies, network)
+		}
+		return nil
+	}
+}
+
+//WithNotify call notify for every lockout
+func WithNotify(notify func(context.Context, Event)) Option {
+	return func(g *Guard) error {
+		return g.WithNotify(notify)
+	}
+}
+
+func WithLogger(logger interfaces.Logger) Option {
+	return func(g *Guard) error {
+		return g.WithLogger(logger)
+	}
+}
+
+func New(options ...Option) (*Guard, error) {
+	g := &Guard{
+		prefix:     "lockout",
+		attempts:   5,
+		ipAttempts: 20,
+		window:     15 * time.Minute,
+		duration:   15 * time.Minute,
+		delay:      500 * time.Millisecond,
+		maxDelay:   8 * time.Second,
+		now:        time.Now,
+		Logger:     logging.Logrus(logrus.New()),
+	}
+	for _, option := range options {
+		if err := option(g); err != nil {
+			return nil, err
+		}
+	}
+	return g, nil
+}
+
+//ClientIP return the IP whose failures are counted for a request from
+//remoteAddr carrying the X-Forwarded-For addresses forwarded: the nearest one
+//not added by a trusted proxy
+func (g *Guard) ClientIP(remoteAddr string, forwarded ...string) string {
+	ip := remoteAddr
+	if host, _, err := net.SplitHostPort(remoteAddr); err == nil {
+		ip = host
+	}
+	hops := strings.Split(strings.Join(forwarded, ","), ",")
+	for i := len(hops) - 1; i >= 0 && g.trusted(ip); i-- {
+		hop := strings.TrimSpace(hops[i])
+		if net.ParseIP(hop) == nil {
+			break
+		}
+		ip = hop
+	}
+	return ip
+}
+
+func (g *Guard) trusted(ip string) bool {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+	for _, proxy := range g.proxies {
+		if proxy.Contains(parsed) {
+			return true
+		}
+	}
+	return false
+}
+
+// HasCache tell whether the guard has a cache for the failures
+func (g *Guard) HasCache() bool {
+	return g.cache != nil
+}
+
+func (g *Guard) WithCache(cache interfaces.Cache) error {
+	if cache != nil {
+		g.cache = cache
+		return nil
+	}
+	return errors.New("cache cannot be nil")
+}
+
+func (g *Guard) WithNotify(notify func(context.Context, Event)) error {
+	if notify != nil {
+		g.notify = notify
+		return nil
+	}
+	return errors.New("notify cannot be nil")
+}
+
+func (g *Guard) WithLogger(logger interfaces.Logger) error {
+	if logger != nil {
+		g.Logger = logger
+		return nil
+	}
+	return errors.New("logger cannot be nil")
+}
+
+func (g *Guard) Check(username, ip string) error {
+	return g.CheckContext(context.Background(), username, ip)
+}
+
+//CheckContext return a *LockedError when username or ip is locked out, to be
+//called before checking the password
+func (g *Guard) CheckContext(ctx context.Context, username, ip string) error {
+	for _, target := range g.targets(username, ip) {
+		until, err := g.lockedUntil(ctx, target[0], target[1])
+		if err != nil {
+			return err
+		}
+		if until != nil {
+			return &LockedError{Kind: target[0], Key: target[1], RetryAfter: until.Sub(g.now())}
+		}
+	}
+	return nil
+}
+
+func (g *Guard) Failure(username, ip string) (time.Duration, error) {
+	return g.FailureContext(context.Background(), username, ip)
+}
+
+//FailureContext count a failed login of username from ip and return how long
+//to wait before answering it. The failure reaching the limit locks the
+//username or the ip out and returns a *LockedError
+func (g *Guard) FailureContext(ctx context.Context, username, ip string) (time.Duration, error) {
+	var delay time.Duration
+	var locked error
+	for _, target := range g.targets(username, ip) {
+		kind, key := target[0], target[1]
+		failures, err := g.increment(ctx, kind, key)
+		if err != nil {
+			return 0, err
+		}
+		limit := g.attempts
+		if kind == IP {
+			limit = g.ipAttempts
+		}
+		if failures >= limit {
+			if err := g.lock(ctx, kind, key, failures); err != nil {
+				return 0, err
+			}
+			locked = &LockedError{Kind: kind, Key: key, RetryAfter: g.duration}
+			continue
+		}
+		if kind == User {
+			delay = g.backoff(failures)
+		}
+	}
+	if locked != nil {
+		return 0, locked
+	}
+	return delay, nil
+}
+
+func (g *Guard) Success(username string) error {
+	return g.SuccessContext(context.Background(), username)
+}
+
+//SuccessContext forget the failed logins of username. Those of the client IP
+//are kept, a valid account does not clear them
+func (g *Guard) SuccessContext(ctx context.Context, username string) error {
+	if username == "" {
+		return nil
+	}
+	return g.cache.DeleteContext(ctx, g.key(User, username, "failures"))
+}
+
+func (g *Guard) Status(kind, key string) (*Status, error) {
+	return g.StatusContext(context.Background(), kind, key)
+}
+
+//StatusContext return the failed logins of a username or a client IP and,
+//when it is locked out, until when
+func (g *Guard) StatusContext(ctx context.Context, kind, key string) (*Status, error) {
+	if err := validate(kind, key); err != nil {
+		return nil, err
+	}
+	status := &Status{Kind: kind, Key: key}
+	value, found, err := g.take(ctx, g.key(kind, key, "failures"))
+	if err != nil {
+		return nil, err
+	}
+	if found {
+		if status.Failures, err = g.failures(value); err != nil {
+			return nil, err
+		}
+	}
+	if status.LockedUntil, err = g.lockedUntil(ctx, kind, key); err != nil {
+		return nil, err
+	}
+	return status, nil
+}
+
+func (g *Guard) Unlock(kind, key string) error {
+	return g.UnlockContext(context.Background(), kind, key)
+}
+
+//UnlockContext lift the lockout of a username or a client IP and forget its
+//failed logins
+func (g *Guard) UnlockContext(ctx context.Context, kind, key string) error {
+	if err := validate(kind, key); err != nil {
+		return err
+	}
+	if err := g.cache.DeleteContext(ctx, g.key(kind, key, "failures"), g.key(kind, key, "locked")); err != nil {
+		return err
+	}
+	g.Info("login unlocked", kind, key)
+	return nil
+}
+
+func validate(kind, key string) error {
+	if kind != User && kind != IP {
+		return fmt.Errorf("unknown kind %q, expected %s or %s", kind, User, IP)
+	}
+	if key == "" {
+		return errors.New("key cannot be empty")
+	}
+	return nil
+}
+
+// targets return the kinds and keys a login is counted against
+func (g *Guard) targets(username, ip string) [][2]string {
+	targets := make([][2]string, 0, 2)
+	if username != "" {
+		targets = append(targets, [2]string{User, username})
+	}
+	if ip != "" && g.ipAttempts > 0 {
+		targets = append(targets, [2]string{IP, ip})
+	}
+	return targets
+}
+
+func (g *Guard) key(kind, key, suffix string) string {
+	return fmt.Sprintf("%s:%s:%s:%s", g.prefix, kind, key, suffix)
+}
+
+// backoff return the delay of the answer to the failures-th failure
+func (g *Guard) backoff(failures int64) time.Duration {
+	delay := g.delay
+	for i := int64(1); i < failures && delay < g.maxDelay; i++ {
+		delay *= 2
+	}
+	if delay > g.maxDelay {
+		return g.maxDelay
+	}
+	return delay
+}
+
+// increment count a failure, atomically with an interfaces.Counter. Other
+// caches are read then written, concurrent failures may be counted once
+func (g *Guard) increment(ctx context.Context, kind, key string) (int64, error) {
+	k := g.key(kind, key, "failures")
+	if counter, ok := g.cache.(interfaces.Counter); ok {
+		return counter.Increment(ctx, k, g.window)
+	}
+	var c count
+	value, found, err := g.take(ctx, k)
+	if err != nil {
+		return 0, err
+	}
+	now := g.now()
+	if found {
+		if err := json.Unmarshal([]byte(value), &c); err != nil {
+			return 0, err
+		}
+	}
+	if !found || now.UnixNano() >= c.Expires {
+		c = count{Expires: now.Add(g.window).UnixNano()}
+	}
+	c.Count++
+	b, err := json.Marshal(c)
+	if err != nil {
+		return 0, err
+	}
+	return c.Count, g.cache.PutContext(ctx, k, string(b))
+}
+
+// failures read the value of a failure counter
+func (g *Guard) failures(value string) (int64, error) {
+	if _, ok := g.cache.(interfaces.Counter); ok {
+		return strconv.ParseInt(value, 10, 64)
+	}
+	var c count
+	if err := json.Unmarshal([]byte(value), &c); err != nil {
+		return 0, err
+	}
+	if g.now().UnixNano() >= c.Expires {
+		return 0, nil
+	}
+	return c.Count, nil
+}
+
+func (g *Guard) lock(ctx context.Context, kind, key string, failures int64) error {
+	until := g.now().Add(g.duration)
+	k := g.key(kind, key, "locked")
+	var err error
+	if locker, ok := g.cache.(interfaces.Locker); ok {
+		_, err = locker.TryLock(ctx, k, strconv.FormatInt(until.UnixNano(), 10), g.duration)
+	} else {
+		err = g.cache.PutContext(ctx, k, strconv.FormatInt(until.UnixNano(), 10))
+	}
+	if err != nil {
+		return err
+	}
+	// the next lockout starts from a clean count
+	if err := g.cache.DeleteContext(ctx, g.key(kind, key, "failures")); err != nil {
+		return err
+	}
+	g.Warn("login locked out", kind, key, "failures", failures, "until", until.UTC())
+	if g.notify != nil {
+		g.notify(ctx, Event{Kind: kind, Key: key, Failures: failures, Until: until.UTC()})
+	}
+	return nil
+}
+
+// lockedUntil return the end of the lockout of a username or an IP, nil when
+// it is not locked out
+func (g *Guard) lockedUntil(ctx context.Context, kind, key string) (*time.Time, error) {
+	value, found, err := g.take(ctx, g.key(kind, key, "locked"))
+	if err != nil || !found {
+		return nil, err
+	}
+	nanoseconds, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	until := time.Unix(0, nanoseconds).UTC()
+	if !g.now().Before(until) {
+		return nil, nil
+	}
+	return &until, nil
+}
+
+// take read key as a string, found is false for a missing key
+func (g *Guard) take(ctx context.Context, key string) (string, bool, error) {
+	v, err := g.cache.TakeContext(ctx, key)
+	if err != nil {
+		// a missing key is an error for the caches, tell it from a failure
+		if exists, e := g.cache.ExistsContext(ctx, key); e == nil && !exists {
+			return "", false, nil
+		}
+		return "", false, err
+	}
+	switch v := v.(type) {
+	case string:
+		return v, true, nil
+	case []byte:
+		return string(v), true, nil
+	default:
+		return fmt.Sprint(v), true, nil
+	}
+}
@@ -0,0 +1,134 @@
+package lockout_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/advancedlogic/easy/authn/lockout"
+	"github.com/advancedlogic/easy/easytest"
+	"github.com/advancedlogic/easy/interfaces"
+	"github.com/stretchr/testify/assert"
+)
+
+// plain hide the counter and the locker of the easytest cache
+type plain struct {
+	interfaces.Cache
+}
+
+func TestGuard(t *testing.T) {
+	for name, cache := range map[string]interfaces.Cache{
+		"counter": easytest.NewCache(),
+		"plain":   plain{easytest.NewCache()},
+	} {
+		t.Run(name, func(t *testing.T) {
+			var mutex sync.Mutex
+			events := make([]lockout.Event, 0)
+			g, err := lockout.New(
+				lockout.WithCache(cache),
+				lockout.WithMaxAttempts(3),
+				lockout.WithIPMaxAttempts(5),
+				lockout.WithDelay(time.Second, 3*time.Second),
+				lockout.WithDuration(100*time.Millisecond),
+				lockout.WithNotify(func(ctx context.Context, e lockout.Event) {
+					mutex.Lock()
+					defer mutex.Unlock()
+					events = append(events, e)
+				}),
+			)
+			assert.Nil(t, err)
+
+			// the delays grow with the failures
+			assert.Nil(t, g.Check("ada", "10.0.0.1"))
+			delay, err := g.Failure("ada", "10.0.0.1")
+			assert.Nil(t, err)
+			assert.Equal(t, time.Second, delay)
+			delay, err = g.Failure("ada", "10.0.0.1")
+			assert.Nil(t, err)
+			assert.Equal(t, 2*time.Second, delay)
+			status, err := g.Status(lockout.User, "ada")
+			assert.Nil(t, err)
+			assert.Equal(t, int64(2), status.Failures)
+			assert.Nil(t, status.LockedUntil)
+
+			// a success forget the failures of the username only
+			assert.Nil(t, g.Success("ada"))
+			delay, err = g.Failure("ada", "10.0.0.1")
+			assert.Nil(t, err)
+			assert.Equal(t, time.Second, delay)
+			_, err = g.Failure("ada", "10.0.0.1")
+			assert.Nil(t, err)
+			status, err = g.Status(lockout.IP, "10.0.0.1")
+			assert.Nil(t, err)
+			assert.Equal(t, int64(4), status.Failures)
+
+			// the failure reaching the limit locks out
+			_, err = g.Failure("ada", "10.0.0.2")
+			assert.True(t, errors.Is(err, lockout.ErrLocked))
+			err = g.Check("ada", "10.0.0.2")
+			var locked *lockout.LockedError
+			assert.True(t, errors.As(err, &locked))
+			assert.Equal(t, lockout.User, locked.Kind)
+			assert.True(t, locked.RetryAfter > 0)
+			assert.Nil(t, g.Check("bob", "10.0.0.2"))
+			_, err = g.Failure("bob", "10.0.0.1")
+			assert.True(t, errors.Is(err, lockout.ErrLocked))
+			assert.NotNil(t, g.Check("bob", "10.0.0.1"))
+			mutex.Lock()
+			assert.Len(t, events, 2)
+			assert.Equal(t, lockout.Event{Kind: lockout.User, Key: "ada", Failures: 3, Until: events[0].Until}, events[0])
+			assert.Equal(t, lockout.IP, events[1].Kind)
+			mutex.Unlock()
+
+			// an admin unlock, or time, lift the lockout
+			assert.NotNil(t, g.Unlock("host", "ada"))
+			assert.Nil(t, g.Unlock(lockout.User, "ada"))
+			assert.Nil(t, g.Check("ada", ""))
+			status, err = g.Status(lockout.User, "ada")
+			assert.Nil(t, err)
+			assert.Equal(t, &lockout.Status{Kind: lockout.User, Key: "ada"}, status)
+			time.Sleep(150 * time.Millisecond)
+			assert.Nil(t, g.Check("bob", "10.0.0.1"))
+		})
+	}
+}
+
+func TestGuard_Options(t *testing.T) {
+	_, err := lockout.New(lockout.WithMaxAttempts(0))
+	assert.NotNil(t, err)
+	_, err = lockout.New(lockout.WithDelay(time.Second, time.Millisecond))
+	assert.NotNil(t, err)
+	_, err = lockout.New(lockout.WithCache(nil))
+	assert.NotNil(t, err)
+
+	// without counting the ips, only the username is locked out
+	g, err := lockout.New(lockout.WithCache(easytest.NewCache()), lockout.WithIPMaxAttempts(0), lockout.WithMaxAttempts(1))
+	assert.Nil(t, err)
+	_, err = g.Failure("ada", "10.0.0.1")
+	assert.NotNil(t, err)
+	assert.Nil(t, g.Check("bob", "10.0.0.1"))
+}
+
+func TestGuard_ClientIP(t *testing.T) {
+	_, err := lockout.New(lockout.WithTrustedProxies())
+	assert.NotNil(t, err)
+	_, err = lockout.New(lockout.WithTrustedProxies("proxy"))
+	assert.NotNil(t, err)
+
+	g, err := lockout.New()
+	assert.Nil(t, err)
+	// without trusted proxies the header is ignored
+	assert.Equal(t, "192.0.2.1", g.ClientIP("192.0.2.1:4242", "10.0.0.9"))
+	assert.Equal(t, "::1", g.ClientIP("[::1]:4242"))
+
+	g, err = lockout.New(lockout.WithTrustedProxies("10.0.0.0/8", "192.0.2.1"))
+	assert.Nil(t, err)
+	assert.Equal(t, "203.0.113.7", g.ClientIP("192.0.2.1:4242", "203.0.113.7"))
+	// the addresses before the first untrusted one are set by the client
+	assert.Equal(t, "203.0.113.7", g.ClientIP("192.0.2.1:4242", "198.51.100.1, 203.0.113.7, 10.0.0.2"))
+	assert.Equal(t, "203.0.113.7", g.ClientIP("10.0.0.3:4242", "198.51.100.1", "203.0.113.7"))
+	assert.Equal(t, "10.0.0.2", g.ClientIP("192.0.2.1:4242", "forged, 10.0.0.2"))
+	assert.Equal(t, "198.51.100.9", g.ClientIP("198.51.100.9:4242", "203.0.113.7"))
+}
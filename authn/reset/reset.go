@@ -0,0 +1,303 @@
+// Package reset issue the single-use tokens of a self-service password reset.
+// A token is handed to a notifier, which sends it to the user, and the cache
+// only keeps its hash with the username until it expires. Confirming the reset
+// with the token uses it up, and a password changed since the token was issued
+// voids it
+package reset
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/advancedlogic/easy/interfaces"
+	"github.com/advancedlogic/easy/logging"
+	"github.com/sirupsen/logrus"
+)
+
+//ErrInvalidToken is returned for a token never issued, expired or already used
+var ErrInvalidToken = errors.New("invalid or expired reset token")
+
+type Option func(*Manager) error
+
+//Event is a password reset requested, the notifier sends the token to the user
+type Event struct {
+	Username string    `json:"username"`
+	Token    string    `json:"token"`
+	Expires  time.Time `json:"expires"`
+}
+
+type record struct {
+	Username string    `json:"username"`
+	Issued   time.Time `json:"issued"`
+	Expires  time.Time `json:"expires"`
+}
+
+// Manager issue and use up the password reset tokens
+type Manager struct {
+	cache   interfaces.Cache
+	prefix  string
+	ttl     time.Duration
+	notify  func(context.Context, Event) error
+	changed func(context.Context, string) (time.Time, error)
+	now     func() time.Time
+	interfaces.Logger
+}
+
+//WithCache keep the tokens in cache, shared by every instance of the service
+func WithCache(cache interfaces.Cache) Option {
+	return func(m *Manager) error {
+		return m.WithCache(cache)
+	}
+}
+
+//WithPrefix set the prefix of the cache keys, "reset" by default
+func WithPrefix(prefix string) Option {
+	return func(m *Manager) error {
+		if prefix != "" {
+			m.prefix = strings.TrimSuffix(prefix, ":")
+			return nil
+		}
+		return errors.New("prefix cannot be empty")
+	}
+}
+
+//WithTTL set how long a token is valid, 30 minutes by default
+func WithTTL(ttl time.Duration) Option {
+	return func(m *Manager) error {
+		if ttl > 0 {
+			m.ttl = ttl
+			return nil
+		}
+		return errors.New("ttl must be > 0")
+	}
+}
+
+//WithNotify hand every token issued to notify, which sends it to the user
+func WithNotify(notify func(context.Context, Event) error) Option {
+	return func(m *Manager) error {
+		return m.WithNotify(notify)
+	}
+}
+
+//WithPasswordChanged refuse the tokens issued before the last password change
+//of their user, as told by changed
+func WithPasswordChanged(changed func(ctx context.Context, username string) (time.Time, error)) Option {
+	return func(m *Manager) error {
+		return m.WithPasswordChanged(changed)
+	}
+}
+
+func WithLogger(logger interfaces.Logger) Option {
+	return func(m *Manager) error {
+		return m.WithLogger(logger)
+	}
+}
+
+func New(options ...Option) (*Manager, error) {
+	m := &Manager{
+		prefix: "reset",
+		ttl:    30 * time.Minute,
+		now:    time.Now,
+		Logger: logging.Logrus(logrus.New()),
+	}
+	for _, option := range options {
+		if err := option(m); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// HasCache tell whether the manager has a cache for the tokens
+func (m *Manager) HasCache() bool {
+	return m.cache != nil
+}
+
+// Locks tell whether the cache claims the tokens being confirmed, so that a
+// token is used once across the instances of the service
+func (m *Manager) Locks() bool {
+	_, ok := m.cache.(interfaces.Locker)
+	return ok
+}
+
+func (m *Manager) WithCache(cache interfaces.Cache) error {
+	if cache != nil {
+		m.cache = cache
+		return nil
+	}
+	return errors.New("cache cannot be nil")
+}
+
+func (m *Manager) WithNotify(notify func(context.Context, Event) error) error {
+	if notify != nil {
+		m.notify = notify
+		return nil
+	}
+	return errors.New("notify cannot be nil")
+}
+
+// HasPasswordChanged tell whether the tokens are checked against the last
+// password change of their user
+func (m *Manager) HasPasswordChanged() bool {
+	return m.changed != nil
+}
+
+func (m *Manager) WithPasswordChanged(changed func(context.Context, string) (time.Time, error)) error {
+	if changed != nil {
+		m.changed = changed
+		return nil
+	}
+	return errors.New("password changed cannot be nil")
+}
+
+func (m *Manager) WithLogger(logger interfaces.Logger) error {
+	if logger != nil {
+		m.Logger = logger
+		return nil
+	}
+	return errors.New("logger cannot be nil")
+}
+
+func (m *Manager) Request(username string) error {
+	return m.RequestContext(context.Background(), username)
+}
+
+//RequestContext issue a reset token for username and hand it to the notifier.
+//The token is not returned: it reaches the user through the notifier only
+func (m *Manager) RequestContext(ctx context.Context, username string) error {
+	if username == "" {
+		return errors.New("username cannot be empty")
+	}
+	if m.notify == nil {
+		return errors.New("notify cannot be nil")
+	}
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return err
+	}
+	token := base64.RawURLEncoding.EncodeToString(b)
+	now := m.now().UTC()
+	r := record{Username: username, Issued: now, Expires: now.Add(m.ttl)}
+	value, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	key := m.key("token", digest(token))
+	// a cache able to expire its keys forgets the token with its expiry
+	if locker, ok := m.cache.(interfaces.Locker); ok {
+		_, err = locker.TryLock(ctx, key, string(value), m.ttl)
+	} else {
+		err = m.cache.PutContext(ctx, key, string(value))
+	}
+	if err != nil {
+		return err
+	}
+	if err := m.notify(ctx, Event{Username: username, Token: token, Expires: r.Expires}); err != nil {
+		m.cache.DeleteContext(ctx, key)
+		return err
+	}
+	m.Info("password reset requested", "user", username, "expires", r.Expires)
+	return nil
+}
+
+func (m *Manager) Confirm(token string, reset func(username string) error) error {
+	return m.ConfirmContext(context.Background(), token, reset)
+}
+
+//ConfirmContext call reset with the username of a valid token and use the
+//token up when reset succeeds, the error of reset is returned as it is. A
+//token confirmed at the same time on another instance is refused with a
+//cache implementing interfaces.Locker
+func (m *Manager) ConfirmContext(ctx context.Context, token string, reset func(username string) error) error {
+	if token == "" {
+		return ErrInvalidToken
+	}
+	hash := digest(token)
+	key := m.key("token", hash)
+	r, err := m.load(ctx, key)
+	if err != nil {
+		return err
+	}
+	if !m.now().Before(r.Expires) {
+		m.cache.DeleteContext(ctx, key)
+		return ErrInvalidToken
+	}
+	// a reset, by this token or another, voids the tokens issued before it
+	if m.changed != nil {
+		changed, err := m.changed(ctx, r.Username)
+		if err == interfaces.ErrUserNotFound {
+			return ErrInvalidToken
+		}
+		if err != nil {
+			return err
+		}
+		if r.Issued.Before(changed) {
+			m.cache.DeleteContext(ctx, key)
+			return ErrInvalidToken
+		}
+	}
+	claim := m.key("claim", hash)
+	if locker, ok := m.cache.(interfaces.Locker); ok {
+		claimed, err := locker.TryLock(ctx, claim, r.Username, r.Expires.Sub(m.now()))
+		if err != nil {
+			return err
+		}
+		if !claimed {
+			return ErrInvalidToken
+		}
+	}
+	if err := reset(r.Username); err != nil {
+		// a password refused by the policy can be chosen again
+		m.cache.DeleteContext(ctx, claim)
+		return err
+	}
+	// the password is reset: a token left behind by a failure expires, and is
+	// claimed until then with a cache implementing interfaces.Locker
+	if err := m.cache.DeleteContext(ctx, key); err != nil {
+		m.Warn("reset token not deleted", "user", r.Username, "error", err)
+	}
+	m.Info("password reset confirmed", "user", r.Username)
+	return nil
+}
+
+func (m *Manager) key(kind, hash string) string {
+	return fmt.Sprintf("%s:%s:%s", m.prefix, kind, hash)
+}
+
+func (m *Manager) load(ctx context.Context, key string) (*record, error) {
+	v, err := m.cache.TakeContext(ctx, key)
+	if err != nil {
+		// a missing key is an error for the caches, tell it from a failure
+		if exists, e := m.cache.ExistsContext(ctx, key); e == nil && !exists {
+			return nil, ErrInvalidToken
+		}
+		return nil, err
+	}
+	var value []byte
+	switch v := v.(type) {
+	case string:
+		value = []byte(v)
+	case []byte:
+		value = v
+	default:
+		return nil, fmt.Errorf("unexpected reset record %T", v)
+	}
+	var r record
+	if err := json.Unmarshal(value, &r); err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+func digest(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,118 @@
+package reset_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/advancedlogic/easy/authn/reset"
+	"github.com/advancedlogic/easy/easytest"
+	"github.com/advancedlogic/easy/interfaces"
+	"github.com/stretchr/testify/assert"
+)
+
+// plain hide the locker of the easytest cache
+type plain struct {
+	interfaces.Cache
+}
+
+func TestManager(t *testing.T) {
+	for name, cache := range map[string]interfaces.Cache{
+		"locker": easytest.NewCache(),
+		"plain":  plain{easytest.NewCache()},
+	} {
+		t.Run(name, func(t *testing.T) {
+			events := make([]reset.Event, 0)
+			m, err := reset.New(reset.WithCache(cache), reset.WithNotify(func(ctx context.Context, e reset.Event) error {
+				events = append(events, e)
+				return nil
+			}))
+			assert.Nil(t, err)
+			assert.Equal(t, name == "locker", m.Locks())
+			assert.NotNil(t, m.Request(""))
+			assert.Nil(t, m.Request("ada"))
+			assert.Len(t, events, 1)
+			token := events[0].Token
+			assert.Equal(t, "ada", events[0].Username)
+			assert.True(t, events[0].Expires.After(time.Now().Add(29*time.Minute)))
+
+			// only the hash of the token is kept
+			keys, _ := cache.Keys()
+			for _, key := range keys.([]string) {
+				assert.NotContains(t, key, token)
+			}
+
+			// a refused reset leaves the token usable, a successful one uses it up
+			refused := errors.New("password too short")
+			assert.Equal(t, refused, m.Confirm(token, func(string) error { return refused }))
+			var username string
+			assert.Nil(t, m.Confirm(token, func(u string) error {
+				username = u
+				return nil
+			}))
+			assert.Equal(t, "ada", username)
+			assert.Equal(t, reset.ErrInvalidToken, m.Confirm(token, func(string) error { return nil }))
+			assert.Equal(t, reset.ErrInvalidToken, m.Confirm("", func(string) error { return nil }))
+		})
+	}
+}
+
+func TestManager_Expiry(t *testing.T) {
+	var token string
+	m, err := reset.New(reset.WithCache(easytest.NewCache()), reset.WithTTL(50*time.Millisecond),
+		reset.WithNotify(func(ctx context.Context, e reset.Event) error {
+			token = e.Token
+			return nil
+		}))
+	assert.Nil(t, err)
+	assert.Nil(t, m.Request("ada"))
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(t, reset.ErrInvalidToken, m.Confirm(token, func(string) error { return nil }))
+
+	// a token the notifier could not send is forgotten
+	cache := easytest.NewCache()
+	failing, _ := reset.New(reset.WithCache(cache), reset.WithNotify(func(ctx context.Context, e reset.Event) error {
+		return errors.New("mail server down")
+	}))
+	assert.NotNil(t, failing.Request("ada"))
+	keys, _ := cache.Keys()
+	for _, key := range keys.([]string) {
+		assert.False(t, strings.HasPrefix(key, "reset:token:"))
+	}
+}
+
+func TestManager_PasswordChanged(t *testing.T) {
+	_, err := reset.New(reset.WithPasswordChanged(nil))
+	assert.NotNil(t, err)
+
+	var changed time.Time
+	tokens := make([]string, 0)
+	m, err := reset.New(reset.WithCache(easytest.NewCache()),
+		reset.WithNotify(func(ctx context.Context, e reset.Event) error {
+			tokens = append(tokens, e.Token)
+			return nil
+		}),
+		reset.WithPasswordChanged(func(ctx context.Context, username string) (time.Time, error) {
+			if username != "ada" {
+				return time.Time{}, interfaces.ErrUserNotFound
+			}
+			return changed, nil
+		}))
+	assert.Nil(t, err)
+	assert.True(t, m.HasPasswordChanged())
+	assert.Nil(t, m.Request("ada"))
+	assert.Nil(t, m.Request("ada"))
+	assert.Nil(t, m.Request("bob"))
+
+	// the first reset voids the token issued before it
+	assert.Nil(t, m.Confirm(tokens[0], func(string) error {
+		changed = time.Now()
+		return nil
+	}))
+	assert.Equal(t, reset.ErrInvalidToken, m.Confirm(tokens[1], func(string) error { return nil }))
+	assert.Equal(t, reset.ErrInvalidToken, m.Confirm(tokens[2], func(string) error { return nil }))
+	assert.Nil(t, m.Request("ada"))
+	assert.Nil(t, m.Confirm(tokens[3], func(string) error { return nil }))
+}
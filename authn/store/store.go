@@ -0,0 +1,680 @@
+// Package store implement interfaces.AuthN over any interfaces.Store, so that
+// every replica of a service sees the same users. A user is a JSON record
+// under <prefix>/<id>, and <prefix>/index maps the usernames to the ids: a
+// login reads two records and never lists the store.
+//
+// Updates are optimistic: a record is replaced only if it did not change since
+// it was read, and retried otherwise. The check and the write are atomic with a
+// store implementing interfaces.Swapper, or under a lock taken in a cache
+// implementing interfaces.Locker (WithCache). With neither, two replicas
+// updating the same record at once can lose one of the updates: run a single
+// replica changing the users
+package store
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"sort"
+	"time"
+
+	"github.com/advancedlogic/easy/commons"
+	"github.com/advancedlogic/easy/factory"
+	"github.com/advancedlogic/easy/interfaces"
+)
+
+//ErrConflict is returned when a record kept changing while being updated
+var ErrConflict = errors.New("user changed concurrently, retry")
+
+const (
+	retries = 5
+	//lockTTL bounds how long a replica dying with a lock keeps the record locked
+	lockTTL  = 10 * time.Second
+	lockWait = 5 * time.Second
+)
+
+type Store struct {
+	store  interfaces.Store
+	cache  interfaces.Cache
+	prefix string
+	policy commons.PasswordPolicy
+}
+
+type User struct {
+	ID              string   `json:"id"`
+	Username        string   `json:"username"`
+	Password        string   `json:"password,omitempty"`
+	Timestamp       int64    `json:"timestamp"`
+	Groups          []string `json:"groups"`
+	Enabled         bool     `json:"enabled"`
+	PasswordChanged int64    `json:"password_changed,omitempty"`
+	//Version is incremented by every update
+	Version int64 `json:"version"`
+}
+
+//WithStore keep the users in store
+func WithStore(store interfaces.Store) interfaces.AuthNOption {
+	return func(a interfaces.AuthN) error {
+		return a.(*Store).WithStore(store)
+	}
+}
+
+//WithCache lock the records being updated in cache, when it implements
+//interfaces.Locker and the store does not implement interfaces.Swapper
+func WithCache(cache interfaces.Cache) interfaces.AuthNOption {
+	return func(a interfaces.AuthN) error {
+		return a.(*Store).WithCache(cache)
+	}
+}
+
+//WithPrefix set the prefix of the store keys, "users" by default
+func WithPrefix(prefix string) interfaces.AuthNOption {
+	return func(a interfaces.AuthN) error {
+		if prefix != "" {
+			a.(*Store).prefix = prefix
+			return nil
+		}
+		return errors.New("prefix cannot be empty")
+	}
+}
+
+//WithPasswordPolicy set what a new password must satisfy, 8 characters by default
+func WithPasswordPolicy(policy commons.PasswordPolicy) interfaces.AuthNOption {
+	return func(a interfaces.AuthN) error {
+		if policy.MinLength < 1 {
+			return errors.New("password min length must be positive")
+		}
+		a.(*Store).policy = policy
+		return nil
+	}
+}
+
+//FromEnv configure the authn from the EASY_USERS_* variables: PREFIX and
+//PASSWORD_MIN_LENGTH
+func FromEnv() interfaces.AuthNOption {
+	return func(a interfaces.AuthN) error {
+		if err := commons.EnvString("users", "prefix", func(prefix string) error {
+			return WithPrefix(prefix)(a)
+		}); err != nil {
+			return err
+		}
+		return commons.EnvInt("users", "password_min_length", func(length int) error {
+			policy := a.(*Store).policy
+			policy.MinLength = length
+			return WithPasswordPolicy(policy)(a)
+		})
+	}
+}
+
+func New(options ...interfaces.AuthNOption) (*Store, error) {
+	s := &Store{
+		prefix: "users",
+		policy: commons.DefaultPasswordPolicy,
+	}
+	for _, option := range options {
+		if err := option(s); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// HasStore tell whether the users have a store
+func (s *Store) HasStore() bool {
+	return s.store != nil
+}
+
+func (s *Store) WithStore(store interfaces.Store) error {
+	if store != nil {
+		s.store = store
+		return nil
+	}
+	return errors.New("store cannot be nil")
+}
+
+// HasCache tell whether the updates are locked in a cache
+func (s *Store) HasCache() bool {
+	return s.cache != nil
+}
+
+func (s *Store) WithCache(cache interfaces.Cache) error {
+	if cache != nil {
+		s.cache = cache
+		return nil
+	}
+	return errors.New("cache cannot be nil")
+}
+
+//Health check the store when it can tell its health
+func (s *Store) Health(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if s.store == nil {
+		return errors.New("store cannot be nil")
+	}
+	if checker, ok := s.store.(interface {
+		Health(context.Context) error
+	}); ok {
+		return checker.Health(ctx)
+	}
+	return nil
+}
+
+func (s *Store) Register(username, password string) (interface{}, error) {
+	return s.RegisterContext(context.Background(), username, password)
+}
+
+//RegisterContext create a user in the group user, or fail with
+//interfaces.ErrUserExists when the username is taken
+func (s *Store) RegisterContext(ctx context.Context, username, password string) (interface{}, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if username == "" || password == "" {
+		return nil, errors.New("username and password cannot be empty")
+	}
+	if err := commons.ValidateUsername(username); err != nil {
+		return nil, err
+	}
+	if err := s.policy.Validate(password); err != nil {
+		return nil, err
+	}
+	if s.store == nil {
+		return nil, errors.New("store cannot be nil")
+	}
+	epassword, err := commons.HashAndSalt(password)
+	if err != nil {
+		return nil, err
+	}
+	user := User{
+		ID:        commons.UUID(),
+		Username:  username,
+		Password:  epassword,
+		Timestamp: time.Now().UnixNano(),
+		Groups:    []string{"user"},
+		Enabled:   true,
+		Version:   1,
+	}
+	record, err := encode(user)
+	if err != nil {
+		return nil, err
+	}
+	// the record is written before the index, a failure never leaves a
+	// username pointing to nothing
+	swapped, err := s.swap(ctx, s.key(user.ID), nil, record)
+	if err != nil {
+		return nil, err
+	}
+	if !swapped {
+		return nil, ErrConflict
+	}
+	err = s.updateIndex(ctx, func(index map[string]string) error {
+		if _, exists := index[username]; exists {
+			return interfaces.ErrUserExists
+		}
+		index[username] = user.ID
+		return nil
+	})
+	if err != nil {
+		_ = s.store.DeleteContext(ctx, s.key(user.ID))
+		return nil, err
+	}
+	user.Password = ""
+	return user, nil
+}
+
+func (s *Store) Login(username, password string) (interface{}, error) {
+	return s.LoginContext(context.Background(), username, password)
+}
+
+//LoginContext return the user, without password, when password is right and
+//the user is enabled
+func (s *Store) LoginContext(ctx context.Context, username, password string) (interface{}, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if username == "" || password == "" {
+		return nil, errors.New("username and password cannot be empty")
+	}
+	user, _, err := s.read(ctx, username)
+	if err == interfaces.ErrUserNotFound {
+		// the time of a bcrypt comparison does not tell the unknown users
+		commons.CompareDummyPassword([]byte(password))
+		return nil, interfaces.ErrWrongCredentials
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !commons.ComparePasswords(user.Password, []byte(password)) {
+		return nil, interfaces.ErrWrongCredentials
+	}
+	if !user.Enabled {
+		return nil, interfaces.ErrUserDisabled
+	}
+	user.Password = ""
+	return *user, nil
+}
+
+func (s *Store) Logout(username string) error {
+	return s.LogoutContext(context.Background(), username)
+}
+
+//LogoutContext check that the user exists, the sessions are ended by the authz
+func (s *Store) LogoutContext(ctx context.Context, username string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if username == "" {
+		return errors.New("username cannot be empty")
+	}
+	_, _, err := s.read(ctx, username)
+	return err
+}
+
+func (s *Store) Delete(username string) error {
+	return s.DeleteContext(context.Background(), username)
+}
+
+//DeleteContext remove a user from the index, then its record
+func (s *Store) DeleteContext(ctx context.Context, username string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if username == "" {
+		return errors.New("username cannot be empty")
+	}
+	var id string
+	err := s.updateIndex(ctx, func(index map[string]string) error {
+		var exists bool
+		if id, exists = index[username]; !exists {
+			return interfaces.ErrUserNotFound
+		}
+		delete(index, username)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return s.store.DeleteContext(ctx, s.key(id))
+}
+
+func (s *Store) Reset(username, password string) (interface{}, error) {
+	return s.ResetContext(context.Background(), username, password)
+}
+
+//ResetContext replace the password of a user, keeping its groups and state
+func (s *Store) ResetContext(ctx context.Context, username, password string) (interface{}, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if username == "" || password == "" {
+		return nil, errors.New("username and password cannot be empty")
+	}
+	if err := s.policy.Validate(password); err != nil {
+		return nil, err
+	}
+	epassword, err := commons.HashAndSalt(password)
+	if err != nil {
+		return nil, err
+	}
+	user, err := s.update(ctx, username, func(user *User) {
+		user.Password = epassword
+		user.PasswordChanged = time.Now().UnixNano()
+	})
+	if err != nil {
+		return nil, err
+	}
+	return *user, nil
+}
+
+//GroupsContext return the groups of a user
+func (s *Store) GroupsContext(ctx context.Context, username string) ([]string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	user, _, err := s.read(ctx, username)
+	if err != nil {
+		return nil, err
+	}
+	return user.Groups, nil
+}
+
+//UsersContext return every user, sorted by username and without password
+func (s *Store) UsersContext(ctx context.Context) (interface{}, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	index, _, err := s.index(ctx)
+	if err != nil {
+		return nil, err
+	}
+	usernames := make([]string, 0, len(index))
+	for username := range index {
+		usernames = append(usernames, username)
+	}
+	sort.Strings(usernames)
+	users := make([]User, 0, len(usernames))
+	for _, username := range usernames {
+		user, _, err := s.record(ctx, index[username])
+		if err == interfaces.ErrUserNotFound {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		user.Password = ""
+		users = append(users, *user)
+	}
+	return users, nil
+}
+
+//UserContext return a user without password
+func (s *Store) UserContext(ctx context.Context, username string) (interface{}, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	user, _, err := s.read(ctx, username)
+	if err != nil {
+		return nil, err
+	}
+	user.Password = ""
+	return *user, nil
+}
+
+//SetEnabledContext enable or disable a user, a disabled user cannot log in
+func (s *Store) SetEnabledContext(ctx context.Context, username string, enabled bool) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	_, err := s.update(ctx, username, func(user *User) {
+		user.Enabled = enabled
+	})
+	return err
+}
+
+//EnabledContext tell whether a user is enabled
+func (s *Store) EnabledContext(ctx context.Context, username string) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	user, _, err := s.read(ctx, username)
+	if err != nil {
+		return false, err
+	}
+	return user.Enabled, nil
+}
+
+//PasswordChangedContext tell when the password of a user was last reset
+func (s *Store) PasswordChangedContext(ctx context.Context, username string) (time.Time, error) {
+	if err := ctx.Err(); err != nil {
+		return time.Time{}, err
+	}
+	user, _, err := s.read(ctx, username)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if user.PasswordChanged == 0 {
+		return time.Time{}, nil
+	}
+	return time.Unix(0, user.PasswordChanged), nil
+}
+
+//AddGroupsContext add groups to a user and return its groups
+func (s *Store) AddGroupsContext(ctx context.Context, username string, groups ...string) ([]string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	user, err := s.update(ctx, username, func(user *User) {
+		for _, group := range groups {
+			if group != "" && !contains(user.Groups, group) {
+				user.Groups = append(user.Groups, group)
+			}
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return user.Groups, nil
+}
+
+//RemoveGroupsContext remove groups from a user and return its groups
+func (s *Store) RemoveGroupsContext(ctx context.Context, username string, groups ...string) ([]string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	user, err := s.update(ctx, username, func(user *User) {
+		kept := make([]string, 0, len(user.Groups))
+		for _, group := range user.Groups {
+			if !contains(groups, group) {
+				kept = append(kept, group)
+			}
+		}
+		user.Groups = kept
+	})
+	if err != nil {
+		return nil, err
+	}
+	return user.Groups, nil
+}
+
+func (s *Store) key(id string) string {
+	return s.prefix + "/" + id
+}
+
+//read return the user of username and its record as stored
+func (s *Store) read(ctx context.Context, username string) (*User, interface{}, error) {
+	if s.store == nil {
+		return nil, nil, errors.New("store cannot be nil")
+	}
+	index, _, err := s.index(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	id, exists := index[username]
+	if !exists {
+		return nil, nil, interfaces.ErrUserNotFound
+	}
+	return s.record(ctx, id)
+}
+
+func (s *Store) record(ctx context.Context, id string) (*User, interface{}, error) {
+	raw, err := s.store.ReadContext(ctx, s.key(id))
+	if errors.Is(err, interfaces.ErrKeyNotFound) {
+		return nil, nil, interfaces.ErrUserNotFound
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	var user User
+	if err := decode(raw, &user); err != nil {
+		return nil, nil, err
+	}
+	return &user, raw, nil
+}
+
+//update change the user of username with fn and save it unless it changed
+//meanwhile, in which case it starts again
+func (s *Store) update(ctx context.Context, username string, fn func(*User)) (*User, error) {
+	for i := 0; i < retries; i++ {
+		user, raw, err := s.read(ctx, username)
+		if err != nil {
+			return nil, err
+		}
+		fn(user)
+		user.Version++
+		record, err := encode(*user)
+		if err != nil {
+			return nil, err
+		}
+		swapped, err := s.swap(ctx, s.key(user.ID), raw, record)
+		if err != nil {
+			return nil, err
+		}
+		if swapped {
+			user.Password = ""
+			return user, nil
+		}
+	}
+	return nil, ErrConflict
+}
+
+//index return the usernames mapped to the ids and the index as stored, nil
+//when there is none yet
+func (s *Store) index(ctx context.Context) (map[string]string, interface{}, error) {
+	index := make(map[string]string)
+	raw, err := s.store.ReadContext(ctx, s.key("index"))
+	if errors.Is(err, interfaces.ErrKeyNotFound) {
+		return index, nil, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := decode(raw, &index); err != nil {
+		return nil, nil, err
+	}
+	return index, raw, nil
+}
+
+//updateIndex change the index with fn and save it like update does
+func (s *Store) updateIndex(ctx context.Context, fn func(map[string]string) error) error {
+	if s.store == nil {
+		return errors.New("store cannot be nil")
+	}
+	for i := 0; i < retries; i++ {
+		index, raw, err := s.index(ctx)
+		if err != nil {
+			return err
+		}
+		if err := fn(index); err != nil {
+			return err
+		}
+		record, err := encode(index)
+		if err != nil {
+			return err
+		}
+		swapped, err := s.swap(ctx, s.key("index"), raw, record)
+		if err != nil {
+			return err
+		}
+		if swapped {
+			return nil
+		}
+	}
+	return ErrConflict
+}
+
+//swap write value under key when the record is still old, nil for none
+func (s *Store) swap(ctx context.Context, key string, old, value interface{}) (bool, error) {
+	if swapper, ok := s.store.(interfaces.Swapper); ok {
+		return swapper.CompareAndSwapContext(ctx, key, old, value)
+	}
+	unlock, err := s.lock(ctx, key)
+	if err != nil {
+		return false, err
+	}
+	defer unlock()
+	current, err := s.store.ReadContext(ctx, key)
+	if errors.Is(err, interfaces.ErrKeyNotFound) {
+		current = nil
+	} else if err != nil {
+		return false, err
+	}
+	if !reflect.DeepEqual(current, old) {
+		return false, nil
+	}
+	if old == nil {
+		return true, s.store.CreateContext(ctx, key, value)
+	}
+	return true, s.store.UpdateContext(ctx, key, value)
+}
+
+//lock take key in a cache implementing interfaces.Locker and return its
+//release, it does nothing without such a cache
+func (s *Store) lock(ctx context.Context, key string) (func(), error) {
+	locker, ok := s.cache.(interfaces.Locker)
+	if !ok {
+		return func() {}, nil
+	}
+	lock := s.prefix + ":lock:" + key
+	owner := commons.UUID()
+	deadline := time.Now().Add(lockWait)
+	for {
+		locked, err := locker.TryLock(ctx, lock, owner, lockTTL)
+		if err != nil {
+			return nil, err
+		}
+		if locked {
+			return func() {
+				// the record is written, a lock left behind expires with lockTTL
+				_ = s.cache.DeleteContext(context.Background(), lock)
+			}, nil
+		}
+		if time.Now().After(deadline) {
+			return nil, ErrConflict
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
+
+//encode a record as a JSON object, vault only keeps maps. The numbers are
+//kept as json.Number, a float64 would round the timestamps
+func encode(value interface{}) (map[string]interface{}, error) {
+	b, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	record := make(map[string]interface{})
+	decoder := json.NewDecoder(bytes.NewReader(b))
+	decoder.UseNumber()
+	if err := decoder.Decode(&record); err != nil {
+		return nil, err
+	}
+	return record, nil
+}
+
+func decode(raw interface{}, value interface{}) error {
+	switch r := raw.(type) {
+	case string:
+		return json.Unmarshal([]byte(r), value)
+	case []byte:
+		return json.Unmarshal(r, value)
+	}
+	b, err := json.Marshal(raw)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, value)
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func init() {
+	factory.Register(factory.AuthN, "store", func(settings interfaces.Configuration) (interface{}, error) {
+		options := make([]interfaces.AuthNOption, 0)
+		if prefix := settings.GetStringOrDefault("prefix", ""); prefix != "" {
+			options = append(options, WithPrefix(prefix))
+		}
+		policy := commons.DefaultPasswordPolicy
+		policy.MinLength = settings.GetIntOrDefault("password_min_length", policy.MinLength)
+		policy.RequireUpper = settings.GetBoolOrDefault("password_upper", false)
+		policy.RequireLower = settings.GetBoolOrDefault("password_lower", false)
+		policy.RequireDigit = settings.GetBoolOrDefault("password_digit", false)
+		policy.RequireSymbol = settings.GetBoolOrDefault("password_symbol", false)
+		options = append(options, WithPasswordPolicy(policy))
+		return New(append(options, FromEnv())...)
+	})
+}
@@ -0,0 +1,201 @@
+package store_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/advancedlogic/easy/authn/store"
+	"github.com/advancedlogic/easy/easytest"
+	"github.com/advancedlogic/easy/interfaces"
+	"github.com/advancedlogic/easy/store/vault"
+	"github.com/stretchr/testify/assert"
+)
+
+// plain hide the compare-and-swap of the easytest store
+type plain struct {
+	interfaces.Store
+}
+
+// busy is a store where another replica always updates a user in between
+type busy struct {
+	*easytest.Store
+}
+
+func (b busy) CompareAndSwapContext(ctx context.Context, key string, old, value interface{}) (bool, error) {
+	if strings.HasSuffix(key, "/index") {
+		return b.Store.CompareAndSwapContext(ctx, key, old, value)
+	}
+	return false, nil
+}
+
+func TestStore(t *testing.T) {
+	server := easytest.VaultServer()
+	defer server.Close()
+	secrets, err := vault.New(vault.WithServers(server.URL), vault.WithToken("token"), vault.WithNamespace("secret"))
+	assert.Nil(t, err)
+	for name, backend := range map[string]interfaces.Store{
+		"swapper": easytest.NewStore(),
+		"plain":   plain{easytest.NewStore()},
+		"vault":   secrets,
+	} {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			_, err := store.New(store.WithStore(nil))
+			assert.NotNil(t, err)
+			s, err := store.New()
+			assert.Nil(t, err)
+			_, err = s.Register("ada", "long enough")
+			assert.NotNil(t, err)
+			assert.Nil(t, s.WithStore(backend))
+
+			_, err = s.Register("ada", "short")
+			assert.NotNil(t, err)
+			_, err = s.Register("ada/..", "long enough")
+			assert.NotNil(t, err)
+			registered, err := s.Register("ada", "long enough")
+			assert.Nil(t, err)
+			assert.Equal(t, "", registered.(store.User).Password)
+			_, err = s.Register("ada", "long enough")
+			assert.Equal(t, interfaces.ErrUserExists, err)
+
+			_, err = s.Login("ada", "wrong password")
+			assert.Equal(t, interfaces.ErrWrongCredentials, err)
+			_, err = s.Login("bob", "long enough")
+			assert.Equal(t, interfaces.ErrWrongCredentials, err)
+			user, err := s.Login("ada", "long enough")
+			assert.Nil(t, err)
+			assert.Equal(t, int64(1), user.(store.User).Version)
+
+			groups, err := s.AddGroupsContext(ctx, "ada", "staff")
+			assert.Nil(t, err)
+			assert.Equal(t, []string{"user", "staff"}, groups)
+			groups, err = s.GroupsContext(ctx, "ada")
+			assert.Nil(t, err)
+			assert.Equal(t, []string{"user", "staff"}, groups)
+			changed, err := s.PasswordChangedContext(ctx, "ada")
+			assert.Nil(t, err)
+			assert.True(t, changed.IsZero())
+			_, err = s.Reset("ada", "a new password")
+			assert.Nil(t, err)
+			changed, err = s.PasswordChangedContext(ctx, "ada")
+			assert.Nil(t, err)
+			assert.False(t, changed.IsZero())
+			assert.Nil(t, s.SetEnabledContext(ctx, "ada", false))
+			enabled, err := s.EnabledContext(ctx, "ada")
+			assert.Nil(t, err)
+			assert.False(t, enabled)
+			_, err = s.Login("ada", "a new password")
+			assert.Equal(t, interfaces.ErrUserDisabled, err)
+			assert.Nil(t, s.SetEnabledContext(ctx, "ada", true))
+			user, err = s.Login("ada", "a new password")
+			assert.Nil(t, err)
+			assert.Equal(t, int64(5), user.(store.User).Version)
+			assert.Equal(t, []string{"user", "staff"}, user.(store.User).Groups)
+
+			_, err = s.Register("bob", "long enough")
+			assert.Nil(t, err)
+			users, err := s.UsersContext(ctx)
+			assert.Nil(t, err)
+			assert.Len(t, users, 2)
+			assert.Equal(t, "ada", users.([]store.User)[0].Username)
+
+			assert.Nil(t, s.Delete("bob"))
+			assert.Equal(t, interfaces.ErrUserNotFound, s.Delete("bob"))
+			assert.Equal(t, interfaces.ErrUserNotFound, s.Logout("bob"))
+			_, err = s.RemoveGroupsContext(ctx, "bob", "user")
+			assert.Equal(t, interfaces.ErrUserNotFound, err)
+			_, err = s.Register("bob", "long enough")
+			assert.Nil(t, err)
+		})
+	}
+}
+
+func TestStore_Concurrency(t *testing.T) {
+	ctx := context.Background()
+	s, err := store.New(store.WithStore(easytest.NewStore()))
+	assert.Nil(t, err)
+	_, err = s.Register("ada", "long enough")
+	assert.Nil(t, err)
+
+	// concurrent updates are retried, none is lost while retries last
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, err := s.AddGroupsContext(ctx, "ada", fmt.Sprintf("group%d", i))
+			assert.Nil(t, err)
+		}(i)
+	}
+	wg.Wait()
+	groups, err := s.GroupsContext(ctx, "ada")
+	assert.Nil(t, err)
+	assert.Len(t, groups, 5)
+
+	// a store unable to swap is locked through the cache
+	server := easytest.VaultServer()
+	defer server.Close()
+	secrets, err := vault.New(vault.WithServers(server.URL), vault.WithToken("token"), vault.WithNamespace("secret"))
+	assert.Nil(t, err)
+	locked, err := store.New(store.WithStore(secrets), store.WithCache(easytest.NewCache()))
+	assert.Nil(t, err)
+	_, err = locked.Register("ada", "long enough")
+	assert.Nil(t, err)
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, err := locked.AddGroupsContext(ctx, "ada", fmt.Sprintf("group%d", i))
+			assert.Nil(t, err)
+		}(i)
+	}
+	wg.Wait()
+	groups, err = locked.GroupsContext(ctx, "ada")
+	assert.Nil(t, err)
+	assert.Len(t, groups, 9)
+
+	busy, err := store.New(store.WithStore(busy{easytest.NewStore()}))
+	assert.Nil(t, err)
+	_, err = busy.Register("ada", "long enough")
+	assert.Equal(t, store.ErrConflict, err)
+}
+
+// unavailable fail every read once down is set
+type unavailable struct {
+	*easytest.Store
+	down bool
+}
+
+func (u *unavailable) ReadContext(ctx context.Context, key string) (interface{}, error) {
+	if u.down {
+		return nil, errors.New("store unavailable")
+	}
+	return u.Store.ReadContext(ctx, key)
+}
+
+func TestStore_Errors(t *testing.T) {
+	backend := &unavailable{Store: easytest.NewStore()}
+	s, err := store.New(store.WithStore(backend))
+	assert.Nil(t, err)
+	_, err = s.Register("ada", "long enough")
+	assert.Nil(t, err)
+
+	// a failing store is not a missing user, nor an empty index
+	backend.down = true
+	_, err = s.Login("ada", "long enough")
+	assert.NotNil(t, err)
+	assert.NotEqual(t, interfaces.ErrWrongCredentials, err)
+	_, err = s.UserContext(context.Background(), "ada")
+	assert.NotEqual(t, interfaces.ErrUserNotFound, err)
+	_, err = s.Register("bob", "long enough")
+	assert.NotNil(t, err)
+
+	backend.down = false
+	users, err := s.UsersContext(context.Background())
+	assert.Nil(t, err)
+	assert.Len(t, users, 1)
+}
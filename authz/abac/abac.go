@@ -0,0 +1,419 @@
+// Package abac decide whether a subject may perform an action on a resource
+// from rules over their attributes. The rules are read from the configuration,
+// below the "abac" key by default:
+//
+//	abac:
+//	  rules:
+//	    - name: owners-update
+//	      effect: allow
+//	      actions: [update]
+//	      resources: [order]                # the type attribute of the resource
+//	      when: ["resource.owner == subject.id"]
+//	    - name: support-read
+//	      effect: allow
+//	      actions: [read]
+//	      when: ["subject.groups contains support"]
+//	    - name: support-keeps-old-records
+//	      effect: deny
+//	      actions: [delete]
+//	      when: ["subject.groups contains support", "resource.created older_than 30d"]
+//	      audit: true                       # logged, not enforced yet
+//
+// A request is denied when a deny rule matches, allowed when an allow rule
+// matches and denied when no rule does. A rule in audit, or every rule when the
+// engine is in audit mode, only logs what it would have decided: a new policy
+// can be watched in the logs before it is enforced. The rules are reloaded
+// when a configuration implementing interfaces.ConfigurationWatcher changes
+package abac
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/advancedlogic/easy/interfaces"
+	"github.com/advancedlogic/easy/logging"
+	"github.com/sirupsen/logrus"
+)
+
+// Effects of a rule
+const (
+	Allow = "allow"
+	Deny  = "deny"
+)
+
+//ErrDenied is returned by Check for a denied request
+var ErrDenied = errors.New("access denied")
+
+type Option func(*Engine) error
+
+//Attributes describe a subject, a resource or the environment of a request
+type Attributes map[string]interface{}
+
+//SubjectAttributes return the attributes id and groups of subject
+func SubjectAttributes(subject interfaces.Subject) Attributes {
+	return Attributes{"id": subject.ID, "groups": subject.Groups}
+}
+
+//Request is what the engine decides on
+type Request struct {
+	Subject     Attributes
+	Action      string
+	Resource    Attributes
+	Environment Attributes
+}
+
+//Decision is the answer of the engine and the reason for it
+type Decision struct {
+	Allowed bool   `json:"allowed"`
+	Rule    string `json:"rule,omitempty"`
+	Reason  string `json:"reason"`
+	//Audited is true when the engine in audit mode allowed a request its rules deny
+	Audited bool `json:"audited,omitempty"`
+}
+
+//Rule allow or deny the actions on the resources matching all its conditions
+type Rule struct {
+	Name      string   `json:"name"`
+	Effect    string   `json:"effect"`
+	Actions   []string `json:"actions,omitempty"`
+	Resources []string `json:"resources,omitempty"`
+	When      []string `json:"when,omitempty"`
+	Audit     bool     `json:"audit,omitempty"`
+
+	conditions []condition
+}
+
+//compile validate the rule and parse its conditions
+func (r *Rule) compile() error {
+	if r.Name == "" {
+		return errors.New("rule name cannot be empty")
+	}
+	r.Effect = strings.ToLower(r.Effect)
+	if r.Effect != Allow && r.Effect != Deny {
+		return fmt.Errorf("rule %s: effect must be allow or deny", r.Name)
+	}
+	r.conditions = make([]condition, 0, len(r.When))
+	for _, source := range r.When {
+		c, err := parse(source)
+		if err != nil {
+			return fmt.Errorf("rule %s: %s", r.Name, err)
+		}
+		r.conditions = append(r.conditions, c)
+	}
+	return nil
+}
+
+//match tell whether the rule applies to request, the strings explain why
+func (r *Rule) match(request Request, now time.Time) (bool, []string) {
+	if !matchAny(r.Actions, request.Action) {
+		return false, []string{fmt.Sprintf("action %s not in %v", request.Action, r.Actions)}
+	}
+	resource := fmt.Sprint(request.Resource["type"])
+	if !matchAny(r.Resources, resource) {
+		return false, []string{fmt.Sprintf("resource %s not in %v", resource, r.Resources)}
+	}
+	explanations := make([]string, 0, len(r.conditions))
+	for _, c := range r.conditions {
+		holds, explanation := c.holds(request, now)
+		explanations = append(explanations, explanation)
+		if !holds {
+			return false, explanations
+		}
+	}
+	return true, explanations
+}
+
+//matchAny tell whether value is one of patterns, no patterns or "*" match anything
+func matchAny(patterns []string, value string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	for _, pattern := range patterns {
+		if pattern == "*" || strings.EqualFold(pattern, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// Engine evaluate requests against rules
+type Engine struct {
+	sync.RWMutex
+	key          string
+	audit        bool
+	defaultAudit bool
+	defaults     []Rule
+	rules        []Rule
+	now          func() time.Time
+	interfaces.Logger
+}
+
+//WithKey set the configuration key holding the rules, "abac" by default
+func WithKey(key string) Option {
+	return func(e *Engine) error {
+		if key != "" {
+			e.key = strings.ToLower(key)
+			return nil
+		}
+		return errors.New("key cannot be empty")
+	}
+}
+
+//WithRule add a rule evaluated together with the ones of the configuration
+func WithRule(rule Rule) Option {
+	return func(e *Engine) error {
+		if err := rule.compile(); err != nil {
+			return err
+		}
+		e.defaults = append(e.defaults, rule)
+		e.rules = append(e.rules, rule)
+		return nil
+	}
+}
+
+//WithAudit evaluate and log the rules without enforcing them: every request is
+//allowed. The configuration turns it on and off with the audit setting
+func WithAudit() Option {
+	return func(e *Engine) error {
+		e.audit, e.defaultAudit = true, true
+		return nil
+	}
+}
+
+func WithLogger(logger interfaces.Logger) Option {
+	return func(e *Engine) error {
+		return e.WithLogger(logger)
+	}
+}
+
+func New(options ...Option) (*Engine, error) {
+	e := &Engine{
+		key:    "abac",
+		now:    time.Now,
+		Logger: logging.Logrus(logrus.New()),
+	}
+	for _, option := range options {
+		if err := option(e); err != nil {
+			return nil, err
+		}
+	}
+	return e, nil
+}
+
+func (e *Engine) WithLogger(logger interfaces.Logger) error {
+	if logger != nil {
+		e.Logger = logger
+		return nil
+	}
+	return errors.New("logger cannot be nil")
+}
+
+//Watch load the rules from configuration and, when it is an
+//interfaces.ConfigurationWatcher, reload them every time it changes
+func (e *Engine) Watch(configuration interfaces.Configuration) error {
+	if configuration == nil {
+		return errors.New("configuration cannot be nil")
+	}
+	if err := e.Load(configuration); err != nil {
+		return err
+	}
+	if watcher, ok := configuration.(interfaces.ConfigurationWatcher); ok {
+		watcher.OnChange(func() {
+			// a broken edit keep the previous rules
+			if err := e.Load(configuration); err != nil {
+				e.Error("abac rules not reloaded", "error", err)
+			}
+		})
+	}
+	return nil
+}
+
+//Load replace the rules with the ones of configuration, after the ones of WithRule
+func (e *Engine) Load(configuration interfaces.Configuration) error {
+	rules := append([]Rule{}, e.defaults...)
+	audit := e.defaultAudit
+	if settings, exists := lookup(configuration.AllSettings(), e.key); exists {
+		section, ok := toMap(settings)
+		if !ok {
+			return fmt.Errorf("%s must be a map", e.key)
+		}
+		if value, exists := section["audit"]; exists {
+			b, ok := value.(bool)
+			if !ok {
+				return fmt.Errorf("%s.audit must be a boolean", e.key)
+			}
+			audit = b
+		}
+		if value, exists := section["rules"]; exists {
+			definitions, ok := value.([]interface{})
+			if !ok {
+				return fmt.Errorf("%s.rules must be a list", e.key)
+			}
+			for i, definition := range definitions {
+				rule, err := toRule(definition)
+				if err != nil {
+					return fmt.Errorf("%s.rules[%d]: %s", e.key, i, err)
+				}
+				if err := rule.compile(); err != nil {
+					return err
+				}
+				rules = append(rules, rule)
+			}
+		}
+	}
+	e.Lock()
+	e.rules = rules
+	e.audit = audit
+	e.Unlock()
+	e.Info("abac rules loaded", "rules", len(rules), "audit", audit)
+	return nil
+}
+
+//Rules return the rules evaluated by the engine
+func (e *Engine) Rules() []Rule {
+	e.RLock()
+	defer e.RUnlock()
+	return append([]Rule{}, e.rules...)
+}
+
+//Evaluate decide on request and log the decision and its reasons at debug level
+func (e *Engine) Evaluate(request Request) Decision {
+	e.RLock()
+	rules, audit := e.rules, e.audit
+	e.RUnlock()
+	now := e.now()
+	logger := e.With("action", request.Action, "subject", request.Subject["id"],
+		"resource", fmt.Sprint(request.Resource["type"]), "id", fmt.Sprint(request.Resource["id"]))
+
+	var allow, deny *Rule
+	for i := range rules {
+		rule := &rules[i]
+		matched, explanations := rule.match(request, now)
+		logger.Debug("abac rule evaluated", "rule", rule.Name, "effect", rule.Effect, "matched", matched,
+			"explanation", strings.Join(explanations, "; "))
+		if !matched {
+			continue
+		}
+		if rule.Audit {
+			logger.Info("abac audit rule matched", "rule", rule.Name, "effect", rule.Effect)
+			continue
+		}
+		if rule.Effect == Deny && deny == nil {
+			deny = rule
+		}
+		if rule.Effect == Allow && allow == nil {
+			allow = rule
+		}
+	}
+
+	var decision Decision
+	switch {
+	case deny != nil:
+		decision = Decision{Rule: deny.Name, Reason: "denied by " + deny.Name}
+	case allow != nil:
+		decision = Decision{Allowed: true, Rule: allow.Name, Reason: "allowed by " + allow.Name}
+	default:
+		decision = Decision{Reason: "no rule allows it"}
+	}
+	if !decision.Allowed && audit {
+		logger.Info("abac would deny", "rule", decision.Rule, "reason", decision.Reason)
+		decision.Allowed, decision.Audited = true, true
+	}
+	logger.Debug("abac decision", "allowed", decision.Allowed, "rule", decision.Rule, "reason", decision.Reason)
+	return decision
+}
+
+//Check return nil when request is allowed, an error wrapping ErrDenied otherwise
+func (e *Engine) Check(request Request) error {
+	decision := e.Evaluate(request)
+	if decision.Allowed {
+		return nil
+	}
+	return &DeniedError{Decision: decision}
+}
+
+//DeniedError is the error of a denied request, it tells the reason
+type DeniedError struct {
+	Decision Decision
+}
+
+func (d *DeniedError) Error() string {
+	return fmt.Sprintf("%s: %s", ErrDenied, d.Decision.Reason)
+}
+
+//Is make errors.Is(err, ErrDenied) true
+func (d *DeniedError) Is(target error) bool {
+	return target == ErrDenied
+}
+
+func toRule(definition interface{}) (Rule, error) {
+	m, ok := toMap(definition)
+	if !ok {
+		return Rule{}, errors.New("a rule must be a map")
+	}
+	var rule Rule
+	for key, value := range m {
+		var err error
+		switch strings.ToLower(key) {
+		case "name":
+			rule.Name = fmt.Sprint(value)
+		case "effect":
+			rule.Effect = fmt.Sprint(value)
+		case "actions":
+			rule.Actions, err = toStrings(value)
+		case "resources":
+			rule.Resources, err = toStrings(value)
+		case "when":
+			rule.When, err = toStrings(value)
+		case "audit":
+			b, ok := value.(bool)
+			if !ok {
+				err = errors.New("audit must be a boolean")
+			}
+			rule.Audit = b
+		default:
+			err = fmt.Errorf("unknown setting %s", key)
+		}
+		if err != nil {
+			return Rule{}, err
+		}
+	}
+	return rule, nil
+}
+
+func toStrings(value interface{}) ([]string, error) {
+	switch v := value.(type) {
+	case []string:
+		return v, nil
+	case string:
+		return []string{v}, nil
+	case []interface{}:
+		values := make([]string, 0, len(v))
+		for _, item := range v {
+			s, ok := item.(string)
+			if !ok {
+				return nil, fmt.Errorf("%v is not a string", item)
+			}
+			values = append(values, s)
+		}
+		return values, nil
+	}
+	return nil, fmt.Errorf("%v is not a list of strings", value)
+}
+
+func lookup(settings map[string]interface{}, key string) (interface{}, bool) {
+	var value interface{} = settings
+	for _, part := range strings.Split(key, ".") {
+		m, ok := toMap(value)
+		if !ok {
+			return nil, false
+		}
+		if value, ok = m[part]; !ok {
+			return nil, false
+		}
+	}
+	return value, true
+}
@@ -0,0 +1,182 @@
+package abac
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/advancedlogic/easy/interfaces"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+type configuration struct {
+	interfaces.Configuration
+	settings  map[string]interface{}
+	listeners []func()
+}
+
+func (c *configuration) AllSettings() map[string]interface{} {
+	return c.settings
+}
+
+func (c *configuration) OnChange(fn func()) {
+	c.listeners = append(c.listeners, fn)
+}
+
+func TestParse(t *testing.T) {
+	for _, source := range []string{
+		"resource.owner == subject.id",
+		"subject.groups contains support",
+		"action in [read, 'list all']",
+		"resource.created older_than 30d",
+		"resource.archived exists",
+		"env.ip != \"10.0.0.1\"",
+	} {
+		_, err := parse(source)
+		assert.Nil(t, err, source)
+	}
+	for _, source := range []string{
+		"resource.owner",
+		"resource.owner is subject.id",
+		"resource.owner == ",
+		"resource.archived exists now",
+		"action in [read",
+		"subject.id == 'ada",
+	} {
+		_, err := parse(source)
+		assert.NotNil(t, err, source)
+	}
+}
+
+func TestHolds(t *testing.T) {
+	now := time.Date(2020, 1, 31, 0, 0, 0, 0, time.UTC)
+	r := Request{
+		Subject: Attributes{"id": "ada", "groups": []string{"user", "support"}, "level": 3},
+		Action:  "read",
+		Resource: Attributes{
+			"type":    "order",
+			"owner":   "ada",
+			"amount":  120.5,
+			"created": "2020-01-01T00:00:00Z",
+			"age":     48 * time.Hour,
+			"address": map[string]interface{}{"country": "IT"},
+		},
+		Environment: Attributes{"ip": "10.0.0.1"},
+	}
+	for source, expected := range map[string]bool{
+		"resource.owner == subject.id":               true,
+		"resource.owner != subject.id":               false,
+		"subject.groups contains support":            true,
+		"subject.groups not_contains admin":          true,
+		"action in [read, list]":                     true,
+		"action not_in [read, list]":                 false,
+		"resource.amount > 100":                      true,
+		"resource.amount <= 100":                     false,
+		"subject.level >= 3":                         true,
+		"resource.age < 3d":                          true,
+		"resource.created older_than 29d":            true,
+		"resource.created newer_than 29d":            false,
+		"resource.address.country == IT":             true,
+		"resource.address.city exists":               false,
+		"resource.deleted missing":                   true,
+		"env.ip == '10.0.0.1'":                       true,
+		"resource.missing == subject.id":             false,
+		"resource.owner > 3":                         false,
+		"resource.created == '2020-01-01T00:00:00Z'": true,
+	} {
+		c, err := parse(source)
+		assert.Nil(t, err, source)
+		holds, explanation := c.holds(r, now)
+		assert.Equal(t, expected, holds, explanation)
+		assert.NotEmpty(t, explanation)
+	}
+}
+
+func TestEngine(t *testing.T) {
+	_, err := New(WithRule(Rule{Name: "broken", Effect: "maybe"}))
+	assert.NotNil(t, err)
+	_, err = New(WithRule(Rule{Name: "broken", Effect: Allow, When: []string{"subject.id ~ ada"}}))
+	assert.NotNil(t, err)
+	e, err := New(WithRule(Rule{Name: "admins", Effect: Allow, When: []string{"subject.groups contains admin"}}))
+	assert.Nil(t, err)
+	e.now = func() time.Time { return time.Date(2020, 3, 1, 0, 0, 0, 0, time.UTC) }
+
+	v := viper.New()
+	v.SetConfigType("yaml")
+	assert.Nil(t, v.ReadConfig(strings.NewReader(`
+abac:
+  rules:
+    - name: owners-update
+      effect: allow
+      actions: [read, update]
+      resources: [order]
+      when: ["resource.owner == subject.id"]
+    - name: support-read
+      effect: allow
+      actions: [read, delete]
+      when: ["subject.groups contains support"]
+    - name: support-keeps-old-records
+      effect: deny
+      actions: [delete]
+      when: ["subject.groups contains support", "resource.created older_than 30d"]
+    - name: nobody-on-archived
+      effect: deny
+      actions: ["*"]
+      when: ["resource.archived == true"]
+      audit: true
+`)))
+	c := &configuration{settings: v.AllSettings()}
+	assert.Nil(t, e.Watch(c))
+	assert.Len(t, e.Rules(), 5)
+
+	ada := Attributes{"id": "ada", "groups": []string{"user"}}
+	bob := SubjectAttributes(interfaces.Subject{ID: "bob", Groups: []string{"support"}})
+	root := Attributes{"id": "root", "groups": []interface{}{"admin"}}
+	order := Attributes{"type": "order", "id": "1", "owner": "ada", "created": "2020-01-01T00:00:00Z"}
+	recent := Attributes{"type": "order", "id": "2", "owner": "ada", "created": "2020-02-15T00:00:00Z"}
+	archived := Attributes{"type": "order", "id": "3", "owner": "ada", "archived": true}
+
+	decide := func(subject Attributes, action string, resource Attributes) Decision {
+		return e.Evaluate(Request{Subject: subject, Action: action, Resource: resource})
+	}
+	assert.Equal(t, Decision{Allowed: true, Rule: "owners-update", Reason: "allowed by owners-update"}, decide(ada, "update", order))
+	assert.False(t, decide(ada, "delete", order).Allowed)
+	assert.Equal(t, "no rule allows it", decide(ada, "delete", order).Reason)
+	assert.False(t, decide(ada, "update", Attributes{"type": "invoice", "owner": "ada"}).Allowed)
+	assert.True(t, decide(bob, "read", order).Allowed)
+	assert.False(t, decide(bob, "update", order).Allowed)
+	// deny overrides allow
+	assert.Equal(t, Decision{Rule: "support-keeps-old-records", Reason: "denied by support-keeps-old-records"}, decide(bob, "delete", order))
+	assert.True(t, decide(bob, "delete", recent).Allowed)
+	assert.True(t, decide(root, "delete", order).Allowed)
+	// a rule in audit is not enforced
+	assert.True(t, decide(ada, "update", archived).Allowed)
+
+	assert.Nil(t, e.Check(Request{Subject: ada, Action: "read", Resource: order}))
+	err = e.Check(Request{Subject: ada, Action: "delete", Resource: order})
+	assert.True(t, errors.Is(err, ErrDenied))
+	assert.Contains(t, err.Error(), "no rule allows it")
+
+	// the audit mode allows everything but tells what would have been denied
+	c.settings = map[string]interface{}{"abac": map[string]interface{}{"audit": true}}
+	c.listeners[0]()
+	assert.Len(t, e.Rules(), 1)
+	assert.Equal(t, Decision{Allowed: true, Reason: "no rule allows it", Audited: true}, decide(ada, "delete", order))
+	assert.Equal(t, Decision{Allowed: true, Rule: "admins", Reason: "allowed by admins"}, decide(root, "delete", order))
+
+	// a broken reload keep the previous rules
+	c.settings = map[string]interface{}{"abac": map[string]interface{}{"rules": []interface{}{
+		map[string]interface{}{"name": "broken", "effect": "allow", "when": []interface{}{"subject.id"}},
+	}}}
+	c.listeners[0]()
+	assert.Len(t, e.Rules(), 1)
+	assert.NotNil(t, e.Load(c))
+	c.settings = map[string]interface{}{"abac": map[string]interface{}{"rules": "all"}}
+	assert.NotNil(t, e.Load(c))
+	c.settings = map[string]interface{}{"abac": map[string]interface{}{"rules": []interface{}{
+		map[string]interface{}{"name": "typo", "effect": "allow", "whne": "subject.id exists"},
+	}}}
+	assert.NotNil(t, e.Load(c))
+}
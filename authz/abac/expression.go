@@ -0,0 +1,366 @@
+package abac
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// operators of the conditions, the value of each one tells whether it is
+// followed by a right operand
+var operators = map[string]bool{
+	"==": true, "!=": true, "<": true, "<=": true, ">": true, ">=": true,
+	"in": true, "not_in": true, "contains": true, "not_contains": true,
+	"older_than": true, "newer_than": true, "exists": false, "missing": false,
+}
+
+//operand is an attribute path like resource.owner or a literal value
+type operand struct {
+	path    []string
+	literal interface{}
+}
+
+func (o operand) String() string {
+	if o.path != nil {
+		return strings.Join(o.path, ".")
+	}
+	return fmt.Sprint(o.literal)
+}
+
+func (o operand) value(r Request) (interface{}, bool) {
+	if o.path == nil {
+		return o.literal, true
+	}
+	var root Attributes
+	switch o.path[0] {
+	case "subject":
+		root = r.Subject
+	case "resource":
+		root = r.Resource
+	case "env":
+		root = r.Environment
+	case "action":
+		return r.Action, len(o.path) == 1
+	}
+	var value interface{} = map[string]interface{}(root)
+	for _, part := range o.path[1:] {
+		m, ok := toMap(value)
+		if !ok {
+			return nil, false
+		}
+		if value, ok = m[part]; !ok {
+			return nil, false
+		}
+	}
+	return value, value != nil
+}
+
+//condition is a comparison like "resource.owner == subject.id"
+type condition struct {
+	source   string
+	left     operand
+	operator string
+	right    operand
+}
+
+//parse read "<operand> <operator> [operand]". An operand starting with
+//subject., resource., env. or the word action is an attribute, anything else
+//a literal: a quoted string, a number, a boolean, a duration (30d, 12h) or a
+//list ([a, b])
+func parse(source string) (condition, error) {
+	tokens, err := tokenize(source)
+	if err != nil {
+		return condition{}, fmt.Errorf("%q: %s", source, err)
+	}
+	if len(tokens) < 2 {
+		return condition{}, fmt.Errorf("%q: expected <operand> <operator> <operand>", source)
+	}
+	c := condition{source: source, left: toOperand(tokens[0]), operator: tokens[1]}
+	binary, known := operators[c.operator]
+	if !known {
+		return condition{}, fmt.Errorf("%q: unknown operator %s", source, c.operator)
+	}
+	if binary && len(tokens) != 3 || !binary && len(tokens) != 2 {
+		return condition{}, fmt.Errorf("%q: wrong number of operands for %s", source, c.operator)
+	}
+	if binary {
+		c.right = toOperand(tokens[2])
+	}
+	return c, nil
+}
+
+func tokenize(source string) ([]string, error) {
+	tokens := make([]string, 0, 3)
+	var current strings.Builder
+	var quote rune
+	depth := 0
+	flush := func() {
+		if current.Len() > 0 {
+			tokens = append(tokens, current.String())
+			current.Reset()
+		}
+	}
+	for _, r := range source {
+		switch {
+		case quote != 0:
+			current.WriteRune(r)
+			if r == quote {
+				quote = 0
+			}
+		case r == '\'' || r == '"':
+			quote = r
+			current.WriteRune(r)
+		case r == '[':
+			depth++
+			current.WriteRune(r)
+		case r == ']':
+			depth--
+			current.WriteRune(r)
+		case (r == ' ' || r == '\t') && depth == 0:
+			flush()
+		default:
+			current.WriteRune(r)
+		}
+	}
+	if quote != 0 || depth != 0 {
+		return nil, errors.New("unbalanced quote or bracket")
+	}
+	flush()
+	return tokens, nil
+}
+
+func toOperand(token string) operand {
+	if token == "action" {
+		return operand{path: []string{"action"}}
+	}
+	for _, root := range []string{"subject.", "resource.", "env."} {
+		if strings.HasPrefix(token, root) {
+			return operand{path: strings.Split(token, ".")}
+		}
+	}
+	return operand{literal: literal(token)}
+}
+
+func literal(token string) interface{} {
+	if len(token) >= 2 && (token[0] == '\'' || token[0] == '"') && token[len(token)-1] == token[0] {
+		return token[1 : len(token)-1]
+	}
+	if strings.HasPrefix(token, "[") && strings.HasSuffix(token, "]") {
+		items := make([]interface{}, 0)
+		for _, item := range strings.Split(token[1:len(token)-1], ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, literal(item))
+			}
+		}
+		return items
+	}
+	if token == "true" || token == "false" {
+		return token == "true"
+	}
+	if f, err := strconv.ParseFloat(token, 64); err == nil {
+		return f
+	}
+	if d, err := parseDuration(token); err == nil {
+		return d
+	}
+	return token
+}
+
+//parseDuration read a time.Duration, with d for days
+func parseDuration(s string) (time.Duration, error) {
+	if strings.HasSuffix(s, "d") {
+		days, err := strconv.ParseFloat(strings.TrimSuffix(s, "d"), 64)
+		if err != nil {
+			return 0, err
+		}
+		return time.Duration(days * float64(24*time.Hour)), nil
+	}
+	return time.ParseDuration(s)
+}
+
+//holds evaluate the condition, the string explains the result
+func (c condition) holds(r Request, now time.Time) (bool, string) {
+	left, found := c.left.value(r)
+	switch c.operator {
+	case "exists":
+		return found, fmt.Sprintf("%s exists: %t", c.left, found)
+	case "missing":
+		return !found, fmt.Sprintf("%s missing: %t", c.left, !found)
+	}
+	right, rightFound := c.right.value(r)
+	if !found || !rightFound {
+		return false, fmt.Sprintf("%s: attribute missing", c.source)
+	}
+	var result bool
+	switch c.operator {
+	case "==":
+		result = equal(left, right)
+	case "!=":
+		result = !equal(left, right)
+	case "<", "<=", ">", ">=":
+		cmp, ok := compare(left, right)
+		if !ok {
+			return false, fmt.Sprintf("%s: cannot compare %v and %v", c.source, left, right)
+		}
+		result = map[string]bool{"<": cmp < 0, "<=": cmp <= 0, ">": cmp > 0, ">=": cmp >= 0}[c.operator]
+	case "in":
+		result = member(right, left)
+	case "not_in":
+		result = !member(right, left)
+	case "contains":
+		result = member(left, right)
+	case "not_contains":
+		result = !member(left, right)
+	case "older_than", "newer_than":
+		t, okTime := toTime(left)
+		d, okDuration := toDuration(right)
+		if !okTime || !okDuration {
+			return false, fmt.Sprintf("%s: expected a time and a duration", c.source)
+		}
+		result = now.Sub(t) > d
+		if c.operator == "newer_than" {
+			result = now.Sub(t) < d
+		}
+	}
+	return result, fmt.Sprintf("%s (%v %s %v): %t", c.source, left, c.operator, right, result)
+}
+
+func equal(a, b interface{}) bool {
+	if fa, ok := toFloat(a); ok {
+		if fb, ok := toFloat(b); ok {
+			return fa == fb
+		}
+	}
+	if ta, ok := toTime(a); ok {
+		if tb, ok := toTime(b); ok {
+			return ta.Equal(tb)
+		}
+	}
+	return fmt.Sprint(a) == fmt.Sprint(b)
+}
+
+func compare(a, b interface{}) (int, bool) {
+	if fa, ok := toFloat(a); ok {
+		if fb, ok := toFloat(b); ok {
+			return sign(fa - fb), true
+		}
+	}
+	if ta, ok := toTime(a); ok {
+		if tb, ok := toTime(b); ok {
+			return sign(float64(ta.Sub(tb))), true
+		}
+	}
+	if da, ok := toDuration(a); ok {
+		if db, ok := toDuration(b); ok {
+			return sign(float64(da - db)), true
+		}
+	}
+	sa, okA := a.(string)
+	sb, okB := b.(string)
+	if okA && okB {
+		return strings.Compare(sa, sb), true
+	}
+	return 0, false
+}
+
+func sign(f float64) int {
+	switch {
+	case f < 0:
+		return -1
+	case f > 0:
+		return 1
+	}
+	return 0
+}
+
+//member tell whether item is in list, or a substring of a string
+func member(list, item interface{}) bool {
+	if s, ok := list.(string); ok {
+		return strings.Contains(s, fmt.Sprint(item))
+	}
+	v := reflect.ValueOf(list)
+	if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+		return false
+	}
+	for i := 0; i < v.Len(); i++ {
+		if equal(v.Index(i).Interface(), item) {
+			return true
+		}
+	}
+	return false
+}
+
+func toFloat(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case int:
+		return float64(v), true
+	case int32:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case uint:
+		return float64(v), true
+	case uint64:
+		return float64(v), true
+	case float32:
+		return float64(v), true
+	case float64:
+		return v, true
+	case json.Number:
+		f, err := v.Float64()
+		return f, err == nil
+	}
+	return 0, false
+}
+
+func toTime(value interface{}) (time.Time, bool) {
+	switch v := value.(type) {
+	case time.Time:
+		return v, true
+	case *time.Time:
+		if v != nil {
+			return *v, true
+		}
+	case string:
+		t, err := time.Parse(time.RFC3339, v)
+		return t, err == nil
+	}
+	return time.Time{}, false
+}
+
+func toDuration(value interface{}) (time.Duration, bool) {
+	switch v := value.(type) {
+	case time.Duration:
+		return v, true
+	case string:
+		d, err := parseDuration(v)
+		return d, err == nil
+	}
+	return 0, false
+}
+
+func toMap(value interface{}) (map[string]interface{}, bool) {
+	switch v := value.(type) {
+	case Attributes:
+		return v, true
+	case map[string]interface{}:
+		return v, true
+	case map[string]string:
+		m := make(map[string]interface{}, len(v))
+		for key, value := range v {
+			m[key] = value
+		}
+		return m, true
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for key, value := range v {
+			m[fmt.Sprint(key)] = value
+		}
+		return m, true
+	}
+	return nil, false
+}
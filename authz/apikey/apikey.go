@@ -0,0 +1,525 @@
+// Package apikey authenticate machine-to-machine callers with API keys. A key
+// is shown once, when it is issued; the store only keeps the hash of its
+// secret, with its name, scopes, expiry, rate limit and last use. The records
+// are JSON objects below the "apikeys/" prefix of the store, and
+// "apikeys/index" lists their ids.
+//
+// The changes to the index are serialized and the rate limits counted by each
+// Manager: run a single replica issuing and revoking keys, and expect a key to
+// be allowed its rate limit once per replica
+package apikey
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/advancedlogic/easy/authz/rbac"
+	"github.com/advancedlogic/easy/interfaces"
+	"github.com/advancedlogic/easy/logging"
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	//ErrInvalidKey is returned for a key that was never issued or was revoked
+	ErrInvalidKey = errors.New("invalid api key")
+	//ErrExpiredKey is returned for a key past its expiry
+	ErrExpiredKey = errors.New("api key expired")
+	//ErrRateLimited is returned for a key used more than its rate limit
+	ErrRateLimited = errors.New("api key rate limit exceeded")
+	//ErrNotFound is returned for an unknown key id
+	ErrNotFound = errors.New("api key not found")
+)
+
+const (
+	tokenPrefix = "ek"
+	window      = time.Minute
+)
+
+type Option func(*Manager) error
+
+//Key describe an API key, never its secret
+type Key struct {
+	ID     string   `json:"id"`
+	Name   string   `json:"name"`
+	Scopes []string `json:"scopes"`
+	//RateLimit is the number of requests allowed per minute, 0 for no limit
+	RateLimit int        `json:"rate_limit,omitempty"`
+	Created   time.Time  `json:"created"`
+	Expires   *time.Time `json:"expires,omitempty"`
+	LastUsed  *time.Time `json:"last_used,omitempty"`
+}
+
+//Allowed tell whether the key is granted every one of scopes. A scope ending
+//with * grants every scope starting like it
+func (k *Key) Allowed(scopes ...string) bool {
+	for _, scope := range scopes {
+		granted := false
+		for _, s := range k.Scopes {
+			if rbac.Match(s, scope) {
+				granted = true
+				break
+			}
+		}
+		if !granted {
+			return false
+		}
+	}
+	return true
+}
+
+//Spec is what a new key is issued with
+type Spec struct {
+	Name      string   `json:"name"`
+	Scopes    []string `json:"scopes"`
+	TTL       string   `json:"ttl,omitempty"`
+	RateLimit int      `json:"rate_limit,omitempty"`
+}
+
+//RateLimitError is the error of a key used more than its rate limit, it tells
+//when the key can be used again
+type RateLimitError struct {
+	RetryAfter time.Duration
+}
+
+func (r *RateLimitError) Error() string {
+	return fmt.Sprintf("%s, retry after %s", ErrRateLimited, r.RetryAfter)
+}
+
+//Is make errors.Is(err, ErrRateLimited) true
+func (r *RateLimitError) Is(target error) bool {
+	return target == ErrRateLimited
+}
+
+type record struct {
+	Key
+	Hash string `json:"hash"`
+}
+
+//keyIndex is stored as an object, as vault keeps a map under each key
+type keyIndex struct {
+	IDs []string `json:"ids"`
+}
+
+type usage struct {
+	start time.Time
+	count int
+}
+
+// Manager issue, check and revoke API keys
+type Manager struct {
+	sync.Mutex
+	store   interfaces.Store
+	prefix  string
+	header  string
+	touch   time.Duration
+	usage   map[string]*usage
+	touched map[string]time.Time
+	now     func() time.Time
+	interfaces.Logger
+}
+
+//WithStore keep the keys in store, shared by every instance of the service
+func WithStore(store interfaces.Store) Option {
+	return func(m *Manager) error {
+		return m.WithStore(store)
+	}
+}
+
+//WithPrefix set the prefix of the store keys, "apikeys" by default
+func WithPrefix(prefix string) Option {
+	return func(m *Manager) error {
+		if prefix != "" {
+			m.prefix = strings.TrimSuffix(prefix, "/")
+			return nil
+		}
+		return errors.New("prefix cannot be empty")
+	}
+}
+
+//WithHeader set the request header carrying the key, X-API-Key by default
+func WithHeader(header string) Option {
+	return func(m *Manager) error {
+		if header != "" {
+			m.header = header
+			return nil
+		}
+		return errors.New("header cannot be empty")
+	}
+}
+
+//WithTouchInterval set how often the last use of a key is written to the
+//store, every minute by default
+func WithTouchInterval(interval time.Duration) Option {
+	return func(m *Manager) error {
+		if interval >= 0 {
+			m.touch = interval
+			return nil
+		}
+		return errors.New("touch interval cannot be negative")
+	}
+}
+
+func WithLogger(logger interfaces.Logger) Option {
+	return func(m *Manager) error {
+		return m.WithLogger(logger)
+	}
+}
+
+func New(options ...Option) (*Manager, error) {
+	m := &Manager{
+		prefix:  "apikeys",
+		header:  "X-API-Key",
+		touch:   time.Minute,
+		usage:   make(map[string]*usage),
+		touched: make(map[string]time.Time),
+		now:     time.Now,
+		Logger:  logging.Logrus(logrus.New()),
+	}
+	for _, option := range options {
+		if err := option(m); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// HasStore tell whether the manager has a store for the keys
+func (m *Manager) HasStore() bool {
+	return m.store != nil
+}
+
+func (m *Manager) WithStore(store interfaces.Store) error {
+	if store != nil {
+		m.store = store
+		return nil
+	}
+	return errors.New("store cannot be nil")
+}
+
+func (m *Manager) WithLogger(logger interfaces.Logger) error {
+	if logger != nil {
+		m.Logger = logger
+		return nil
+	}
+	return errors.New("logger cannot be nil")
+}
+
+//Header return the request header carrying the key
+func (m *Manager) Header() string {
+	return m.header
+}
+
+func (m *Manager) Issue(spec Spec) (string, *Key, error) {
+	return m.IssueContext(context.Background(), spec)
+}
+
+//IssueContext create a key and return it with its description. The key is
+//not kept: it cannot be shown again
+func (m *Manager) IssueContext(ctx context.Context, spec Spec) (string, *Key, error) {
+	if spec.Name == "" {
+		return "", nil, errors.New("name cannot be empty")
+	}
+	if spec.RateLimit < 0 {
+		return "", nil, errors.New("rate limit cannot be negative")
+	}
+	r := record{Key: Key{Name: spec.Name, Scopes: spec.Scopes, RateLimit: spec.RateLimit, Created: m.now().UTC()}}
+	if r.Scopes == nil {
+		r.Scopes = make([]string, 0)
+	}
+	if spec.TTL != "" {
+		ttl, err := time.ParseDuration(spec.TTL)
+		if err != nil || ttl <= 0 {
+			return "", nil, fmt.Errorf("invalid ttl %q", spec.TTL)
+		}
+		expires := r.Created.Add(ttl)
+		r.Expires = &expires
+	}
+	id, err := random(8)
+	if err != nil {
+		return "", nil, err
+	}
+	secret, err := random(32)
+	if err != nil {
+		return "", nil, err
+	}
+	r.ID = hex.EncodeToString(id)
+	token := fmt.Sprintf("%s_%s_%s", tokenPrefix, r.ID, base64.RawURLEncoding.EncodeToString(secret))
+	r.Hash = hash(token)
+
+	m.Lock()
+	defer m.Unlock()
+	ids, err := m.index(ctx)
+	if err != nil {
+		return "", nil, err
+	}
+	if err := m.write(ctx, r); err != nil {
+		return "", nil, err
+	}
+	if err := m.writeIndex(ctx, append(ids, r.ID)); err != nil {
+		return "", nil, err
+	}
+	return token, &r.Key, nil
+}
+
+func (m *Manager) List() ([]Key, error) {
+	return m.ListContext(context.Background())
+}
+
+//ListContext return the keys sorted by creation
+func (m *Manager) ListContext(ctx context.Context) ([]Key, error) {
+	m.Lock()
+	defer m.Unlock()
+	ids, err := m.index(ctx)
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]Key, 0, len(ids))
+	for _, id := range ids {
+		r, err := m.read(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, r.Key)
+	}
+	sort.SliceStable(keys, func(i, j int) bool {
+		return keys[i].Created.Before(keys[j].Created)
+	})
+	return keys, nil
+}
+
+func (m *Manager) Scope(id string, scopes []string) (*Key, error) {
+	return m.ScopeContext(context.Background(), id, scopes)
+}
+
+//ScopeContext replace the scopes of a key
+func (m *Manager) ScopeContext(ctx context.Context, id string, scopes []string) (*Key, error) {
+	if scopes == nil {
+		scopes = make([]string, 0)
+	}
+	m.Lock()
+	defer m.Unlock()
+	r, err := m.read(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	r.Scopes = scopes
+	if err := m.write(ctx, *r); err != nil {
+		return nil, err
+	}
+	return &r.Key, nil
+}
+
+func (m *Manager) Revoke(id string) error {
+	return m.RevokeContext(context.Background(), id)
+}
+
+//RevokeContext delete a key, it stops working at once
+func (m *Manager) RevokeContext(ctx context.Context, id string) error {
+	m.Lock()
+	defer m.Unlock()
+	ids, err := m.index(ctx)
+	if err != nil {
+		return err
+	}
+	kept := make([]string, 0, len(ids))
+	for _, i := range ids {
+		if i != id {
+			kept = append(kept, i)
+		}
+	}
+	if len(kept) == len(ids) {
+		return ErrNotFound
+	}
+	if err := m.store.DeleteContext(ctx, m.key(id)); err != nil {
+		return err
+	}
+	delete(m.usage, id)
+	delete(m.touched, id)
+	return m.writeIndex(ctx, kept)
+}
+
+func (m *Manager) Authenticate(token string) (*Key, error) {
+	return m.AuthenticateContext(context.Background(), token)
+}
+
+//AuthenticateContext return the key of token when it is valid, not expired
+//and within its rate limit, and record its use. The rate limit is counted by
+//each instance of the service
+func (m *Manager) AuthenticateContext(ctx context.Context, token string) (*Key, error) {
+	parts := strings.SplitN(token, "_", 3)
+	if len(parts) != 3 || parts[0] != tokenPrefix || parts[1] == "" {
+		return nil, ErrInvalidKey
+	}
+	id := parts[1]
+	r, err := m.read(ctx, id)
+	if err == ErrNotFound {
+		return nil, ErrInvalidKey
+	}
+	if err != nil {
+		return nil, err
+	}
+	if subtle.ConstantTimeCompare([]byte(hash(token)), []byte(r.Hash)) != 1 {
+		return nil, ErrInvalidKey
+	}
+	now := m.now().UTC()
+	if r.Expires != nil && !now.Before(*r.Expires) {
+		return nil, ErrExpiredKey
+	}
+	m.Lock()
+	if r.RateLimit > 0 {
+		u, exists := m.usage[id]
+		if !exists || now.Sub(u.start) >= window {
+			u = &usage{start: now}
+			m.usage[id] = u
+		}
+		if u.count >= r.RateLimit {
+			m.Unlock()
+			return nil, &RateLimitError{RetryAfter: u.start.Add(window).Sub(now)}
+		}
+		u.count++
+	}
+	touch := now.Sub(m.touched[id]) >= m.touch
+	if touch {
+		m.touched[id] = now
+	}
+	m.Unlock()
+	r.LastUsed = &now
+	if touch {
+		// a failed write must not fail the request
+		if err := m.used(ctx, id, now); err != nil {
+			m.Warn("api key last use not recorded", "id", id, "error", err)
+		}
+	}
+	return &r.Key, nil
+}
+
+//used record the last use of a key on a fresh copy, not to undo a concurrent
+//change of its scopes
+func (m *Manager) used(ctx context.Context, id string, now time.Time) error {
+	m.Lock()
+	defer m.Unlock()
+	r, err := m.read(ctx, id)
+	if err != nil {
+		return err
+	}
+	r.LastUsed = &now
+	return m.write(ctx, *r)
+}
+
+func (m *Manager) key(id string) string {
+	return m.prefix + "/" + id
+}
+
+func (m *Manager) read(ctx context.Context, id string) (*record, error) {
+	if m.store == nil {
+		return nil, errors.New("store cannot be nil")
+	}
+	if id == "" || id == "index" {
+		return nil, ErrNotFound
+	}
+	value, err := m.store.ReadContext(ctx, m.key(id))
+	if errors.Is(err, interfaces.ErrKeyNotFound) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	var r record
+	if err := decode(value, &r); err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+func (m *Manager) write(ctx context.Context, r record) error {
+	if m.store == nil {
+		return errors.New("store cannot be nil")
+	}
+	value, err := encode(r)
+	if err != nil {
+		return err
+	}
+	return m.store.UpdateContext(ctx, m.key(r.ID), value)
+}
+
+//index return the ids of the keys, none when the index was never written
+func (m *Manager) index(ctx context.Context) ([]string, error) {
+	if m.store == nil {
+		return nil, errors.New("store cannot be nil")
+	}
+	value, err := m.store.ReadContext(ctx, m.key("index"))
+	if errors.Is(err, interfaces.ErrKeyNotFound) {
+		return make([]string, 0), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var i keyIndex
+	if err := decode(value, &i); err != nil {
+		return nil, err
+	}
+	if i.IDs == nil {
+		i.IDs = make([]string, 0)
+	}
+	return i.IDs, nil
+}
+
+func (m *Manager) writeIndex(ctx context.Context, ids []string) error {
+	value, err := encode(keyIndex{IDs: ids})
+	if err != nil {
+		return err
+	}
+	return m.store.UpdateContext(ctx, m.key("index"), value)
+}
+
+//encode turn v into the JSON object the stores keep, vault only takes maps
+func encode(v interface{}) (map[string]interface{}, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	value := make(map[string]interface{})
+	if err := json.Unmarshal(b, &value); err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+//decode read a record stored as a JSON string, bytes or a decoded map
+func decode(value interface{}, v interface{}) error {
+	switch s := value.(type) {
+	case string:
+		return json.Unmarshal([]byte(s), v)
+	case []byte:
+		return json.Unmarshal(s, v)
+	}
+	b, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
+func hash(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func random(n int) ([]byte, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
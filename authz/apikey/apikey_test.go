@@ -0,0 +1,160 @@
+package apikey_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/advancedlogic/easy/authz/apikey"
+	"github.com/advancedlogic/easy/easytest"
+	"github.com/advancedlogic/easy/interfaces"
+	"github.com/advancedlogic/easy/store/vault"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAPIKey(t *testing.T) {
+	_, err := apikey.New(apikey.WithStore(nil))
+	assert.NotNil(t, err)
+	m, err := apikey.New()
+	assert.Nil(t, err)
+	_, _, err = m.Issue(apikey.Spec{Name: "batch"})
+	assert.NotNil(t, err)
+
+	store := easytest.NewStore()
+	m, err = apikey.New(apikey.WithStore(store), apikey.WithTouchInterval(0))
+	assert.Nil(t, err)
+	_, _, err = m.Issue(apikey.Spec{})
+	assert.NotNil(t, err)
+	_, _, err = m.Issue(apikey.Spec{Name: "batch", TTL: "forever"})
+	assert.NotNil(t, err)
+
+	token, key, err := m.Issue(apikey.Spec{Name: "batch", Scopes: []string{"orders:*"}, TTL: "24h"})
+	assert.Nil(t, err)
+	assert.True(t, strings.HasPrefix(token, "ek_"+key.ID+"_"))
+	assert.NotNil(t, key.Expires)
+	// only the hash of the key is stored
+	for _, value := range store.Records() {
+		assert.NotContains(t, fmt.Sprint(value), token)
+	}
+
+	used, err := m.Authenticate(token)
+	assert.Nil(t, err)
+	assert.Equal(t, "batch", used.Name)
+	assert.True(t, used.Allowed("orders:read", "orders:write"))
+	assert.False(t, used.Allowed("orders:read", "users:read"))
+	for _, wrong := range []string{"", "ek_" + key.ID, "ek_" + key.ID + "_wrong", "ek_unknown_" + token[len(key.ID)+4:], token + "x"} {
+		_, err = m.Authenticate(wrong)
+		assert.Equal(t, apikey.ErrInvalidKey, err, wrong)
+	}
+
+	keys, err := m.List()
+	assert.Nil(t, err)
+	assert.Len(t, keys, 1)
+	assert.NotNil(t, keys[0].LastUsed)
+
+	scoped, err := m.Scope(key.ID, []string{"users:read"})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"users:read"}, scoped.Scopes)
+	used, err = m.Authenticate(token)
+	assert.Nil(t, err)
+	assert.True(t, used.Allowed("users:read"))
+	_, err = m.Scope("unknown", nil)
+	assert.Equal(t, apikey.ErrNotFound, err)
+
+	assert.Nil(t, m.Revoke(key.ID))
+	assert.Equal(t, apikey.ErrNotFound, m.Revoke(key.ID))
+	_, err = m.Authenticate(token)
+	assert.Equal(t, apikey.ErrInvalidKey, err)
+	keys, err = m.List()
+	assert.Nil(t, err)
+	assert.Len(t, keys, 0)
+}
+
+func TestAPIKey_Limits(t *testing.T) {
+	m, err := apikey.New(apikey.WithStore(easytest.NewStore()))
+	assert.Nil(t, err)
+	_, _, err = m.Issue(apikey.Spec{Name: "batch", RateLimit: -1})
+	assert.NotNil(t, err)
+
+	token, _, err := m.Issue(apikey.Spec{Name: "batch", RateLimit: 2})
+	assert.Nil(t, err)
+	for i := 0; i < 2; i++ {
+		_, err = m.Authenticate(token)
+		assert.Nil(t, err)
+	}
+	_, err = m.Authenticate(token)
+	assert.True(t, errors.Is(err, apikey.ErrRateLimited))
+	var limited *apikey.RateLimitError
+	assert.True(t, errors.As(err, &limited))
+	assert.True(t, limited.RetryAfter > 0)
+
+	expired, _, err := m.Issue(apikey.Spec{Name: "old", TTL: "1ns"})
+	assert.Nil(t, err)
+	_, err = m.Authenticate(expired)
+	assert.Equal(t, apikey.ErrExpiredKey, err)
+}
+
+func TestAPIKey_Vault(t *testing.T) {
+	server := easytest.VaultServer()
+	defer server.Close()
+	store, err := vault.New(vault.WithServers(server.URL), vault.WithToken("token"), vault.WithNamespace("secret"))
+	assert.Nil(t, err)
+	m, err := apikey.New(apikey.WithStore(store))
+	assert.Nil(t, err)
+
+	keys, err := m.List()
+	assert.Nil(t, err)
+	assert.Len(t, keys, 0)
+	token, key, err := m.Issue(apikey.Spec{Name: "batch", Scopes: []string{"orders:*"}})
+	assert.Nil(t, err)
+	used, err := m.Authenticate(token)
+	assert.Nil(t, err)
+	assert.Equal(t, key.ID, used.ID)
+	keys, err = m.List()
+	assert.Nil(t, err)
+	assert.Len(t, keys, 1)
+	assert.Nil(t, m.Revoke(key.ID))
+	_, err = m.Authenticate(token)
+	assert.Equal(t, apikey.ErrInvalidKey, err)
+}
+
+// unavailable fail every read once down is set
+type unavailable struct {
+	*easytest.Store
+	down bool
+}
+
+func (u *unavailable) ReadContext(ctx context.Context, key string) (interface{}, error) {
+	if u.down {
+		return nil, errors.New("store unavailable")
+	}
+	return u.Store.ReadContext(ctx, key)
+}
+
+func TestAPIKey_StoreErrors(t *testing.T) {
+	store := &unavailable{Store: easytest.NewStore()}
+	var _ interfaces.Store = store
+	m, err := apikey.New(apikey.WithStore(store))
+	assert.Nil(t, err)
+	token, key, err := m.Issue(apikey.Spec{Name: "batch"})
+	assert.Nil(t, err)
+
+	store.down = true
+	_, err = m.Authenticate(token)
+	assert.NotNil(t, err)
+	assert.NotEqual(t, apikey.ErrInvalidKey, err)
+	_, err = m.List()
+	assert.NotNil(t, err)
+	// a failed read of the index must not drop the keys already issued
+	_, _, err = m.Issue(apikey.Spec{Name: "other"})
+	assert.NotNil(t, err)
+	assert.NotEqual(t, apikey.ErrNotFound, m.Revoke(key.ID))
+
+	store.down = false
+	keys, err := m.List()
+	assert.Nil(t, err)
+	assert.Len(t, keys, 1)
+	assert.Equal(t, key.ID, keys[0].ID)
+}
@@ -0,0 +1,892 @@
+// Package jwt implement interfaces.AuthZ with JSON Web Tokens signed with
+// HS256, RS256 or EdDSA. The public keys are published as a JWKS, so other
+// services verify the tokens with WithJWKS. A revoked token is listed in the
+// cache of the service until it expires, so every replica refuses it
+package jwt
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/advancedlogic/easy/commons"
+	"github.com/advancedlogic/easy/factory"
+	"github.com/advancedlogic/easy/interfaces"
+	"github.com/advancedlogic/easy/logging"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	//ErrInvalidToken is returned for a token that is malformed, badly signed or revoked
+	ErrInvalidToken = errors.New("invalid token")
+	//ErrExpiredToken is returned for a token past its expiry
+	ErrExpiredToken = errors.New("token expired")
+)
+
+const (
+	access  = "access"
+	refresh = "refresh"
+	// a published key is fetched again at most once per interval
+	jwksRefresh = time.Minute
+)
+
+// the claims every token carries, the custom ones cannot replace them
+var registered = map[string]bool{"iss": true, "sub": true, "aud": true, "exp": true,
+	"iat": true, "jti": true, "sid": true, "typ": true}
+
+type Option func(*JWT) error
+
+//ClaimsFunc return the custom claims of the tokens issued to subject
+type ClaimsFunc func(ctx context.Context, subject string) (map[string]interface{}, error)
+
+// JWT issue and verify JSON Web Tokens
+type JWT struct {
+	sync.RWMutex
+	issuer     string
+	audience   []string
+	accessTTL  time.Duration
+	refreshTTL time.Duration
+	claims     map[string]interface{}
+	claimsFunc ClaimsFunc
+	algorithm  string
+	signing    *Key
+	keys       map[string]*Key
+	retired    map[string]time.Time
+	rotation   time.Duration
+	rotated    time.Time
+	jwksURL    string
+	fetched    time.Time
+	client     *http.Client
+	cache      interfaces.Cache
+	prefix     string
+	revoked    map[string]time.Time
+	subjects   map[string]time.Time
+	now        func() time.Time
+	interfaces.Logger
+}
+
+//WithKey sign the tokens with key
+func WithKey(key *Key) Option {
+	return func(j *JWT) error {
+		if err := key.validate(); err != nil {
+			return err
+		}
+		if !key.CanSign() {
+			return errors.New("signing key needs its secret or private key")
+		}
+		j.signing = key
+		j.algorithm = key.Algorithm
+		j.keys[key.ID] = key
+		return nil
+	}
+}
+
+//WithSecret sign the tokens with HS256, secret must be at least 32 bytes
+func WithSecret(secret []byte) Option {
+	return WithKey(&Key{ID: "default", Algorithm: HS256, Secret: secret})
+}
+
+//WithPEM sign the tokens with a RSA (RS256) or Ed25519 (EdDSA) private key
+func WithPEM(id string, data []byte) Option {
+	return func(j *JWT) error {
+		key, err := ParsePEM(id, data)
+		if err != nil {
+			return err
+		}
+		return WithKey(key)(j)
+	}
+}
+
+//WithGeneratedKey sign the tokens with a random key of algorithm, for a single
+//issuer publishing its keys. See WithRotation
+func WithGeneratedKey(algorithm string) Option {
+	return func(j *JWT) error {
+		key, err := GenerateKey(algorithm)
+		if err != nil {
+			return err
+		}
+		return WithKey(key)(j)
+	}
+}
+
+//WithVerificationKey accept the tokens signed with key, like the public key of
+//another issuer or a key being retired
+func WithVerificationKey(key *Key) Option {
+	return func(j *JWT) error {
+		if err := key.validate(); err != nil {
+			return err
+		}
+		if key.ID == "" {
+			return errors.New("key ID cannot be empty")
+		}
+		j.keys[key.ID] = key
+		return nil
+	}
+}
+
+//WithJWKS accept the tokens signed with the keys published at url. A token
+//signed with an unknown key makes the set be fetched again
+func WithJWKS(url string) Option {
+	return func(j *JWT) error {
+		if url != "" {
+			j.jwksURL = url
+			return nil
+		}
+		return errors.New("jwks url cannot be empty")
+	}
+}
+
+//WithRotation replace the signing key with a new random one every interval.
+//The old keys still verify the tokens they signed until those expire
+func WithRotation(interval time.Duration) Option {
+	return func(j *JWT) error {
+		if interval > 0 {
+			j.rotation = interval
+			return nil
+		}
+		return errors.New("rotation interval must be positive")
+	}
+}
+
+//WithIssuer set the iss claim, checked on the tokens received
+func WithIssuer(issuer string) Option {
+	return func(j *JWT) error {
+		if issuer != "" {
+			j.issuer = issuer
+			return nil
+		}
+		return errors.New("issuer cannot be empty")
+	}
+}
+
+//WithAudience set the aud claim, a token received must be for one of them
+func WithAudience(audience ...string) Option {
+	return func(j *JWT) error {
+		for _, a := range audience {
+			if a == "" {
+				return errors.New("audience cannot be empty")
+			}
+		}
+		j.audience = append(j.audience, audience...)
+		return nil
+	}
+}
+
+//WithClaim add a custom claim to every token
+func WithClaim(name string, value interface{}) Option {
+	return func(j *JWT) error {
+		if name == "" || registered[name] {
+			return fmt.Errorf("invalid claim name %q", name)
+		}
+		j.claims[name] = value
+		return nil
+	}
+}
+
+//WithClaims add the custom claims of each subject, like its groups
+func WithClaims(fn ClaimsFunc) Option {
+	return func(j *JWT) error {
+		if fn != nil {
+			j.claimsFunc = fn
+			return nil
+		}
+		return errors.New("claims func cannot be nil")
+	}
+}
+
+//WithAccessTTL set how long an access token is valid, 15 minutes by default
+func WithAccessTTL(ttl time.Duration) Option {
+	return func(j *JWT) error {
+		if ttl > 0 {
+			j.accessTTL = ttl
+			return nil
+		}
+		return errors.New("access ttl must be positive")
+	}
+}
+
+//WithRefreshTTL set how long a refresh token is valid, 7 days by default
+func WithRefreshTTL(ttl time.Duration) Option {
+	return func(j *JWT) error {
+		if ttl > 0 {
+			j.refreshTTL = ttl
+			return nil
+		}
+		return errors.New("refresh ttl must be positive")
+	}
+}
+
+//WithCache keep the revoked tokens in cache, shared by every instance of the service
+func WithCache(cache interfaces.Cache) Option {
+	return func(j *JWT) error {
+		return j.WithCache(cache)
+	}
+}
+
+//WithPrefix set the prefix of the cache keys, "jwt" by default
+func WithPrefix(prefix string) Option {
+	return func(j *JWT) error {
+		if prefix != "" {
+			j.prefix = prefix
+			return nil
+		}
+		return errors.New("prefix cannot be empty")
+	}
+}
+
+func WithLogger(logger interfaces.Logger) Option {
+	return func(j *JWT) error {
+		return j.WithLogger(logger)
+	}
+}
+
+//FromEnv configure the jwt from the EASY_JWT_* variables: SECRET, ISSUER,
+//AUDIENCE, ACCESS_TTL, REFRESH_TTL and JWKS_URL
+func FromEnv() Option {
+	return func(j *JWT) error {
+		if err := commons.EnvString("jwt", "secret", func(secret string) error {
+			return WithSecret([]byte(secret))(j)
+		}); err != nil {
+			return err
+		}
+		if err := commons.EnvString("jwt", "issuer", func(issuer string) error {
+			return WithIssuer(issuer)(j)
+		}); err != nil {
+			return err
+		}
+		if err := commons.EnvStrings("jwt", "audience", func(audience []string) error {
+			return WithAudience(audience...)(j)
+		}); err != nil {
+			return err
+		}
+		if err := commons.EnvDuration("jwt", "access_ttl", func(ttl time.Duration) error {
+			return WithAccessTTL(ttl)(j)
+		}); err != nil {
+			return err
+		}
+		if err := commons.EnvDuration("jwt", "refresh_ttl", func(ttl time.Duration) error {
+			return WithRefreshTTL(ttl)(j)
+		}); err != nil {
+			return err
+		}
+		return commons.EnvString("jwt", "jwks_url", func(url string) error {
+			return WithJWKS(url)(j)
+		})
+	}
+}
+
+func New(options ...Option) (*JWT, error) {
+	j := &JWT{
+		accessTTL:  15 * time.Minute,
+		refreshTTL: 7 * 24 * time.Hour,
+		claims:     make(map[string]interface{}),
+		keys:       make(map[string]*Key),
+		retired:    make(map[string]time.Time),
+		client:     &http.Client{Timeout: 10 * time.Second},
+		prefix:     "jwt",
+		revoked:    make(map[string]time.Time),
+		subjects:   make(map[string]time.Time),
+		now:        time.Now,
+		Logger:     logging.Logrus(logrus.New()),
+	}
+	for _, option := range options {
+		if err := option(j); err != nil {
+			return nil, err
+		}
+	}
+	if len(j.keys) == 0 && j.jwksURL == "" {
+		return nil, errors.New("a key or a jwks url is required")
+	}
+	j.rotated = j.now()
+	return j, nil
+}
+
+//HasCache tell whether the revoked tokens are shared through a cache
+func (j *JWT) HasCache() bool {
+	return j.cache != nil
+}
+
+func (j *JWT) WithCache(cache interfaces.Cache) error {
+	if cache != nil {
+		j.cache = cache
+		return nil
+	}
+	return errors.New("cache cannot be nil")
+}
+
+func (j *JWT) WithLogger(logger interfaces.Logger) error {
+	if logger != nil {
+		j.Logger = logger
+		return nil
+	}
+	return errors.New("logger cannot be nil")
+}
+
+//Rotate sign the next tokens with key. The previous signing key still verifies
+//the tokens it signed until they expire
+func (j *JWT) Rotate(key *Key) error {
+	if err := key.validate(); err != nil {
+		return err
+	}
+	if !key.CanSign() {
+		return errors.New("signing key needs its secret or private key")
+	}
+	j.Lock()
+	defer j.Unlock()
+	j.rotate(key)
+	return nil
+}
+
+//rotate replace the signing key, the caller holds the lock
+func (j *JWT) rotate(key *Key) {
+	if j.signing != nil {
+		j.retired[j.signing.ID] = j.now().Add(j.refreshTTL)
+	}
+	j.signing = key
+	j.algorithm = key.Algorithm
+	j.keys[key.ID] = key
+	j.rotated = j.now()
+	j.Info("signing key rotated", "kid", key.ID, "algorithm", key.Algorithm)
+}
+
+//JWKS return the public keys as a JWKS document, HS256 keys are never published
+func (j *JWT) JWKS() ([]byte, error) {
+	j.Lock()
+	j.retire()
+	set := KeySet{Keys: make([]JSONWebKey, 0, len(j.keys))}
+	for _, key := range j.keys {
+		if jwk, public := key.jwk(); public {
+			set.Keys = append(set.Keys, jwk)
+		}
+	}
+	j.Unlock()
+	return json.Marshal(set)
+}
+
+//retire forget the keys whose tokens all expired, the caller holds the lock
+func (j *JWT) retire() {
+	now := j.now()
+	for id, until := range j.retired {
+		if now.After(until) {
+			delete(j.keys, id)
+			delete(j.retired, id)
+		}
+	}
+}
+
+func (j *JWT) NewToken(subject string) (string, error) {
+	return j.NewTokenContext(context.Background(), subject)
+}
+
+//NewTokenContext issue an access token without refresh token
+func (j *JWT) NewTokenContext(ctx context.Context, subject string) (string, error) {
+	return j.issue(ctx, subject, access, "", j.accessTTL)
+}
+
+func (j *JWT) RefreshToken(token string) (string, error) {
+	return j.RefreshTokenContext(context.Background(), token)
+}
+
+//RefreshTokenContext trade a valid access token for a new one without refresh
+//token, the old one and its refresh token are revoked
+func (j *JWT) RefreshTokenContext(ctx context.Context, token string) (string, error) {
+	claims, err := j.verify(ctx, token, access)
+	if err != nil {
+		return "", err
+	}
+	if err := j.revoke(ctx, claims); err != nil {
+		return "", err
+	}
+	return j.NewTokenContext(ctx, claims.Subject)
+}
+
+func (j *JWT) RevokeToken(token string) error {
+	return j.RevokeTokenContext(context.Background(), token)
+}
+
+//RevokeTokenContext revoke an access or a refresh token and the other token of its pair
+func (j *JWT) RevokeTokenContext(ctx context.Context, token string) error {
+	claims, err := j.verify(ctx, token, "")
+	if err != nil {
+		return err
+	}
+	return j.revoke(ctx, claims)
+}
+
+func (j *JWT) RevokeSubject(subject string) error {
+	return j.RevokeSubjectContext(context.Background(), subject)
+}
+
+//RevokeSubjectContext revoke every token issued to subject until now. As iat
+//counts seconds, the tokens issued within the same second are revoked too
+func (j *JWT) RevokeSubjectContext(ctx context.Context, subject string) error {
+	if subject == "" {
+		return errors.New("subject cannot be empty")
+	}
+	key := j.subjectRevocation(subject)
+	now := j.now()
+	if j.cache == nil {
+		j.Lock()
+		defer j.Unlock()
+		j.subjects[key] = now
+		return nil
+	}
+	value := strconv.FormatInt(now.Unix(), 10)
+	// every token issued until now expires before its refresh token
+	if locker, ok := j.cache.(interfaces.Locker); ok {
+		if err := j.cache.DeleteContext(ctx, key); err != nil {
+			return err
+		}
+		_, err := locker.TryLock(ctx, key, value, j.refreshTTL)
+		return err
+	}
+	return j.cache.PutContext(ctx, key, value)
+}
+
+func (j *JWT) CheckToken(token string) error {
+	return j.CheckTokenContext(context.Background(), token)
+}
+
+//CheckTokenContext check that an access token is valid
+func (j *JWT) CheckTokenContext(ctx context.Context, token string) error {
+	_, err := j.verify(ctx, token, access)
+	return err
+}
+
+//SubjectContext return who a valid access token was issued to
+func (j *JWT) SubjectContext(ctx context.Context, token string) (string, error) {
+	claims, err := j.verify(ctx, token, access)
+	if err != nil {
+		return "", err
+	}
+	return claims.Subject, nil
+}
+
+//ClaimsContext return the claims of a valid access token, custom ones included
+func (j *JWT) ClaimsContext(ctx context.Context, token string) (map[string]interface{}, error) {
+	claims, err := j.verify(ctx, token, access)
+	if err != nil {
+		return nil, err
+	}
+	return claims.all, nil
+}
+
+//NewSessionContext issue an access token and its refresh token, both carry
+//the same session ID so revoking one revokes the other
+func (j *JWT) NewSessionContext(ctx context.Context, subject string) (*interfaces.Tokens, error) {
+	sid := uuid.New().String()
+	accessToken, err := j.issue(ctx, subject, access, sid, j.accessTTL)
+	if err != nil {
+		return nil, err
+	}
+	refreshToken, err := j.issue(ctx, subject, refresh, sid, j.refreshTTL)
+	if err != nil {
+		return nil, err
+	}
+	return &interfaces.Tokens{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int64(j.accessTTL / time.Second),
+	}, nil
+}
+
+//RefreshSessionContext trade a refresh token for a new pair, the old pair is
+//revoked so a refresh token can be used once
+func (j *JWT) RefreshSessionContext(ctx context.Context, token string) (*interfaces.Tokens, error) {
+	claims, err := j.verify(ctx, token, refresh)
+	if err != nil {
+		return nil, err
+	}
+	if err := j.revoke(ctx, claims); err != nil {
+		return nil, err
+	}
+	return j.NewSessionContext(ctx, claims.Subject)
+}
+
+type claims struct {
+	Subject string
+	ID      string
+	Session string
+	Type    string
+	Issued  time.Time
+	Expires time.Time
+	all     map[string]interface{}
+}
+
+func (j *JWT) issue(ctx context.Context, subject, kind, sid string, ttl time.Duration) (string, error) {
+	if subject == "" {
+		return "", errors.New("subject cannot be empty")
+	}
+	payload := make(map[string]interface{}, len(j.claims)+8)
+	for name, value := range j.claims {
+		payload[name] = value
+	}
+	if j.claimsFunc != nil {
+		custom, err := j.claimsFunc(ctx, subject)
+		if err != nil {
+			return "", err
+		}
+		for name, value := range custom {
+			if !registered[name] {
+				payload[name] = value
+			}
+		}
+	}
+	now := j.now()
+	payload["sub"] = subject
+	payload["iat"] = now.Unix()
+	payload["exp"] = now.Add(ttl).Unix()
+	payload["jti"] = uuid.New().String()
+	payload["typ"] = kind
+	if sid != "" {
+		payload["sid"] = sid
+	}
+	if j.issuer != "" {
+		payload["iss"] = j.issuer
+	}
+	if len(j.audience) == 1 {
+		payload["aud"] = j.audience[0]
+	} else if len(j.audience) > 1 {
+		payload["aud"] = j.audience
+	}
+
+	key, err := j.signingKey()
+	if err != nil {
+		return "", err
+	}
+	header, err := json.Marshal(map[string]string{"alg": key.Algorithm, "typ": "JWT", "kid": key.ID})
+	if err != nil {
+		return "", err
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return "", err
+	}
+	encode := base64.RawURLEncoding.EncodeToString
+	input := encode(header) + "." + encode(body)
+	signature, err := key.sign([]byte(input))
+	if err != nil {
+		return "", err
+	}
+	return input + "." + encode(signature), nil
+}
+
+//signingKey return the key signing the tokens, rotating it when it is due
+func (j *JWT) signingKey() (*Key, error) {
+	j.Lock()
+	defer j.Unlock()
+	if j.signing == nil {
+		return nil, errors.New("no signing key, tokens can only be verified")
+	}
+	if j.rotation > 0 && j.now().Sub(j.rotated) >= j.rotation {
+		key, err := GenerateKey(j.algorithm)
+		if err != nil {
+			return nil, err
+		}
+		j.rotate(key)
+	}
+	j.retire()
+	return j.signing, nil
+}
+
+//verify check the signature, the expiry, the issuer, the audience and the
+//revocation of token. An empty kind accepts both access and refresh tokens
+func (j *JWT) verify(ctx context.Context, token, kind string) (*claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrInvalidToken
+	}
+	decode := base64.RawURLEncoding.DecodeString
+	var header struct {
+		Algorithm string `json:"alg"`
+		KeyID     string `json:"kid"`
+	}
+	rawHeader, err := decode(parts[0])
+	if err != nil || json.Unmarshal(rawHeader, &header) != nil {
+		return nil, ErrInvalidToken
+	}
+	key, err := j.key(ctx, header.KeyID)
+	if err != nil {
+		return nil, err
+	}
+	// the algorithm is the one of the key, never the one the token claims
+	if key == nil || key.Algorithm != header.Algorithm {
+		return nil, ErrInvalidToken
+	}
+	signature, err := decode(parts[2])
+	if err != nil || !key.verify([]byte(parts[0]+"."+parts[1]), signature) {
+		return nil, ErrInvalidToken
+	}
+
+	rawPayload, err := decode(parts[1])
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	decoder := json.NewDecoder(bytes.NewReader(rawPayload))
+	decoder.UseNumber()
+	var payload map[string]interface{}
+	if err := decoder.Decode(&payload); err != nil {
+		return nil, ErrInvalidToken
+	}
+	c := &claims{all: payload}
+	c.Subject, _ = payload["sub"].(string)
+	c.ID, _ = payload["jti"].(string)
+	c.Session, _ = payload["sid"].(string)
+	c.Type, _ = payload["typ"].(string)
+	exp, ok := payload["exp"].(json.Number)
+	if !ok || c.Subject == "" || c.ID == "" {
+		return nil, ErrInvalidToken
+	}
+	seconds, err := exp.Int64()
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	c.Expires = time.Unix(seconds, 0)
+	if iat, ok := payload["iat"].(json.Number); ok {
+		if seconds, err := iat.Int64(); err == nil {
+			c.Issued = time.Unix(seconds, 0)
+		}
+	}
+	if !j.now().Before(c.Expires) {
+		return nil, ErrExpiredToken
+	}
+	if kind != "" && c.Type != kind {
+		return nil, ErrInvalidToken
+	}
+	if j.issuer != "" && payload["iss"] != j.issuer {
+		return nil, ErrInvalidToken
+	}
+	if len(j.audience) > 0 && !j.audienced(payload["aud"]) {
+		return nil, ErrInvalidToken
+	}
+	revoked, err := j.isRevoked(ctx, c)
+	if err != nil {
+		return nil, err
+	}
+	if revoked {
+		return nil, ErrInvalidToken
+	}
+	return c, nil
+}
+
+func (j *JWT) audienced(aud interface{}) bool {
+	var audience []string
+	switch a := aud.(type) {
+	case string:
+		audience = []string{a}
+	case []interface{}:
+		for _, v := range a {
+			if s, ok := v.(string); ok {
+				audience = append(audience, s)
+			}
+		}
+	}
+	for _, a := range audience {
+		for _, expected := range j.audience {
+			if a == expected {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+//key return the key with id, fetching the published keys when it is unknown
+func (j *JWT) key(ctx context.Context, id string) (*Key, error) {
+	j.Lock()
+	j.retire()
+	key, exists := j.keys[id]
+	if !exists && id == "" && j.signing != nil {
+		key, exists = j.signing, true
+	}
+	fetch := !exists && j.jwksURL != "" && j.now().Sub(j.fetched) >= jwksRefresh
+	if fetch {
+		j.fetched = j.now()
+	}
+	j.Unlock()
+	if exists || !fetch {
+		return key, nil
+	}
+	if err := j.fetch(ctx); err != nil {
+		j.Error("jwks fetch failed", "url", j.jwksURL, "error", err)
+		return nil, err
+	}
+	j.RLock()
+	defer j.RUnlock()
+	return j.keys[id], nil
+}
+
+func (j *JWT) fetch(ctx context.Context) error {
+	request, err := http.NewRequest(http.MethodGet, j.jwksURL, nil)
+	if err != nil {
+		return err
+	}
+	response, err := j.client.Do(request.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("jwks returned %s", response.Status)
+	}
+	body, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return err
+	}
+	var set KeySet
+	if err := json.Unmarshal(body, &set); err != nil {
+		return err
+	}
+	keys := make(map[string]*Key, len(set.Keys))
+	for _, jwk := range set.Keys {
+		key, err := jwk.Key()
+		if err != nil {
+			j.Warn("jwks key ignored", "kid", jwk.ID, "error", err)
+			continue
+		}
+		keys[key.ID] = key
+	}
+	j.Lock()
+	defer j.Unlock()
+	for id, key := range keys {
+		if _, exists := j.keys[id]; !exists {
+			j.keys[id] = key
+			// a published key is dropped when it is no longer published
+			j.retired[id] = j.now().Add(j.refreshTTL)
+		}
+	}
+	j.Debug("jwks fetched", "url", j.jwksURL, "keys", len(keys))
+	return nil
+}
+
+//revocation return the revocation key of the token, its session when it has one
+func (j *JWT) revocation(c *claims) string {
+	if c.Session != "" {
+		return fmt.Sprintf("%s:revoked:sid:%s", j.prefix, c.Session)
+	}
+	return fmt.Sprintf("%s:revoked:jti:%s", j.prefix, c.ID)
+}
+
+//revoke list the token until it expires; a session is listed until its
+//refresh token expires
+func (j *JWT) revoke(ctx context.Context, c *claims) error {
+	key := j.revocation(c)
+	until := c.Expires
+	if c.Session != "" && c.Type == access {
+		until = j.now().Add(j.refreshTTL)
+	}
+	if j.cache == nil {
+		j.Lock()
+		defer j.Unlock()
+		j.revoked[key] = until
+		return nil
+	}
+	// a cache able to expire its keys forgets the entry with the token
+	if locker, ok := j.cache.(interfaces.Locker); ok {
+		_, err := locker.TryLock(ctx, key, c.Subject, until.Sub(j.now()))
+		return err
+	}
+	return j.cache.PutContext(ctx, key, until.Unix())
+}
+
+func (j *JWT) subjectRevocation(subject string) string {
+	return fmt.Sprintf("%s:revoked:sub:%s", j.prefix, subject)
+}
+
+func (j *JWT) isRevoked(ctx context.Context, c *claims) (bool, error) {
+	key := j.revocation(c)
+	if j.cache == nil {
+		j.Lock()
+		defer j.Unlock()
+		now := j.now()
+		for k, until := range j.revoked {
+			if now.After(until) {
+				delete(j.revoked, k)
+			}
+		}
+		for k, since := range j.subjects {
+			if now.After(since.Add(j.refreshTTL)) {
+				delete(j.subjects, k)
+			}
+		}
+		_, revoked := j.revoked[key]
+		since, exists := j.subjects[j.subjectRevocation(c.Subject)]
+		return revoked || exists && c.Issued.Unix() <= since.Unix(), nil
+	}
+	revoked, err := j.cache.ExistsContext(ctx, key)
+	if err != nil || revoked {
+		return revoked, err
+	}
+	return j.isSubjectRevoked(ctx, c)
+}
+
+//isSubjectRevoked tell whether the token was issued before its subject was revoked
+func (j *JWT) isSubjectRevoked(ctx context.Context, c *claims) (bool, error) {
+	key := j.subjectRevocation(c.Subject)
+	v, err := j.cache.TakeContext(ctx, key)
+	if err != nil {
+		// a missing key is an error for the caches, tell it from a failure
+		if exists, e := j.cache.ExistsContext(ctx, key); e == nil && !exists {
+			return false, nil
+		}
+		return false, err
+	}
+	value := fmt.Sprint(v)
+	if b, ok := v.([]byte); ok {
+		value = string(b)
+	}
+	since, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return false, err
+	}
+	return c.Issued.Unix() <= since, nil
+}
+
+func init() {
+	factory.Register(factory.AuthZ, "jwt", func(settings interfaces.Configuration) (interface{}, error) {
+		options := make([]Option, 0)
+		if secret := settings.GetStringOrDefault("secret", ""); secret != "" {
+			options = append(options, WithSecret([]byte(secret)))
+		}
+		if file := settings.GetStringOrDefault("key_file", ""); file != "" {
+			data, err := ioutil.ReadFile(file)
+			if err != nil {
+				return nil, err
+			}
+			options = append(options, WithPEM(settings.GetStringOrDefault("key_id", "default"), data))
+		}
+		if algorithm := settings.GetStringOrDefault("generate", ""); algorithm != "" {
+			options = append(options, WithGeneratedKey(algorithm))
+		}
+		if rotation := settings.GetDurationOrDefault("rotation", 0); rotation > 0 {
+			options = append(options, WithRotation(rotation))
+		}
+		if url := settings.GetStringOrDefault("jwks_url", ""); url != "" {
+			options = append(options, WithJWKS(url))
+		}
+		if issuer := settings.GetStringOrDefault("issuer", ""); issuer != "" {
+			options = append(options, WithIssuer(issuer))
+		}
+		if audience := settings.GetArrayOfStringsOrDefault("audience", nil); len(audience) > 0 {
+			options = append(options, WithAudience(audience...))
+		}
+		if ttl := settings.GetDurationOrDefault("access_ttl", 0); ttl > 0 {
+			options = append(options, WithAccessTTL(ttl))
+		}
+		if ttl := settings.GetDurationOrDefault("refresh_ttl", 0); ttl > 0 {
+			options = append(options, WithRefreshTTL(ttl))
+		}
+		return New(append(options, FromEnv())...)
+	})
+}
@@ -0,0 +1,293 @@
+package jwt
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/advancedlogic/easy/interfaces"
+	"github.com/advancedlogic/easy/logging"
+	"github.com/stretchr/testify/assert"
+)
+
+var secret = []byte("0123456789abcdef0123456789abcdef")
+
+// cache is the part of a cache able to expire its keys used for revocations
+type cache struct {
+	interfaces.Cache
+	sync.Mutex
+	keys   map[string]time.Time
+	owners map[string]string
+}
+
+func (c *cache) TryLock(ctx context.Context, key, owner string, ttl time.Duration) (bool, error) {
+	c.Lock()
+	defer c.Unlock()
+	if _, exists := c.keys[key]; exists {
+		return false, nil
+	}
+	c.keys[key] = time.Now().Add(ttl)
+	c.owners[key] = owner
+	return true, nil
+}
+
+func (c *cache) TakeContext(ctx context.Context, key string) (interface{}, error) {
+	c.Lock()
+	defer c.Unlock()
+	if _, exists := c.keys[key]; !exists {
+		return nil, errors.New("not found")
+	}
+	return c.owners[key], nil
+}
+
+func (c *cache) DeleteContext(ctx context.Context, keys ...string) error {
+	c.Lock()
+	defer c.Unlock()
+	for _, key := range keys {
+		delete(c.keys, key)
+		delete(c.owners, key)
+	}
+	return nil
+}
+
+func (c *cache) ExistsContext(ctx context.Context, keys ...string) (bool, error) {
+	c.Lock()
+	defer c.Unlock()
+	for _, key := range keys {
+		if _, exists := c.keys[key]; exists {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func TestJWT(t *testing.T) {
+	_, err := New()
+	assert.NotNil(t, err)
+	_, err = New(WithSecret([]byte("short")))
+	assert.NotNil(t, err)
+	_, err = New(WithSecret(secret), WithClaim("sub", "bob"))
+	assert.NotNil(t, err)
+
+	for _, algorithm := range []string{HS256, RS256, EdDSA} {
+		j, err := New(WithGeneratedKey(algorithm), WithIssuer("easy"), WithAudience("orders"),
+			WithClaim("tenant", "acme"), WithLogger(logging.Discard()),
+			WithClaims(func(ctx context.Context, subject string) (map[string]interface{}, error) {
+				return map[string]interface{}{"groups": []string{"admin"}, "exp": 0}, nil
+			}))
+		assert.Nil(t, err, algorithm)
+
+		token, err := j.NewToken("ada")
+		assert.Nil(t, err, algorithm)
+		header, _ := base64.RawURLEncoding.DecodeString(strings.Split(token, ".")[0])
+		assert.Contains(t, string(header), `"alg":"`+algorithm+`"`)
+		assert.Nil(t, j.CheckToken(token), algorithm)
+		claims, err := j.ClaimsContext(context.Background(), token)
+		assert.Nil(t, err)
+		assert.Equal(t, "acme", claims["tenant"])
+		assert.Equal(t, []interface{}{"admin"}, claims["groups"])
+		assert.Equal(t, "orders", claims["aud"])
+
+		// a tampered payload breaks the signature
+		parts := strings.Split(token, ".")
+		payload, _ := base64.RawURLEncoding.DecodeString(parts[1])
+		parts[1] = base64.RawURLEncoding.EncodeToString([]byte(strings.Replace(string(payload), "ada", "bob", 1)))
+		assert.Equal(t, ErrInvalidToken, j.CheckToken(strings.Join(parts, ".")), algorithm)
+	}
+
+	// tokens of another issuer or audience are refused
+	j, _ := New(WithSecret(secret), WithIssuer("easy"), WithAudience("orders"))
+	other, _ := New(WithSecret(secret), WithIssuer("other"), WithAudience("orders"))
+	token, _ := other.NewToken("ada")
+	assert.Equal(t, ErrInvalidToken, j.CheckToken(token))
+	other, _ = New(WithSecret(secret), WithIssuer("easy"), WithAudience("billing", "orders"))
+	token, _ = other.NewToken("ada")
+	assert.Nil(t, j.CheckToken(token))
+	assert.Equal(t, ErrInvalidToken, j.CheckToken("not.a.token"))
+}
+
+func TestJWT_AlgorithmConfusion(t *testing.T) {
+	key, err := GenerateKey(RS256)
+	assert.Nil(t, err)
+	j, _ := New(WithKey(key))
+	// a HS256 token signed with the public key must not verify
+	public, _ := json.Marshal(key.Public)
+	forged, err := New(WithKey(&Key{ID: key.ID, Algorithm: HS256, Secret: append(public, secret...)}))
+	assert.Nil(t, err)
+	token, _ := forged.NewToken("ada")
+	assert.Equal(t, ErrInvalidToken, j.CheckToken(token))
+}
+
+func TestJWT_Sessions(t *testing.T) {
+	c := &cache{keys: make(map[string]time.Time), owners: make(map[string]string)}
+	j, _ := New(WithSecret(secret), WithCache(c))
+	replica, _ := New(WithSecret(secret), WithCache(c))
+	assert.True(t, j.HasCache())
+
+	tokens, err := j.NewSessionContext(context.Background(), "ada")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(900), tokens.ExpiresIn)
+	assert.Equal(t, ErrInvalidToken, j.CheckToken(tokens.RefreshToken))
+	subject, err := replica.SubjectContext(context.Background(), tokens.AccessToken)
+	assert.Nil(t, err)
+	assert.Equal(t, "ada", subject)
+
+	// a refresh token is used once, the old pair is revoked on every replica
+	refreshed, err := j.RefreshSessionContext(context.Background(), tokens.RefreshToken)
+	assert.Nil(t, err)
+	assert.Equal(t, ErrInvalidToken, replica.CheckToken(tokens.AccessToken))
+	_, err = replica.RefreshSessionContext(context.Background(), tokens.RefreshToken)
+	assert.Equal(t, ErrInvalidToken, err)
+
+	assert.Nil(t, replica.RevokeToken(refreshed.AccessToken))
+	_, err = j.RefreshSessionContext(context.Background(), refreshed.RefreshToken)
+	assert.Equal(t, ErrInvalidToken, err)
+
+	// without cache the revocations stay on the instance
+	local, _ := New(WithSecret(secret))
+	token, _ := local.NewToken("ada")
+	next, err := local.RefreshToken(token)
+	assert.Nil(t, err)
+	assert.Equal(t, ErrInvalidToken, local.CheckToken(token))
+	assert.Nil(t, local.CheckToken(next))
+}
+
+func TestJWT_RevokeSubject(t *testing.T) {
+	now := time.Now()
+	c := &cache{keys: make(map[string]time.Time), owners: make(map[string]string)}
+	shared, _ := New(WithSecret(secret), WithCache(c))
+	local, _ := New(WithSecret(secret))
+	for _, j := range []*JWT{shared, local} {
+		j.now = func() time.Time { return now }
+		tokens, err := j.NewSessionContext(context.Background(), "ada")
+		assert.Nil(t, err)
+		other, _ := j.NewToken("bob")
+		assert.NotNil(t, j.RevokeSubject(""))
+		assert.Nil(t, j.RevokeSubject("ada"))
+		assert.Equal(t, ErrInvalidToken, j.CheckToken(tokens.AccessToken))
+		_, err = j.RefreshSessionContext(context.Background(), tokens.RefreshToken)
+		assert.Equal(t, ErrInvalidToken, err)
+		assert.Nil(t, j.CheckToken(other))
+
+		// the tokens issued after the revocation are valid, a second one moves it
+		now = now.Add(time.Second)
+		token, _ := j.NewToken("ada")
+		assert.Nil(t, j.CheckToken(token))
+		now = now.Add(time.Second)
+		assert.Nil(t, j.RevokeSubject("ada"))
+		assert.Equal(t, ErrInvalidToken, j.CheckToken(token))
+	}
+}
+
+func TestJWT_Expiry(t *testing.T) {
+	now := time.Now()
+	j, _ := New(WithSecret(secret), WithAccessTTL(time.Minute))
+	j.now = func() time.Time { return now }
+	token, _ := j.NewToken("ada")
+	now = now.Add(time.Minute)
+	assert.Equal(t, ErrExpiredToken, j.CheckToken(token))
+}
+
+func TestJWT_Rotation(t *testing.T) {
+	now := time.Now()
+	j, _ := New(WithGeneratedKey(EdDSA), WithRotation(time.Hour), WithRefreshTTL(2*time.Hour),
+		WithLogger(logging.Discard()))
+	j.now = func() time.Time { return now }
+	j.rotated = now
+	first, _ := j.NewToken("ada")
+
+	now = now.Add(time.Hour)
+	second, _ := j.NewToken("ada")
+	assert.NotEqual(t, kid(first), kid(second))
+	assert.Nil(t, j.CheckToken(second))
+	var set KeySet
+	jwks, err := j.JWKS()
+	assert.Nil(t, err)
+	assert.Nil(t, json.Unmarshal(jwks, &set))
+	assert.Equal(t, 2, len(set.Keys))
+
+	// the old key is dropped once its tokens expired
+	now = now.Add(2*time.Hour + time.Second)
+	jwks, _ = j.JWKS()
+	assert.Nil(t, json.Unmarshal(jwks, &set))
+	assert.Equal(t, 1, len(set.Keys))
+	assert.Equal(t, kid(second), set.Keys[0].ID)
+
+	// HS256 secrets are never published
+	h, _ := New(WithSecret(secret))
+	jwks, _ = h.JWKS()
+	assert.Equal(t, `{"keys":[]}`, string(jwks))
+}
+
+func TestJWT_JWKS(t *testing.T) {
+	issuer, _ := New(WithGeneratedKey(RS256), WithLogger(logging.Discard()))
+	fetches := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches++
+		jwks, _ := issuer.JWKS()
+		w.Write(jwks)
+	}))
+	defer server.Close()
+
+	verifier, err := New(WithJWKS(server.URL), WithLogger(logging.Discard()))
+	assert.Nil(t, err)
+	token, _ := issuer.NewToken("ada")
+	assert.Nil(t, verifier.CheckToken(token))
+	_, err = verifier.NewToken("ada")
+	assert.NotNil(t, err)
+
+	// an unknown key is fetched again, at most once per minute
+	assert.Nil(t, issuer.Rotate(mustKey(t, EdDSA)))
+	token, _ = issuer.NewToken("ada")
+	assert.Equal(t, ErrInvalidToken, verifier.CheckToken(token))
+	verifier.fetched = time.Time{}
+	assert.Nil(t, verifier.CheckToken(token))
+	assert.Equal(t, 2, fetches)
+}
+
+func TestParsePEM(t *testing.T) {
+	_, private, _ := ed25519.GenerateKey(rand.Reader)
+	der, err := x509.MarshalPKCS8PrivateKey(private)
+	assert.Nil(t, err)
+	key, err := ParsePEM("ed", pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}))
+	assert.Nil(t, err)
+	assert.Equal(t, EdDSA, key.Algorithm)
+	assert.True(t, key.CanSign())
+
+	der, _ = x509.MarshalPKIXPublicKey(private.Public())
+	public, err := ParsePEM("ed", pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+	assert.Nil(t, err)
+	assert.False(t, public.CanSign())
+	_, err = New(WithKey(public))
+	assert.NotNil(t, err)
+	_, err = ParsePEM("ed", []byte("garbage"))
+	assert.NotNil(t, err)
+}
+
+func kid(token string) string {
+	header, _ := base64.RawURLEncoding.DecodeString(strings.Split(token, ".")[0])
+	var h struct {
+		KeyID string `json:"kid"`
+	}
+	json.Unmarshal(header, &h)
+	return h.KeyID
+}
+
+func mustKey(t *testing.T, algorithm string) *Key {
+	key, err := GenerateKey(algorithm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
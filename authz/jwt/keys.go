@@ -0,0 +1,232 @@
+package jwt
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/google/uuid"
+)
+
+// Algorithms supported for signing the tokens
+const (
+	HS256 = "HS256"
+	RS256 = "RS256"
+	EdDSA = "EdDSA"
+)
+
+//Key sign or verify tokens. A HS256 key has a Secret; a RS256 or EdDSA key
+//has a Private key to sign and a Public key to verify
+type Key struct {
+	ID        string
+	Algorithm string
+	Secret    []byte
+	Private   crypto.Signer
+	Public    crypto.PublicKey
+}
+
+//GenerateKey create a random key for algorithm, with a random ID
+func GenerateKey(algorithm string) (*Key, error) {
+	key := &Key{ID: uuid.New().String(), Algorithm: algorithm}
+	switch algorithm {
+	case HS256:
+		key.Secret = make([]byte, 32)
+		if _, err := rand.Read(key.Secret); err != nil {
+			return nil, err
+		}
+	case RS256:
+		private, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			return nil, err
+		}
+		key.Private, key.Public = private, &private.PublicKey
+	case EdDSA:
+		public, private, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		key.Private, key.Public = private, public
+	default:
+		return nil, fmt.Errorf("unknown algorithm %s", algorithm)
+	}
+	return key, nil
+}
+
+//ParsePEM read a PKCS#1 or PKCS#8 private key, or a PKIX public key. The
+//algorithm is RS256 for a RSA key and EdDSA for an Ed25519 key
+func ParsePEM(id string, data []byte) (*Key, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+	var parsed interface{}
+	var err error
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		parsed, err = x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unsupported PEM block %s", block.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+	key := &Key{ID: id}
+	switch k := parsed.(type) {
+	case *rsa.PrivateKey:
+		key.Algorithm, key.Private, key.Public = RS256, k, &k.PublicKey
+	case *rsa.PublicKey:
+		key.Algorithm, key.Public = RS256, k
+	case ed25519.PrivateKey:
+		key.Algorithm, key.Private, key.Public = EdDSA, k, k.Public()
+	case ed25519.PublicKey:
+		key.Algorithm, key.Public = EdDSA, k
+	default:
+		return nil, fmt.Errorf("unsupported key %T", parsed)
+	}
+	return key, nil
+}
+
+//CanSign tell whether the key has its secret or private part
+func (k *Key) CanSign() bool {
+	return len(k.Secret) > 0 || k.Private != nil
+}
+
+func (k *Key) validate() error {
+	if k == nil {
+		return errors.New("key cannot be nil")
+	}
+	switch k.Algorithm {
+	case HS256:
+		if len(k.Secret) < 32 {
+			return errors.New("HS256 secret must be at least 32 bytes")
+		}
+		return nil
+	case RS256:
+		if _, ok := k.Public.(*rsa.PublicKey); !ok {
+			return errors.New("RS256 key needs a RSA public key")
+		}
+		return nil
+	case EdDSA:
+		if _, ok := k.Public.(ed25519.PublicKey); !ok {
+			return errors.New("EdDSA key needs an Ed25519 public key")
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown algorithm %s", k.Algorithm)
+}
+
+func (k *Key) sign(input []byte) ([]byte, error) {
+	switch k.Algorithm {
+	case HS256:
+		mac := hmac.New(sha256.New, k.Secret)
+		mac.Write(input)
+		return mac.Sum(nil), nil
+	case RS256:
+		sum := sha256.Sum256(input)
+		return k.Private.Sign(rand.Reader, sum[:], crypto.SHA256)
+	case EdDSA:
+		return k.Private.Sign(rand.Reader, input, crypto.Hash(0))
+	}
+	return nil, fmt.Errorf("unknown algorithm %s", k.Algorithm)
+}
+
+func (k *Key) verify(input, signature []byte) bool {
+	switch k.Algorithm {
+	case HS256:
+		mac := hmac.New(sha256.New, k.Secret)
+		mac.Write(input)
+		return hmac.Equal(signature, mac.Sum(nil))
+	case RS256:
+		sum := sha256.Sum256(input)
+		return rsa.VerifyPKCS1v15(k.Public.(*rsa.PublicKey), crypto.SHA256, sum[:], signature) == nil
+	case EdDSA:
+		return ed25519.Verify(k.Public.(ed25519.PublicKey), input, signature)
+	}
+	return false
+}
+
+//JSONWebKey is the public part of a key as published in a JWKS
+type JSONWebKey struct {
+	KeyType   string `json:"kty"`
+	ID        string `json:"kid"`
+	Algorithm string `json:"alg"`
+	Use       string `json:"use"`
+	N         string `json:"n,omitempty"`
+	E         string `json:"e,omitempty"`
+	Curve     string `json:"crv,omitempty"`
+	X         string `json:"x,omitempty"`
+}
+
+//KeySet is a JWKS document
+type KeySet struct {
+	Keys []JSONWebKey `json:"keys"`
+}
+
+//jwk return the public part of the key, false for a HS256 key which has none
+func (k *Key) jwk() (JSONWebKey, bool) {
+	encode := base64.RawURLEncoding.EncodeToString
+	jwk := JSONWebKey{ID: k.ID, Algorithm: k.Algorithm, Use: "sig"}
+	switch public := k.Public.(type) {
+	case *rsa.PublicKey:
+		jwk.KeyType = "RSA"
+		jwk.N = encode(public.N.Bytes())
+		jwk.E = encode(big.NewInt(int64(public.E)).Bytes())
+		return jwk, true
+	case ed25519.PublicKey:
+		jwk.KeyType, jwk.Curve, jwk.X = "OKP", "Ed25519", encode(public)
+		return jwk, true
+	}
+	return jwk, false
+}
+
+//Key return the verification key of a published key
+func (j JSONWebKey) Key() (*Key, error) {
+	decode := base64.RawURLEncoding.DecodeString
+	key := &Key{ID: j.ID, Algorithm: j.Algorithm}
+	switch j.KeyType {
+	case "RSA":
+		n, err := decode(j.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decode(j.E)
+		if err != nil {
+			return nil, err
+		}
+		key.Public = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+		if key.Algorithm == "" {
+			key.Algorithm = RS256
+		}
+	case "OKP":
+		if j.Curve != "Ed25519" {
+			return nil, fmt.Errorf("unsupported curve %s", j.Curve)
+		}
+		x, err := decode(j.X)
+		if err != nil {
+			return nil, err
+		}
+		if len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid Ed25519 key")
+		}
+		key.Public = ed25519.PublicKey(x)
+		if key.Algorithm == "" {
+			key.Algorithm = EdDSA
+		}
+	default:
+		return nil, fmt.Errorf("unsupported key type %s", j.KeyType)
+	}
+	return key, key.validate()
+}
@@ -0,0 +1,227 @@
+// Package rbac grant permissions to groups. The policy is read from the
+// configuration, below the "policy" key by default:
+//
+//	policy:
+//	  admin: ["*"]                       # every permission
+//	  support: [orders:read, users:read]
+//	  billing: ["invoices:*"]            # every permission starting with invoices:
+//
+// The policy is reloaded when a configuration implementing
+// interfaces.ConfigurationWatcher changes
+package rbac
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/advancedlogic/easy/interfaces"
+)
+
+type Option func(*Policy) error
+
+// Policy map groups to permissions
+type Policy struct {
+	sync.RWMutex
+	key       string
+	defaults  map[string][]string
+	groups    map[string][]string
+	listeners []func()
+}
+
+//WithKey set the configuration key holding the policy, "policy" by default
+func WithKey(key string) Option {
+	return func(p *Policy) error {
+		if key != "" {
+			p.key = strings.ToLower(key)
+			return nil
+		}
+		return errors.New("key cannot be empty")
+	}
+}
+
+//WithGroup grant permissions to group until the configuration defines the group
+func WithGroup(group string, permissions ...string) Option {
+	return func(p *Policy) error {
+		if group == "" {
+			return errors.New("group cannot be empty")
+		}
+		group = strings.ToLower(group)
+		p.defaults[group] = permissions
+		p.groups[group] = permissions
+		return nil
+	}
+}
+
+func New(options ...Option) (*Policy, error) {
+	p := &Policy{
+		key:      "policy",
+		defaults: make(map[string][]string),
+		groups:   make(map[string][]string),
+	}
+	for _, option := range options {
+		if err := option(p); err != nil {
+			return nil, err
+		}
+	}
+	return p, nil
+}
+
+//Watch load the policy from configuration and, when it is an
+//interfaces.ConfigurationWatcher, reload it every time it changes
+func (p *Policy) Watch(configuration interfaces.Configuration) error {
+	if configuration == nil {
+		return errors.New("configuration cannot be nil")
+	}
+	if err := p.Load(configuration); err != nil {
+		return err
+	}
+	if watcher, ok := configuration.(interfaces.ConfigurationWatcher); ok {
+		watcher.OnChange(func() {
+			// a broken edit keep the previous policy
+			_ = p.Load(configuration)
+		})
+	}
+	return nil
+}
+
+//Load replace the policy with the one of configuration and notify the
+//OnChange listeners
+func (p *Policy) Load(configuration interfaces.Configuration) error {
+	groups := make(map[string][]string, len(p.defaults))
+	for group, permissions := range p.defaults {
+		groups[group] = permissions
+	}
+	if settings, exists := lookup(configuration.AllSettings(), p.key); exists {
+		definitions, ok := toMap(settings)
+		if !ok {
+			return fmt.Errorf("%s must map groups to permissions", p.key)
+		}
+		for group, definition := range definitions {
+			permissions, err := toStrings(definition)
+			if err != nil {
+				return fmt.Errorf("group %s: %s", group, err)
+			}
+			groups[strings.ToLower(group)] = permissions
+		}
+	}
+	p.Lock()
+	p.groups = groups
+	listeners := append([]func(){}, p.listeners...)
+	p.Unlock()
+	for _, listener := range listeners {
+		listener()
+	}
+	return nil
+}
+
+//OnChange call fn every time the policy is loaded
+func (p *Policy) OnChange(fn func()) {
+	p.Lock()
+	defer p.Unlock()
+	p.listeners = append(p.listeners, fn)
+}
+
+//Permissions return the sorted permissions granted to any of groups
+func (p *Policy) Permissions(groups []string) []string {
+	p.RLock()
+	defer p.RUnlock()
+	unique := make(map[string]bool)
+	for _, group := range groups {
+		for _, permission := range p.groups[strings.ToLower(group)] {
+			unique[permission] = true
+		}
+	}
+	permissions := make([]string, 0, len(unique))
+	for permission := range unique {
+		permissions = append(permissions, permission)
+	}
+	sort.Strings(permissions)
+	return permissions
+}
+
+//Allowed tell whether one of groups is granted permission
+func (p *Policy) Allowed(groups []string, permission string) bool {
+	for _, granted := range p.Permissions(groups) {
+		if Match(granted, permission) {
+			return true
+		}
+	}
+	return false
+}
+
+//Groups return the policy, groups to permissions
+func (p *Policy) Groups() map[string][]string {
+	p.RLock()
+	defer p.RUnlock()
+	groups := make(map[string][]string, len(p.groups))
+	for group, permissions := range p.groups {
+		groups[group] = append([]string{}, permissions...)
+	}
+	return groups
+}
+
+//Match tell whether a granted permission covers permission: "*" covers
+//everything and "orders:*" every permission starting with "orders:"
+func Match(granted, permission string) bool {
+	if strings.HasSuffix(granted, "*") {
+		return strings.HasPrefix(permission, strings.TrimSuffix(granted, "*"))
+	}
+	return granted == permission
+}
+
+func lookup(settings map[string]interface{}, key string) (interface{}, bool) {
+	var value interface{} = settings
+	for _, part := range strings.Split(key, ".") {
+		m, ok := toMap(value)
+		if !ok {
+			return nil, false
+		}
+		if value, ok = m[part]; !ok {
+			return nil, false
+		}
+	}
+	return value, true
+}
+
+func toMap(value interface{}) (map[string]interface{}, bool) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		return v, true
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for key, value := range v {
+			m[fmt.Sprint(key)] = value
+		}
+		return m, true
+	}
+	return nil, false
+}
+
+func toStrings(value interface{}) ([]string, error) {
+	switch v := value.(type) {
+	case []string:
+		return v, nil
+	case string:
+		values := make([]string, 0)
+		for _, s := range strings.Split(v, ",") {
+			if s = strings.TrimSpace(s); s != "" {
+				values = append(values, s)
+			}
+		}
+		return values, nil
+	case []interface{}:
+		values := make([]string, 0, len(v))
+		for _, item := range v {
+			s, ok := item.(string)
+			if !ok {
+				return nil, fmt.Errorf("%v is not a permission", item)
+			}
+			values = append(values, s)
+		}
+		return values, nil
+	}
+	return nil, fmt.Errorf("%v is not a list of permissions", value)
+}
@@ -0,0 +1,66 @@
+package rbac
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/advancedlogic/easy/interfaces"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+type configuration struct {
+	interfaces.Configuration
+	settings  map[string]interface{}
+	listeners []func()
+}
+
+func (c *configuration) AllSettings() map[string]interface{} {
+	return c.settings
+}
+
+func (c *configuration) OnChange(fn func()) {
+	c.listeners = append(c.listeners, fn)
+}
+
+func TestPolicy(t *testing.T) {
+	_, err := New(WithGroup(""))
+	assert.NotNil(t, err)
+	p, err := New(WithGroup("Admin", "*"))
+	assert.Nil(t, err)
+
+	v := viper.New()
+	v.SetConfigType("yaml")
+	assert.Nil(t, v.ReadConfig(strings.NewReader(`
+policy:
+  support: [orders:read, users:read]
+  billing: "invoices:*, reports:read"
+`)))
+	c := &configuration{settings: v.AllSettings()}
+	loads := 0
+	p.OnChange(func() { loads++ })
+	assert.Nil(t, p.Watch(c))
+	assert.Equal(t, 1, loads)
+
+	assert.True(t, p.Allowed([]string{"admin"}, "orders:delete"))
+	assert.True(t, p.Allowed([]string{"user", "support"}, "orders:read"))
+	assert.False(t, p.Allowed([]string{"support"}, "orders:delete"))
+	assert.True(t, p.Allowed([]string{"billing"}, "invoices:create"))
+	assert.False(t, p.Allowed([]string{"billing"}, "invoice"))
+	assert.False(t, p.Allowed(nil, "orders:read"))
+	assert.Equal(t, []string{"invoices:*", "orders:read", "reports:read", "users:read"},
+		p.Permissions([]string{"support", "billing"}))
+
+	// a reload replace the policy, a broken one keep the previous
+	c.settings = map[string]interface{}{"policy": map[string]interface{}{"support": []interface{}{"orders:*"}}}
+	c.listeners[0]()
+	assert.Equal(t, 2, loads)
+	assert.True(t, p.Allowed([]string{"support"}, "orders:delete"))
+	assert.False(t, p.Allowed([]string{"billing"}, "invoices:create"))
+	c.settings = map[string]interface{}{"policy": map[string]interface{}{"support": 42}}
+	c.listeners[0]()
+	assert.True(t, p.Allowed([]string{"support"}, "orders:delete"))
+	assert.Equal(t, 2, len(p.Groups()))
+
+	assert.NotNil(t, p.Watch(nil))
+}
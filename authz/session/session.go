@@ -0,0 +1,504 @@
+// Package session implement interfaces.AuthZ with opaque tokens. A token is a
+// random string, only its hash is kept: in the cache of the service, so every
+// instance can check it, or in memory without one. Logging in issues an
+// access token and a refresh token, revoking either ends the session
+package session
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/advancedlogic/easy/factory"
+	"github.com/advancedlogic/easy/interfaces"
+)
+
+var (
+	//ErrInvalidToken is returned for a token that was never issued or was revoked
+	ErrInvalidToken = errors.New("invalid token")
+	//ErrExpiredToken is returned for a token past its expiry
+	ErrExpiredToken = errors.New("token expired")
+)
+
+const (
+	access  = "access"
+	refresh = "refresh"
+)
+
+type Option func(*Session) error
+
+type record struct {
+	Subject string    `json:"subject"`
+	Kind    string    `json:"kind"`
+	Pair    string    `json:"pair,omitempty"`
+	Issued  time.Time `json:"issued"`
+	Expires time.Time `json:"expires"`
+}
+
+// entry is a record kept in memory without cache, forgotten once expired
+type entry struct {
+	value   string
+	expires time.Time
+}
+
+// Session issue and check opaque tokens
+type Session struct {
+	sync.Mutex
+	cache      interfaces.Cache
+	memory     map[string]entry
+	purged     time.Time
+	prefix     string
+	accessTTL  time.Duration
+	refreshTTL time.Duration
+}
+
+// WithCache keep the tokens in cache, shared by every instance of the service
+func WithCache(cache interfaces.Cache) Option {
+	return func(s *Session) error {
+		return s.WithCache(cache)
+	}
+}
+
+// WithPrefix set the prefix of the cache keys, "session" by default
+func WithPrefix(prefix string) Option {
+	return func(s *Session) error {
+		if prefix != "" {
+			s.prefix = prefix
+			return nil
+		}
+		return errors.New("prefix cannot be empty")
+	}
+}
+
+// WithAccessTTL set how long an access token is valid, 15 minutes by default
+func WithAccessTTL(ttl time.Duration) Option {
+	return func(s *Session) error {
+		if ttl > 0 {
+			s.accessTTL = ttl
+			return nil
+		}
+		return errors.New("access ttl must be positive")
+	}
+}
+
+// WithRefreshTTL set how long a refresh token is valid, 7 days by default
+func WithRefreshTTL(ttl time.Duration) Option {
+	return func(s *Session) error {
+		if ttl > 0 {
+			s.refreshTTL = ttl
+			return nil
+		}
+		return errors.New("refresh ttl must be positive")
+	}
+}
+
+func New(options ...Option) (*Session, error) {
+	s := &Session{
+		memory:     make(map[string]entry),
+		prefix:     "session",
+		accessTTL:  15 * time.Minute,
+		refreshTTL: 7 * 24 * time.Hour,
+	}
+	for _, option := range options {
+		if err := option(s); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// HasCache tell whether the tokens are shared through a cache
+func (s *Session) HasCache() bool {
+	return s.cache != nil
+}
+
+func (s *Session) WithCache(cache interfaces.Cache) error {
+	if cache != nil {
+		s.cache = cache
+		return nil
+	}
+	return errors.New("cache cannot be nil")
+}
+
+func (s *Session) NewToken(subject string) (string, error) {
+	return s.NewTokenContext(context.Background(), subject)
+}
+
+// NewTokenContext issue an access token without refresh token
+func (s *Session) NewTokenContext(ctx context.Context, subject string) (string, error) {
+	if subject == "" {
+		return "", errors.New("subject cannot be empty")
+	}
+	now := time.Now()
+	token, _, err := s.issue(ctx, record{Subject: subject, Kind: access, Issued: now, Expires: now.Add(s.accessTTL)})
+	return token, err
+}
+
+func (s *Session) RefreshToken(token string) (string, error) {
+	return s.RefreshTokenContext(context.Background(), token)
+}
+
+// RefreshTokenContext trade a valid access token for a new one without refresh
+// token, the old one and its refresh token are revoked
+func (s *Session) RefreshTokenContext(ctx context.Context, token string) (string, error) {
+	hash, r, err := s.check(ctx, token, access)
+	if err != nil {
+		return "", err
+	}
+	if claimed, err := s.claim(ctx, hash, r); err != nil || !claimed {
+		return "", claimError(err)
+	}
+	if err := s.delete(ctx, hash, r.Pair); err != nil {
+		return "", err
+	}
+	return s.NewTokenContext(ctx, r.Subject)
+}
+
+func (s *Session) RevokeToken(token string) error {
+	return s.RevokeTokenContext(context.Background(), token)
+}
+
+// RevokeTokenContext revoke an access or a refresh token and the other token of its pair
+func (s *Session) RevokeTokenContext(ctx context.Context, token string) error {
+	hash := digest(token)
+	r, err := s.load(ctx, hash)
+	if err != nil {
+		return err
+	}
+	return s.delete(ctx, hash, r.Pair)
+}
+
+func (s *Session) RevokeSubject(subject string) error {
+	return s.RevokeSubjectContext(context.Background(), subject)
+}
+
+// RevokeSubjectContext revoke every token issued to subject until now
+func (s *Session) RevokeSubjectContext(ctx context.Context, subject string) error {
+	if subject == "" {
+		return errors.New("subject cannot be empty")
+	}
+	value := strconv.FormatInt(time.Now().UnixNano(), 10)
+	if s.cache != nil {
+		key := s.subjectKey(subject)
+		// every token issued until now expires before its refresh token
+		if locker, ok := s.cache.(interfaces.Locker); ok {
+			if err := s.cache.DeleteContext(ctx, key); err != nil {
+				return err
+			}
+			// a revocation written in between is as recent as this one
+			_, err := locker.TryLock(ctx, key, value, s.refreshTTL)
+			return err
+		}
+		return s.cache.PutContext(ctx, key, value)
+	}
+	s.Lock()
+	defer s.Unlock()
+	s.memory[s.subjectKey(subject)] = entry{value: value, expires: time.Now().Add(s.refreshTTL)}
+	return nil
+}
+
+func (s *Session) CheckToken(token string) error {
+	return s.CheckTokenContext(context.Background(), token)
+}
+
+// CheckTokenContext check that an access token is valid
+func (s *Session) CheckTokenContext(ctx context.Context, token string) error {
+	_, _, err := s.check(ctx, token, access)
+	return err
+}
+
+// SubjectContext return who a valid access token was issued to
+func (s *Session) SubjectContext(ctx context.Context, token string) (string, error) {
+	_, r, err := s.check(ctx, token, access)
+	if err != nil {
+		return "", err
+	}
+	return r.Subject, nil
+}
+
+// NewSessionContext issue an access token and its refresh token
+func (s *Session) NewSessionContext(ctx context.Context, subject string) (*interfaces.Tokens, error) {
+	if subject == "" {
+		return nil, errors.New("subject cannot be empty")
+	}
+	accessToken, accessHash, err := generate()
+	if err != nil {
+		return nil, err
+	}
+	refreshToken, refreshHash, err := generate()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	if err := s.put(ctx, refreshHash, record{Subject: subject, Kind: refresh, Pair: accessHash, Issued: now, Expires: now.Add(s.refreshTTL)}); err != nil {
+		return nil, err
+	}
+	if err := s.put(ctx, accessHash, record{Subject: subject, Kind: access, Pair: refreshHash, Issued: now, Expires: now.Add(s.accessTTL)}); err != nil {
+		return nil, err
+	}
+	return &interfaces.Tokens{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int64(s.accessTTL / time.Second),
+	}, nil
+}
+
+// RefreshSessionContext trade a refresh token for a new pair, the old pair is
+// revoked so a refresh token can be used once. Concurrent refreshes with the
+// same token are told apart in memory and with a cache implementing
+// interfaces.Locker, one only succeeds
+func (s *Session) RefreshSessionContext(ctx context.Context, token string) (*interfaces.Tokens, error) {
+	hash, r, err := s.check(ctx, token, refresh)
+	if err != nil {
+		return nil, err
+	}
+	if claimed, err := s.claim(ctx, hash, r); err != nil || !claimed {
+		return nil, claimError(err)
+	}
+	if err := s.delete(ctx, hash, r.Pair); err != nil {
+		return nil, err
+	}
+	return s.NewSessionContext(ctx, r.Subject)
+}
+
+// claimError return the error of a failed claim, or ErrInvalidToken for a
+// token claimed by another refresh
+func claimError(err error) error {
+	if err != nil {
+		return err
+	}
+	return ErrInvalidToken
+}
+
+func (s *Session) issue(ctx context.Context, r record) (string, string, error) {
+	token, hash, err := generate()
+	if err != nil {
+		return "", "", err
+	}
+	if err := s.put(ctx, hash, r); err != nil {
+		return "", "", err
+	}
+	return token, hash, nil
+}
+
+// generate return a random token and its hash
+func generate() (string, string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(b)
+	return token, digest(token), nil
+}
+
+// check load a token of the given kind and forget it when it is expired
+func (s *Session) check(ctx context.Context, token, kind string) (string, *record, error) {
+	if token == "" {
+		return "", nil, ErrInvalidToken
+	}
+	hash := digest(token)
+	r, err := s.load(ctx, hash)
+	if err != nil {
+		return "", nil, err
+	}
+	if r.Kind != kind {
+		return "", nil, ErrInvalidToken
+	}
+	if time.Now().After(r.Expires) {
+		if err := s.delete(ctx, hash); err != nil {
+			return "", nil, err
+		}
+		return "", nil, ErrExpiredToken
+	}
+	revoked, err := s.revoked(ctx, r)
+	if err != nil {
+		return "", nil, err
+	}
+	if revoked {
+		if err := s.delete(ctx, hash); err != nil {
+			return "", nil, err
+		}
+		return "", nil, ErrInvalidToken
+	}
+	return hash, r, nil
+}
+
+func (s *Session) subjectKey(subject string) string {
+	return fmt.Sprintf("%s:subject:%s", s.prefix, subject)
+}
+
+// revoked tell whether the token was issued before its subject was revoked
+func (s *Session) revoked(ctx context.Context, r *record) (bool, error) {
+	var value string
+	if s.cache != nil {
+		v, err := s.cache.TakeContext(ctx, s.subjectKey(r.Subject))
+		if err != nil {
+			if exists, e := s.cache.ExistsContext(ctx, s.subjectKey(r.Subject)); e == nil && !exists {
+				return false, nil
+			}
+			return false, err
+		}
+		value = fmt.Sprint(v)
+		if b, ok := v.([]byte); ok {
+			value = string(b)
+		}
+	} else {
+		s.Lock()
+		v, exists := s.memory[s.subjectKey(r.Subject)]
+		s.Unlock()
+		if !exists {
+			return false, nil
+		}
+		value = v.value
+	}
+	revoked, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return false, err
+	}
+	return r.Issued.UnixNano() < revoked, nil
+}
+
+func digest(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func (s *Session) key(hash string) string {
+	return fmt.Sprintf("%s:%s", s.prefix, hash)
+}
+
+func (s *Session) put(ctx context.Context, hash string, r record) error {
+	value, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	if s.cache != nil {
+		// a cache able to expire its keys forgets the token with its expiry
+		if locker, ok := s.cache.(interfaces.Locker); ok {
+			stored, err := locker.TryLock(ctx, s.key(hash), string(value), time.Until(r.Expires))
+			if err == nil && !stored {
+				err = errors.New("token already issued")
+			}
+			return err
+		}
+		return s.cache.PutContext(ctx, s.key(hash), string(value))
+	}
+	s.Lock()
+	defer s.Unlock()
+	s.purge()
+	s.memory[hash] = entry{value: string(value), expires: r.Expires}
+	return nil
+}
+
+// purge forget the expired records kept in memory, at most once a minute
+func (s *Session) purge() {
+	now := time.Now()
+	if now.Sub(s.purged) < time.Minute {
+		return
+	}
+	s.purged = now
+	for key, e := range s.memory {
+		if now.After(e.expires) {
+			delete(s.memory, key)
+		}
+	}
+}
+
+// claim take a token for a single use: of two refreshes with the same token,
+// one only claims it. A cache without interfaces.Locker cannot tell
+func (s *Session) claim(ctx context.Context, hash string, r *record) (bool, error) {
+	if s.cache == nil {
+		s.Lock()
+		defer s.Unlock()
+		if _, exists := s.memory[hash]; !exists {
+			return false, nil
+		}
+		delete(s.memory, hash)
+		return true, nil
+	}
+	if locker, ok := s.cache.(interfaces.Locker); ok {
+		return locker.TryLock(ctx, fmt.Sprintf("%s:claim:%s", s.prefix, hash), r.Subject, time.Until(r.Expires))
+	}
+	return true, nil
+}
+
+func (s *Session) load(ctx context.Context, hash string) (*record, error) {
+	var value string
+	if s.cache != nil {
+		v, err := s.cache.TakeContext(ctx, s.key(hash))
+		if err != nil {
+			// a missing key is an error for the caches, tell it from a failure
+			if exists, e := s.cache.ExistsContext(ctx, s.key(hash)); e == nil && !exists {
+				return nil, ErrInvalidToken
+			}
+			return nil, err
+		}
+		switch v := v.(type) {
+		case string:
+			value = v
+		case []byte:
+			value = string(v)
+		default:
+			return nil, fmt.Errorf("unexpected token record %T", v)
+		}
+	} else {
+		s.Lock()
+		v, exists := s.memory[hash]
+		s.Unlock()
+		if !exists {
+			return nil, ErrInvalidToken
+		}
+		value = v.value
+	}
+	var r record
+	if err := json.Unmarshal([]byte(value), &r); err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+func (s *Session) delete(ctx context.Context, hashes ...string) error {
+	keys := make([]string, 0, len(hashes))
+	for _, hash := range hashes {
+		if hash != "" {
+			keys = append(keys, hash)
+		}
+	}
+	if s.cache != nil {
+		for i, hash := range keys {
+			keys[i] = s.key(hash)
+		}
+		return s.cache.DeleteContext(ctx, keys...)
+	}
+	s.Lock()
+	defer s.Unlock()
+	for _, hash := range keys {
+		delete(s.memory, hash)
+	}
+	return nil
+}
+
+func init() {
+	factory.Register(factory.AuthZ, "session", func(settings interfaces.Configuration) (interface{}, error) {
+		options := make([]Option, 0)
+		if prefix := settings.GetStringOrDefault("prefix", ""); prefix != "" {
+			options = append(options, WithPrefix(prefix))
+		}
+		if ttl := settings.GetDurationOrDefault("access_ttl", 0); ttl > 0 {
+			options = append(options, WithAccessTTL(ttl))
+		}
+		if ttl := settings.GetDurationOrDefault("refresh_ttl", 0); ttl > 0 {
+			options = append(options, WithRefreshTTL(ttl))
+		}
+		return New(options...)
+	})
+}
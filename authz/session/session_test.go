@@ -0,0 +1,133 @@
+package session_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/advancedlogic/easy/authz/session"
+	"github.com/advancedlogic/easy/easytest"
+	"github.com/advancedlogic/easy/interfaces"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSession(t *testing.T) {
+	_, err := session.New(session.WithAccessTTL(0))
+	assert.NotNil(t, err)
+
+	cache := easytest.NewCache()
+	s, err := session.New(session.WithCache(cache))
+	assert.Nil(t, err)
+	_, err = s.NewToken("")
+	assert.NotNil(t, err)
+
+	tokens, err := s.NewSessionContext(context.Background(), "ada")
+	assert.Nil(t, err)
+	assert.Equal(t, "Bearer", tokens.TokenType)
+	assert.Equal(t, int64(900), tokens.ExpiresIn)
+	assert.Nil(t, s.CheckToken(tokens.AccessToken))
+	assert.Equal(t, session.ErrInvalidToken, s.CheckToken(tokens.RefreshToken))
+	subject, err := s.SubjectContext(context.Background(), tokens.AccessToken)
+	assert.Nil(t, err)
+	assert.Equal(t, "ada", subject)
+
+	// only the hashes are stored
+	keys, _ := cache.Keys()
+	for _, key := range keys.([]string) {
+		assert.NotContains(t, key, tokens.AccessToken)
+	}
+
+	// a refresh token is used once and revokes its access token
+	refreshed, err := s.RefreshSessionContext(context.Background(), tokens.RefreshToken)
+	assert.Nil(t, err)
+	assert.NotEqual(t, tokens.AccessToken, refreshed.AccessToken)
+	assert.Equal(t, session.ErrInvalidToken, s.CheckToken(tokens.AccessToken))
+	_, err = s.RefreshSessionContext(context.Background(), tokens.RefreshToken)
+	assert.Equal(t, session.ErrInvalidToken, err)
+
+	// revoking the access token ends the session
+	assert.Nil(t, s.RevokeToken(refreshed.AccessToken))
+	_, err = s.RefreshSessionContext(context.Background(), refreshed.RefreshToken)
+	assert.Equal(t, session.ErrInvalidToken, err)
+	assert.NotNil(t, s.RevokeToken("unknown"))
+
+	// revoking the subject ends its sessions, not the next ones
+	revoked, err := s.NewSessionContext(context.Background(), "ada")
+	assert.Nil(t, err)
+	assert.Nil(t, s.RevokeSubject("ada"))
+	assert.Equal(t, session.ErrInvalidToken, s.CheckToken(revoked.AccessToken))
+	_, err = s.RefreshSessionContext(context.Background(), revoked.RefreshToken)
+	assert.Equal(t, session.ErrInvalidToken, err)
+	tokens, err = s.NewSessionContext(context.Background(), "ada")
+	assert.Nil(t, err)
+	assert.Nil(t, s.CheckToken(tokens.AccessToken))
+}
+
+func TestSession_Expiry(t *testing.T) {
+	s, err := session.New(session.WithAccessTTL(20 * time.Millisecond))
+	assert.Nil(t, err)
+	assert.False(t, s.HasCache())
+
+	token, err := s.NewToken("ada")
+	assert.Nil(t, err)
+	refreshed, err := s.RefreshToken(token)
+	assert.Nil(t, err)
+	assert.Equal(t, session.ErrInvalidToken, s.CheckToken(token))
+	assert.Nil(t, s.CheckToken(refreshed))
+
+	time.Sleep(30 * time.Millisecond)
+	assert.Equal(t, session.ErrExpiredToken, s.CheckToken(refreshed))
+	assert.Equal(t, session.ErrInvalidToken, s.CheckToken(refreshed))
+}
+
+func TestSession_CacheExpiry(t *testing.T) {
+	cache := easytest.NewCache()
+	s, err := session.New(session.WithCache(cache),
+		session.WithAccessTTL(20*time.Millisecond), session.WithRefreshTTL(80*time.Millisecond))
+	assert.Nil(t, err)
+	_, err = s.NewSessionContext(context.Background(), "ada")
+	assert.Nil(t, err)
+	assert.Nil(t, s.RevokeSubject("bob"))
+	assert.Nil(t, s.RevokeSubject("bob"))
+	keys, _ := cache.Keys()
+	assert.Len(t, keys, 3)
+
+	// the records expire with the tokens, unchecked, and a revocation with
+	// the last token it revokes
+	time.Sleep(40 * time.Millisecond)
+	keys, _ = cache.Keys()
+	assert.Len(t, keys, 2)
+	time.Sleep(60 * time.Millisecond)
+	keys, _ = cache.Keys()
+	assert.Len(t, keys, 0)
+}
+
+func TestSession_ConcurrentRefresh(t *testing.T) {
+	for name, options := range map[string][]session.Option{
+		"memory": nil,
+		"cache":  {session.WithCache(easytest.NewCache())},
+	} {
+		t.Run(name, func(t *testing.T) {
+			s, err := session.New(options...)
+			assert.Nil(t, err)
+			tokens, err := s.NewSessionContext(context.Background(), "ada")
+			assert.Nil(t, err)
+
+			var wg sync.WaitGroup
+			refreshed := make(chan *interfaces.Tokens, 10)
+			for i := 0; i < 10; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					if pair, err := s.RefreshSessionContext(context.Background(), tokens.RefreshToken); err == nil {
+						refreshed <- pair
+					}
+				}()
+			}
+			wg.Wait()
+			close(refreshed)
+			assert.Len(t, refreshed, 1)
+		})
+	}
+}
@@ -1,10 +1,17 @@
 package nats
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"sort"
 
+	"github.com/advancedlogic/easy/commons"
+	"github.com/advancedlogic/easy/executor"
+	"github.com/advancedlogic/easy/factory"
 	"github.com/advancedlogic/easy/interfaces"
+	"github.com/advancedlogic/easy/logging"
 	"github.com/nats-io/go-nats"
 	"github.com/sirupsen/logrus"
 )
@@ -15,8 +22,9 @@ type Nats struct {
 	userCredentialsPath string
 	userJWT             string
 	userNK              string
-	*logrus.Logger
-	handlers      map[string]func(*nats.Msg)
+	interfaces.Logger
+	executor      *executor.Executor
+	handlers      map[string]func(context.Context, *nats.Msg)
 	subscriptions map[string]*nats.Subscription
 }
 
@@ -31,19 +39,40 @@ func WithEndpoint(endpoint string) interfaces.BrokerOption {
 	}
 }
 
-func WithLogger(logger *logrus.Logger) interfaces.BrokerOption {
+func WithLogger(logger interfaces.Logger) interfaces.BrokerOption {
 	return func(i interfaces.Broker) error {
 		n := i.(*Nats)
 		return n.WithLogger(logger)
 	}
 }
 
+//WithExecutor hand the messages to the workers of e instead of running the
+//handlers on the NATS goroutine. The subscribed topic name the handler for
+//the executor limits. A request refused by the executor is answered with
+//{"error": "..."} on its reply subject; core NATS has no redelivery, any
+//other refused message is lost
+func WithExecutor(e *executor.Executor) interfaces.BrokerOption {
+	return func(i interfaces.Broker) error {
+		n := i.(*Nats)
+		return n.WithExecutor(e)
+	}
+}
+
+//FromEnv configure the broker from the EASY_NATS_* variables: ENDPOINT
+func FromEnv() interfaces.BrokerOption {
+	return func(i interfaces.Broker) error {
+		return commons.EnvString("nats", "endpoint", func(endpoint string) error {
+			return WithEndpoint(endpoint)(i)
+		})
+	}
+}
+
 func New(options ...interfaces.BrokerOption) (*Nats, error) {
 	n := &Nats{
 		endpoint:      "localhost:4222",
-		handlers:      make(map[string]func(*nats.Msg)),
+		handlers:      make(map[string]func(context.Context, *nats.Msg)),
 		subscriptions: make(map[string]*nats.Subscription),
-		Logger:        logrus.New(),
+		Logger:        logging.Logrus(logrus.New()),
 	}
 
 	for _, option := range options {
@@ -56,16 +85,23 @@ func New(options ...interfaces.BrokerOption) (*Nats, error) {
 }
 
 func (n *Nats) Connect() error {
-	var err error
-	if conn, err := nats.Connect(n.endpoint); err == nil {
-		n.conn = conn
-		return nil
+	conn, err := nats.Connect(n.endpoint)
+	if err != nil {
+		return err
 	}
-	return err
-
+	n.conn = conn
+	return nil
 }
 
 func (n *Nats) Publish(topic string, message interface{}) error {
+	return n.PublishContext(context.Background(), topic, message)
+}
+
+//PublishContext publish the message unless ctx is already done
+func (n *Nats) PublishContext(ctx context.Context, topic string, message interface{}) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 	var m []byte
 	switch message.(type) {
 	case string:
@@ -76,16 +112,98 @@ func (n *Nats) Publish(topic string, message interface{}) error {
 	return n.conn.Publish(topic, m)
 }
 
+//Subscribe accept a func(*nats.Msg) or an interfaces.MessageHandler, handlers
+//subscribed after Run are bound immediately
 func (n *Nats) Subscribe(topic string, handler interface{}) error {
-	n.handlers[topic] = handler.(func(*nats.Msg))
+	switch h := handler.(type) {
+	case func(*nats.Msg):
+		n.handlers[topic] = func(ctx context.Context, msg *nats.Msg) {
+			h(msg)
+		}
+	case interfaces.MessageHandler:
+		n.handlers[topic] = n.adapt(h)
+	case func(context.Context, *interfaces.Message) error:
+		n.handlers[topic] = n.adapt(h)
+	default:
+		return fmt.Errorf("unsupported handler type %T", handler)
+	}
+	if n.conn != nil {
+		return n.subscribe(topic, n.handlers[topic])
+	}
+	return nil
+}
+
+func (n *Nats) adapt(handler interfaces.MessageHandler) func(context.Context, *nats.Msg) {
+	return func(ctx context.Context, msg *nats.Msg) {
+		message := &interfaces.Message{
+			Topic: msg.Subject,
+			Reply: msg.Reply,
+			Data:  msg.Data,
+		}
+		logger := n.Logger.With("topic", msg.Subject)
+		if err := handler(logging.NewContext(ctx, logger), message); err != nil {
+			logger.Error("message handling failed", "error", err)
+		}
+	}
+}
+
+func (n *Nats) subscribe(topic string, handler func(context.Context, *nats.Msg)) error {
+	subscription, err := n.conn.QueueSubscribe(topic, "default", func(msg *nats.Msg) {
+		if n.executor == nil {
+			handler(context.Background(), msg)
+			return
+		}
+		if err := n.executor.Submit(context.Background(), topic, func(ctx context.Context) error {
+			handler(ctx, msg)
+			return nil
+		}); err != nil {
+			n.Warn("message refused", "topic", msg.Subject, "error", err)
+			n.refuse(msg, err)
+		}
+	})
+	if err != nil {
+		return err
+	}
+	n.subscriptions[topic] = subscription
 	return nil
 }
 
+//refuse answer a request refused by the executor with {"error": "..."}, so
+//that the caller does not wait for its timeout. Core NATS does not redeliver:
+//a refused message without reply subject is lost
+func (n *Nats) refuse(msg *nats.Msg, refusal error) {
+	if msg.Reply == "" {
+		return
+	}
+	data, err := json.Marshal(map[string]string{"error": refusal.Error()})
+	if err == nil {
+		err = n.conn.Publish(msg.Reply, data)
+	}
+	if err != nil {
+		n.Warn("refusal not sent", "topic", msg.Subject, "error", err)
+	}
+}
+
 func (n *Nats) Unsubscribe(topic string) error {
+	if _, exists := n.handlers[topic]; !exists {
+		return errors.New(fmt.Sprintf("topic %s does not exist", topic))
+	}
+	delete(n.handlers, topic)
 	if subscription, exists := n.subscriptions[topic]; exists {
+		delete(n.subscriptions, topic)
 		return subscription.Unsubscribe()
 	}
-	return errors.New(fmt.Sprintf("topic %s does not exist", topic))
+	return nil
+}
+
+//Subscriptions return the sorted topics with a handler
+func (n *Nats) Subscriptions() []string {
+	topics := make([]string, 0, len(n.handlers))
+	for topic := range n.handlers {
+		topics = append(topics, topic)
+	}
+	sort.Strings(topics)
+	return topics
 }
 
 func (n *Nats) Run() error {
@@ -93,11 +211,20 @@ func (n *Nats) Run() error {
 		return err
 	}
 	for topic, handler := range n.handlers {
-		subscription, err := n.conn.QueueSubscribe(topic, "default", handler)
-		if err != nil {
+		if err := n.subscribe(topic, handler); err != nil {
 			return err
 		}
-		n.subscriptions[topic] = subscription
+	}
+	return nil
+}
+
+//Health report whether the connection to the server is up
+func (n *Nats) Health(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if n.conn == nil || !n.conn.IsConnected() {
+		return fmt.Errorf("not connected to %s", n.endpoint)
 	}
 	return nil
 }
@@ -114,10 +241,28 @@ func (n *Nats) Close() error {
 	return errors.New("broker cannot be closed")
 }
 
-func (n *Nats) WithLogger(logger *logrus.Logger) error {
+func (n *Nats) WithExecutor(e *executor.Executor) error {
+	if e != nil {
+		n.executor = e
+		return nil
+	}
+	return errors.New("executor cannot be nil")
+}
+
+func (n *Nats) WithLogger(logger interfaces.Logger) error {
 	if logger != nil {
 		n.Logger = logger
 		return nil
 	}
 	return errors.New("logger cannot be nil")
 }
+
+func init() {
+	factory.Register(factory.Broker, "nats", func(settings interfaces.Configuration) (interface{}, error) {
+		options := make([]interfaces.BrokerOption, 0)
+		if endpoint := settings.GetStringOrDefault("endpoint", ""); endpoint != "" {
+			options = append(options, WithEndpoint(endpoint))
+		}
+		return New(append(options, FromEnv())...)
+	})
+}
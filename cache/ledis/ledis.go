@@ -1,6 +1,11 @@
 package ledis
 
 import (
+	"context"
+	"time"
+
+	"github.com/advancedlogic/easy/commons"
+	"github.com/advancedlogic/easy/factory"
 	"github.com/advancedlogic/easy/interfaces"
 	"github.com/go-redis/redis"
 	"github.com/pkg/errors"
@@ -51,17 +56,46 @@ func WithDB(db int) interfaces.CacheOption {
 
 func AddEndpoints(endpoints ...string) interfaces.CacheOption {
 	return func(c interfaces.Cache) error {
+		added := false
 		for _, endpoint := range endpoints {
 			if endpoint != "" {
 				ledis := c.(*Ledis)
 				ledis.endpoints = append(ledis.endpoints, endpoint)
-				return nil
+				added = true
 			}
 		}
+		if added {
+			return nil
+		}
 		return errors.New("endpoint cannot be empty")
 	}
 }
 
+//FromEnv configure the cache from the EASY_LEDIS_* variables:
+//ENDPOINTS (comma separated), PASSWORD, DB and COLLECTION
+func FromEnv() interfaces.CacheOption {
+	return func(c interfaces.Cache) error {
+		if err := commons.EnvStrings("ledis", "endpoints", func(endpoints []string) error {
+			return AddEndpoints(endpoints...)(c)
+		}); err != nil {
+			return err
+		}
+		if err := commons.EnvString("ledis", "password", func(password string) error {
+			return WithPassowrd(password)(c)
+		}); err != nil {
+			return err
+		}
+		if err := commons.EnvInt("ledis", "db", func(db int) error {
+			return WithDB(db)(c)
+		}); err != nil {
+			return err
+		}
+		return commons.EnvString("ledis", "collection", func(collection string) error {
+			return WithCollection(collection)(c)
+		})
+	}
+}
+
 func New(options ...interfaces.CacheOption) (*Ledis, error) {
 	ledis := &Ledis{
 		endpoints: make([]string, 0),
@@ -103,13 +137,27 @@ func (l *Ledis) Close() error {
 	return nil
 }
 
-func (l *Ledis) Put(key string, value interface{}) error {
-	var status *redis.StatusCmd
+//Health ping the server
+func (l *Ledis) Health(ctx context.Context) error {
+	if l.client == nil && l.clusterClient == nil {
+		return errors.New("cache not initialised")
+	}
+	return l.cmdable(ctx).Ping().Err()
+}
+
+func (l *Ledis) cmdable(ctx context.Context) redis.Cmdable {
 	if l.client != nil {
-		status = l.client.Set(key, value, -1)
-	} else {
-		status = l.clusterClient.Set(key, value, -1)
+		return l.client.WithContext(ctx)
 	}
+	return l.clusterClient.WithContext(ctx)
+}
+
+func (l *Ledis) Put(key string, value interface{}) error {
+	return l.PutContext(context.Background(), key, value)
+}
+
+func (l *Ledis) PutContext(ctx context.Context, key string, value interface{}) error {
+	status := l.cmdable(ctx).Set(key, value, -1)
 	if status.Err() != nil {
 		return status.Err()
 	}
@@ -117,12 +165,11 @@ func (l *Ledis) Put(key string, value interface{}) error {
 }
 
 func (l *Ledis) Set(value string) error {
-	var status *redis.IntCmd
-	if l.client != nil {
-		status = l.client.SAdd(l.collection, value)
-	} else {
-		status = l.clusterClient.SAdd(l.collection, value)
-	}
+	return l.SetContext(context.Background(), value)
+}
+
+func (l *Ledis) SetContext(ctx context.Context, value string) error {
+	status := l.cmdable(ctx).SAdd(l.collection, value)
 	if status.Err() != nil {
 		return status.Err()
 	}
@@ -130,12 +177,11 @@ func (l *Ledis) Set(value string) error {
 }
 
 func (l *Ledis) IsMember(value string) (bool, error) {
-	var status *redis.BoolCmd
-	if l.client != nil {
-		status = l.client.SIsMember(l.collection, value)
-	} else {
-		status = l.clusterClient.SIsMember(l.collection, value)
-	}
+	return l.IsMemberContext(context.Background(), value)
+}
+
+func (l *Ledis) IsMemberContext(ctx context.Context, value string) (bool, error) {
+	status := l.cmdable(ctx).SIsMember(l.collection, value)
 	if status.Err() != nil {
 		return false, status.Err()
 	}
@@ -143,12 +189,11 @@ func (l *Ledis) IsMember(value string) (bool, error) {
 }
 
 func (l *Ledis) Take(key string) (interface{}, error) {
-	var status *redis.StringCmd
-	if l.client != nil {
-		status = l.client.Get(key)
-	} else {
-		status = l.clusterClient.Get(key)
-	}
+	return l.TakeContext(context.Background(), key)
+}
+
+func (l *Ledis) TakeContext(ctx context.Context, key string) (interface{}, error) {
+	status := l.cmdable(ctx).Get(key)
 	if status.Err() != nil {
 		return nil, status.Err()
 	}
@@ -157,12 +202,11 @@ func (l *Ledis) Take(key string) (interface{}, error) {
 }
 
 func (l *Ledis) Exists(keys ...string) (bool, error) {
-	var status *redis.IntCmd
-	if l.client != nil {
-		status = l.client.Exists(keys...)
-	} else {
-		status = l.clusterClient.Exists(keys...)
-	}
+	return l.ExistsContext(context.Background(), keys...)
+}
+
+func (l *Ledis) ExistsContext(ctx context.Context, keys ...string) (bool, error) {
+	status := l.cmdable(ctx).Exists(keys...)
 	if status.Err() != nil {
 		return false, status.Err()
 	}
@@ -170,27 +214,66 @@ func (l *Ledis) Exists(keys ...string) (bool, error) {
 }
 
 func (l *Ledis) Delete(keys ...string) error {
-	var status *redis.IntCmd
-	if l.client != nil {
-		status = l.client.Del(keys...)
-	} else {
-		status = l.clusterClient.Del(keys...)
-	}
+	return l.DeleteContext(context.Background(), keys...)
+}
+
+func (l *Ledis) DeleteContext(ctx context.Context, keys ...string) error {
+	status := l.cmdable(ctx).Del(keys...)
 	if status.Err() != nil {
 		return status.Err()
 	}
 	return nil
 }
 
-func (l *Ledis) Keys() (interface{}, error) {
-	var status *redis.StringSliceCmd
-	if l.client != nil {
-		status = l.client.Keys("*")
-	} else {
-		status = l.clusterClient.Keys("*")
+//TryLock take key with SET NX, the lock is released when ttl expires
+func (l *Ledis) TryLock(ctx context.Context, key, owner string, ttl time.Duration) (bool, error) {
+	status := l.cmdable(ctx).SetNX(key, owner, ttl)
+	if status.Err() != nil {
+		return false, status.Err()
+	}
+	return status.Val(), nil
+}
+
+//Increment add one to key with INCR, a new counter expires after ttl
+func (l *Ledis) Increment(ctx context.Context, key string, ttl time.Duration) (int64, error) {
+	cmdable := l.cmdable(ctx)
+	status := cmdable.Incr(key)
+	if status.Err() != nil {
+		return 0, status.Err()
 	}
+	if status.Val() == 1 {
+		if err := cmdable.Expire(key, ttl).Err(); err != nil {
+			return 0, err
+		}
+	}
+	return status.Val(), nil
+}
+
+func (l *Ledis) Keys() (interface{}, error) {
+	return l.KeysContext(context.Background())
+}
+
+func (l *Ledis) KeysContext(ctx context.Context) (interface{}, error) {
+	status := l.cmdable(ctx).Keys("*")
 	if status.Err() != nil {
 		return nil, status.Err()
 	}
 	return status.Val(), nil
 }
+
+func init() {
+	factory.Register(factory.Cache, "ledis", func(settings interfaces.Configuration) (interface{}, error) {
+		options := make([]interfaces.CacheOption, 0)
+		if endpoints := settings.GetArrayOfStringsOrDefault("endpoints", nil); len(endpoints) > 0 {
+			options = append(options, AddEndpoints(endpoints...))
+		}
+		if password := settings.GetStringOrDefault("password", ""); password != "" {
+			options = append(options, WithPassowrd(password))
+		}
+		if collection := settings.GetStringOrDefault("collection", ""); collection != "" {
+			options = append(options, WithCollection(collection))
+		}
+		options = append(options, WithDB(settings.GetIntOrDefault("db", 0)))
+		return New(append(options, FromEnv())...)
+	})
+}
@@ -1,6 +1,7 @@
 package client
 
 import (
+	"context"
 	"crypto/tls"
 	"github.com/advancedlogic/easy/interfaces"
 	"github.com/pkg/errors"
@@ -126,7 +127,7 @@ func New(options ...interfaces.ClientOption) (*Resty, error) {
 	return r, nil
 }
 
-func (r *Resty) render() (*resty.Request, error) {
+func (r *Resty) render(ctx context.Context) (*resty.Request, error) {
 	client := resty.New()
 	if len(r.Cookies) > 0 {
 		for key, value := range r.Cookies {
@@ -145,7 +146,7 @@ func (r *Resty) render() (*resty.Request, error) {
 		client.SetCertificates(cert)
 	}
 
-	request := client.R()
+	request := client.R().SetContext(ctx)
 	if len(r.Headers) > 0 {
 		request.SetHeaders(r.Headers)
 	}
@@ -166,7 +167,11 @@ func (r *Resty) render() (*resty.Request, error) {
 }
 
 func (r *Resty) GET(h interface{}) error {
-	request, err := r.render()
+	return r.GETContext(context.Background(), h)
+}
+
+func (r *Resty) GETContext(ctx context.Context, h interface{}) error {
+	request, err := r.render(ctx)
 	if err != nil {
 		return err
 	}
@@ -179,7 +184,11 @@ func (r *Resty) GET(h interface{}) error {
 }
 
 func (r *Resty) POST(h interface{}) error {
-	request, err := r.render()
+	return r.POSTContext(context.Background(), h)
+}
+
+func (r *Resty) POSTContext(ctx context.Context, h interface{}) error {
+	request, err := r.render(ctx)
 	if err != nil {
 		return err
 	}
@@ -192,7 +201,11 @@ func (r *Resty) POST(h interface{}) error {
 }
 
 func (r *Resty) PUT(h interface{}) error {
-	request, err := r.render()
+	return r.PUTContext(context.Background(), h)
+}
+
+func (r *Resty) PUTContext(ctx context.Context, h interface{}) error {
+	request, err := r.render(ctx)
 	if err != nil {
 		return err
 	}
@@ -205,7 +218,11 @@ func (r *Resty) PUT(h interface{}) error {
 }
 
 func (r *Resty) DELETE(h interface{}) error {
-	request, err := r.render()
+	return r.DELETEContext(context.Background(), h)
+}
+
+func (r *Resty) DELETEContext(ctx context.Context, h interface{}) error {
+	request, err := r.render(ctx)
 	if err != nil {
 		return err
 	}
@@ -218,7 +235,11 @@ func (r *Resty) DELETE(h interface{}) error {
 }
 
 func (r *Resty) HEAD(h interface{}) error {
-	request, err := r.render()
+	return r.HEADContext(context.Background(), h)
+}
+
+func (r *Resty) HEADContext(ctx context.Context, h interface{}) error {
+	request, err := r.render(ctx)
 	if err != nil {
 		return err
 	}
@@ -231,7 +252,11 @@ func (r *Resty) HEAD(h interface{}) error {
 }
 
 func (r *Resty) OPTIONS(h interface{}) error {
-	request, err := r.render()
+	return r.OPTIONSContext(context.Background(), h)
+}
+
+func (r *Resty) OPTIONSContext(ctx context.Context, h interface{}) error {
+	request, err := r.render(ctx)
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,106 @@
+package commons
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// EnvPrefix is the prefix of every environment variable read by easy
+const EnvPrefix = "EASY"
+
+// EnvKey return the name of the variable holding a component setting,
+// e.g. EnvKey("rest", "port") is EASY_REST_PORT
+func EnvKey(component, setting string) string {
+	key := strings.Join([]string{EnvPrefix, component, setting}, "_")
+	return strings.ToUpper(strings.Replace(key, "-", "_", -1))
+}
+
+// Env look up EASY_<COMPONENT>_<SETTING>. When it is not set the content of the
+// file named by EASY_<COMPONENT>_<SETTING>_FILE is used instead, so that secrets
+// can be mounted as files (docker and kubernetes secrets)
+func Env(component, setting string) (string, bool, error) {
+	key := EnvKey(component, setting)
+	if value, exists := os.LookupEnv(key); exists {
+		return value, true, nil
+	}
+	if file, exists := os.LookupEnv(key + "_FILE"); exists && file != "" {
+		content, err := ioutil.ReadFile(file)
+		if err != nil {
+			return "", false, fmt.Errorf("%s_FILE: %s", key, err)
+		}
+		return strings.TrimRight(string(content), "\r\n"), true, nil
+	}
+	return "", false, nil
+}
+
+// EnvString call fn with the setting value when it is set
+func EnvString(component, setting string, fn func(string) error) error {
+	value, exists, err := Env(component, setting)
+	if err != nil || !exists {
+		return err
+	}
+	if err := fn(value); err != nil {
+		return fmt.Errorf("%s: %s", EnvKey(component, setting), err)
+	}
+	return nil
+}
+
+// EnvInt call fn with the setting parsed as an integer when it is set
+func EnvInt(component, setting string, fn func(int) error) error {
+	return EnvString(component, setting, func(value string) error {
+		i, err := strconv.Atoi(value)
+		if err != nil {
+			return err
+		}
+		return fn(i)
+	})
+}
+
+// EnvBool call fn with the setting parsed as a boolean when it is set
+func EnvBool(component, setting string, fn func(bool) error) error {
+	return EnvString(component, setting, func(value string) error {
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		return fn(b)
+	})
+}
+
+// EnvDuration call fn with the setting parsed as a duration (e.g. 5s) when it is set
+func EnvDuration(component, setting string, fn func(time.Duration) error) error {
+	return EnvString(component, setting, func(value string) error {
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+		return fn(d)
+	})
+}
+
+// EnvStrings call fn with the comma separated values of the setting when it is set
+func EnvStrings(component, setting string, fn func([]string) error) error {
+	return EnvString(component, setting, func(value string) error {
+		values := make([]string, 0)
+		for _, v := range strings.Split(value, ",") {
+			if v = strings.TrimSpace(v); v != "" {
+				values = append(values, v)
+			}
+		}
+		return fn(values)
+	})
+}
+
+// EnvIsSet tell if the setting is provided either directly or through a _FILE variable
+func EnvIsSet(component, setting string) bool {
+	key := EnvKey(component, setting)
+	if _, exists := os.LookupEnv(key); exists {
+		return true
+	}
+	_, exists := os.LookupEnv(key + "_FILE")
+	return exists
+}
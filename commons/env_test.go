@@ -0,0 +1,43 @@
+package commons
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEnvKey(t *testing.T) {
+	assert.Equal(t, EnvKey("rest", "port"), "EASY_REST_PORT")
+	assert.Equal(t, EnvKey("minio", "access-key"), "EASY_MINIO_ACCESS_KEY")
+}
+
+func TestEnv(t *testing.T) {
+	os.Setenv("EASY_TEST_PORT", "8081")
+	defer os.Unsetenv("EASY_TEST_PORT")
+	port := 0
+	err := EnvInt("test", "port", func(value int) error {
+		port = value
+		return nil
+	})
+	assert.Equal(t, err, nil)
+	assert.Equal(t, port, 8081)
+
+	_, exists, _ := Env("test", "missing")
+	assert.Equal(t, exists, false)
+}
+
+func TestEnvFile(t *testing.T) {
+	file, _ := ioutil.TempFile("", "secret")
+	defer os.Remove(file.Name())
+	file.WriteString("s3cr3t\n")
+	file.Close()
+	os.Setenv("EASY_TEST_TOKEN_FILE", file.Name())
+	defer os.Unsetenv("EASY_TEST_TOKEN_FILE")
+
+	value, exists, err := Env("test", "token")
+	assert.Equal(t, err, nil)
+	assert.Equal(t, exists, true)
+	assert.Equal(t, value, "s3cr3t")
+}
@@ -0,0 +1,83 @@
+package commons
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+var username = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9._@-]{0,63}$`)
+
+// ValidateUsername accept up to 64 letters, digits, dots, dashes, underscores
+// and @, starting with a letter or a digit, so that a username is safe as a
+// file name or a store key
+func ValidateUsername(name string) error {
+	if !username.MatchString(name) {
+		return &PolicyError{Reason: fmt.Sprintf("invalid username %q", name)}
+	}
+	return nil
+}
+
+// PasswordPolicy is what a new password must satisfy
+type PasswordPolicy struct {
+	MinLength     int
+	RequireUpper  bool
+	RequireLower  bool
+	RequireDigit  bool
+	RequireSymbol bool
+}
+
+// PolicyError is a username or a password refused by the policy, the fault of
+// whoever chose it
+type PolicyError struct {
+	Reason string
+}
+
+func (e *PolicyError) Error() string {
+	return e.Reason
+}
+
+// DefaultPasswordPolicy require 8 characters
+var DefaultPasswordPolicy = PasswordPolicy{MinLength: 8}
+
+// Validate return an error telling every rule password breaks
+func (p PasswordPolicy) Validate(password string) error {
+	var upper, lower, digit, symbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsDigit(r):
+			digit = true
+		default:
+			symbol = true
+		}
+	}
+	broken := make([]string, 0)
+	if len([]rune(password)) < p.MinLength {
+		broken = append(broken, fmt.Sprintf("at least %d characters", p.MinLength))
+	}
+	for _, rule := range []struct {
+		required, met bool
+		description   string
+	}{
+		{p.RequireUpper, upper, "an uppercase letter"},
+		{p.RequireLower, lower, "a lowercase letter"},
+		{p.RequireDigit, digit, "a digit"},
+		{p.RequireSymbol, symbol, "a symbol"},
+	} {
+		if rule.required && !rule.met {
+			broken = append(broken, rule.description)
+		}
+	}
+	if password == "" {
+		return &PolicyError{Reason: "password cannot be empty"}
+	}
+	if len(broken) > 0 {
+		return &PolicyError{Reason: fmt.Sprintf("password must contain %s", strings.Join(broken, ", "))}
+	}
+	return nil
+}
@@ -19,6 +19,7 @@ import (
 	"math/rand"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -208,6 +209,23 @@ func ComparePasswords(hashedPwd string, plainPwd []byte) bool {
 	return true
 }
 
+var (
+	dummyOnce sync.Once
+	dummyHash string
+)
+
+// CompareDummyPassword take as long as ComparePasswords does for a user, to
+// be called when the user does not exist: the response time does not tell
+// which usernames are taken. It is always false
+func CompareDummyPassword(plainPwd []byte) bool {
+	dummyOnce.Do(func() {
+		// a hash of the cost of HashAndSalt, of a password nobody knows
+		dummyHash, _ = HashAndSalt(UUID())
+	})
+	ComparePasswords(dummyHash, plainPwd)
+	return false
+}
+
 func PrimitiveArrayContains(array interface{}, element interface{}) int {
 	for i, data := range array.([]interface{}) {
 		switch x := element.(type) {
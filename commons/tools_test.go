@@ -33,3 +33,9 @@ func TestSHA1(t *testing.T) {
 	assert.NotEqual(t, s, "test")
 	assert.Equal(t, s, "qUqP5cyxm6YcTAhz05Hph5gvu9M=")
 }
+
+func TestCompareDummyPassword(t *testing.T) {
+	assert.False(t, CompareDummyPassword([]byte("")))
+	assert.False(t, CompareDummyPassword([]byte("secret")))
+	assert.NotEqual(t, dummyHash, "")
+}
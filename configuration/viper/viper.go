@@ -3,9 +3,12 @@ package viper
 import (
 	"errors"
 	"fmt"
+	"sync"
 	"time"
 
+	"github.com/advancedlogic/easy/commons"
 	"github.com/advancedlogic/easy/interfaces"
+	"github.com/advancedlogic/easy/logging"
 	"github.com/fsnotify/fsnotify"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/viper"
@@ -47,31 +50,66 @@ func WithURI(uri string) interfaces.ConfigurationOption {
 	}
 }
 
-func WithLogger(logger *logrus.Logger) interfaces.ConfigurationOption {
+//WithFile read the configuration from the given file instead of searching
+//<name>.{json,yaml,toml,...} in the standard paths
+func WithFile(file string) interfaces.ConfigurationOption {
 	return func(i interfaces.Configuration) error {
-		if logger != nil {
+		if file != "" {
 			v := i.(*Viper)
-			v.Logger = logger
+			v.file = file
 			return nil
 		}
 
-		return errors.New("logger cannot be nil")
+		return errors.New("file cannot be empty")
+	}
+}
+
+func WithLogger(logger interfaces.Logger) interfaces.ConfigurationOption {
+	return func(i interfaces.Configuration) error {
+		v := i.(*Viper)
+		return v.WithLogger(logger)
+	}
+}
+
+//FromEnv configure the configuration source from the EASY_VIPER_* variables:
+//NAME, PROVIDER and URI
+func FromEnv() interfaces.ConfigurationOption {
+	return func(i interfaces.Configuration) error {
+		settings := map[string]func(string) interfaces.ConfigurationOption{
+			"name":     WithName,
+			"provider": WithProvider,
+			"uri":      WithURI,
+		}
+		for _, setting := range []string{"name", "provider", "uri"} {
+			option := settings[setting]
+			if err := commons.EnvString("viper", setting, func(value string) error {
+				return option(value)(i)
+			}); err != nil {
+				return err
+			}
+		}
+		return nil
 	}
 }
 
 type Viper struct {
 	*viper.Viper
-	*logrus.Logger
+	interfaces.Logger
 
 	name     string
 	provider string
 	uri      string
+	file     string
+	opened   bool
+
+	mutex     sync.Mutex
+	listeners []func()
 }
 
 func New(options ...interfaces.ConfigurationOption) (*Viper, error) {
 	v := &Viper{
 		Viper:  viper.New(),
-		Logger: logrus.New(),
+		Logger: logging.Logrus(logrus.New()),
 	}
 
 	for _, option := range options {
@@ -83,9 +121,18 @@ func New(options ...interfaces.ConfigurationOption) (*Viper, error) {
 }
 
 func (v *Viper) Open(paths ...string) error {
+	if v.opened && len(paths) == 0 {
+		return nil
+	}
 	v.SetConfigName(v.name)
 
-	if v.provider != "" && v.uri != "" {
+	if v.file != "" {
+		v.SetConfigFile(v.file)
+		v.AutomaticEnv()
+		if err := v.ReadInConfig(); err != nil {
+			return err
+		}
+	} else if v.provider != "" && v.uri != "" {
 		if err := v.AddRemoteProvider(v.provider, v.uri, v.name); err != nil {
 			return err
 		}
@@ -109,13 +156,52 @@ func (v *Viper) Open(paths ...string) error {
 	v.OnConfigChange(func(in fsnotify.Event) {
 		err := v.ReadInConfig()
 		if err != nil {
+			v.Warn("configuration not reloaded", "file", in.Name, "error", err)
 			return
 		}
+		v.Info("configuration reloaded", "file", in.Name)
+		v.mutex.Lock()
+		listeners := append([]func(){}, v.listeners...)
+		v.mutex.Unlock()
+		for _, listener := range listeners {
+			listener()
+		}
 	})
+	v.opened = true
 
 	return nil
 }
 
+func (v *Viper) WithLogger(logger interfaces.Logger) error {
+	if logger != nil {
+		v.Logger = logger
+		return nil
+	}
+	return errors.New("logger cannot be nil")
+}
+
+//OnChange call fn every time the configuration file is reloaded
+func (v *Viper) OnChange(fn func()) {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	v.listeners = append(v.listeners, fn)
+}
+
+//Child return the settings below key as a configuration of their own,
+//empty when key does not exist
+func (v *Viper) Child(key string) *Viper {
+	child := v.Viper.Sub(key)
+	if child == nil {
+		child = viper.New()
+	}
+	return &Viper{
+		Viper:  child,
+		Logger: v.Logger,
+		name:   v.name,
+		opened: true,
+	}
+}
+
 func (v *Viper) Save(data interface{}) error {
 	return nil
 }
@@ -0,0 +1,102 @@
+package easy
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/advancedlogic/easy/authz/abac"
+	"github.com/advancedlogic/easy/interfaces"
+	"github.com/gin-gonic/gin"
+)
+
+//WithRules configure the attribute-based rules, e.g. to add rules with
+//abac.WithRule or to start in audit mode with abac.WithAudit
+func WithRules(options ...abac.Option) Option {
+	return func(easy *Easy) error {
+		e, err := abac.New(options...)
+		if err != nil {
+			return err
+		}
+		easy.rules = e
+		return nil
+	}
+}
+
+//Rules return the attribute-based rules, read from the configuration of the µs
+func (easy *Easy) Rules() *abac.Engine {
+	return easy.rules
+}
+
+//ContextWithSubject return a copy of ctx carrying subject, for the broker
+//handlers and the processors calling Can on behalf of a user
+func ContextWithSubject(ctx context.Context, subject interfaces.Subject) context.Context {
+	return context.WithValue(ctx, userKey{}, subject)
+}
+
+//Can decide whether the subject of ctx may perform action on resource. The
+//environment holds the current time as env.now
+func (easy *Easy) Can(ctx context.Context, action string, resource abac.Attributes) abac.Decision {
+	subject, _ := SubjectFromContext(ctx)
+	return easy.rules.Evaluate(abac.Request{
+		Subject:     abac.SubjectAttributes(subject),
+		Action:      action,
+		Resource:    resource,
+		Environment: abac.Attributes{"now": time.Now()},
+	})
+}
+
+//Authorize return a handler answering 401 without a valid access token and 403
+//when the rules deny action on the resource returned by resource. The
+//environment holds env.now, env.ip, env.method and env.path:
+//
+//	service.Handler("put", "/orders/:id", service.Authorize("update", loadOrder))
+//	service.Handler("put", "/orders/:id", updateOrder)
+func (easy *Easy) Authorize(action string, resource func(*gin.Context) (abac.Attributes, error)) func(*gin.Context) {
+	return func(c *gin.Context) {
+		if !easy.authenticate(c) {
+			return
+		}
+		attributes, err := resource(c)
+		if err != nil {
+			easy.Error("resource attributes lookup failed", "path", c.Request.URL.Path, "error", err)
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		subject, _ := SubjectFromContext(c)
+		decision := easy.rules.Evaluate(abac.Request{
+			Subject:  abac.SubjectAttributes(subject),
+			Action:   action,
+			Resource: attributes,
+			Environment: abac.Attributes{
+				"now":    time.Now(),
+				"ip":     c.ClientIP(),
+				"method": c.Request.Method,
+				"path":   c.Request.URL.Path,
+			},
+		})
+		if !decision.Allowed {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "forbidden"})
+			return
+		}
+		c.Next()
+	}
+}
+
+//setupRules load the attribute-based rules from the configuration
+func (easy *Easy) setupRules() error {
+	if easy.rules == nil {
+		e, err := abac.New()
+		if err != nil {
+			return err
+		}
+		easy.rules = e
+	}
+	if err := easy.rules.WithLogger(easy.logger.With("component", "abac")); err != nil {
+		return err
+	}
+	if easy.configuration == nil {
+		return nil
+	}
+	return easy.rules.Watch(easy.configuration)
+}
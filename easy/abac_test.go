@@ -0,0 +1,99 @@
+package easy_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/advancedlogic/easy/authz/abac"
+	"github.com/advancedlogic/easy/easy"
+	"github.com/advancedlogic/easy/easytest"
+	"github.com/advancedlogic/easy/interfaces"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRules(t *testing.T) {
+	orders := map[string]abac.Attributes{
+		"1": {"type": "order", "id": "1", "owner": "ada", "created": time.Now().Add(-40 * 24 * time.Hour)},
+		"2": {"type": "order", "id": "2", "owner": "bob", "created": time.Now()},
+	}
+	order := func(c *gin.Context) (abac.Attributes, error) {
+		if c.Param("id") == "broken" {
+			return nil, errors.New("store unavailable")
+		}
+		return orders[c.Param("id")], nil
+	}
+	ok := func(c *gin.Context) {
+		c.String(http.StatusOK, "ok")
+	}
+	routes := func(e *easy.Easy) error {
+		for method, action := range map[string]string{"get": "read", "put": "update", "delete": "delete"} {
+			if err := e.Handler(method, "/orders/:id", e.Authorize(action, order)); err != nil {
+				return err
+			}
+			if err := e.Handler(method, "/orders/:id", ok); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	service := easytest.Start(t,
+		easy.WithRules(abac.WithRule(abac.Rule{Name: "owners", Effect: abac.Allow, Actions: []string{"read", "update"},
+			When: []string{"resource.owner == subject.id"}})),
+		routes)
+	defer service.Close()
+
+	tokens := make(map[string]string)
+	for _, user := range []string{"ada", "sam"} {
+		_, err := service.AuthN.Register(user, "secret")
+		assert.Nil(t, err)
+		tokens[user], err = service.AuthZ().(interface {
+			NewToken(string) (string, error)
+		}).NewToken(user)
+		assert.Nil(t, err)
+	}
+	assert.Nil(t, service.AuthN.SetGroups("sam", "support"))
+
+	call := func(method, path, user string) int {
+		request, _ := http.NewRequest(method, path, strings.NewReader(""))
+		if user != "" {
+			request.Header.Set("Authorization", "Bearer "+tokens[user])
+		}
+		response, err := service.Do(request)
+		assert.Nil(t, err)
+		response.Body.Close()
+		return response.StatusCode
+	}
+
+	assert.Equal(t, http.StatusUnauthorized, call("GET", "/orders/1", ""))
+	assert.Equal(t, http.StatusOK, call("PUT", "/orders/1", "ada"))
+	assert.Equal(t, http.StatusForbidden, call("PUT", "/orders/2", "ada"))
+	assert.Equal(t, http.StatusForbidden, call("GET", "/orders/2", "sam"))
+	assert.Equal(t, http.StatusInternalServerError, call("GET", "/orders/broken", "ada"))
+
+	// support reads everything but cannot delete the orders older than 30 days
+	service.Configuration.Set("abac.rules", []interface{}{
+		map[string]interface{}{"name": "support", "effect": "allow", "actions": []interface{}{"read", "delete"},
+			"when": []interface{}{"subject.groups contains support"}},
+		map[string]interface{}{"name": "old-orders", "effect": "deny", "actions": []interface{}{"delete"},
+			"when": []interface{}{"subject.groups contains support", "resource.created older_than 30d"}},
+	})
+	assert.Equal(t, http.StatusOK, call("GET", "/orders/2", "sam"))
+	assert.Equal(t, http.StatusOK, call("DELETE", "/orders/2", "sam"))
+	assert.Equal(t, http.StatusForbidden, call("DELETE", "/orders/1", "sam"))
+	assert.Equal(t, http.StatusForbidden, call("PUT", "/orders/1", "sam"))
+
+	// processors and broker handlers ask on behalf of a subject
+	ctx := easy.ContextWithSubject(context.Background(), interfaces.Subject{ID: "sam", Groups: []string{"support"}})
+	assert.Equal(t, "old-orders", service.Can(ctx, "delete", orders["1"]).Rule)
+	assert.False(t, service.Can(context.Background(), "read", orders["1"]).Allowed)
+
+	// in audit mode nothing is denied
+	service.Configuration.Set("abac.audit", true)
+	assert.Equal(t, http.StatusOK, call("DELETE", "/orders/1", "sam"))
+	assert.True(t, service.Can(ctx, "delete", orders["1"]).Audited)
+}
@@ -0,0 +1,397 @@
+package easy
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"reflect"
+	"runtime/debug"
+	"strings"
+
+	"github.com/advancedlogic/easy/authz/apikey"
+	"github.com/advancedlogic/easy/commons"
+	"github.com/advancedlogic/easy/flags"
+	"github.com/advancedlogic/easy/interfaces"
+	"github.com/advancedlogic/easy/lifecycle"
+	"github.com/advancedlogic/easy/scheduler"
+	"github.com/gin-gonic/gin"
+)
+
+const adminRoute = "/admin"
+
+//Redacted replace the secret settings in the admin configuration
+const Redacted = "******"
+
+type AdminOption func(*admin) error
+
+type admin struct {
+	port     int
+	token    string
+	insecure bool
+	secrets  []string
+	server   *http.Server
+}
+
+//ComponentInfo describe a component of the µs
+type ComponentInfo struct {
+	Name           string `json:"name"`
+	Implementation string `json:"implementation"`
+	Version        string `json:"version,omitempty"`
+}
+
+//Introspection is what the admin API tell about a running µs
+type Introspection struct {
+	ID            string                 `json:"id"`
+	Name          string                 `json:"name"`
+	Version       string                 `json:"version,omitempty"`
+	Running       bool                   `json:"running"`
+	Components    []ComponentInfo        `json:"components"`
+	Routes        []interfaces.Route     `json:"routes"`
+	Subscriptions []string               `json:"subscriptions"`
+	Flags         []flags.Evaluation     `json:"flags"`
+	Jobs          []scheduler.Status     `json:"jobs"`
+	Configuration map[string]interface{} `json:"configuration,omitempty"`
+}
+
+//AdminPort serve the admin API on its own port instead of the transport one
+func AdminPort(port int) AdminOption {
+	return func(a *admin) error {
+		if port > 0 {
+			a.port = port
+			return nil
+		}
+		return errors.New("port must be positive")
+	}
+}
+
+//AdminToken require the requests to carry the header Authorization: Bearer <token>
+func AdminToken(token string) AdminOption {
+	return func(a *admin) error {
+		if token != "" {
+			a.token = token
+			return nil
+		}
+		return errors.New("token cannot be empty")
+	}
+}
+
+//AdminInsecure serve the admin API on the transport port without AdminToken,
+//to anyone reaching the µs. Meant for development only
+func AdminInsecure() AdminOption {
+	return func(a *admin) error {
+		a.insecure = true
+		return nil
+	}
+}
+
+//AdminSecrets add to the fragments of the setting names whose value is
+//redacted, by default password, secret, token, key, credential and private
+func AdminSecrets(fragments ...string) AdminOption {
+	return func(a *admin) error {
+		for _, fragment := range fragments {
+			if fragment == "" {
+				return errors.New("fragment cannot be empty")
+			}
+			a.secrets = append(a.secrets, strings.ToLower(fragment))
+		}
+		return nil
+	}
+}
+
+//WithAdmin expose the admin API: GET /admin return the whole Introspection and
+//GET /admin/components, /admin/routes, /admin/subscriptions, /admin/flags, /admin/jobs
+//or /admin/configuration a part of it. Secrets are redacted from the configuration.
+//On the transport port the API requires AdminToken, or AdminInsecure
+func WithAdmin(options ...AdminOption) Option {
+	return func(easy *Easy) error {
+		a := &admin{
+			secrets: append([]string(nil), secretFragments...),
+		}
+		for _, option := range options {
+			if err := option(a); err != nil {
+				return err
+			}
+		}
+		easy.admin = a
+		return nil
+	}
+}
+
+//Introspect describe the µs: components, routes, subscriptions, feature flags, jobs and configuration,
+//secrets included. The admin API redact them
+func (easy *Easy) Introspect() Introspection {
+	info := Introspection{
+		ID:            easy.id,
+		Name:          easy.name,
+		Version:       easy.version,
+		Running:       easy.IsRunning(),
+		Components:    easy.components(),
+		Routes:        make([]interfaces.Route, 0),
+		Subscriptions: make([]string, 0),
+		Flags:         make([]flags.Evaluation, 0),
+		Jobs:          make([]scheduler.Status, 0),
+	}
+	if easy.transport != nil {
+		info.Routes = easy.transport.Routes()
+	}
+	if easy.broker != nil {
+		info.Subscriptions = easy.broker.Subscriptions()
+	}
+	if easy.flags != nil {
+		info.Flags = easy.flags.Flags()
+	}
+	if easy.scheduler != nil {
+		info.Jobs = easy.scheduler.Jobs()
+	}
+	if easy.configuration != nil {
+		info.Configuration = easy.configuration.AllSettings()
+	}
+	return info
+}
+
+func (easy *Easy) components() []ComponentInfo {
+	components := make([]ComponentInfo, 0)
+	add := func(name string, component interface{}) {
+		if component == nil {
+			return
+		}
+		components = append(components, ComponentInfo{
+			Name:           name,
+			Implementation: fmt.Sprintf("%T", component),
+			Version:        moduleVersion(component),
+		})
+	}
+	builtin := []struct {
+		name      string
+		component interface{}
+	}{
+		{"configuration", easy.configuration},
+		{"registry", easy.registry},
+		{"transport", easy.transport},
+		{"broker", easy.broker},
+		{"client", easy.client},
+		{"store", easy.store},
+		{"cache", easy.cache},
+		{"authn", easy.authn},
+		{"authz", easy.authz},
+		{"processor", easy.processor},
+	}
+	names := make(map[string]bool)
+	for _, b := range builtin {
+		names[b.name] = true
+		add(b.name, b.component)
+	}
+	if order, err := easy.lifecycle.Order(); err == nil {
+		for _, name := range order {
+			if names[name] {
+				continue
+			}
+			component, _ := easy.lifecycle.Get(name)
+			add(name, component)
+		}
+	}
+	return components
+}
+
+//moduleVersion return the version of the module defining the type of value,
+//as recorded in the binary
+func moduleVersion(value interface{}) string {
+	t := reflect.TypeOf(value)
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	path := t.PkgPath()
+	info, ok := debug.ReadBuildInfo()
+	if path == "" || !ok {
+		return ""
+	}
+	modules := append([]*debug.Module{&info.Main}, info.Deps...)
+	var found *debug.Module
+	for _, module := range modules {
+		if path != module.Path && !strings.HasPrefix(path, module.Path+"/") {
+			continue
+		}
+		if found == nil || len(module.Path) > len(found.Path) {
+			found = module
+		}
+	}
+	if found == nil {
+		return ""
+	}
+	if found.Replace != nil {
+		return found.Replace.Version
+	}
+	return found.Version
+}
+
+func (a *admin) redact(settings map[string]interface{}) map[string]interface{} {
+	return redact(settings, a.secrets)
+}
+
+func (a *admin) authorize(c *gin.Context) {
+	if a.token == "" {
+		return
+	}
+	expected := "Bearer " + a.token
+	if subtle.ConstantTimeCompare([]byte(c.GetHeader("Authorization")), []byte(expected)) != 1 {
+		c.AbortWithStatus(http.StatusUnauthorized)
+	}
+}
+
+//guard return handler running once the request is authorized
+func (a *admin) guard(handler func(*gin.Context)) func(*gin.Context) {
+	return func(c *gin.Context) {
+		if a.authorize(c); c.IsAborted() {
+			return
+		}
+		handler(c)
+	}
+}
+
+//respond answer value with status, or the status telling err
+func respond(c *gin.Context, status int, value interface{}, err error) {
+	switch {
+	case err == apikey.ErrNotFound || err == interfaces.ErrUserNotFound:
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case err == interfaces.ErrUserExists:
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	case value == nil:
+		c.Status(status)
+	default:
+		c.JSON(status, value)
+	}
+}
+
+func (easy *Easy) adminHandlers() map[string]func(*gin.Context) {
+	a := easy.admin
+	introspect := func() Introspection {
+		info := easy.Introspect()
+		if info.Configuration != nil {
+			info.Configuration = a.redact(info.Configuration)
+		}
+		return info
+	}
+	handle := func(part func(Introspection) interface{}) func(*gin.Context) {
+		return func(c *gin.Context) {
+			if a.authorize(c); c.IsAborted() {
+				return
+			}
+			c.JSON(http.StatusOK, part(introspect()))
+		}
+	}
+	return map[string]func(*gin.Context){
+		adminRoute: handle(func(info Introspection) interface{} { return info }),
+		adminRoute + "/components": handle(func(info Introspection) interface{} {
+			return info.Components
+		}),
+		adminRoute + "/routes": handle(func(info Introspection) interface{} {
+			return info.Routes
+		}),
+		adminRoute + "/subscriptions": handle(func(info Introspection) interface{} {
+			return info.Subscriptions
+		}),
+		adminRoute + "/configuration": handle(func(info Introspection) interface{} {
+			return info.Configuration
+		}),
+		adminRoute + "/flags": handle(func(info Introspection) interface{} {
+			return info.Flags
+		}),
+		adminRoute + "/jobs": handle(func(info Introspection) interface{} {
+			return info.Jobs
+		}),
+	}
+}
+
+//adminEndpoint is a route of the admin API
+type adminEndpoint struct {
+	mode    string
+	route   string
+	handler func(*gin.Context)
+}
+
+//adminEndpoints return the routes of the admin API: the introspection and
+//the administration of the optional components
+func (easy *Easy) adminEndpoints() []adminEndpoint {
+	endpoints := make([]adminEndpoint, 0)
+	for route, handler := range easy.adminHandlers() {
+		endpoints = append(endpoints, adminEndpoint{mode: commons.ModeGet, route: route, handler: handler})
+	}
+	if easy.apikeys != nil {
+		endpoints = append(endpoints, easy.apiKeyEndpoints()...)
+	}
+	if easy.lockout != nil {
+		endpoints = append(endpoints, easy.lockoutEndpoints()...)
+	}
+	if _, ok := easy.authn.(interfaces.UserManager); ok {
+		endpoints = append(endpoints, easy.userEndpoints()...)
+	}
+	return endpoints
+}
+
+//adminRoutes register the admin API on the transport or, with AdminPort,
+//on a server of its own started with the other components
+func (easy *Easy) adminRoutes() error {
+	a := easy.admin
+	if a.token == "" {
+		// issuing a key or a user, or lifting a lockout, grants access to the
+		// API, whatever the port
+		if easy.apikeys != nil {
+			return errors.New("admin: token cannot be empty to administer the api keys, use AdminToken")
+		}
+		if _, ok := easy.authn.(interfaces.UserManager); ok {
+			return errors.New("admin: token cannot be empty to administer the users, use AdminToken")
+		}
+		if easy.lockout != nil {
+			return errors.New("admin: token cannot be empty to unlock the lockouts, use AdminToken")
+		}
+		if a.port == 0 && !a.insecure {
+			return errors.New("admin: token cannot be empty on the transport port, use AdminToken or AdminInsecure")
+		}
+		easy.Warn("admin API served without a token", "port", a.port)
+	}
+	endpoints := easy.adminEndpoints()
+	if a.port == 0 {
+		if easy.transport == nil {
+			return errors.New("admin: transport cannot be nil without an admin port")
+		}
+		for _, endpoint := range endpoints {
+			if err := easy.transport.Handler(endpoint.mode, endpoint.route, endpoint.handler); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	router := gin.New()
+	router.Use(gin.Recovery())
+	for _, endpoint := range endpoints {
+		router.Handle(strings.ToUpper(endpoint.mode), endpoint.route, endpoint.handler)
+	}
+	return easy.lifecycle.Add("admin", lifecycle.Func{
+		OnStart: func(ctx context.Context) error {
+			listener, err := net.Listen("tcp", fmt.Sprintf(":%d", a.port))
+			if err != nil {
+				return err
+			}
+			a.server = &http.Server{Handler: router}
+			go func() {
+				if err := a.server.Serve(listener); err != nil && err != http.ErrServerClosed {
+					easy.Error("admin server stopped", "error", err)
+				}
+			}()
+			easy.Info("admin server listening", "port", a.port)
+			return nil
+		},
+		OnStop: func(ctx context.Context) error {
+			if a.server == nil {
+				return nil
+			}
+			return a.server.Shutdown(ctx)
+		},
+	})
+}
@@ -0,0 +1,71 @@
+package easy_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/advancedlogic/easy/easy"
+	"github.com/advancedlogic/easy/easytest"
+	"github.com/advancedlogic/easy/interfaces"
+	"github.com/advancedlogic/easy/transport/rest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWithAdmin(t *testing.T) {
+	service := easytest.Start(t,
+		easy.WithVersion("1.2.3"),
+		easy.WithAdmin(easy.AdminToken("s3cr3t")),
+		easy.BindTopic("orders"))
+	defer service.Close()
+	service.Configuration.Set("vault.token", "root")
+	service.Configuration.Set("vault.servers", []interface{}{"http://vault:8200"})
+
+	response, err := service.Get("/admin")
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusUnauthorized, response.StatusCode)
+
+	request, _ := http.NewRequest(http.MethodGet, "/admin", nil)
+	request.Header.Set("Authorization", "Bearer s3cr3t")
+	response, err = service.Do(request)
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	var info easy.Introspection
+	assert.Nil(t, json.NewDecoder(response.Body).Decode(&info))
+
+	assert.Equal(t, "easytest", info.Name)
+	assert.Equal(t, "1.2.3", info.Version)
+	assert.True(t, info.Running)
+	assert.Equal(t, []string{"orders"}, info.Subscriptions)
+	assert.Contains(t, info.Routes, interfaces.Route{Mode: "get", Path: "/admin"})
+	vault := info.Configuration["vault"].(map[string]interface{})
+	assert.Equal(t, easy.Redacted, vault["token"])
+	assert.Equal(t, []interface{}{"http://vault:8200"}, vault["servers"])
+
+	implementations := make(map[string]string)
+	for _, component := range info.Components {
+		implementations[component.Name] = component.Implementation
+	}
+	assert.Equal(t, "*easytest.Broker", implementations["broker"])
+	assert.Equal(t, "*rest.Rest", implementations["transport"])
+}
+
+// plain hide the user management of an authn
+type plain struct {
+	interfaces.AuthN
+}
+
+func TestWithAdmin_Token(t *testing.T) {
+	transport, _ := rest.New()
+	service, err := easy.New(easy.WithTransport(transport), easy.WithAdmin())
+	assert.Nil(t, err)
+	assert.NotNil(t, service.Start(context.Background()))
+
+	// without users to administer
+	insecure := easytest.Start(t, easy.WithAuthN(plain{easytest.NewAuthN()}), easy.WithAdmin(easy.AdminInsecure()))
+	defer insecure.Close()
+	response, err := insecure.Get("/admin")
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+}
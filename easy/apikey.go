@@ -0,0 +1,152 @@
+package easy
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/advancedlogic/easy/authz/apikey"
+	"github.com/advancedlogic/easy/commons"
+	"github.com/advancedlogic/easy/interfaces"
+	"github.com/gin-gonic/gin"
+)
+
+type apiKeyKey struct{}
+
+//WithAPIKeys accept API keys for the machine-to-machine callers. The keys are
+//kept in the store of the µs unless apikey.WithStore gives another one and,
+//with WithAdmin, are issued, listed, scoped and revoked through the admin API
+func WithAPIKeys(options ...apikey.Option) Option {
+	return func(easy *Easy) error {
+		m, err := apikey.New(options...)
+		if err != nil {
+			return err
+		}
+		easy.apikeys = m
+		return nil
+	}
+}
+
+//APIKeys return the manager of the API keys, nil without WithAPIKeys
+func (easy *Easy) APIKeys() *apikey.Manager {
+	return easy.apikeys
+}
+
+//APIKeyFromContext return the API key authenticated by APIKey
+func APIKeyFromContext(ctx context.Context) (*apikey.Key, bool) {
+	if c, ok := ctx.(*gin.Context); ok {
+		ctx = c.Request.Context()
+	}
+	key, ok := ctx.Value(apiKeyKey{}).(*apikey.Key)
+	return key, ok
+}
+
+//APIKey return a handler answering 401 without a valid API key in the
+//X-API-Key header, 429 when the key is over its rate limit and 403 when it is
+//not granted every one of scopes. Register it before the handler of a route:
+//
+//	service.Handler("post", "/imports", service.APIKey("imports:write"))
+//	service.Handler("post", "/imports", importOrders)
+//
+//The subject of the request is apikey:<id>
+func (easy *Easy) APIKey(scopes ...string) func(*gin.Context) {
+	return func(c *gin.Context) {
+		if easy.apikeys == nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "api keys not configured"})
+			return
+		}
+		token := c.GetHeader(easy.apikeys.Header())
+		if token == "" {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "missing api key"})
+			return
+		}
+		key, err := easy.apikeys.AuthenticateContext(c.Request.Context(), token)
+		var limited *apikey.RateLimitError
+		switch {
+		case errors.As(err, &limited):
+			c.Header("Retry-After", strconv.Itoa(int(math.Ceil(limited.RetryAfter.Seconds()))))
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"error": err.Error()})
+			return
+		case err == apikey.ErrInvalidKey || err == apikey.ErrExpiredKey:
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		case err != nil:
+			easy.Error("api key check failed", "error", err)
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if !key.Allowed(scopes...) {
+			easy.Debug("access denied", "key", key.ID, "path", c.Request.URL.Path, "scopes", scopes)
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "forbidden"})
+			return
+		}
+		ctx := context.WithValue(c.Request.Context(), apiKeyKey{}, key)
+		ctx = ContextWithSubject(ctx, interfaces.Subject{ID: "apikey:" + key.ID})
+		c.Request = c.Request.WithContext(ctx)
+		c.Next()
+	}
+}
+
+//apiKeyEndpoints return the admin routes of the API keys: list and issue on
+//apikeys, replace the scopes on apikeys/:id/scopes and revoke on apikeys/:id
+func (easy *Easy) apiKeyEndpoints() []adminEndpoint {
+	handle := easy.admin.guard
+	route := adminRoute + "/apikeys"
+	return []adminEndpoint{
+		{commons.ModeGet, route, handle(func(c *gin.Context) {
+			keys, err := easy.apikeys.ListContext(c.Request.Context())
+			respond(c, http.StatusOK, keys, err)
+		})},
+		{commons.ModePost, route, handle(func(c *gin.Context) {
+			var spec apikey.Spec
+			if err := c.ShouldBindJSON(&spec); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			token, key, err := easy.apikeys.IssueContext(c.Request.Context(), spec)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			easy.Info("api key issued", "id", key.ID, "name", key.Name)
+			c.JSON(http.StatusCreated, struct {
+				*apikey.Key
+				Token string `json:"key"`
+			}{key, token})
+		})},
+		{commons.ModePut, route + "/:id/scopes", handle(func(c *gin.Context) {
+			var body struct {
+				Scopes []string `json:"scopes"`
+			}
+			if err := c.ShouldBindJSON(&body); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			key, err := easy.apikeys.ScopeContext(c.Request.Context(), c.Param("id"), body.Scopes)
+			if err == nil {
+				easy.Info("api key scoped", "id", key.ID, "scopes", key.Scopes)
+			}
+			respond(c, http.StatusOK, key, err)
+		})},
+		{commons.ModeDelete, route + "/:id", handle(func(c *gin.Context) {
+			err := easy.apikeys.RevokeContext(c.Request.Context(), c.Param("id"))
+			if err == nil {
+				easy.Info("api key revoked", "id", c.Param("id"))
+			}
+			respond(c, http.StatusNoContent, nil, err)
+		})},
+	}
+}
+
+//setupAPIKeys give the API keys the store of the µs
+func (easy *Easy) setupAPIKeys() error {
+	if easy.apikeys.HasStore() {
+		return nil
+	}
+	if easy.store == nil {
+		return errors.New("api keys: store cannot be nil")
+	}
+	return easy.apikeys.WithStore(easy.store)
+}
@@ -0,0 +1,110 @@
+package easy_test
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/advancedlogic/easy/authz/apikey"
+	"github.com/advancedlogic/easy/easy"
+	"github.com/advancedlogic/easy/easytest"
+	"github.com/advancedlogic/easy/transport/rest"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAPIKey(t *testing.T) {
+	routes := func(e *easy.Easy) error {
+		if err := e.Handler("post", "/imports", e.APIKey("imports:write")); err != nil {
+			return err
+		}
+		return e.Handler("post", "/imports", func(c *gin.Context) {
+			user, _ := easy.UserFromContext(c)
+			key, _ := easy.APIKeyFromContext(c)
+			c.String(http.StatusOK, user+" "+key.Name)
+		})
+	}
+	service := easytest.Start(t,
+		easy.WithAdmin(easy.AdminToken("admin-token")),
+		easy.WithAPIKeys(apikey.WithTouchInterval(0)),
+		routes)
+	defer service.Close()
+
+	call := func(method, path string, header http.Header, body string) (int, string) {
+		request, _ := http.NewRequest(method, path, strings.NewReader(body))
+		request.Header = header
+		response, err := service.Do(request)
+		assert.Nil(t, err)
+		defer response.Body.Close()
+		b, _ := ioutil.ReadAll(response.Body)
+		return response.StatusCode, string(b)
+	}
+	admin := http.Header{"Authorization": {"Bearer admin-token"}}
+
+	status, _ := call("POST", "/admin/apikeys", nil, `{"name":"batch"}`)
+	assert.Equal(t, http.StatusUnauthorized, status)
+	status, _ = call("POST", "/admin/apikeys", admin, `{"scopes":["imports:write"]}`)
+	assert.Equal(t, http.StatusBadRequest, status)
+	status, body := call("POST", "/admin/apikeys", admin, `{"name":"batch","scopes":["imports:write"],"rate_limit":2}`)
+	assert.Equal(t, http.StatusCreated, status)
+	var issued struct {
+		ID  string `json:"id"`
+		Key string `json:"key"`
+	}
+	assert.Nil(t, json.Unmarshal([]byte(body), &issued))
+	assert.NotEmpty(t, issued.Key)
+
+	status, _ = call("POST", "/imports", nil, "")
+	assert.Equal(t, http.StatusUnauthorized, status)
+	status, _ = call("POST", "/imports", http.Header{"X-Api-Key": {"ek_wrong_key"}}, "")
+	assert.Equal(t, http.StatusUnauthorized, status)
+	key := http.Header{"X-Api-Key": {issued.Key}}
+	status, body = call("POST", "/imports", key, "")
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "apikey:"+issued.ID+" batch", body)
+
+	status, body = call("GET", "/admin/apikeys", admin, "")
+	assert.Equal(t, http.StatusOK, status)
+	var keys []apikey.Key
+	assert.Nil(t, json.Unmarshal([]byte(body), &keys))
+	assert.Len(t, keys, 1)
+	assert.NotNil(t, keys[0].LastUsed)
+	assert.NotContains(t, body, issued.Key)
+
+	status, _ = call("PUT", "/admin/apikeys/"+issued.ID+"/scopes", admin, `{"scopes":["reports:read"]}`)
+	assert.Equal(t, http.StatusOK, status)
+	status, _ = call("POST", "/imports", key, "")
+	assert.Equal(t, http.StatusForbidden, status)
+	// the third request of the minute is over the rate limit
+	request, _ := http.NewRequest("POST", "/imports", nil)
+	request.Header = key
+	response, err := service.Do(request)
+	assert.Nil(t, err)
+	response.Body.Close()
+	assert.Equal(t, http.StatusTooManyRequests, response.StatusCode)
+	assert.NotEmpty(t, response.Header.Get("Retry-After"))
+
+	status, _ = call("DELETE", "/admin/apikeys/"+issued.ID, admin, "")
+	assert.Equal(t, http.StatusNoContent, status)
+	status, _ = call("DELETE", "/admin/apikeys/"+issued.ID, admin, "")
+	assert.Equal(t, http.StatusNotFound, status)
+	status, _ = call("POST", "/imports", key, "")
+	assert.Equal(t, http.StatusUnauthorized, status)
+}
+
+func TestAPIKey_AdminToken(t *testing.T) {
+	for _, option := range []easy.AdminOption{easy.AdminInsecure(), easy.AdminPort(9090)} {
+		transport, _ := rest.New()
+		service, err := easy.New(easy.WithTransport(transport), easy.WithStore(easytest.NewStore()),
+			easy.WithAdmin(option), easy.WithAPIKeys())
+		assert.Nil(t, err)
+		err = service.Start(context.Background())
+		assert.NotNil(t, err)
+		if err != nil {
+			assert.Contains(t, err.Error(), "api keys")
+		}
+	}
+}
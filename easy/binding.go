@@ -0,0 +1,308 @@
+package easy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"unicode/utf8"
+
+	"github.com/advancedlogic/easy/executor"
+	"github.com/advancedlogic/easy/interfaces"
+	"github.com/gin-gonic/gin"
+)
+
+type BindingOption func(*binding) error
+
+//Decoder turn the raw input of a binding into the data given to the processor
+type Decoder func([]byte) (interface{}, error)
+
+//Encoder turn the output of the processor into the payload of a binding
+type Encoder func(interface{}) ([]byte, error)
+
+//defaultMaxBody is the largest request body of a route binding, 1 MiB
+const defaultMaxBody = 1 << 20
+
+type binding struct {
+	topic       string
+	mode        string
+	route       string
+	output      string
+	contentType string
+	maxBody     int64
+	decoder     Decoder
+	encoder     Encoder
+}
+
+//PublishTo publish the output of the processor on topic. For a route the
+//response is then 202 Accepted instead of the output itself
+func PublishTo(topic string) BindingOption {
+	return func(b *binding) error {
+		if topic != "" {
+			b.output = topic
+			return nil
+		}
+		return errors.New("topic cannot be empty")
+	}
+}
+
+//WithDecoder replace the default decoder, which pass the input as a string
+func WithDecoder(decoder Decoder) BindingOption {
+	return func(b *binding) error {
+		if decoder != nil {
+			b.decoder = decoder
+			return nil
+		}
+		return errors.New("decoder cannot be nil")
+	}
+}
+
+//WithEncoder replace the default encoder, which keep strings and []byte
+//as they are and marshal anything else to JSON
+func WithEncoder(encoder Encoder) BindingOption {
+	return func(b *binding) error {
+		if encoder != nil {
+			b.encoder = encoder
+			return nil
+		}
+		return errors.New("encoder cannot be nil")
+	}
+}
+
+//WithContentType set the content type of the responses of a route binding.
+//Without it, an output is sent as application/json when it is valid JSON and
+//as text/plain otherwise
+func WithContentType(contentType string) BindingOption {
+	return func(b *binding) error {
+		if contentType != "" {
+			b.contentType = contentType
+			return nil
+		}
+		return errors.New("content type cannot be empty")
+	}
+}
+
+//WithMaxBody set the largest request body of a route binding, 1 MiB by
+//default. A larger body is answered 413
+func WithMaxBody(bytes int64) BindingOption {
+	return func(b *binding) error {
+		if bytes > 0 {
+			b.maxBody = bytes
+			return nil
+		}
+		return errors.New("max body must be positive")
+	}
+}
+
+//JSONDecoder unmarshal the input into a generic value
+func JSONDecoder(data []byte) (interface{}, error) {
+	var value interface{}
+	if err := json.Unmarshal(data, &value); err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+func stringDecoder(data []byte) (interface{}, error) {
+	return string(data), nil
+}
+
+func defaultEncoder(output interface{}) ([]byte, error) {
+	switch o := output.(type) {
+	case []byte:
+		return o, nil
+	case string:
+		return []byte(o), nil
+	default:
+		return json.Marshal(o)
+	}
+}
+
+func newBinding(options []BindingOption) (*binding, error) {
+	b := &binding{
+		maxBody: defaultMaxBody,
+		decoder: stringDecoder,
+		encoder: defaultEncoder,
+	}
+	for _, option := range options {
+		if err := option(b); err != nil {
+			return nil, err
+		}
+	}
+	return b, nil
+}
+
+//BindTopic feed the processor with the messages published on topic. The output
+//is published on the PublishTo topic or, for request/reply messages, on the reply subject
+func BindTopic(topic string, options ...BindingOption) Option {
+	return func(easy *Easy) error {
+		if topic == "" {
+			return errors.New("topic cannot be empty")
+		}
+		b, err := newBinding(options)
+		if err != nil {
+			return err
+		}
+		b.topic = topic
+		easy.bindings = append(easy.bindings, b)
+		return nil
+	}
+}
+
+//BindRoute feed the processor with the body of the requests received on route.
+//The output is the response or, with PublishTo, is published on a topic
+func BindRoute(mode, route string, options ...BindingOption) Option {
+	return func(easy *Easy) error {
+		if mode == "" || route == "" {
+			return errors.New("mode and route cannot be empty")
+		}
+		b, err := newBinding(options)
+		if err != nil {
+			return err
+		}
+		b.mode = mode
+		b.route = route
+		easy.bindings = append(easy.bindings, b)
+		return nil
+	}
+}
+
+//bind register the bindings on the broker and the transport, the processor
+//is looked up on every call so that it can be replaced at runtime
+func (easy *Easy) bind() error {
+	for _, b := range easy.bindings {
+		if b.output != "" && easy.broker == nil {
+			return fmt.Errorf("output %s: broker cannot be nil", b.output)
+		}
+		if b.topic != "" {
+			if easy.broker == nil {
+				return fmt.Errorf("topic %s: broker cannot be nil", b.topic)
+			}
+			if err := easy.broker.Subscribe(b.topic, interfaces.MessageHandler(easy.topicHandler(b))); err != nil {
+				return err
+			}
+			continue
+		}
+		if easy.transport == nil {
+			return fmt.Errorf("route %s: transport cannot be nil", b.route)
+		}
+		if err := easy.transport.Handler(b.mode, b.route, easy.routeHandler(b)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//handler name the binding for the executor limits: its topic or its route
+func (b *binding) handler() string {
+	if b.topic != "" {
+		return b.topic
+	}
+	return b.route
+}
+
+//process run the processor through the executor, unless there is none or the
+//broker already hands the messages to it
+func (easy *Easy) process(ctx context.Context, b *binding, data []byte) ([]byte, error) {
+	if easy.executor == nil || (b.topic != "" && easy.brokerExecutes) {
+		return easy.processNow(ctx, b, data)
+	}
+	var output []byte
+	err := easy.executor.Run(ctx, b.handler(), func(ctx context.Context) error {
+		var err error
+		output, err = easy.processNow(ctx, b, data)
+		return err
+	})
+	return output, err
+}
+
+func (easy *Easy) processNow(ctx context.Context, b *binding, data []byte) ([]byte, error) {
+	processor := easy.Processor()
+	if processor == nil {
+		return nil, errors.New("processor cannot be nil")
+	}
+	input, err := b.decoder(data)
+	if err != nil {
+		return nil, err
+	}
+	output, err := processor.ProcessContext(ctx, input)
+	if err != nil || output == nil {
+		return nil, err
+	}
+	return b.encoder(output)
+}
+
+func (easy *Easy) topicHandler(b *binding) interfaces.MessageHandler {
+	return func(ctx context.Context, message *interfaces.Message) error {
+		output, err := easy.process(ctx, b, message.Data)
+		if err != nil || output == nil {
+			return err
+		}
+		switch {
+		case b.output != "":
+			return easy.broker.PublishContext(ctx, b.output, output)
+		case message.Reply != "":
+			return easy.broker.PublishContext(ctx, message.Reply, output)
+		}
+		return nil
+	}
+}
+
+func (easy *Easy) routeHandler(b *binding) func(*gin.Context) {
+	return func(c *gin.Context) {
+		ctx := c.Request.Context()
+		body, err := ioutil.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, b.maxBody))
+		if err != nil {
+			// the reader stops at the limit, a body reaching it is too large
+			if int64(len(body)) >= b.maxBody {
+				c.String(http.StatusRequestEntityTooLarge, fmt.Sprintf("body larger than %d bytes", b.maxBody))
+				return
+			}
+			c.String(http.StatusBadRequest, err.Error())
+			return
+		}
+		output, err := easy.process(ctx, b, body)
+		switch err {
+		case nil:
+		case executor.ErrRejected, executor.ErrDropped, executor.ErrStopped:
+			c.Header("Retry-After", "1")
+			c.String(http.StatusServiceUnavailable, err.Error())
+			return
+		default:
+			c.String(http.StatusInternalServerError, err.Error())
+			return
+		}
+		if b.output != "" {
+			if output != nil {
+				if err := easy.broker.PublishContext(ctx, b.output, output); err != nil {
+					c.String(http.StatusBadGateway, err.Error())
+					return
+				}
+			}
+			c.Status(http.StatusAccepted)
+			return
+		}
+		if output == nil {
+			c.Status(http.StatusNoContent)
+			return
+		}
+		c.Data(http.StatusOK, b.responseType(output), output)
+	}
+}
+
+//responseType return the declared content type of the responses or, without
+//one, the type of the output: JSON, text or raw bytes
+func (b *binding) responseType(output []byte) string {
+	switch {
+	case b.contentType != "":
+		return b.contentType
+	case json.Valid(output):
+		return "application/json"
+	case utf8.Valid(output):
+		return "text/plain; charset=utf-8"
+	default:
+		return "application/octet-stream"
+	}
+}
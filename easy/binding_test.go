@@ -0,0 +1,91 @@
+package easy
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/advancedlogic/easy/pipeline"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBindRoute(t *testing.T) {
+	upper := pipeline.Func(func(ctx context.Context, data interface{}) (interface{}, error) {
+		return strings.ToUpper(data.(string)), nil
+	})
+	easy, err := New(WithProcessor(upper), BindRoute("post", "/upper"))
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(easy.bindings))
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/upper", strings.NewReader("hello"))
+	easy.routeHandler(easy.bindings[0])(c)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "HELLO", w.Body.String())
+}
+
+func TestBindTopicWithoutBroker(t *testing.T) {
+	easy, _ := New(BindTopic("in", PublishTo("out")))
+	assert.NotNil(t, easy.bind())
+}
+
+func TestBindRoute_Responses(t *testing.T) {
+	echo := pipeline.Func(func(ctx context.Context, data interface{}) (interface{}, error) {
+		switch data.(string) {
+		case "fail":
+			return nil, errors.New("processor failed")
+		case "nothing":
+			return nil, nil
+		case "object":
+			return map[string]int{"answer": 42}, nil
+		}
+		return data, nil
+	})
+	easy, err := New(WithProcessor(echo),
+		BindRoute("post", "/echo", WithMaxBody(16)),
+		BindRoute("post", "/csv", WithContentType("text/csv")))
+	assert.Nil(t, err)
+	_, err = New(BindRoute("post", "/echo", WithMaxBody(0)))
+	assert.NotNil(t, err)
+	_, err = New(BindRoute("post", "/echo", WithContentType("")))
+	assert.NotNil(t, err)
+
+	call := func(b *binding, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+		easy.routeHandler(b)(c)
+		// a status without body is written when the request ends
+		c.Writer.WriteHeaderNow()
+		return w
+	}
+	route, csv := easy.bindings[0], easy.bindings[1]
+
+	w := call(route, "hello")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "text/plain; charset=utf-8", w.Header().Get("Content-Type"))
+	w = call(route, "object")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+	assert.JSONEq(t, `{"answer":42}`, w.Body.String())
+	w = call(csv, "a,b")
+	assert.Equal(t, "text/csv", w.Header().Get("Content-Type"))
+
+	assert.Equal(t, http.StatusNoContent, call(route, "nothing").Code)
+	assert.Equal(t, http.StatusInternalServerError, call(route, "fail").Code)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, call(route, strings.Repeat("x", 17)).Code)
+	assert.Equal(t, http.StatusOK, call(route, strings.Repeat("x", 16)).Code)
+
+	// without a processor
+	empty, _ := New(BindRoute("post", "/echo"))
+	w = httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/", strings.NewReader("hello"))
+	empty.routeHandler(empty.bindings[0])(c)
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+}
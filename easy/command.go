@@ -0,0 +1,238 @@
+package easy
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"runtime"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/advancedlogic/easy/broker/nats"
+	"github.com/advancedlogic/easy/registry/consul"
+	"github.com/advancedlogic/easy/transport/rest"
+	"github.com/spf13/cobra"
+)
+
+//Command turn the µs into a CLI with the standard subcommands:
+//serve, config print, config validate, health, routes and version.
+//Flags are applied on top of the options the µs was created with
+func Command(easy *Easy) *cobra.Command {
+	var (
+		id              string
+		name            string
+		logLevel        string
+		port            int
+		cors            bool
+		brokerEndpoint  string
+		registryAddress string
+	)
+
+	root := &cobra.Command{
+		Use:           easy.name,
+		Short:         fmt.Sprintf("%s microservice", easy.name),
+		SilenceUsage:  true,
+		SilenceErrors: true,
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			flags := cmd.Flags()
+			options := make([]Option, 0)
+			if flags.Changed("id") {
+				options = append(options, WithID(id))
+			}
+			if flags.Changed("name") {
+				options = append(options, WithName(name))
+				if _, ok := easy.registry.(*consul.Consul); ok {
+					options = append(options, WithRegistryOptions(consul.WithName(name)))
+				}
+			}
+			if flags.Changed("log-level") {
+				options = append(options, WithLogLevel(logLevel))
+			}
+			if _, ok := easy.transport.(*rest.Rest); ok {
+				if flags.Changed("port") {
+					options = append(options, WithTransportOptions(rest.WithPort(port)))
+				}
+				if flags.Changed("cors") && cors {
+					options = append(options, WithTransportOptions(rest.EnableCORS()))
+				}
+			}
+			if _, ok := easy.broker.(*nats.Nats); ok && flags.Changed("broker-endpoint") {
+				options = append(options, WithBrokerOptions(nats.WithEndpoint(brokerEndpoint)))
+			}
+			if _, ok := easy.registry.(*consul.Consul); ok && flags.Changed("registry-address") {
+				options = append(options, WithRegistryOptions(consul.WithAddress(registryAddress)))
+			}
+			for _, option := range options {
+				if err := option(easy); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	}
+
+	flags := root.PersistentFlags()
+	flags.StringVar(&id, "id", easy.id, "service id")
+	flags.StringVar(&name, "name", easy.name, "service name")
+	flags.StringVar(&logLevel, "log-level", "info", "log level: debug, info, warn or error")
+	flags.IntVar(&port, "port", 8080, "transport port")
+	flags.BoolVar(&cors, "cors", false, "enable CORS on the transport")
+	flags.StringVar(&brokerEndpoint, "broker-endpoint", "", "broker endpoint")
+	flags.StringVar(&registryAddress, "registry-address", "", "registry address")
+	if easy.transport != nil {
+		flags.Lookup("port").DefValue = fmt.Sprintf("%d", easy.transport.Port())
+		port = easy.transport.Port()
+	}
+
+	root.AddCommand(
+		serveCommand(easy),
+		configCommand(easy),
+		healthCommand(easy),
+		routesCommand(easy),
+		versionCommand(easy),
+	)
+	return root
+}
+
+func serveCommand(easy *Easy) *cobra.Command {
+	return &cobra.Command{
+		Use:   "serve",
+		Short: "Start the service and block until it is stopped",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return easy.Run()
+		},
+	}
+}
+
+func configCommand(easy *Easy) *cobra.Command {
+	config := &cobra.Command{
+		Use:   "config",
+		Short: "Inspect the service configuration",
+	}
+	printConfig := &cobra.Command{
+		Use:   "print",
+		Short: "Print the effective configuration as JSON, secrets redacted",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if easy.configuration == nil {
+				return errors.New("configuration cannot be nil")
+			}
+			b, err := json.MarshalIndent(redact(easy.configuration.AllSettings(), easy.secrets()), "", "  ")
+			if err != nil {
+				return err
+			}
+			fmt.Fprintln(cmd.OutOrStdout(), string(b))
+			return nil
+		},
+	}
+	validate := &cobra.Command{
+		Use:   "validate",
+		Short: "Check the configuration and the component wiring",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if easy.configuration == nil {
+				return errors.New("configuration cannot be nil")
+			}
+			if err := easy.prepare(); err != nil {
+				return err
+			}
+			order, err := easy.lifecycle.Order()
+			if err != nil {
+				return err
+			}
+			for _, component := range []interface{}{
+				easy.configuration, easy.registry, easy.transport, easy.broker,
+				easy.client, easy.store, easy.processor, easy.authn, easy.cache,
+			} {
+				if validator, ok := component.(interface{ Validate() error }); ok {
+					if err := validator.Validate(); err != nil {
+						return err
+					}
+				}
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "configuration is valid, components start order: %s\n", strings.Join(order, ", "))
+			return nil
+		},
+	}
+	config.AddCommand(printConfig, validate)
+	return config
+}
+
+func healthCommand(easy *Easy) *cobra.Command {
+	var (
+		url     string
+		timeout time.Duration
+	)
+	health := &cobra.Command{
+		Use:   "health",
+		Short: "Query the readiness endpoint of a running instance",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if url == "" {
+				if easy.transport == nil {
+					return errors.New("transport cannot be nil")
+				}
+				url = fmt.Sprintf("http://localhost:%d%s", easy.transport.Port(), readinessRoute)
+			}
+			client := &http.Client{Timeout: timeout}
+			response, err := client.Get(url)
+			if err != nil {
+				return err
+			}
+			defer response.Body.Close()
+			body, err := ioutil.ReadAll(response.Body)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintln(cmd.OutOrStdout(), string(body))
+			if response.StatusCode != http.StatusOK {
+				return fmt.Errorf("%s answered %s", url, response.Status)
+			}
+			return nil
+		},
+	}
+	health.Flags().StringVar(&url, "url", "", "readiness endpoint, default to the local transport port")
+	health.Flags().DurationVar(&timeout, "timeout", 5*time.Second, "request timeout")
+	return health
+}
+
+func routesCommand(easy *Easy) *cobra.Command {
+	return &cobra.Command{
+		Use:   "routes",
+		Short: "List the routes registered on the transport",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if easy.transport == nil {
+				return errors.New("transport cannot be nil")
+			}
+			if err := easy.prepare(); err != nil {
+				return err
+			}
+			w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 4, 2, ' ', 0)
+			for _, route := range easy.transport.Routes() {
+				fmt.Fprintf(w, "%s\t%s\n", strings.ToUpper(route.Mode), route.Path)
+			}
+			return w.Flush()
+		},
+	}
+}
+
+func versionCommand(easy *Easy) *cobra.Command {
+	return &cobra.Command{
+		Use:   "version",
+		Short: "Print the service version",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			version := easy.version
+			if version == "" {
+				version = "unknown"
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "%s %s (id %s, %s)\n", easy.name, version, easy.id, runtime.Version())
+			return nil
+		},
+	}
+}
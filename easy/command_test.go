@@ -0,0 +1,55 @@
+package easy
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/advancedlogic/easy/configuration/viper"
+	"github.com/advancedlogic/easy/transport/rest"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCommand_Version(t *testing.T) {
+	easy, _ := New(WithName("test"), WithVersion("1.0.0"))
+	out := new(bytes.Buffer)
+	cmd := Command(easy)
+	cmd.SetOutput(out)
+	cmd.SetArgs([]string{"version", "--id", "123"})
+	assert.Nil(t, cmd.Execute())
+	assert.Contains(t, out.String(), "test 1.0.0 (id 123")
+}
+
+func TestCommand_Routes(t *testing.T) {
+	transport, _ := rest.New()
+	easy, _ := New(WithTransport(transport))
+	assert.Nil(t, easy.GET("/hello", func(c *gin.Context) {}))
+	out := new(bytes.Buffer)
+	cmd := Command(easy)
+	cmd.SetOutput(out)
+	cmd.SetArgs([]string{"routes", "--port", "9090"})
+	assert.Nil(t, cmd.Execute())
+	assert.Contains(t, out.String(), "GET")
+	assert.Contains(t, out.String(), "/hello")
+	assert.Equal(t, 9090, easy.Transport().Port())
+}
+
+func TestCommand_ConfigPrint(t *testing.T) {
+	file, _ := ioutil.TempFile("", "config*.json")
+	defer os.Remove(file.Name())
+	file.WriteString(`{"db": {"host": "localhost", "password": "hunter2"}}`)
+	file.Close()
+	configuration, _ := viper.New(viper.WithFile(file.Name()))
+	easy, err := New(WithConfiguration(configuration))
+	assert.Nil(t, err)
+	out := new(bytes.Buffer)
+	cmd := Command(easy)
+	cmd.SetOutput(out)
+	cmd.SetArgs([]string{"config", "print"})
+	assert.Nil(t, cmd.Execute())
+	assert.Contains(t, out.String(), "localhost")
+	assert.NotContains(t, out.String(), "hunter2")
+	assert.Contains(t, out.String(), Redacted)
+}
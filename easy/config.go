@@ -0,0 +1,137 @@
+package easy
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/advancedlogic/easy/configuration/viper"
+	"github.com/advancedlogic/easy/executor"
+	"github.com/advancedlogic/easy/factory"
+	"github.com/advancedlogic/easy/interfaces"
+)
+
+//FromConfig create a µs from a YAML, TOML or JSON document that declares its components:
+//
+//	name: orders
+//	registry:
+//	  type: consul
+//	  settings:
+//	    address: consul:8500
+//	broker:
+//	  type: nats
+//	  settings:
+//	    endpoint: nats:4222
+//	transport:
+//	  type: rest
+//	  settings:
+//	    port: 8080
+//	executor:
+//	  workers: 8
+//	  queue: 100
+//	  policy: reject
+//	  limits:
+//	    orders: 2
+//
+//Components are built through the factory package, so any implementation
+//registered with factory.Register can be used. A missing section or the type
+//"none" leaves the component out. The document is also the µs configuration
+func FromConfig(path string, options ...Option) (*Easy, error) {
+	configuration, err := viper.New(
+		viper.WithFile(path),
+		viper.FromEnv())
+	if err != nil {
+		return nil, err
+	}
+	if err := configuration.Open(); err != nil {
+		return nil, err
+	}
+
+	defaults := []Option{
+		FromEnv(),
+	}
+	if name := configuration.GetStringOrDefault("name", ""); name != "" {
+		defaults = append([]Option{WithName(name)}, defaults...)
+	}
+	if id := configuration.GetStringOrDefault("id", ""); id != "" {
+		defaults = append([]Option{WithID(id)}, defaults...)
+	}
+	if version := configuration.GetStringOrDefault("version", ""); version != "" {
+		defaults = append([]Option{WithVersion(version)}, defaults...)
+	}
+	defaults = append(defaults, WithConfiguration(configuration))
+	for _, kind := range []string{factory.Cache, factory.Store, factory.Broker, factory.AuthN, factory.AuthZ, factory.Transport, factory.Registry} {
+		defaults = append(defaults, withComponent(kind, configuration.Child(kind)))
+	}
+	if configuration.IsSet("executor") {
+		defaults = append(defaults, withExecutor(configuration.Child("executor")))
+	}
+
+	return New(append(defaults, options...)...)
+}
+
+func withComponent(kind string, section *viper.Viper) Option {
+	return func(easy *Easy) error {
+		name := section.GetStringOrDefault("type", "none")
+		if name == "none" {
+			return nil
+		}
+		settings := section.Child("settings")
+		settings.SetDefault("name", easy.name)
+		settings.SetDefault("id", easy.id)
+		if kind == factory.Registry {
+			settings.SetDefault("health_endpoint", "health/ready")
+		}
+		component, err := factory.New(kind, name, settings)
+		if err != nil {
+			return err
+		}
+		var assigned bool
+		switch kind {
+		case factory.Registry:
+			easy.registry, assigned = component.(interfaces.Registry)
+		case factory.Broker:
+			easy.broker, assigned = component.(interfaces.Broker)
+		case factory.Cache:
+			easy.cache, assigned = component.(interfaces.Cache)
+		case factory.Store:
+			easy.store, assigned = component.(interfaces.Store)
+		case factory.AuthN:
+			easy.authn, assigned = component.(interfaces.AuthN)
+		case factory.AuthZ:
+			easy.authz, assigned = component.(interfaces.AuthZ)
+		case factory.Transport:
+			easy.transport, assigned = component.(interfaces.Transport)
+		}
+		if !assigned {
+			return fmt.Errorf("%s %s does not implement the %s interface", kind, name, kind)
+		}
+		return nil
+	}
+}
+
+func withExecutor(section *viper.Viper) Option {
+	return func(easy *Easy) error {
+		options := []executor.Option{executor.WithName(easy.name)}
+		if workers := section.GetIntOrDefault("workers", 0); workers > 0 {
+			options = append(options, executor.WithWorkers(workers))
+		}
+		if section.IsSet("queue") {
+			options = append(options, executor.WithQueueSize(section.GetInt("queue")))
+		}
+		if name := section.GetStringOrDefault("policy", ""); name != "" {
+			policy, err := executor.ParsePolicy(name)
+			if err != nil {
+				return err
+			}
+			options = append(options, executor.WithPolicy(policy))
+		}
+		for handler, value := range section.GetMapOfStringOrDefault("limits", nil) {
+			limit, err := strconv.Atoi(value)
+			if err != nil {
+				return fmt.Errorf("executor limit %s: %s", handler, err)
+			}
+			options = append(options, executor.WithLimit(handler, limit))
+		}
+		return WithExecutor(options...)(easy)
+	}
+}
@@ -0,0 +1,66 @@
+package easy
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/advancedlogic/easy/authz/jwt"
+	"github.com/advancedlogic/easy/broker/nats"
+	"github.com/advancedlogic/easy/transport/rest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFromConfig(t *testing.T) {
+	folder, _ := ioutil.TempDir("", "easy")
+	defer os.RemoveAll(folder)
+	path := filepath.Join(folder, "service.yaml")
+	ioutil.WriteFile(path, []byte(`
+name: orders
+registry:
+  type: none
+broker:
+  type: nats
+  settings:
+    endpoint: nats:4222
+transport:
+  type: rest
+  settings:
+    port: 9191
+authz:
+  type: jwt
+  settings:
+    secret: 0123456789abcdef0123456789abcdef
+    issuer: orders
+executor:
+  workers: 2
+  policy: reject
+  limits:
+    orders: 1
+`), 0644)
+
+	easy, err := FromConfig(path)
+	assert.Nil(t, err)
+	assert.Equal(t, easy.Name(), "orders")
+	assert.Nil(t, easy.Registry())
+	assert.Equal(t, easy.Broker().(*nats.Nats).Endpoint(), "nats:4222")
+	assert.Equal(t, easy.Transport().(*rest.Rest).Port(), 9191)
+	assert.Equal(t, easy.Configuration().GetStringOrDefault("name", ""), "orders")
+	assert.NotNil(t, easy.executor)
+	assert.IsType(t, &jwt.JWT{}, easy.AuthZ())
+}
+
+func TestFromConfigUnknownType(t *testing.T) {
+	folder, _ := ioutil.TempDir("", "easy")
+	defer os.RemoveAll(folder)
+	path := filepath.Join(folder, "service.json")
+	ioutil.WriteFile(path, []byte(`{"broker": {"type": "kafka"}}`), 0644)
+
+	_, err := FromConfig(path)
+	assert.NotNil(t, err)
+
+	ioutil.WriteFile(path, []byte(`{"executor": {"policy": "ignore"}}`), 0644)
+	_, err = FromConfig(path)
+	assert.NotNil(t, err)
+}
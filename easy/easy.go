@@ -1,17 +1,36 @@
 package easy
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"io/ioutil"
 	"net/http"
-	"plugin"
+	"sync/atomic"
+	"time"
 
 	"github.com/advancedlogic/easy/authn/fs"
+	"github.com/advancedlogic/easy/authn/lockout"
+	"github.com/advancedlogic/easy/authn/reset"
+	"github.com/advancedlogic/easy/authz/abac"
+	"github.com/advancedlogic/easy/authz/apikey"
+	"github.com/advancedlogic/easy/authz/jwt"
+	"github.com/advancedlogic/easy/authz/rbac"
 	"github.com/advancedlogic/easy/broker/nats"
+	"github.com/advancedlogic/easy/cache/ledis"
 	"github.com/advancedlogic/easy/commons"
 	"github.com/advancedlogic/easy/configuration/viper"
+	"github.com/advancedlogic/easy/executor"
+	"github.com/advancedlogic/easy/flags"
+	"github.com/advancedlogic/easy/health"
+	"github.com/advancedlogic/easy/hotswap"
 	"github.com/advancedlogic/easy/interfaces"
+	"github.com/advancedlogic/easy/lifecycle"
+	"github.com/advancedlogic/easy/logging"
 	"github.com/advancedlogic/easy/registry/consul"
+	"github.com/advancedlogic/easy/scheduler"
+	"github.com/advancedlogic/easy/store/minio"
+	"github.com/advancedlogic/easy/store/vault"
 	"github.com/advancedlogic/easy/transport/rest"
 	go_shutdown_hook "github.com/ankit-arora/go-utils/go-shutdown-hook"
 	"github.com/gin-gonic/gin"
@@ -23,10 +42,13 @@ import (
 type Option func(*Easy) error
 
 type Easy struct {
-	id        string
-	name      string
-	isRunning bool
-	logo      string
+	id      string
+	name    string
+	version string
+	// running is read by the readiness checks while Start and Stop write it
+	running  int32
+	prepared bool
+	logo     string
 
 	registry      interfaces.Registry
 	transport     interfaces.Transport
@@ -36,8 +58,24 @@ type Easy struct {
 	processor     interfaces.Processor
 	configuration interfaces.Configuration
 	authn         interfaces.AuthN
+	authz         interfaces.AuthZ
 	cache         interfaces.Cache
-	*logrus.Logger
+	lifecycle     *lifecycle.Manager
+	health        *health.Checker
+	admin         *admin
+	flags         *flags.Flags
+	policy        *rbac.Policy
+	protected     []protected
+	rules         *abac.Engine
+	apikeys       *apikey.Manager
+	lockout       *lockout.Guard
+	reset         *reset.Manager
+	scheduler     *scheduler.Scheduler
+	executor      *executor.Executor
+	bindings      []*binding
+	logger        interfaces.Logger
+
+	brokerExecutes bool
 }
 
 //WithID(id string) set the id of the µs
@@ -62,6 +100,46 @@ func WithName(name string) Option {
 	}
 }
 
+//WithVersion(version string) set the version of the µs
+func WithVersion(version string) Option {
+	return func(easy *Easy) error {
+		if version == "" {
+			return errors.New("version cannot be empty")
+		}
+		easy.version = version
+		return nil
+	}
+}
+
+//WithLogLevel(level string) set the log level: debug, info, warn or error
+func WithLogLevel(level string) Option {
+	return func(easy *Easy) error {
+		l, err := logging.ParseLevel(level)
+		if err != nil {
+			return err
+		}
+		leveled, ok := easy.logger.(logging.Leveled)
+		if !ok {
+			return fmt.Errorf("logger %T does not support levels", easy.logger)
+		}
+		leveled.SetLevel(l)
+		return nil
+	}
+}
+
+//WithLogger replace the default logrus logger, see the logging package for
+//the standard library and JSON adapters. Every component gets a child logger
+//carrying its name
+func WithLogger(logger interfaces.Logger) Option {
+	return func(easy *Easy) error {
+		if logger != nil {
+			easy.logger = logger
+			return nil
+		}
+		return errors.New("logger cannot be nil")
+	}
+}
+
 func WithLogo(logo interface{}) Option {
 	return func(easy *Easy) error {
 		if logo != nil {
@@ -91,13 +169,36 @@ func WithRegistry(registry interfaces.Registry) Option {
 	}
 }
 
+//FromEnv configure the µs from the EASY_SERVICE_* variables:
+//ID, NAME, VERSION and LOG_LEVEL. Every built-in component reads its own
+//EASY_<COMPONENT>_<SETTING> variables, see README.md
+func FromEnv() Option {
+	return func(easy *Easy) error {
+		settings := map[string]func(string) Option{
+			"id":        WithID,
+			"name":      WithName,
+			"version":   WithVersion,
+			"log_level": WithLogLevel,
+		}
+		for _, setting := range []string{"id", "name", "version", "log_level"} {
+			option := settings[setting]
+			if err := commons.EnvString("service", setting, func(value string) error {
+				return option(value)(easy)
+			}); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
 func WithDefaultRegistry() Option {
 	return func(easy *Easy) error {
 		r, err := consul.New(
-			consul.WithLogger(easy.Logger),
 			consul.WithID(commons.UUID()),
 			consul.WithName(easy.Name()),
-			consul.WithHealthEndpoint("healthcheck"),
+			consul.WithHealthEndpoint("health/ready"),
+			consul.FromEnv(),
 		)
 		if err != nil {
 			return err
@@ -109,7 +210,8 @@ func WithDefaultRegistry() Option {
 
 func WithDefaultTransport() Option {
 	return func(easy *Easy) error {
-		t, err := rest.New(rest.WithLogger(easy.Logger))
+		t, err := rest.New(
+			rest.FromEnv())
 		if err != nil {
 			return err
 		}
@@ -120,7 +222,8 @@ func WithDefaultTransport() Option {
 
 func WithDefaultBroker() Option {
 	return func(easy *Easy) error {
-		b, err := nats.New(nats.WithLogger(easy.Logger))
+		b, err := nats.New(
+			nats.FromEnv())
 		if err != nil {
 			return err
 		}
@@ -132,7 +235,8 @@ func WithDefaultBroker() Option {
 func WithDefaultConfiguration() Option {
 	return func(easy *Easy) error {
 		c, err := viper.New(
-			viper.WithName(easy.name))
+			viper.WithName(easy.name),
+			viper.FromEnv())
 		if err != nil {
 			return err
 		}
@@ -146,11 +250,45 @@ func WithDefaultConfiguration() Option {
 	}
 }
 
+//WithDefaultCache use ledis, configured from the EASY_LEDIS_* variables
+func WithDefaultCache() Option {
+	return func(easy *Easy) error {
+		c, err := ledis.New(ledis.FromEnv())
+		if err != nil {
+			return err
+		}
+		easy.cache = c
+		return nil
+	}
+}
+
+//WithDefaultStore use vault when EASY_VAULT_SERVERS is set, minio otherwise,
+//configured from the EASY_VAULT_* or EASY_MINIO_* variables
+func WithDefaultStore() Option {
+	return func(easy *Easy) error {
+		var (
+			s   interfaces.Store
+			err error
+		)
+		if commons.EnvIsSet("vault", "servers") {
+			s, err = vault.New(vault.FromEnv())
+		} else {
+			s, err = minio.New(minio.FromEnv())
+		}
+		if err != nil {
+			return err
+		}
+		easy.store = s
+		return nil
+	}
+}
+
 func WithDefaultAuthN(folder string) Option {
 	return func(easy *Easy) error {
 		if folder != "" {
 			c, err := fs.New(
-				fs.WithFolder(folder))
+				fs.WithFolder(folder),
+				fs.FromEnv())
 			if err != nil {
 				return err
 			}
@@ -161,6 +299,18 @@ func WithDefaultAuthN(folder string) Option {
 	}
 }
 
+//WithDefaultAuthZ issue JSON Web Tokens configured from the EASY_JWT_* variables
+func WithDefaultAuthZ() Option {
+	return func(easy *Easy) error {
+		j, err := jwt.New(jwt.FromEnv())
+		if err != nil {
+			return err
+		}
+		easy.authz = j
+		return nil
+	}
+}
+
 func WithHandler(mode, route string, handler interface{}) Option {
 	return func(easy *Easy) error {
 		return easy.transport.Handler(mode, route, handler)
@@ -179,6 +329,51 @@ func WithStaticFilesFolder(route, folder string) Option {
 	}
 }
 
+//WithTransportOptions apply options to the transport already set
+func WithTransportOptions(options ...interfaces.TransportOption) Option {
+	return func(easy *Easy) error {
+		if easy.transport == nil {
+			return errors.New("transport cannot be nil")
+		}
+		for _, option := range options {
+			if err := option(easy.transport); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+//WithBrokerOptions apply options to the broker already set
+func WithBrokerOptions(options ...interfaces.BrokerOption) Option {
+	return func(easy *Easy) error {
+		if easy.broker == nil {
+			return errors.New("broker cannot be nil")
+		}
+		for _, option := range options {
+			if err := option(easy.broker); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+//WithRegistryOptions apply options to the registry already set
+func WithRegistryOptions(options ...interfaces.RegistryOption) Option {
+	return func(easy *Easy) error {
+		if easy.registry == nil {
+			return errors.New("registry cannot be nil")
+		}
+		for _, option := range options {
+			if err := option(easy.registry); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
 func WithTransport(transport interfaces.Transport) Option {
 	return func(easy *Easy) error {
 		if transport != nil {
@@ -219,13 +414,19 @@ func WithStore(store interfaces.Store) Option {
 	}
 }
 
+func WithAuthN(authn interfaces.AuthN) Option {
+	return func(easy *Easy) error {
+		if authn != nil {
+			easy.authn = authn
+			return nil
+		}
+		return errors.New("authn cannot be nil")
+	}
+}
+
 func WithProcessor(processor interfaces.Processor) Option {
 	return func(easy *Easy) error {
 		if processor != nil {
-			err := processor.Init(easy)
-			if err != nil {
-				return err
-			}
 			easy.processor = processor
 			return nil
 		}
@@ -236,10 +437,6 @@ func WithProcessor(processor interfaces.Processor) Option {
 func WithCache(cache interfaces.Cache) Option {
 	return func(easy *Easy) error {
 		if cache != nil {
-			err := cache.Init()
-			if err != nil {
-				return err
-			}
 			easy.cache = cache
 			return nil
 		}
@@ -250,23 +447,48 @@ func WithCache(cache interfaces.Cache) Option {
 func WithPlugin(lib, name string) Option {
 	return func(easy *Easy) error {
 		if lib != "" && name != "" {
-			plug, err := plugin.Open(lib)
+			processor, err := hotswap.Open(lib, name)
 			if err != nil {
 				return err
 			}
-			symPlugin, err := plug.Lookup(name)
+			easy.processor = processor
+			return nil
+		}
+		return errors.New("lib and name cannot be empty")
+	}
+}
+
+//WithPluginFolder serve the latest plugin of folder and hot swap to the new
+//versions dropped in it, see hotswap.Processor
+func WithPluginFolder(folder, name string, options ...hotswap.Option) Option {
+	return func(easy *Easy) error {
+		if folder != "" && name != "" {
+			processor, err := hotswap.New(append([]hotswap.Option{
+				hotswap.WithFolder(folder),
+				hotswap.WithSymbol(name),
+			}, options...)...)
 			if err != nil {
 				return err
 			}
-			var processor interfaces.Processor
-			processor, ok := symPlugin.(interfaces.Processor)
-			if !ok {
-				return errors.New("unexpected type from module symbol")
-			}
 			easy.processor = processor
 			return nil
 		}
-		return errors.New("lib and name cannot be empty")
+		return errors.New("folder and name cannot be empty")
+	}
+}
+
+//WithComponent register a user component started after the components it depends on
+//e.g. WithComponent("indexer", indexer, lifecycle.DependsOn("store", "broker"))
+func WithComponent(name string, component interfaces.Component, options ...lifecycle.ComponentOption) Option {
+	return func(easy *Easy) error {
+		return easy.lifecycle.Add(name, component, options...)
+	}
+}
+
+//WithShutdownTimeout set the default time given to each component to stop
+func WithShutdownTimeout(timeout time.Duration) Option {
+	return func(easy *Easy) error {
+		return lifecycle.WithStopTimeout(timeout)(easy.lifecycle)
 	}
 }
 
@@ -284,8 +506,7 @@ func WithLocalConfiguration() Option {
 	return func(easy *Easy) error {
 		if easy.name != "" {
 			conf, err := viper.New(
-				viper.WithName(easy.name),
-				viper.WithLogger(easy.Logger))
+				viper.WithName(easy.name))
 			if err != nil {
 				return err
 			}
@@ -304,8 +525,7 @@ func WithRemoteConfiguration(provider, uri string) Option {
 			conf, err := viper.New(
 				viper.WithName(easy.name),
 				viper.WithProvider(provider),
-				viper.WithURI(uri),
-				viper.WithLogger(easy.Logger))
+				viper.WithURI(uri))
 			if err != nil {
 				return nil
 			}
@@ -320,15 +540,28 @@ func WithRemoteConfiguration(provider, uri string) Option {
 //WithID: default random
 //WithName: default "default"
 func New(options ...Option) (*Easy, error) {
+	formatter := new(prefixed.TextFormatter)
+	formatter.FullTimestamp = true
+	logger := logrus.New()
+	logger.Formatter = formatter
+
 	easy := &Easy{
 		id:     uuid.New().String(),
-		Logger: logrus.New(),
+		logger: logging.Logrus(logger),
 		name:   "default",
 	}
 
-	formatter := new(prefixed.TextFormatter)
-	formatter.FullTimestamp = true
-	easy.Formatter = formatter
+	manager, err := lifecycle.New()
+	if err != nil {
+		return nil, err
+	}
+	easy.lifecycle = manager
+
+	checker, err := health.New()
+	if err != nil {
+		return nil, err
+	}
+	easy.health = checker
 
 	for _, option := range options {
 		err := option(easy)
@@ -337,48 +570,114 @@ func New(options ...Option) (*Easy, error) {
 		}
 	}
 
-	logLevel := "info"
 	if easy.configuration != nil {
 		if err := easy.configuration.Open(); err != nil {
 			return nil, err
 		}
-		logLevel = easy.configuration.GetStringOrDefault("log.level", "info")
+		if logLevel := easy.configuration.GetStringOrDefault("log.level", ""); logLevel != "" {
+			if err := WithLogLevel(logLevel)(easy); err != nil {
+				easy.Warn("log level ignored", "level", logLevel, "error", err)
+			}
+		}
 		if timestamp := easy.configuration.GetStringOrDefault("log.timestamp", ""); timestamp != "" {
 			formatter.TimestampFormat = timestamp
 		}
 	}
-	switch logLevel {
-	case "debug":
-		easy.Level = logrus.DebugLevel
-	case "info":
-		easy.Level = logrus.InfoLevel
-	case "warn":
-		easy.Level = logrus.WarnLevel
-	case "error":
-		easy.Level = logrus.ErrorLevel
-	default:
-		easy.Level = logrus.InfoLevel
+
+	if err := easy.setupFlags(); err != nil {
+		return nil, err
+	}
+
+	if err := easy.setupPolicy(); err != nil {
+		return nil, err
+	}
+
+	if err := easy.setupRules(); err != nil {
+		return nil, err
 	}
 
+	if err := easy.attachLoggers(); err != nil {
+		return nil, err
+	}
 	return easy, nil
 }
 
+//attachLoggers give every component that accepts one a child of the µs logger
+func (easy *Easy) attachLoggers() error {
+	if err := lifecycle.WithLogger(easy.logger.With("component", "lifecycle"))(easy.lifecycle); err != nil {
+		return err
+	}
+	components := map[string]interface{}{
+		"registry":      easy.registry,
+		"transport":     easy.transport,
+		"broker":        easy.broker,
+		"client":        easy.client,
+		"store":         easy.store,
+		"processor":     easy.processor,
+		"configuration": easy.configuration,
+		"authn":         easy.authn,
+		"cache":         easy.cache,
+	}
+	if easy.scheduler != nil {
+		components["scheduler"] = easy.scheduler
+	}
+	if easy.executor != nil {
+		components["executor"] = easy.executor
+	}
+	if easy.authz != nil {
+		components["authz"] = easy.authz
+	}
+	if easy.apikeys != nil {
+		components["apikeys"] = easy.apikeys
+	}
+	if easy.lockout != nil {
+		components["lockout"] = easy.lockout
+	}
+	if easy.reset != nil {
+		components["reset"] = easy.reset
+	}
+	for name, component := range components {
+		logged, ok := component.(interface {
+			WithLogger(interfaces.Logger) error
+		})
+		if !ok {
+			continue
+		}
+		if err := logged.WithLogger(easy.logger.With("component", name)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//Default create a µs with viper, consul, nats and rest. Every component is
+//configured from the environment (see FromEnv) and the cache, the store and
+//the authn are added when their EASY_LEDIS_ENDPOINTS, EASY_VAULT_SERVERS,
+//EASY_MINIO_ENDPOINT or EASY_FS_FOLDER variables are set, and the JWT authz
+//when EASY_JWT_SECRET or EASY_JWT_JWKS_URL is
 func Default(options ...Option) (*Easy, error) {
-	microservice, err := New(
+	defaults := []Option{
+		FromEnv(),
 		WithDefaultConfiguration(),
 		WithDefaultRegistry(),
 		WithDefaultBroker(),
-		WithDefaultTransport())
-	if err != nil {
-		return nil, err
+		WithDefaultTransport(),
 	}
-
-	for _, option := range options {
-		if err := option(microservice); err != nil {
-			return nil, err
-		}
+	if commons.EnvIsSet("ledis", "endpoints") {
+		defaults = append(defaults, WithDefaultCache())
+	}
+	if commons.EnvIsSet("vault", "servers") || commons.EnvIsSet("minio", "endpoint") {
+		defaults = append(defaults, WithDefaultStore())
+	}
+	if commons.EnvIsSet("fs", "folder") {
+		defaults = append(defaults, WithDefaultAuthN("fs"))
+	}
+	if commons.EnvIsSet("jwt", "secret") || commons.EnvIsSet("jwt", "jwks_url") {
+		defaults = append(defaults, WithDefaultAuthZ())
 	}
-	return microservice, nil
+	// the options go through New, which wires the loggers, flags, policy and
+	// rules they set
+	return New(append(defaults, options...)...)
 }
 
 //ID() return the µs' ID
@@ -393,6 +692,11 @@ func (easy *Easy) Name() string {
 	return easy.name
 }
 
+//Version() return the µs' version
+func (easy *Easy) Version() string {
+	return easy.version
+}
+
 //Registry() return the µs' registry
 func (easy *Easy) Registry() interfaces.Registry {
 	return easy.registry
@@ -431,114 +735,354 @@ func (easy *Easy) Cache() interfaces.Cache {
 	return easy.cache
 }
 
-func (easy *Easy) Run() {
+//Run start the µs and block until a shutdown signal is received
+//Part of Service interface implementation
+func (easy *Easy) Run() error {
 	println(easy.logo)
 
+	if err := easy.Start(context.Background()); err != nil {
+		return err
+	}
+
+	stopped := make(chan error, 1)
 	go_shutdown_hook.ADD(func() {
-		easy.Stop()
+		stopped <- easy.Stop()
 		easy.Warn("Goodbye and thanks for all the fish")
 	})
-	if easy.registry != nil {
-		easy.Info("registry setup")
-		err := easy.registry.WithPort(easy.Transport().Port())
-		if err != nil {
-			easy.Fatal(err)
+
+	go_shutdown_hook.Wait()
+	return <-stopped
+}
+
+//Start start every component in dependency order without blocking
+func (easy *Easy) Start(ctx context.Context) error {
+	if err := easy.prepare(); err != nil {
+		return err
+	}
+
+	if err := easy.lifecycle.Start(ctx); err != nil {
+		return err
+	}
+	atomic.StoreInt32(&easy.running, 1)
+	return nil
+}
+
+//Stop stop every component in reverse order and return the aggregated errors
+//Part of Service interface implementation
+func (easy *Easy) Stop() error {
+	atomic.StoreInt32(&easy.running, 0)
+	return easy.lifecycle.Stop(context.Background())
+}
+
+//prepare register the built-in routes and components, only once
+func (easy *Easy) prepare() error {
+	if easy.prepared {
+		return nil
+	}
+	if err := easy.setupAuthZ(); err != nil {
+		return err
+	}
+	// an authn keeping its users in a store, like authn/store, gets the one of the µs
+	if stored, ok := easy.authn.(interface {
+		HasStore() bool
+		WithStore(interfaces.Store) error
+	}); ok && !stored.HasStore() && easy.store != nil {
+		if err := stored.WithStore(easy.store); err != nil {
+			return err
+		}
+	}
+	// and the cache of the µs to lock the users being updated
+	if cached, ok := easy.authn.(interface {
+		HasCache() bool
+		WithCache(interfaces.Cache) error
+	}); ok && !cached.HasCache() && easy.cache != nil {
+		if err := cached.WithCache(easy.cache); err != nil {
+			return err
+		}
+	}
+	if easy.lockout != nil {
+		if err := easy.setupLockout(); err != nil {
+			return err
+		}
+	}
+	if easy.reset != nil {
+		if err := easy.setupPasswordReset(); err != nil {
+			return err
+		}
+	}
+	if easy.authn != nil && easy.transport != nil {
+		easy.Info("authn setup")
+		if err := easy.authnRoutes(); err != nil {
+			return err
+		}
+		if easy.reset != nil {
+			if err := easy.resetRoutes(); err != nil {
+				return err
+			}
+		}
+	}
+	if easy.authz != nil && easy.transport != nil {
+		if err := easy.jwksRoute(); err != nil {
+			return err
+		}
+	}
+	if len(easy.protected) > 0 && easy.transport != nil {
+		if err := easy.protectedRoutes(); err != nil {
+			return err
+		}
+	}
+	if easy.apikeys != nil {
+		if err := easy.setupAPIKeys(); err != nil {
+			return err
+		}
+	}
+
+	if easy.executor != nil && easy.broker != nil {
+		if err := easy.attachExecutor(); err != nil {
+			return err
 		}
-		err = easy.registry.Register()
+	}
+
+	if err := easy.bind(); err != nil {
+		return err
+	}
+
+	if err := easy.builtinComponents(); err != nil {
+		return err
+	}
+
+	if err := easy.healthChecks(); err != nil {
+		return err
+	}
+	if easy.transport != nil {
+		if err := easy.healthRoutes(); err != nil {
+			return err
+		}
+	}
+
+	if easy.admin != nil {
+		if err := easy.adminRoutes(); err != nil {
+			return err
+		}
+	}
+	easy.prepared = true
+	return nil
+}
+
+func (easy *Easy) authnRoutes() error {
+	register := func(c *gin.Context) {
+		var user fs.User
+		err := c.BindJSON(&user)
 		if err != nil {
-			easy.Fatal(err)
+			c.String(http.StatusBadRequest, err.Error())
+			return
 		}
+		if user.Username == "" || user.Password == "" {
+			c.String(http.StatusBadRequest, "username and password cannot be empty")
+			return
+		}
+		response, err := easy.authn.RegisterContext(c.Request.Context(), user.Username, user.Password)
+		var policy *commons.PolicyError
+		switch {
+		case err == interfaces.ErrUserExists:
+			c.String(http.StatusConflict, err.Error())
+			return
+		case errors.As(err, &policy):
+			c.String(http.StatusBadRequest, err.Error())
+			return
+		case err != nil:
+			c.String(http.StatusBadGateway, err.Error())
+			return
+		}
+		c.JSON(http.StatusOK, response)
 	}
-	if easy.broker != nil {
-		easy.Info("broker setup")
-		err := easy.broker.Run()
+
+	login := func(c *gin.Context) {
+		var user fs.User
+		err := c.BindJSON(&user)
 		if err != nil {
-			easy.Fatal(err)
+			c.String(http.StatusBadRequest, err.Error())
+			return
 		}
+		if user.Username == "" || user.Password == "" {
+			c.String(http.StatusBadRequest, "username and password cannot be empty")
+			return
+		}
+		if !easy.allowLogin(c, user.Username) {
+			return
+		}
+		response, err := easy.authn.LoginContext(c.Request.Context(), user.Username, user.Password)
+		if err != nil {
+			easy.failedLogin(c, user.Username, err)
+			return
+		}
+		easy.succeededLogin(c, user.Username)
+		tokens, err := easy.newSession(c.Request.Context(), user.Username)
+		if err != nil {
+			c.String(http.StatusBadGateway, err.Error())
+			return
+		}
+		c.JSON(http.StatusOK, struct {
+			*interfaces.Tokens
+			User interface{} `json:"user"`
+		}{tokens, response})
 	}
 
-	if easy.authn != nil {
-		easy.Info("authn setup")
+	refresh := func(c *gin.Context) {
+		var request struct {
+			RefreshToken string `json:"refresh_token" binding:"required"`
+		}
+		if err := c.BindJSON(&request); err != nil {
+			c.String(http.StatusBadRequest, err.Error())
+			return
+		}
+		tokens, err := easy.refreshSession(c.Request.Context(), request.RefreshToken)
+		if err != nil {
+			c.String(http.StatusUnauthorized, err.Error())
+			return
+		}
+		c.JSON(http.StatusOK, tokens)
+	}
 
-		register := func(c *gin.Context) {
-			var user fs.User
-			err := c.BindJSON(&user)
-			if err != nil {
-				c.String(http.StatusBadGateway, err.Error())
-				return
-			}
-			response, err := easy.authn.Register(user.Username, user.Password)
-			if err != nil {
+	logout := func(c *gin.Context) {
+		if !easy.authenticate(c) {
+			return
+		}
+		username, _ := UserFromContext(c)
+		if err := easy.authz.RevokeTokenContext(c.Request.Context(), bearer(c)); err != nil {
+			c.String(http.StatusUnauthorized, err.Error())
+			return
+		}
+		if username != "" {
+			if err := easy.authn.LogoutContext(c.Request.Context(), username); err != nil {
 				c.String(http.StatusBadGateway, err.Error())
 				return
 			}
-			c.JSON(http.StatusOK, response)
 		}
+		c.String(http.StatusOK, "")
+	}
 
-		login := func(c *gin.Context) {
-			var user fs.User
-			err := c.BindJSON(&user)
-			if err != nil {
-				c.String(http.StatusBadGateway, err.Error())
-				return
-			}
-			response, err := easy.authn.Login(user.Username, user.Password)
-			if err != nil {
-				c.String(http.StatusBadGateway, err.Error())
-			}
-			c.JSON(http.StatusOK, response)
+	if err := easy.transport.Handler("post", "/register", register); err != nil {
+		return err
+	}
+
+	if err := easy.transport.Handler("post", "/login", login); err != nil {
+		return err
+	}
+
+	if err := easy.transport.Handler("post", "/refresh", refresh); err != nil {
+		return err
+	}
+
+	return easy.transport.Handler("post", "/logout", logout)
+}
+
+//builtinComponents add the configured built-in components to the lifecycle:
+//cache and store first, then broker, processor, transport and last the registry,
+//which needs the port the transport is actually listening on
+func (easy *Easy) builtinComponents() error {
+	add := func(name string, component interfaces.Component, dependencies ...string) error {
+		if easy.lifecycle.Has(name) {
+			return nil
 		}
+		return easy.lifecycle.Add(name, component, lifecycle.DependsOn(dependencies...))
+	}
 
-		logout := func(c *gin.Context) {
-			username := c.Param(":username")
-			err := easy.authn.Logout(username)
-			if err != nil {
-				c.String(http.StatusBadGateway, err.Error())
-				return
+	// the executor outlive the broker, the processor and the transport to
+	// drain the work they queued
+	if easy.executor != nil {
+		if err := add("executor", easy.executor, "cache", "store"); err != nil {
+			return err
+		}
+	}
+
+	if easy.cache != nil {
+		component, ok := easy.cache.(interfaces.Component)
+		if !ok {
+			component = lifecycle.Func{
+				OnStart: func(context.Context) error { return easy.cache.Init() },
+				OnStop:  func(context.Context) error { return easy.cache.Close() },
 			}
-			c.String(http.StatusOK, "")
 		}
+		if err := add("cache", component); err != nil {
+			return err
+		}
+	}
 
-		if err := easy.transport.Handler("post", "/register", register); err != nil {
-			easy.Fatal(err)
+	if easy.store != nil {
+		if component, ok := easy.store.(interfaces.Component); ok {
+			if err := add("store", component); err != nil {
+				return err
+			}
 		}
+	}
 
-		if err := easy.transport.Handler("post", "/login", login); err != nil {
-			easy.Fatal(err)
+	if easy.broker != nil {
+		component, ok := easy.broker.(interfaces.Component)
+		if !ok {
+			component = lifecycle.Func{
+				OnStart: func(context.Context) error { return easy.broker.Run() },
+				OnStop:  func(context.Context) error { return easy.broker.Close() },
+			}
+		}
+		if err := add("broker", component, "cache", "store", "executor"); err != nil {
+			return err
 		}
+	}
 
-		if err := easy.transport.Handler("post", "/logout", logout); err != nil {
-			easy.Fatal(err)
+	if easy.processor != nil {
+		component := lifecycle.Func{
+			OnStart: func(context.Context) error { return easy.processor.Init(easy) },
+			OnStop:  func(context.Context) error { return easy.processor.Close() },
+		}
+		if err := add("processor", component, "cache", "store", "broker", "executor"); err != nil {
+			return err
 		}
 	}
 
 	if easy.transport != nil {
-		easy.Info("transport setup")
-		err := easy.transport.Run()
-		if err != nil {
-			easy.Fatal(err)
+		component := lifecycle.Func{
+			OnStart: func(context.Context) error { return easy.transport.Run() },
+			OnStop:  easy.transport.StopContext,
+		}
+		if err := add("transport", component, "cache", "store", "broker", "processor", "executor"); err != nil {
+			return err
 		}
 	}
-	easy.isRunning = true
-
-	go_shutdown_hook.Wait()
-}
 
-func (easy *Easy) Stop() {
-	if easy.broker != nil {
-		if err := easy.broker.Close(); err != nil {
-			easy.Fatal(err)
+	if easy.scheduler != nil {
+		if err := easy.schedulerComponent(); err != nil {
+			return err
+		}
+		if err := add("scheduler", easy.scheduler, "cache", "store", "broker", "processor"); err != nil {
+			return err
 		}
 	}
-	if easy.transport != nil {
-		if err := easy.transport.Stop(); err != nil {
-			easy.Fatal(err)
+
+	if easy.registry != nil {
+		component, ok := easy.registry.(interfaces.Component)
+		if !ok {
+			component = lifecycle.Func{
+				OnStart: func(ctx context.Context) error {
+					if easy.transport != nil {
+						if err := easy.registry.WithPort(easy.transport.Port()); err != nil {
+							return err
+						}
+					}
+					return easy.registry.RegisterContext(ctx)
+				},
+				OnStop: easy.registry.DeregisterContext,
+			}
+		}
+		if err := add("registry", component, "transport"); err != nil {
+			return err
 		}
 	}
+	return nil
 }
 
 func (easy *Easy) IsRunning() bool {
-	return easy.isRunning
+	return atomic.LoadInt32(&easy.running) == 1
 }
 
 func (easy *Easy) HookShutDown(fn func()) {
@@ -577,22 +1121,31 @@ func (easy *Easy) Publish(endpoint string, msg interface{}) error {
 	return easy.broker.Publish(endpoint, msg)
 }
 
-func (easy *Easy) Info(message interface{}) {
-	easy.Logger.Info(message)
+func (easy *Easy) PublishContext(ctx context.Context, endpoint string, msg interface{}) error {
+	return easy.broker.PublishContext(ctx, endpoint, msg)
+}
+
+func (easy *Easy) Info(message interface{}, keyvals ...interface{}) {
+	easy.logger.Info(message, keyvals...)
+}
+
+func (easy *Easy) Warn(message interface{}, keyvals ...interface{}) {
+	easy.logger.Warn(message, keyvals...)
 }
 
-func (easy *Easy) Warn(message interface{}) {
-	easy.Logger.Warn(message)
+func (easy *Easy) Error(message interface{}, keyvals ...interface{}) {
+	easy.logger.Error(message, keyvals...)
 }
 
-func (easy *Easy) Error(message interface{}) {
-	easy.Logger.Error(message)
+func (easy *Easy) Fatal(message interface{}, keyvals ...interface{}) {
+	easy.logger.Fatal(message, keyvals...)
 }
 
-func (easy *Easy) Fatal(message interface{}) {
-	easy.Logger.Fatal(message)
+func (easy *Easy) Debug(message interface{}, keyvals ...interface{}) {
+	easy.logger.Debug(message, keyvals...)
 }
 
-func (easy *Easy) Debug(message interface{}) {
-	easy.Logger.Debug(message)
+//Logger return the µs logger, use With to derive child loggers
+func (easy *Easy) Logger() interfaces.Logger {
+	return easy.logger
 }
@@ -1,36 +1,59 @@
 package easy
 
 import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/advancedlogic/easy/logging"
+	"github.com/advancedlogic/easy/transport/rest"
 	"github.com/stretchr/testify/assert"
 	"testing"
 )
 
-func TestNewEasy(t *testing.T) {
-	easy, _ := NewEasy()
+func TestNew(t *testing.T) {
+	easy, _ := New()
 	assert.NotEqual(t, easy, nil)
 }
 
 func TestWithID(t *testing.T) {
-	easy, _ := NewEasy(WithID("123"))
+	easy, _ := New(WithID("123"))
 	assert.Equal(t, easy.id, "123")
 }
 
 func TestWithName(t *testing.T) {
-	easy, _ := NewEasy(WithName("test"))
+	easy, _ := New(WithName("test"))
 	assert.Equal(t, easy.name, "test")
 }
 
 func TestErrorInID(t *testing.T) {
-	_, err := NewEasy(WithID(""))
+	_, err := New(WithID(""))
 	assert.NotEqual(t, err, nil)
 }
 
 func TestErrorInName(t *testing.T) {
-	_, err := NewEasy(WithName(""))
+	_, err := New(WithName(""))
 	assert.NotEqual(t, err, nil)
 }
 
 func TestWithDefaultRegistry(t *testing.T) {
-	easy, _ := NewEasy(WithDefaultRegistry())
+	easy, _ := New(WithDefaultRegistry())
 	assert.NotEqual(t, easy, nil)
 }
+
+func TestDefault_Options(t *testing.T) {
+	// the default configuration is read from the working directory
+	folder, _ := ioutil.TempDir("", "easy")
+	defer os.RemoveAll(folder)
+	ioutil.WriteFile(filepath.Join(folder, "default.yaml"), []byte("name: default\n"), 0644)
+	wd, _ := os.Getwd()
+	defer os.Chdir(wd)
+	assert.Nil(t, os.Chdir(folder))
+
+	// the options are applied before the components get their loggers
+	easy, err := Default(WithLogger(logging.Discard()))
+	assert.Nil(t, err)
+	if assert.NotNil(t, easy) {
+		assert.Equal(t, logging.Discard(), easy.Transport().(*rest.Rest).Logger)
+	}
+}
@@ -0,0 +1,34 @@
+package easy
+
+import (
+	"github.com/advancedlogic/easy/executor"
+)
+
+//WithExecutor bound the concurrent work of the µs: the processor runs on the
+//workers of an executor for the bindings, and a broker able to use it hands
+//every message to it. A route refused by the executor answer 503
+func WithExecutor(options ...executor.Option) Option {
+	return func(easy *Easy) error {
+		e, err := executor.New(options...)
+		if err != nil {
+			return err
+		}
+		easy.executor = e
+		return nil
+	}
+}
+
+//attachExecutor give the executor to the broker when it can use it
+func (easy *Easy) attachExecutor() error {
+	executes, ok := easy.broker.(interface {
+		WithExecutor(*executor.Executor) error
+	})
+	if !ok {
+		return nil
+	}
+	if err := executes.WithExecutor(easy.executor); err != nil {
+		return err
+	}
+	easy.brokerExecutes = true
+	return nil
+}
@@ -0,0 +1,49 @@
+package easy_test
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/advancedlogic/easy/easy"
+	"github.com/advancedlogic/easy/easytest"
+	"github.com/advancedlogic/easy/executor"
+	"github.com/advancedlogic/easy/pipeline"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWithExecutor(t *testing.T) {
+	release := make(chan struct{})
+	started := make(chan struct{}, 1)
+	slow := pipeline.Func(func(ctx context.Context, data interface{}) (interface{}, error) {
+		started <- struct{}{}
+		<-release
+		return data, nil
+	})
+	service := easytest.Start(t,
+		easy.WithProcessor(slow),
+		easy.WithExecutor(executor.WithWorkers(1), executor.WithLimit("/orders", 1), executor.WithPolicy(executor.Reject)),
+		easy.BindRoute("post", "/orders"))
+	defer service.Close()
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		response, err := service.Post("/orders", "text/plain", strings.NewReader("first"))
+		assert.Nil(t, err)
+		assert.Equal(t, http.StatusOK, response.StatusCode)
+	}()
+	<-started
+
+	// the route is at its limit
+	response, err := service.Post("/orders", "text/plain", strings.NewReader("second"))
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusServiceUnavailable, response.StatusCode)
+	assert.Equal(t, "1", response.Header.Get("Retry-After"))
+
+	close(release)
+	wg.Wait()
+}
@@ -0,0 +1,43 @@
+package easy
+
+import (
+	"github.com/advancedlogic/easy/flags"
+	"github.com/advancedlogic/easy/interfaces"
+)
+
+//WithFeatureFlags configure the feature flags, e.g. to define defaults with
+//flags.WithFlag or to read them below another configuration key
+func WithFeatureFlags(options ...flags.Option) Option {
+	return func(easy *Easy) error {
+		f, err := flags.New(options...)
+		if err != nil {
+			return err
+		}
+		easy.flags = f
+		return nil
+	}
+}
+
+//Flags return the feature flags of the µs, read from its configuration
+//Part of Service interface implementation
+func (easy *Easy) Flags() interfaces.FeatureFlags {
+	return easy.flags
+}
+
+//setupFlags load the feature flags from the configuration and log their changes
+func (easy *Easy) setupFlags() error {
+	if easy.flags == nil {
+		f, err := flags.New()
+		if err != nil {
+			return err
+		}
+		easy.flags = f
+	}
+	if easy.configuration == nil {
+		return nil
+	}
+	easy.flags.OnChange(func(changed []string) {
+		easy.Info("feature flags changed", "flags", changed)
+	})
+	return easy.flags.Watch(easy.configuration)
+}
@@ -0,0 +1,44 @@
+package easy_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/advancedlogic/easy/easy"
+	"github.com/advancedlogic/easy/easytest"
+	"github.com/advancedlogic/easy/flags"
+	"github.com/advancedlogic/easy/interfaces"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFlags(t *testing.T) {
+	service := easytest.Start(t,
+		easy.WithAdmin(easy.AdminToken("s3cr3t")),
+		easy.WithFeatureFlags(flags.WithFlag(flags.Flag{Name: "search", Enabled: true})))
+	defer service.Close()
+
+	assert.True(t, service.Flags().Enabled("search"))
+	assert.False(t, service.Flags().Enabled("beta"))
+
+	// flags follow the configuration live
+	service.Configuration.Set("flags.beta", map[string]interface{}{"groups": []interface{}{"testers"}})
+	assert.True(t, service.Flags().EnabledFor("beta", interfaces.Subject{ID: "ada", Groups: []string{"testers"}}))
+	assert.False(t, service.Flags().EnabledFor("beta", interfaces.Subject{ID: "bob"}))
+	service.Configuration.Set("flags.search", false)
+	assert.False(t, service.Flags().Enabled("search"))
+
+	request, _ := http.NewRequest(http.MethodGet, "/admin/flags", nil)
+	request.Header.Set("Authorization", "Bearer s3cr3t")
+	response, err := service.Do(request)
+	assert.Nil(t, err)
+	defer response.Body.Close()
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	var evaluations []flags.Evaluation
+	assert.Nil(t, json.NewDecoder(response.Body).Decode(&evaluations))
+	assert.Equal(t, 2, len(evaluations))
+	assert.Equal(t, "beta", evaluations[0].Name)
+	assert.Equal(t, uint64(1), evaluations[0].On)
+	assert.Equal(t, uint64(2), evaluations[0].Off)
+	assert.Equal(t, []string{"testers"}, evaluations[0].Groups)
+}
@@ -0,0 +1,118 @@
+package easy
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/advancedlogic/easy/commons"
+	"github.com/advancedlogic/easy/health"
+	"github.com/advancedlogic/easy/interfaces"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	livenessRoute  = "/health/live"
+	readinessRoute = "/health/ready"
+)
+
+//WithHealthCheck add a check to the readiness of the µs
+func WithHealthCheck(name string, checker interfaces.HealthChecker) Option {
+	return func(easy *Easy) error {
+		return easy.health.Add(name, checker)
+	}
+}
+
+//WithHealthTimeout set the time given to each component to answer its health check
+func WithHealthTimeout(timeout time.Duration) Option {
+	return func(easy *Easy) error {
+		return health.WithTimeout(timeout)(easy.health)
+	}
+}
+
+//Health run the readiness checks of the components. The µs is ready when it
+//is running and every component implementing interfaces.HealthChecker is healthy
+func (easy *Easy) Health(ctx context.Context) health.Report {
+	report := easy.health.Check(ctx)
+	if !easy.IsRunning() {
+		report.Status = health.Down
+		report.Components["service"] = health.Check{
+			Status: health.Down,
+			Error:  "service is not running",
+		}
+	}
+	return report
+}
+
+//healthChecks register the health checks of the components. The registry is
+//left out: it polls the readiness and an unreachable agent must not take the
+//µs out of service
+func (easy *Easy) healthChecks() error {
+	builtin := map[string]interface{}{
+		"cache":     easy.cache,
+		"store":     easy.store,
+		"broker":    easy.broker,
+		"processor": easy.processor,
+		"transport": easy.transport,
+		"authn":     easy.authn,
+	}
+	names, err := easy.lifecycle.Order()
+	if err != nil {
+		return err
+	}
+	add := func(name string, component interface{}) error {
+		checker, ok := component.(interfaces.HealthChecker)
+		if !ok || easy.health.Has(name) {
+			return nil
+		}
+		return easy.health.Add(name, checker)
+	}
+	for _, name := range names {
+		if name == "registry" {
+			continue
+		}
+		component, exists := builtin[name]
+		if exists {
+			delete(builtin, name)
+		} else {
+			component, _ = easy.lifecycle.Get(name)
+		}
+		if err := add(name, component); err != nil {
+			return err
+		}
+	}
+	for name, component := range builtin {
+		if err := add(name, component); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (easy *Easy) healthRoutes() error {
+	if easy.transport == nil {
+		return errors.New("transport cannot be nil")
+	}
+	if err := easy.transport.Handler(commons.ModeGet, livenessRoute, func(c *gin.Context) {
+		c.JSON(http.StatusOK, health.Report{Status: health.Up})
+	}); err != nil {
+		return err
+	}
+	return easy.transport.Handler(commons.ModeGet, readinessRoute, func(c *gin.Context) {
+		report := easy.Health(c.Request.Context())
+		status := http.StatusOK
+		if report.Status != health.Up {
+			status = http.StatusServiceUnavailable
+		}
+		// the route is public, the errors of the components go to the logs
+		for name, check := range report.Components {
+			if check.Error != "" {
+				easy.Warn("component not ready", "component", name, "error", check.Error)
+				check.Error = ""
+				report.Components[name] = check
+			}
+		}
+		c.JSON(status, report)
+	})
+}
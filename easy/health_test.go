@@ -0,0 +1,64 @@
+package easy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"testing"
+
+	"github.com/advancedlogic/easy/health"
+	"github.com/advancedlogic/easy/transport/rest"
+	"github.com/stretchr/testify/assert"
+)
+
+type checkedComponent struct {
+	err error
+}
+
+func (c *checkedComponent) Start(context.Context) error { return nil }
+
+func (c *checkedComponent) Stop(context.Context) error { return nil }
+
+func (c *checkedComponent) Health(context.Context) error { return c.err }
+
+func TestEasy_Health(t *testing.T) {
+	database := &checkedComponent{}
+	easy, err := New(WithComponent("database", database))
+	assert.Nil(t, err)
+
+	report := easy.Health(context.Background())
+	assert.Equal(t, health.Down, report.Status)
+	assert.Equal(t, health.Down, report.Components["service"].Status)
+
+	assert.Nil(t, easy.Start(context.Background()))
+	defer easy.Stop()
+	report = easy.Health(context.Background())
+	assert.Equal(t, health.Up, report.Status)
+	assert.Equal(t, health.Up, report.Components["database"].Status)
+
+	database.err = errors.New("connection refused")
+	report = easy.Health(context.Background())
+	assert.Equal(t, health.Down, report.Status)
+	assert.Equal(t, "connection refused", report.Components["database"].Error)
+}
+
+func TestEasy_HealthRoutes(t *testing.T) {
+	transport, _ := rest.New()
+	database := &checkedComponent{err: errors.New("connection refused to 10.0.0.7")}
+	easy, err := New(WithTransport(transport), WithHealthCheck("database", database))
+	assert.Nil(t, err)
+	assert.Nil(t, easy.healthRoutes())
+	assert.Nil(t, transport.Run())
+	defer transport.Stop()
+
+	// the readiness is public, it tells which component is down but not why
+	response, err := http.Get(fmt.Sprintf("http://localhost:%d%s", transport.Port(), readinessRoute))
+	assert.Nil(t, err)
+	defer response.Body.Close()
+	body, _ := ioutil.ReadAll(response.Body)
+	assert.Equal(t, http.StatusServiceUnavailable, response.StatusCode)
+	assert.Contains(t, string(body), "database")
+	assert.NotContains(t, string(body), "10.0.0.7")
+}
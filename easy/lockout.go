@@ -0,0 +1,160 @@
+package easy
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/advancedlogic/easy/authn/lockout"
+	"github.com/advancedlogic/easy/commons"
+	"github.com/advancedlogic/easy/interfaces"
+	"github.com/gin-gonic/gin"
+)
+
+//LockoutTopic is the broker topic of the lockout.Event of every username or
+//client IP locked out by WithLockout
+const LockoutTopic = "easy.lockout"
+
+//WithLockout slow down and lock out the logins guessing passwords on /login.
+//The failures are counted in the cache of the µs unless lockout.WithCache
+//gives another one. Every lockout is published on LockoutTopic, unless
+//lockout.WithNotify replaces it and, with WithAdmin, can be lifted through
+//the admin API
+func WithLockout(options ...lockout.Option) Option {
+	return func(easy *Easy) error {
+		g, err := lockout.New(append([]lockout.Option{lockout.WithNotify(easy.lockedOut)}, options...)...)
+		if err != nil {
+			return err
+		}
+		easy.lockout = g
+		return nil
+	}
+}
+
+//Lockout return the guard of /login, nil without WithLockout
+func (easy *Easy) Lockout() *lockout.Guard {
+	return easy.lockout
+}
+
+func (easy *Easy) setupLockout() error {
+	if easy.lockout.HasCache() {
+		return nil
+	}
+	if easy.cache == nil {
+		return errors.New("lockout: cache cannot be nil")
+	}
+	return easy.lockout.WithCache(easy.cache)
+}
+
+// lockedOut publish a lockout on the broker
+func (easy *Easy) lockedOut(ctx context.Context, event lockout.Event) {
+	if easy.broker == nil {
+		return
+	}
+	if err := easy.broker.PublishContext(ctx, LockoutTopic, event); err != nil {
+		easy.Error("lockout event not published", "error", err)
+	}
+}
+
+// allowLogin answer 429 to a login of a username or from an IP locked out
+func (easy *Easy) allowLogin(c *gin.Context, username string) bool {
+	if easy.lockout == nil {
+		return true
+	}
+	err := easy.lockout.CheckContext(c.Request.Context(), username, easy.clientIP(c))
+	if err == nil {
+		return true
+	}
+	easy.lockoutError(c, err)
+	return false
+}
+
+// clientIP return the IP of a login, X-Forwarded-For is only trusted from the
+// proxies given by lockout.WithTrustedProxies
+func (easy *Easy) clientIP(c *gin.Context) string {
+	return easy.lockout.ClientIP(c.Request.RemoteAddr, c.Request.Header["X-Forwarded-For"]...)
+}
+
+// failedLogin count a wrong password and answer it once its delay is over.
+// The other failures are not guesses: they are answered at once
+func (easy *Easy) failedLogin(c *gin.Context, username string, err error) {
+	var policy *commons.PolicyError
+	switch {
+	case err == interfaces.ErrUserDisabled:
+		c.String(http.StatusUnauthorized, err.Error())
+		return
+	case errors.As(err, &policy):
+		// a username no user can have
+		c.String(http.StatusUnauthorized, interfaces.ErrWrongCredentials.Error())
+		return
+	case err != interfaces.ErrWrongCredentials:
+		easy.Error("login failed", "user", username, "error", err)
+		c.String(http.StatusBadGateway, "login failed")
+		return
+	}
+	if easy.lockout != nil {
+		delay, e := easy.lockout.FailureContext(c.Request.Context(), username, easy.clientIP(c))
+		if e != nil {
+			easy.lockoutError(c, e)
+			return
+		}
+		select {
+		case <-time.After(delay):
+		case <-c.Request.Context().Done():
+		}
+	}
+	c.String(http.StatusUnauthorized, err.Error())
+}
+
+func (easy *Easy) succeededLogin(c *gin.Context, username string) {
+	if easy.lockout == nil {
+		return
+	}
+	if err := easy.lockout.SuccessContext(c.Request.Context(), username); err != nil {
+		easy.Error("lockout reset failed", "user", username, "error", err)
+	}
+}
+
+func (easy *Easy) lockoutError(c *gin.Context, err error) {
+	var locked *lockout.LockedError
+	if errors.As(err, &locked) {
+		c.Header("Retry-After", strconv.Itoa(int(math.Ceil(locked.RetryAfter.Seconds()))))
+		c.String(http.StatusTooManyRequests, err.Error())
+		return
+	}
+	easy.Error("lockout check failed", "error", err)
+	c.String(http.StatusInternalServerError, "lockout check failed")
+}
+
+//lockoutEndpoints return the admin routes of the lockouts: the status of a
+//username or a client IP on lockouts/:kind/:key, user or ip, and its unlock
+func (easy *Easy) lockoutEndpoints() []adminEndpoint {
+	handle := easy.admin.guard
+	route := adminRoute + "/lockouts/:kind/:key"
+	known := func(c *gin.Context) bool {
+		if kind := c.Param("kind"); kind != lockout.User && kind != lockout.IP {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "kind must be user or ip"})
+			return false
+		}
+		return true
+	}
+	return []adminEndpoint{
+		{commons.ModeGet, route, handle(func(c *gin.Context) {
+			if !known(c) {
+				return
+			}
+			status, err := easy.lockout.StatusContext(c.Request.Context(), c.Param("kind"), c.Param("key"))
+			respond(c, http.StatusOK, status, err)
+		})},
+		{commons.ModeDelete, route, handle(func(c *gin.Context) {
+			if !known(c) {
+				return
+			}
+			err := easy.lockout.UnlockContext(c.Request.Context(), c.Param("kind"), c.Param("key"))
+			respond(c, http.StatusNoContent, nil, err)
+		})},
+	}
+}
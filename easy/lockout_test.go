@@ -0,0 +1,126 @@
+package easy_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/advancedlogic/easy/authn/lockout"
+	"github.com/advancedlogic/easy/easy"
+	"github.com/advancedlogic/easy/easytest"
+	"github.com/advancedlogic/easy/transport/rest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLockout(t *testing.T) {
+	service := easytest.Start(t, easy.WithAdmin(easy.AdminToken("s3cr3t")), easy.WithLockout(
+		lockout.WithMaxAttempts(2),
+		lockout.WithDelay(0, 0),
+	))
+	defer service.Close()
+
+	call := func(method, path, body string) (*http.Response, string) {
+		request, _ := http.NewRequest(method, path, strings.NewReader(body))
+		request.Header.Set("Authorization", "Bearer s3cr3t")
+		response, err := service.Do(request)
+		assert.Nil(t, err)
+		defer response.Body.Close()
+		b, _ := ioutil.ReadAll(response.Body)
+		return response, string(b)
+	}
+
+	response, _ := call("POST", "/register", `{"username":"ada","password":"secret"}`)
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	response, _ = call("POST", "/login", `{"username":"ada","password":"wrong"}`)
+	assert.Equal(t, http.StatusUnauthorized, response.StatusCode)
+	response, _ = call("POST", "/login", `{"username":"ada","password":"wrong"}`)
+	assert.Equal(t, http.StatusTooManyRequests, response.StatusCode)
+	assert.NotEmpty(t, response.Header.Get("Retry-After"))
+	// the right password does not help a username locked out
+	response, _ = call("POST", "/login", `{"username":"ada","password":"secret"}`)
+	assert.Equal(t, http.StatusTooManyRequests, response.StatusCode)
+
+	published := service.Broker.Published(easy.LockoutTopic)
+	assert.Len(t, published, 1)
+	var event lockout.Event
+	assert.Nil(t, json.Unmarshal(published[0], &event))
+	assert.Equal(t, "ada", event.Key)
+
+	response, body := call("GET", "/admin/lockouts/user/ada", "")
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	assert.Contains(t, body, "locked_until")
+	response, _ = call("GET", "/admin/lockouts/host/ada", "")
+	assert.Equal(t, http.StatusBadRequest, response.StatusCode)
+	request, _ := http.NewRequest("DELETE", "/admin/lockouts/user/ada", nil)
+	response, err := service.Do(request)
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusUnauthorized, response.StatusCode)
+	response, _ = call("DELETE", "/admin/lockouts/user/ada", "")
+	assert.Equal(t, http.StatusNoContent, response.StatusCode)
+	response, _ = call("POST", "/login", `{"username":"ada","password":"secret"}`)
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+}
+
+func TestLockout_AdminToken(t *testing.T) {
+	transport, _ := rest.New()
+	service, err := easy.New(easy.WithTransport(transport), easy.WithCache(easytest.NewCache()),
+		easy.WithAuthN(plain{easytest.NewAuthN()}), easy.WithAdmin(easy.AdminInsecure()), easy.WithLockout())
+	assert.Nil(t, err)
+	err = service.Start(context.Background())
+	assert.NotNil(t, err)
+	if err != nil {
+		assert.Contains(t, err.Error(), "lockouts")
+	}
+}
+
+// brokenLogin fail to check any password
+type brokenLogin struct {
+	*easytest.AuthN
+}
+
+func (brokenLogin) LoginContext(context.Context, string, string) (interface{}, error) {
+	return nil, errors.New("users backend down")
+}
+
+func TestLockout_Failures(t *testing.T) {
+	service := easytest.Start(t, easy.WithLockout(
+		lockout.WithMaxAttempts(100),
+		lockout.WithIPMaxAttempts(2),
+		lockout.WithDelay(0, 0),
+	))
+	defer service.Close()
+
+	login := func(service *easytest.Service, username, forwarded string) (int, string) {
+		request, _ := http.NewRequest("POST", "/login", strings.NewReader(`{"username":"`+username+`","password":"wrong"}`))
+		request.Header.Set("X-Forwarded-For", forwarded)
+		response, err := service.Do(request)
+		assert.Nil(t, err)
+		defer response.Body.Close()
+		b, _ := ioutil.ReadAll(response.Body)
+		return response.StatusCode, string(b)
+	}
+
+	// a forged X-Forwarded-For does not reset the count of the client IP
+	status, _ := login(service, "ada", "203.0.113.1")
+	assert.Equal(t, http.StatusUnauthorized, status)
+	status, _ = login(service, "bob", "203.0.113.2")
+	assert.Equal(t, http.StatusTooManyRequests, status)
+	status, _ = login(service, "eve", "203.0.113.3")
+	assert.Equal(t, http.StatusTooManyRequests, status)
+
+	// a failing backend is not a wrong password, its detail stays in the logs
+	broken := easytest.Start(t, easy.WithAuthN(brokenLogin{easytest.NewAuthN()}), easy.WithLockout(
+		lockout.WithMaxAttempts(1),
+		lockout.WithDelay(0, 0),
+	))
+	defer broken.Close()
+	for i := 0; i < 3; i++ {
+		status, body := login(broken, "ada", "")
+		assert.Equal(t, http.StatusBadGateway, status)
+		assert.NotContains(t, body, "backend")
+	}
+}
@@ -0,0 +1,160 @@
+package easy
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/advancedlogic/easy/authz/rbac"
+	"github.com/advancedlogic/easy/interfaces"
+	"github.com/gin-gonic/gin"
+)
+
+//Requirement is what a route asks of the authenticated user
+type Requirement struct {
+	description string
+	allowed     func(subject interfaces.Subject, policy *rbac.Policy) bool
+}
+
+func (r Requirement) String() string {
+	return r.description
+}
+
+//Group require the user to be a member of one of groups
+func Group(groups ...string) Requirement {
+	return Requirement{
+		description: "group " + strings.Join(groups, " or "),
+		allowed: func(subject interfaces.Subject, _ *rbac.Policy) bool {
+			for _, group := range groups {
+				for _, member := range subject.Groups {
+					if strings.EqualFold(group, member) {
+						return true
+					}
+				}
+			}
+			return false
+		},
+	}
+}
+
+//Permission require the groups of the user to be granted every one of
+//permissions by the policy
+func Permission(permissions ...string) Requirement {
+	return Requirement{
+		description: "permission " + strings.Join(permissions, " and "),
+		allowed: func(subject interfaces.Subject, policy *rbac.Policy) bool {
+			for _, permission := range permissions {
+				if !policy.Allowed(subject.Groups, permission) {
+					return false
+				}
+			}
+			return true
+		},
+	}
+}
+
+type protected struct {
+	prefix       string
+	requirements []Requirement
+}
+
+//WithPolicy configure the policy granting permissions to groups, e.g. to
+//define defaults with rbac.WithGroup or to read it below another key
+func WithPolicy(options ...rbac.Option) Option {
+	return func(easy *Easy) error {
+		p, err := rbac.New(options...)
+		if err != nil {
+			return err
+		}
+		easy.policy = p
+		return nil
+	}
+}
+
+//WithProtectedRoutes apply requirements to every route starting with prefix,
+//e.g. WithProtectedRoutes("/admin/users", Group("admin"))
+func WithProtectedRoutes(prefix string, requirements ...Requirement) Option {
+	return func(easy *Easy) error {
+		if !strings.HasPrefix(prefix, "/") {
+			return fmt.Errorf("prefix %q must start with /", prefix)
+		}
+		easy.protected = append(easy.protected, protected{prefix: prefix, requirements: requirements})
+		return nil
+	}
+}
+
+//Policy return the policy granting permissions to groups, read from the
+//configuration of the µs
+func (easy *Easy) Policy() *rbac.Policy {
+	return easy.policy
+}
+
+//Require return a handler answering 401 without a valid access token and 403
+//when the user does not meet every requirement. Register it before the handler
+//of a route:
+//
+//	service.Handler("delete", "/orders/:id", service.Require(easy.Permission("orders:delete")))
+//	service.Handler("delete", "/orders/:id", deleteOrder)
+func (easy *Easy) Require(requirements ...Requirement) func(*gin.Context) {
+	return func(c *gin.Context) {
+		if easy.authorize(c, requirements) {
+			c.Next()
+		}
+	}
+}
+
+func (easy *Easy) authorize(c *gin.Context, requirements []Requirement) bool {
+	if !easy.authenticate(c) {
+		return false
+	}
+	subject, _ := SubjectFromContext(c)
+	for _, requirement := range requirements {
+		if !requirement.allowed(subject, easy.policy) {
+			easy.Debug("access denied", "user", subject.ID, "path", c.Request.URL.Path, "requirement", requirement.String())
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "forbidden"})
+			return false
+		}
+	}
+	return true
+}
+
+//protectedRoutes register the middleware applying the requirements of
+//WithProtectedRoutes
+func (easy *Easy) protectedRoutes() error {
+	return easy.transport.Middleware(func(c *gin.Context) {
+		for _, p := range easy.protected {
+			if !matchPrefix(c.Request.URL.Path, p.prefix) {
+				continue
+			}
+			if !easy.authorize(c, p.requirements) {
+				return
+			}
+		}
+		c.Next()
+	})
+}
+
+//matchPrefix tell whether path is prefix or below it: a prefix /admin
+//matches /admin/users but not /administrator
+func matchPrefix(path, prefix string) bool {
+	prefix = strings.TrimSuffix(prefix, "/")
+	return path == prefix || strings.HasPrefix(path, prefix+"/") || prefix == ""
+}
+
+//setupPolicy load the policy from the configuration and log its reloads
+func (easy *Easy) setupPolicy() error {
+	if easy.policy == nil {
+		p, err := rbac.New()
+		if err != nil {
+			return err
+		}
+		easy.policy = p
+	}
+	if easy.configuration == nil {
+		return nil
+	}
+	easy.policy.OnChange(func() {
+		easy.Info("policy loaded", "groups", len(easy.policy.Groups()))
+	})
+	return easy.policy.Watch(easy.configuration)
+}
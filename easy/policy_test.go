@@ -0,0 +1,68 @@
+package easy_test
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/advancedlogic/easy/authz/rbac"
+	"github.com/advancedlogic/easy/easy"
+	"github.com/advancedlogic/easy/easytest"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPolicy(t *testing.T) {
+	ok := func(c *gin.Context) {
+		c.String(http.StatusOK, "ok")
+	}
+	routes := func(e *easy.Easy) error {
+		if err := e.Handler("delete", "/orders/1", e.Require(easy.Permission("orders:delete"))); err != nil {
+			return err
+		}
+		if err := e.Handler("delete", "/orders/1", ok); err != nil {
+			return err
+		}
+		if err := e.GET("/reports/daily", ok); err != nil {
+			return err
+		}
+		return e.GET("/public", ok)
+	}
+	service := easytest.Start(t,
+		easy.WithPolicy(rbac.WithGroup("admin", "*")),
+		easy.WithProtectedRoutes("/reports", easy.Group("staff", "admin")),
+		routes)
+	defer service.Close()
+
+	_, err := service.AuthN.Register("ada", "secret")
+	assert.Nil(t, err)
+	token, err := service.AuthZ().(interface {
+		NewToken(string) (string, error)
+	}).NewToken("ada")
+	assert.Nil(t, err)
+
+	call := func(method, path, token string) int {
+		request, _ := http.NewRequest(method, path, strings.NewReader(""))
+		if token != "" {
+			request.Header.Set("Authorization", "Bearer "+token)
+		}
+		response, err := service.Do(request)
+		assert.Nil(t, err)
+		response.Body.Close()
+		return response.StatusCode
+	}
+
+	assert.Equal(t, http.StatusOK, call("GET", "/public", ""))
+	assert.Equal(t, http.StatusUnauthorized, call("GET", "/reports/daily", ""))
+	assert.Equal(t, http.StatusUnauthorized, call("DELETE", "/orders/1", "wrong"))
+	assert.Equal(t, http.StatusForbidden, call("GET", "/reports/daily", token))
+	assert.Equal(t, http.StatusForbidden, call("DELETE", "/orders/1", token))
+
+	// groups come from the authn, permissions from the live policy
+	assert.Nil(t, service.AuthN.SetGroups("ada", "user", "staff"))
+	assert.Equal(t, http.StatusOK, call("GET", "/reports/daily", token))
+	service.Configuration.Set("policy.staff", []interface{}{"orders:*"})
+	assert.Equal(t, http.StatusOK, call("DELETE", "/orders/1", token))
+	assert.Nil(t, service.AuthN.SetGroups("ada", "admin"))
+	assert.Equal(t, http.StatusOK, call("GET", "/reports/daily", token))
+}
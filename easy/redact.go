@@ -0,0 +1,55 @@
+package easy
+
+import "strings"
+
+//secretFragments are the fragments of the setting names whose value is
+//redacted by default
+var secretFragments = []string{"password", "secret", "token", "key", "credential", "private"}
+
+//redact return a copy of settings where the value of every setting whose name
+//contains one of the fragments of secrets is Redacted
+func redact(settings map[string]interface{}, secrets []string) map[string]interface{} {
+	redacted := make(map[string]interface{}, len(settings))
+	for key, value := range settings {
+		if secret(key, secrets) {
+			redacted[key] = Redacted
+			continue
+		}
+		redacted[key] = redactValue(value, secrets)
+	}
+	return redacted
+}
+
+func redactValue(value interface{}, secrets []string) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		return redact(v, secrets)
+	case []interface{}:
+		values := make([]interface{}, len(v))
+		for i, item := range v {
+			values[i] = redactValue(item, secrets)
+		}
+		return values
+	default:
+		return value
+	}
+}
+
+func secret(key string, secrets []string) bool {
+	key = strings.ToLower(key)
+	for _, fragment := range secrets {
+		if strings.Contains(key, fragment) {
+			return true
+		}
+	}
+	return false
+}
+
+//secrets return the fragments of the secret setting names, those of the
+//admin API when it has some of its own
+func (easy *Easy) secrets() []string {
+	if easy.admin != nil {
+		return easy.admin.secrets
+	}
+	return secretFragments
+}
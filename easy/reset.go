@@ -0,0 +1,180 @@
+package easy
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/advancedlogic/easy/authn/lockout"
+	"github.com/advancedlogic/easy/authn/reset"
+	"github.com/advancedlogic/easy/commons"
+	"github.com/advancedlogic/easy/interfaces"
+	"github.com/gin-gonic/gin"
+)
+
+//PasswordResetTopic is the broker topic of the reset.Event of every password
+//reset requested, for a notifier sending the token to the user
+const PasswordResetTopic = "easy.password.reset"
+
+// resetRequestTimeout bounds a reset request, carried on after its answer
+const resetRequestTimeout = 30 * time.Second
+
+//WithPasswordReset let the users reset a forgotten password in two steps:
+//POST /password/reset with {"username"} publishes a single-use token on
+//PasswordResetTopic, unless reset.WithNotify sends it another way, then
+//POST /password/reset/confirm with {"token", "password"} sets the new
+//password and revokes the sessions of the user. The tokens are kept in the
+//cache of the µs unless reset.WithCache gives another one
+func WithPasswordReset(options ...reset.Option) Option {
+	return func(easy *Easy) error {
+		m, err := reset.New(append([]reset.Option{reset.WithNotify(easy.resetRequested)}, options...)...)
+		if err != nil {
+			return err
+		}
+		easy.reset = m
+		return nil
+	}
+}
+
+//PasswordReset return the manager of the reset tokens, nil without WithPasswordReset
+func (easy *Easy) PasswordReset() *reset.Manager {
+	return easy.reset
+}
+
+func (easy *Easy) setupPasswordReset() error {
+	if _, ok := easy.authz.(interfaces.SubjectRevoker); !ok {
+		easy.Warn("authz cannot revoke the sessions of a user, they outlive a password reset")
+	}
+	if !easy.reset.HasCache() {
+		if easy.cache == nil {
+			return errors.New("password reset: cache cannot be nil")
+		}
+		if err := easy.reset.WithCache(easy.cache); err != nil {
+			return err
+		}
+	}
+	// without a lock, two instances could both confirm the same token
+	if !easy.reset.Locks() {
+		return errors.New("password reset: cache must implement interfaces.Locker")
+	}
+	// a reset voids the tokens issued before it
+	if users, ok := easy.authn.(interfaces.UserManager); ok && !easy.reset.HasPasswordChanged() {
+		return easy.reset.WithPasswordChanged(users.PasswordChangedContext)
+	}
+	return nil
+}
+
+// resetRequested publish a reset token on the broker
+func (easy *Easy) resetRequested(ctx context.Context, event reset.Event) error {
+	if easy.broker == nil {
+		return errors.New("password reset: broker cannot be nil")
+	}
+	return easy.broker.PublishContext(ctx, PasswordResetTopic, event)
+}
+
+//passwordReset end the sessions of a user whose password was reset and lift
+//their lockout. The password is changed already: a failure to revoke the
+//sessions is retried, then returned
+func (easy *Easy) passwordReset(ctx context.Context, username string) error {
+	var err error
+	for attempt, backoff := 0, 50*time.Millisecond; attempt < 3; attempt, backoff = attempt+1, backoff*2 {
+		if err = easy.revokeSessions(ctx, username); err == nil {
+			break
+		}
+		select {
+		case <-ctx.Done():
+		case <-time.After(backoff):
+		}
+	}
+	if err != nil {
+		easy.Error("sessions not revoked after a password reset", "user", username, "error", err)
+		return err
+	}
+	// the owner of the account proved who they are
+	if easy.lockout != nil {
+		if err := easy.lockout.UnlockContext(ctx, lockout.User, username); err != nil {
+			easy.Warn("lockout not lifted", "user", username, "error", err)
+		}
+	}
+	return nil
+}
+
+//requestReset issue a reset token for username when the user exists, the
+//failures are logged only: the caller is anonymous
+func (easy *Easy) requestReset(username string) {
+	ctx, cancel := context.WithTimeout(context.Background(), resetRequestTimeout)
+	defer cancel()
+	if users, ok := easy.authn.(interfaces.UserManager); ok {
+		if _, err := users.UserContext(ctx, username); err == interfaces.ErrUserNotFound {
+			easy.Debug("password reset of an unknown user", "user", username)
+			return
+		} else if err != nil {
+			easy.Error("password reset request failed", "user", username, "error", err)
+			return
+		}
+	}
+	if err := easy.reset.RequestContext(ctx, username); err != nil {
+		easy.Error("password reset request failed", "user", username, "error", err)
+	}
+}
+
+//resetRoutes register the two steps of a password reset. A request answers
+//202 before looking the user up, not to tell who has an account by its answer
+//nor by its time
+func (easy *Easy) resetRoutes() error {
+	request := func(c *gin.Context) {
+		var body struct {
+			Username string `json:"username" binding:"required"`
+		}
+		if err := c.BindJSON(&body); err != nil {
+			c.String(http.StatusBadRequest, err.Error())
+			return
+		}
+		go easy.requestReset(body.Username)
+		c.Status(http.StatusAccepted)
+	}
+
+	confirm := func(c *gin.Context) {
+		var body struct {
+			Token    string `json:"token" binding:"required"`
+			Password string `json:"password" binding:"required"`
+		}
+		if err := c.BindJSON(&body); err != nil {
+			c.String(http.StatusBadRequest, err.Error())
+			return
+		}
+		ctx := c.Request.Context()
+		var user string
+		err := easy.reset.ConfirmContext(ctx, body.Token, func(username string) error {
+			user = username
+			_, err := easy.authn.ResetContext(ctx, username, body.Password)
+			return err
+		})
+		var policy *commons.PolicyError
+		switch {
+		case err == reset.ErrInvalidToken || err == interfaces.ErrUserNotFound:
+			c.String(http.StatusBadRequest, reset.ErrInvalidToken.Error())
+			return
+		case errors.As(err, &policy):
+			c.String(http.StatusBadRequest, err.Error())
+			return
+		case err != nil:
+			// the caller is anonymous, the failure is told to the logs only
+			easy.Error("password reset failed", "user", user, "error", err)
+			c.String(http.StatusInternalServerError, "password reset failed")
+			return
+		}
+		if err := easy.passwordReset(ctx, user); err != nil {
+			// the password is changed, the sessions opened before are not over
+			c.String(http.StatusInternalServerError, "password changed, sessions not revoked")
+			return
+		}
+		c.Status(http.StatusNoContent)
+	}
+
+	if err := easy.transport.Handler("post", "/password/reset", request); err != nil {
+		return err
+	}
+	return easy.transport.Handler("post", "/password/reset/confirm", confirm)
+}
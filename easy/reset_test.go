@@ -0,0 +1,169 @@
+package easy_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/advancedlogic/easy/authn/reset"
+	"github.com/advancedlogic/easy/authn/store"
+	"github.com/advancedlogic/easy/authz/session"
+	"github.com/advancedlogic/easy/easy"
+	"github.com/advancedlogic/easy/easytest"
+	"github.com/advancedlogic/easy/interfaces"
+	"github.com/advancedlogic/easy/transport/rest"
+	"github.com/stretchr/testify/assert"
+)
+
+// unlocked hide the locker of a cache
+type unlocked struct {
+	interfaces.Cache
+}
+
+// brokenReset fail to reset a password
+type brokenReset struct {
+	*easytest.AuthN
+}
+
+func (brokenReset) ResetContext(context.Context, string, string) (interface{}, error) {
+	return nil, errors.New("users backend down")
+}
+
+// brokenRevoke fail to revoke the sessions of a user
+type brokenRevoke struct {
+	*session.Session
+}
+
+func (brokenRevoke) RevokeSubjectContext(context.Context, string) error {
+	return errors.New("cache down")
+}
+
+func TestPasswordReset(t *testing.T) {
+	service := easytest.Start(t, easy.WithPasswordReset())
+	defer service.Close()
+
+	call := func(path, body string) (int, string) {
+		request, _ := http.NewRequest("POST", path, strings.NewReader(body))
+		response, err := service.Do(request)
+		assert.Nil(t, err)
+		defer response.Body.Close()
+		b, _ := ioutil.ReadAll(response.Body)
+		return response.StatusCode, string(b)
+	}
+
+	status, _ := call("/register", `{"username":"ada","password":"secret"}`)
+	assert.Equal(t, http.StatusOK, status)
+	status, body := call("/login", `{"username":"ada","password":"secret"}`)
+	assert.Equal(t, http.StatusOK, status)
+	var tokens struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+	assert.Nil(t, json.Unmarshal([]byte(body), &tokens))
+
+	// an unknown user is answered the same, without a token
+	status, _ = call("/password/reset", `{"username":"bob"}`)
+	assert.Equal(t, http.StatusAccepted, status)
+	assert.Len(t, service.Broker.Await(easy.PasswordResetTopic, 1, 100*time.Millisecond), 0)
+	status, _ = call("/password/reset", `{"username":"ada"}`)
+	assert.Equal(t, http.StatusAccepted, status)
+	status, _ = call("/password/reset", `{"username":"ada"}`)
+	assert.Equal(t, http.StatusAccepted, status)
+	published := service.Broker.Await(easy.PasswordResetTopic, 2, time.Second)
+	assert.Len(t, published, 2)
+	var event, other reset.Event
+	assert.Nil(t, json.Unmarshal(published[0], &event))
+	assert.Nil(t, json.Unmarshal(published[1], &other))
+	assert.Equal(t, "ada", event.Username)
+
+	status, _ = call("/password/reset/confirm", `{"token":"forged","password":"changed"}`)
+	assert.Equal(t, http.StatusBadRequest, status)
+	status, _ = call("/password/reset/confirm", `{"token":"`+event.Token+`","password":"changed"}`)
+	assert.Equal(t, http.StatusNoContent, status)
+	status, _ = call("/password/reset/confirm", `{"token":"`+event.Token+`","password":"again"}`)
+	assert.Equal(t, http.StatusBadRequest, status)
+	// the reset voids the other token issued before it
+	status, _ = call("/password/reset/confirm", `{"token":"`+other.Token+`","password":"again"}`)
+	assert.Equal(t, http.StatusBadRequest, status)
+
+	// the sessions opened before the reset are over
+	status, _ = call("/refresh", `{"refresh_token":"`+tokens.RefreshToken+`"}`)
+	assert.Equal(t, http.StatusUnauthorized, status)
+	status, _ = call("/login", `{"username":"ada","password":"secret"}`)
+	assert.Equal(t, http.StatusUnauthorized, status)
+	status, _ = call("/login", `{"username":"ada","password":"changed"}`)
+	assert.Equal(t, http.StatusOK, status)
+}
+
+func TestPasswordReset_Errors(t *testing.T) {
+	transport, _ := rest.New()
+	service, err := easy.New(easy.WithTransport(transport), easy.WithAuthN(easytest.NewAuthN()),
+		easy.WithCache(unlocked{easytest.NewCache()}), easy.WithPasswordReset())
+	assert.Nil(t, err)
+	err = service.Start(context.Background())
+	assert.NotNil(t, err)
+	if err != nil {
+		assert.Contains(t, err.Error(), "Locker")
+	}
+
+	users, _ := store.New()
+	revoker, _ := session.New()
+	for name, option := range map[string]easy.Option{
+		"policy":  easy.WithAuthN(users),
+		"backend": easy.WithAuthN(brokenReset{easytest.NewAuthN()}),
+		"revoke":  easy.WithAuthZ(brokenRevoke{revoker}),
+	} {
+		t.Run(name, func(t *testing.T) {
+			service := easytest.Start(t, option, easy.WithPasswordReset())
+			defer service.Close()
+			call := func(path, body string) (int, string) {
+				request, _ := http.NewRequest("POST", path, strings.NewReader(body))
+				response, err := service.Do(request)
+				assert.Nil(t, err)
+				defer response.Body.Close()
+				b, _ := ioutil.ReadAll(response.Body)
+				return response.StatusCode, string(b)
+			}
+			status, _ := call("/register", `{"username":"ada","password":"long enough"}`)
+			assert.Equal(t, http.StatusOK, status)
+			status, _ = call("/password/reset", `{"username":"ada"}`)
+			assert.Equal(t, http.StatusAccepted, status)
+			published := service.Broker.Await(easy.PasswordResetTopic, 1, time.Second)
+			if !assert.Len(t, published, 1) {
+				return
+			}
+			var event reset.Event
+			assert.Nil(t, json.Unmarshal(published[0], &event))
+			confirm := func(password string) (int, string) {
+				return call("/password/reset/confirm", `{"token":"`+event.Token+`","password":"`+password+`"}`)
+			}
+
+			switch name {
+			case "policy":
+				// a password refused by the policy can be chosen again
+				status, body := confirm("short")
+				assert.Equal(t, http.StatusBadRequest, status)
+				assert.Contains(t, body, "at least 8 characters")
+				status, _ = confirm("long enough, again")
+				assert.Equal(t, http.StatusNoContent, status)
+			case "backend":
+				// an anonymous caller is not told about the backends
+				status, body := confirm("long enough, again")
+				assert.Equal(t, http.StatusInternalServerError, status)
+				assert.NotContains(t, body, "backend")
+			case "revoke":
+				// the password is changed and the token used up, but the
+				// sessions still alive are not reported as a success
+				status, body := confirm("long enough, again")
+				assert.Equal(t, http.StatusInternalServerError, status)
+				assert.Contains(t, body, "sessions not revoked")
+				status, _ = confirm("long enough, once more")
+				assert.Equal(t, http.StatusBadRequest, status)
+			}
+		})
+	}
+}
@@ -0,0 +1,56 @@
+package easy
+
+import (
+	"github.com/advancedlogic/easy/interfaces"
+	"github.com/advancedlogic/easy/scheduler"
+)
+
+//WithScheduler configure the scheduler running the jobs of the µs
+func WithScheduler(options ...scheduler.Option) Option {
+	return func(easy *Easy) error {
+		s, err := scheduler.New(options...)
+		if err != nil {
+			return err
+		}
+		easy.scheduler = s
+		return nil
+	}
+}
+
+//WithJob schedule fn on a cron expression, a descriptor like @hourly or a fixed
+//interval like "@every 30s". When the cache can take locks, each activation
+//runs on a single instance of the µs
+func WithJob(name, spec string, fn scheduler.Func, options ...scheduler.JobOption) Option {
+	return func(easy *Easy) error {
+		if easy.scheduler == nil {
+			if err := WithScheduler()(easy); err != nil {
+				return err
+			}
+		}
+		return easy.scheduler.Add(name, spec, fn, options...)
+	}
+}
+
+//Scheduler return the scheduler of the µs, nil without jobs
+func (easy *Easy) Scheduler() *scheduler.Scheduler {
+	return easy.scheduler
+}
+
+//schedulerComponent register the scheduler, locking through the cache when it
+//implements interfaces.Locker and the scheduler has no locker of its own
+func (easy *Easy) schedulerComponent() error {
+	s := easy.scheduler
+	if s.Name() == "" {
+		if err := scheduler.WithName(easy.name)(s); err != nil {
+			return err
+		}
+	}
+	if locker, ok := easy.cache.(interfaces.Locker); ok && !s.HasLocker() {
+		if err := s.WithLocker(locker); err != nil {
+			return err
+		}
+	} else if !s.HasLocker() {
+		easy.Warn("scheduler without locker, jobs run on every instance")
+	}
+	return nil
+}
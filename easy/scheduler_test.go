@@ -0,0 +1,48 @@
+package easy_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/advancedlogic/easy/easy"
+	"github.com/advancedlogic/easy/easytest"
+	"github.com/advancedlogic/easy/scheduler"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWithJob(t *testing.T) {
+	var runs int32
+	job := func(ctx context.Context) error {
+		atomic.AddInt32(&runs, 1)
+		return nil
+	}
+	_, err := easy.New(easy.WithJob("broken", "every minute", job))
+	assert.NotNil(t, err)
+
+	service := easytest.Start(t, easy.WithAdmin(easy.AdminToken("s3cr3t")), easy.WithJob("cleanup", "@every 20ms", job))
+	time.Sleep(110 * time.Millisecond)
+
+	request, _ := http.NewRequest(http.MethodGet, "/admin/jobs", nil)
+	request.Header.Set("Authorization", "Bearer s3cr3t")
+	response, err := service.Do(request)
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	var jobs []scheduler.Status
+	assert.Nil(t, json.NewDecoder(response.Body).Decode(&jobs))
+	assert.Equal(t, 1, len(jobs))
+	assert.Equal(t, "cleanup", jobs[0].Name)
+	assert.True(t, jobs[0].Runs >= 3)
+
+	// each activation took a lock in the cache
+	keys, _ := service.Cache.Keys()
+	assert.Contains(t, keys.([]string)[0], "scheduler:easytest:cleanup:")
+
+	assert.Nil(t, service.Close())
+	stopped := atomic.LoadInt32(&runs)
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, stopped, atomic.LoadInt32(&runs))
+}
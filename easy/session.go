@@ -0,0 +1,236 @@
+package easy
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/advancedlogic/easy/authz/session"
+	"github.com/advancedlogic/easy/interfaces"
+	"github.com/gin-gonic/gin"
+)
+
+type userKey struct{}
+
+//WithAuthZ set the authz issuing the tokens of /login. Without one, a µs with
+//an authn issues opaque tokens kept in its cache, see the authz/session package
+func WithAuthZ(authz interfaces.AuthZ) Option {
+	return func(easy *Easy) error {
+		if authz != nil {
+			easy.authz = authz
+			return nil
+		}
+		return errors.New("authz cannot be nil")
+	}
+}
+
+func (easy *Easy) AuthZ() interfaces.AuthZ {
+	return easy.authz
+}
+
+//UserFromContext return the user authenticated by Authenticated or Require
+func UserFromContext(ctx context.Context) (string, bool) {
+	subject, ok := SubjectFromContext(ctx)
+	return subject.ID, ok
+}
+
+//SubjectFromContext return the user authenticated by Authenticated or Require,
+//with its groups
+func SubjectFromContext(ctx context.Context) (interfaces.Subject, bool) {
+	if c, ok := ctx.(*gin.Context); ok {
+		ctx = c.Request.Context()
+	}
+	subject, ok := ctx.Value(userKey{}).(interfaces.Subject)
+	return subject, ok
+}
+
+//Authenticated return a handler rejecting the requests without a valid
+//Authorization: Bearer <access token> header. Register it before the handler
+//of a route; the user is then available through UserFromContext
+func (easy *Easy) Authenticated() func(*gin.Context) {
+	return func(c *gin.Context) {
+		if easy.authenticate(c) {
+			c.Next()
+		}
+	}
+}
+
+//authenticate put the user of the bearer token and its groups on the request,
+//or abort it with 401. A request already authenticated is left as it is
+func (easy *Easy) authenticate(c *gin.Context) bool {
+	if _, ok := SubjectFromContext(c); ok {
+		return true
+	}
+	if easy.authz == nil {
+		unauthorized(c, "authentication not configured")
+		return false
+	}
+	token := bearer(c)
+	if token == "" {
+		unauthorized(c, "missing token")
+		return false
+	}
+	ctx := c.Request.Context()
+	var subject interfaces.Subject
+	var err error
+	if sessions, ok := easy.authz.(interfaces.Sessions); ok {
+		subject.ID, err = sessions.SubjectContext(ctx, token)
+	} else {
+		err = easy.authz.CheckTokenContext(ctx, token)
+	}
+	if err != nil {
+		c.Header("WWW-Authenticate", `Bearer error="invalid_token"`)
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return false
+	}
+	if !easy.enabled(c, subject.ID) {
+		return false
+	}
+	if subject.Groups, err = easy.groups(ctx, token, subject.ID); err != nil {
+		easy.Warn("groups lookup failed", "user", subject.ID, "error", err)
+	}
+	c.Set("user", subject.ID)
+	c.Request = c.Request.WithContext(context.WithValue(ctx, userKey{}, subject))
+	return true
+}
+
+//enabled abort the request of a user disabled or deleted since the token
+//was issued, when the authn administers its users
+func (easy *Easy) enabled(c *gin.Context, user string) bool {
+	users, ok := easy.authn.(interfaces.UserManager)
+	if !ok || user == "" {
+		return true
+	}
+	enabled, err := users.EnabledContext(c.Request.Context(), user)
+	switch {
+	case err == interfaces.ErrUserNotFound || err == nil && !enabled:
+		c.Header("WWW-Authenticate", `Bearer error="invalid_token"`)
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "user disabled"})
+		return false
+	case err != nil:
+		easy.Error("user lookup failed", "user", user, "error", err)
+		c.AbortWithStatusJSON(http.StatusBadGateway, gin.H{"error": "user lookup failed"})
+		return false
+	}
+	return true
+}
+
+//revokeSessions end the sessions of user, when the authz can
+func (easy *Easy) revokeSessions(ctx context.Context, user string) error {
+	if revoker, ok := easy.authz.(interfaces.SubjectRevoker); ok {
+		return revoker.RevokeSubjectContext(ctx, user)
+	}
+	return nil
+}
+
+//groups return the groups claimed by the token, like a groups claim of
+//authz/jwt, or else the ones known by the authn
+func (easy *Easy) groups(ctx context.Context, token, user string) ([]string, error) {
+	if claimed, ok := easy.authz.(interface {
+		ClaimsContext(context.Context, string) (map[string]interface{}, error)
+	}); ok {
+		claims, err := claimed.ClaimsContext(ctx, token)
+		if err != nil {
+			return nil, err
+		}
+		if values, ok := claims["groups"].([]interface{}); ok {
+			groups := make([]string, 0, len(values))
+			for _, value := range values {
+				if group, ok := value.(string); ok {
+					groups = append(groups, group)
+				}
+			}
+			return groups, nil
+		}
+	}
+	if provider, ok := easy.authn.(interfaces.GroupProvider); ok && user != "" {
+		return provider.GroupsContext(ctx, user)
+	}
+	return nil, nil
+}
+
+func unauthorized(c *gin.Context, reason string) {
+	c.Header("WWW-Authenticate", "Bearer")
+	c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": reason})
+}
+
+func bearer(c *gin.Context) string {
+	header := c.GetHeader("Authorization")
+	if len(header) > 7 && strings.EqualFold(header[:7], "bearer ") {
+		return strings.TrimSpace(header[7:])
+	}
+	return ""
+}
+
+//setupAuthZ give a µs with an authn the default authz, and the cache to an
+//authz without one
+func (easy *Easy) setupAuthZ() error {
+	if easy.authz == nil {
+		if easy.authn == nil || easy.transport == nil {
+			return nil
+		}
+		s, err := session.New()
+		if err != nil {
+			return err
+		}
+		easy.authz = s
+	}
+	cached, ok := easy.authz.(interface {
+		HasCache() bool
+		WithCache(interfaces.Cache) error
+	})
+	if !ok || cached.HasCache() {
+		return nil
+	}
+	if easy.cache == nil {
+		easy.Warn("authz without cache, tokens are valid on this instance only")
+		return nil
+	}
+	return cached.WithCache(easy.cache)
+}
+
+//newSession issue the tokens of a logged in user, an authz without refresh
+//tokens issues an access token only
+func (easy *Easy) newSession(ctx context.Context, username string) (*interfaces.Tokens, error) {
+	if sessions, ok := easy.authz.(interfaces.Sessions); ok {
+		return sessions.NewSessionContext(ctx, username)
+	}
+	token, err := easy.authz.NewTokenContext(ctx, username)
+	if err != nil {
+		return nil, err
+	}
+	return &interfaces.Tokens{AccessToken: token, TokenType: "Bearer"}, nil
+}
+
+//refreshSession trade a refresh token, or an access token for an authz without
+//refresh tokens, for new tokens
+func (easy *Easy) refreshSession(ctx context.Context, token string) (*interfaces.Tokens, error) {
+	if sessions, ok := easy.authz.(interfaces.Sessions); ok {
+		return sessions.RefreshSessionContext(ctx, token)
+	}
+	token, err := easy.authz.RefreshTokenContext(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	return &interfaces.Tokens{AccessToken: token, TokenType: "Bearer"}, nil
+}
+
+//jwksRoute publish the public keys of an authz signing its tokens, like
+//authz/jwt, at /.well-known/jwks.json
+func (easy *Easy) jwksRoute() error {
+	published, ok := easy.authz.(interface {
+		JWKS() ([]byte, error)
+	})
+	if !ok {
+		return nil
+	}
+	return easy.transport.Handler("get", "/.well-known/jwks.json", func(c *gin.Context) {
+		jwks, err := published.JWKS()
+		if err != nil {
+			c.String(http.StatusInternalServerError, err.Error())
+			return
+		}
+		c.Data(http.StatusOK, "application/json", jwks)
+	})
+}
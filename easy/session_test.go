@@ -0,0 +1,115 @@
+package easy_test
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/advancedlogic/easy/authz/jwt"
+	"github.com/advancedlogic/easy/easy"
+	"github.com/advancedlogic/easy/easytest"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSession(t *testing.T) {
+	me := func(e *easy.Easy) error {
+		if err := e.GET("/me", e.Authenticated()); err != nil {
+			return err
+		}
+		return e.GET("/me", func(c *gin.Context) {
+			user, _ := easy.UserFromContext(c)
+			c.String(http.StatusOK, user)
+		})
+	}
+	service := easytest.Start(t, me)
+	defer service.Close()
+	_, err := service.AuthN.Register("ada", "secret")
+	assert.Nil(t, err)
+
+	call := func(method, path, token, body string) (int, string) {
+		request, err := http.NewRequest(method, path, strings.NewReader(body))
+		assert.Nil(t, err)
+		if token != "" {
+			request.Header.Set("Authorization", "Bearer "+token)
+		}
+		response, err := service.Do(request)
+		assert.Nil(t, err)
+		defer response.Body.Close()
+		b, err := ioutil.ReadAll(response.Body)
+		assert.Nil(t, err)
+		return response.StatusCode, string(b)
+	}
+
+	status, _ := call("POST", "/login", "", `{"username":"ada","password":"wrong"}`)
+	assert.Equal(t, http.StatusUnauthorized, status)
+	status, body := call("POST", "/login", "", `{"username":"ada","password":"secret"}`)
+	assert.Equal(t, http.StatusOK, status)
+	var login struct {
+		AccessToken  string `json:"access_token"`
+		RefreshToken string `json:"refresh_token"`
+		User         struct {
+			Username string `json:"username"`
+		} `json:"user"`
+	}
+	assert.Nil(t, json.Unmarshal([]byte(body), &login))
+	assert.Equal(t, "ada", login.User.Username)
+
+	status, _ = call("GET", "/me", "", "")
+	assert.Equal(t, http.StatusUnauthorized, status)
+	status, body = call("GET", "/me", login.AccessToken, "")
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "ada", body)
+
+	status, body = call("POST", "/refresh", "", `{"refresh_token":"`+login.RefreshToken+`"}`)
+	assert.Equal(t, http.StatusOK, status)
+	var refreshed struct {
+		AccessToken string `json:"access_token"`
+	}
+	assert.Nil(t, json.Unmarshal([]byte(body), &refreshed))
+	status, _ = call("GET", "/me", login.AccessToken, "")
+	assert.Equal(t, http.StatusUnauthorized, status)
+
+	status, _ = call("POST", "/logout", "", "")
+	assert.Equal(t, http.StatusUnauthorized, status)
+	status, _ = call("POST", "/logout", refreshed.AccessToken, "")
+	assert.Equal(t, http.StatusOK, status)
+	status, _ = call("GET", "/me", refreshed.AccessToken, "")
+	assert.Equal(t, http.StatusUnauthorized, status)
+	status, _ = call("POST", "/logout", refreshed.AccessToken, "")
+	assert.Equal(t, http.StatusUnauthorized, status)
+}
+
+func TestSession_JWT(t *testing.T) {
+	authz, err := jwt.New(jwt.WithGeneratedKey(jwt.EdDSA), jwt.WithIssuer("easytest"))
+	assert.Nil(t, err)
+	service := easytest.Start(t, easy.WithAuthZ(authz))
+	defer service.Close()
+	assert.Equal(t, authz, service.AuthZ())
+	// the revocations go to the cache of the µs
+	assert.True(t, authz.HasCache())
+
+	_, err = service.AuthN.Register("ada", "secret")
+	assert.Nil(t, err)
+	response, err := service.Post("/login", "application/json", strings.NewReader(`{"username":"ada","password":"secret"}`))
+	assert.Nil(t, err)
+	defer response.Body.Close()
+	var tokens struct {
+		AccessToken string `json:"access_token"`
+	}
+	assert.Nil(t, json.NewDecoder(response.Body).Decode(&tokens))
+	subject, err := authz.SubjectContext(context.Background(), tokens.AccessToken)
+	assert.Nil(t, err)
+	assert.Equal(t, "ada", subject)
+
+	response, err = service.Get("/.well-known/jwks.json")
+	assert.Nil(t, err)
+	defer response.Body.Close()
+	var set jwt.KeySet
+	assert.Nil(t, json.NewDecoder(response.Body).Decode(&set))
+	assert.Equal(t, 1, len(set.Keys))
+	assert.Equal(t, "OKP", set.Keys[0].KeyType)
+}
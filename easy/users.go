@@ -0,0 +1,115 @@
+package easy
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/advancedlogic/easy/commons"
+	"github.com/advancedlogic/easy/interfaces"
+	"github.com/gin-gonic/gin"
+)
+
+//userEndpoints return the admin routes of the users of an authn implementing
+//interfaces.UserManager, below /admin/users
+func (easy *Easy) userEndpoints() []adminEndpoint {
+	handle := easy.admin.guard
+	users := easy.authn.(interfaces.UserManager)
+	// a username or a password refused by the policy is the fault of the caller
+	rejected := func(c *gin.Context, status int, value interface{}, err error) {
+		var policy *commons.PolicyError
+		if errors.As(err, &policy) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		respond(c, status, value, err)
+	}
+	route := adminRoute + "/users"
+	return []adminEndpoint{
+		{commons.ModeGet, route, handle(func(c *gin.Context) {
+			list, err := users.UsersContext(c.Request.Context())
+			respond(c, http.StatusOK, list, err)
+		})},
+		{commons.ModeGet, route + "/:username", handle(func(c *gin.Context) {
+			user, err := users.UserContext(c.Request.Context(), c.Param("username"))
+			respond(c, http.StatusOK, user, err)
+		})},
+		{commons.ModePost, route, handle(func(c *gin.Context) {
+			var body struct {
+				Username string `json:"username" binding:"required"`
+				Password string `json:"password" binding:"required"`
+			}
+			if err := c.ShouldBindJSON(&body); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			user, err := easy.authn.RegisterContext(c.Request.Context(), body.Username, body.Password)
+			if err == nil {
+				easy.Info("user created", "user", body.Username)
+			}
+			rejected(c, http.StatusCreated, user, err)
+		})},
+		{commons.ModeDelete, route + "/:username", handle(func(c *gin.Context) {
+			err := easy.authn.DeleteContext(c.Request.Context(), c.Param("username"))
+			if err == nil {
+				easy.Info("user deleted", "user", c.Param("username"))
+			}
+			respond(c, http.StatusNoContent, nil, err)
+		})},
+		{commons.ModePut, route + "/:username/enabled", handle(func(c *gin.Context) {
+			var body struct {
+				Enabled *bool `json:"enabled"`
+			}
+			if err := c.ShouldBindJSON(&body); err != nil || body.Enabled == nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "expected {\"enabled\": true|false}"})
+				return
+			}
+			err := users.SetEnabledContext(c.Request.Context(), c.Param("username"), *body.Enabled)
+			if err == nil {
+				easy.Info("user enabled changed", "user", c.Param("username"), "enabled", *body.Enabled)
+				// a disabled user is logged out everywhere
+				if !*body.Enabled {
+					err = easy.revokeSessions(c.Request.Context(), c.Param("username"))
+				}
+			}
+			respond(c, http.StatusNoContent, nil, err)
+		})},
+		{commons.ModePut, route + "/:username/password", handle(func(c *gin.Context) {
+			var body struct {
+				Password string `json:"password" binding:"required"`
+			}
+			if err := c.ShouldBindJSON(&body); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			_, err := easy.authn.ResetContext(c.Request.Context(), c.Param("username"), body.Password)
+			if err != nil {
+				rejected(c, http.StatusNoContent, nil, err)
+				return
+			}
+			easy.Info("user password reset", "user", c.Param("username"))
+			// the sessions opened with the old password are over
+			respond(c, http.StatusNoContent, nil, easy.revokeSessions(c.Request.Context(), c.Param("username")))
+		})},
+		{commons.ModePost, route + "/:username/groups", handle(func(c *gin.Context) {
+			var body struct {
+				Groups []string `json:"groups" binding:"required"`
+			}
+			if err := c.ShouldBindJSON(&body); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			updated, err := users.AddGroupsContext(c.Request.Context(), c.Param("username"), body.Groups...)
+			if err == nil {
+				easy.Info("user groups changed", "user", c.Param("username"), "groups", updated)
+			}
+			respond(c, http.StatusOK, gin.H{"groups": updated}, err)
+		})},
+		{commons.ModeDelete, route + "/:username/groups/:group", handle(func(c *gin.Context) {
+			updated, err := users.RemoveGroupsContext(c.Request.Context(), c.Param("username"), c.Param("group"))
+			if err == nil {
+				easy.Info("user groups changed", "user", c.Param("username"), "groups", updated)
+			}
+			respond(c, http.StatusOK, gin.H{"groups": updated}, err)
+		})},
+	}
+}
@@ -0,0 +1,201 @@
+package easy_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/advancedlogic/easy/authn/fs"
+	"github.com/advancedlogic/easy/authn/store"
+	"github.com/advancedlogic/easy/easy"
+	"github.com/advancedlogic/easy/easytest"
+	"github.com/advancedlogic/easy/transport/rest"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUsers(t *testing.T) {
+	service := easytest.Start(t, easy.WithAdmin(easy.AdminToken("s3cr3t")))
+	defer service.Close()
+
+	call := func(method, path, body string) (int, string) {
+		request, _ := http.NewRequest(method, path, strings.NewReader(body))
+		request.Header.Set("Authorization", "Bearer s3cr3t")
+		response, err := service.Do(request)
+		assert.Nil(t, err)
+		defer response.Body.Close()
+		b, _ := ioutil.ReadAll(response.Body)
+		return response.StatusCode, string(b)
+	}
+
+	status, _ := call("POST", "/admin/users", `{"username":"ada"}`)
+	assert.Equal(t, http.StatusBadRequest, status)
+	status, _ = call("POST", "/admin/users", `{"username":"ada","password":"secret"}`)
+	assert.Equal(t, http.StatusCreated, status)
+	status, _ = call("POST", "/admin/users", `{"username":"ada","password":"secret"}`)
+	assert.Equal(t, http.StatusConflict, status)
+	status, _ = call("POST", "/register", `{"username":"ada","password":"secret"}`)
+	assert.Equal(t, http.StatusConflict, status)
+
+	status, body := call("POST", "/admin/users/ada/groups", `{"groups":["staff","admin"]}`)
+	assert.Equal(t, http.StatusOK, status)
+	assert.JSONEq(t, `{"groups":["user","staff","admin"]}`, body)
+	status, body = call("DELETE", "/admin/users/ada/groups/admin", "")
+	assert.Equal(t, http.StatusOK, status)
+	assert.JSONEq(t, `{"groups":["user","staff"]}`, body)
+
+	status, _ = call("PUT", "/admin/users/ada/enabled", `{"enabled":false}`)
+	assert.Equal(t, http.StatusNoContent, status)
+	status, _ = call("POST", "/login", `{"username":"ada","password":"secret"}`)
+	assert.Equal(t, http.StatusUnauthorized, status)
+	status, _ = call("PUT", "/admin/users/ada/enabled", `{"enabled":true}`)
+	assert.Equal(t, http.StatusNoContent, status)
+	status, _ = call("PUT", "/admin/users/ada/password", `{"password":"renewed"}`)
+	assert.Equal(t, http.StatusNoContent, status)
+	status, _ = call("POST", "/login", `{"username":"ada","password":"renewed"}`)
+	assert.Equal(t, http.StatusOK, status)
+
+	status, body = call("GET", "/admin/users", "")
+	assert.Equal(t, http.StatusOK, status)
+	var users []fs.User
+	assert.Nil(t, json.Unmarshal([]byte(body), &users))
+	assert.Len(t, users, 1)
+	assert.Equal(t, []string{"user", "staff"}, users[0].Groups)
+	assert.NotContains(t, body, "renewed")
+
+	status, _ = call("DELETE", "/admin/users/ada", "")
+	assert.Equal(t, http.StatusNoContent, status)
+	status, _ = call("GET", "/admin/users/ada", "")
+	assert.Equal(t, http.StatusNotFound, status)
+	status, _ = call("PUT", "/admin/users/ada/enabled", `{"enabled":true}`)
+	assert.Equal(t, http.StatusNotFound, status)
+}
+
+func TestUsers_Sessions(t *testing.T) {
+	me := func(e *easy.Easy) error {
+		if err := e.GET("/me", e.Authenticated()); err != nil {
+			return err
+		}
+		return e.GET("/me", func(c *gin.Context) {
+			c.Status(http.StatusOK)
+		})
+	}
+	service := easytest.Start(t, easy.WithAdmin(easy.AdminToken("s3cr3t")), me)
+	defer service.Close()
+	_, err := service.AuthN.Register("ada", "secret")
+	assert.Nil(t, err)
+
+	call := func(method, path, token, body string) (int, string) {
+		request, _ := http.NewRequest(method, path, strings.NewReader(body))
+		request.Header.Set("Authorization", "Bearer "+token)
+		response, err := service.Do(request)
+		assert.Nil(t, err)
+		defer response.Body.Close()
+		b, _ := ioutil.ReadAll(response.Body)
+		return response.StatusCode, string(b)
+	}
+	login := func(password string) string {
+		status, body := call("POST", "/login", "", `{"username":"ada","password":"`+password+`"}`)
+		assert.Equal(t, http.StatusOK, status)
+		var tokens struct {
+			AccessToken string `json:"access_token"`
+		}
+		assert.Nil(t, json.Unmarshal([]byte(body), &tokens))
+		return tokens.AccessToken
+	}
+
+	// a user disabled behind the admin API is refused with a valid token
+	token := login("secret")
+	assert.Nil(t, service.AuthN.SetEnabledContext(context.Background(), "ada", false))
+	status, _ := call("GET", "/me", token, "")
+	assert.Equal(t, http.StatusUnauthorized, status)
+	assert.Nil(t, service.AuthN.SetEnabledContext(context.Background(), "ada", true))
+	status, _ = call("GET", "/me", token, "")
+	assert.Equal(t, http.StatusOK, status)
+
+	// disabling a user or resetting its password ends its sessions
+	status, _ = call("PUT", "/admin/users/ada/enabled", "s3cr3t", `{"enabled":false}`)
+	assert.Equal(t, http.StatusNoContent, status)
+	status, _ = call("PUT", "/admin/users/ada/enabled", "s3cr3t", `{"enabled":true}`)
+	assert.Equal(t, http.StatusNoContent, status)
+	status, _ = call("GET", "/me", token, "")
+	assert.Equal(t, http.StatusUnauthorized, status)
+	token = login("secret")
+	status, _ = call("PUT", "/admin/users/ada/password", "s3cr3t", `{"password":"changed"}`)
+	assert.Equal(t, http.StatusNoContent, status)
+	status, _ = call("GET", "/me", token, "")
+	assert.Equal(t, http.StatusUnauthorized, status)
+}
+
+func TestUsers_AdminToken(t *testing.T) {
+	transport, _ := rest.New()
+	service, err := easy.New(easy.WithTransport(transport), easy.WithAuthN(easytest.NewAuthN()),
+		easy.WithAdmin(easy.AdminPort(9090)))
+	assert.Nil(t, err)
+	err = service.Start(context.Background())
+	assert.NotNil(t, err)
+	if err != nil {
+		assert.Contains(t, err.Error(), "users")
+	}
+}
+
+func TestUsers_Store(t *testing.T) {
+	users, err := store.New()
+	assert.Nil(t, err)
+	service := easytest.Start(t, easy.WithAuthN(users))
+	defer service.Close()
+
+	// the users are kept in the store of the µs
+	request, _ := http.NewRequest("POST", "/register", strings.NewReader(`{"username":"ada","password":"long enough"}`))
+	response, err := service.Do(request)
+	assert.Nil(t, err)
+	response.Body.Close()
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	assert.Contains(t, service.Store.Records(), "users/index")
+	request, _ = http.NewRequest("POST", "/login", strings.NewReader(`{"username":"ada","password":"long enough"}`))
+	response, err = service.Do(request)
+	assert.Nil(t, err)
+	response.Body.Close()
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+}
+
+// brokenRegister fail to create any user
+type brokenRegister struct {
+	*easytest.AuthN
+}
+
+func (brokenRegister) RegisterContext(context.Context, string, string) (interface{}, error) {
+	return nil, errors.New("users backend down")
+}
+
+func TestUsers_Errors(t *testing.T) {
+	call := func(service *easytest.Service, path, body string) int {
+		request, _ := http.NewRequest("POST", path, strings.NewReader(body))
+		request.Header.Set("Authorization", "Bearer s3cr3t")
+		response, err := service.Do(request)
+		assert.Nil(t, err)
+		response.Body.Close()
+		return response.StatusCode
+	}
+
+	users, err := store.New()
+	assert.Nil(t, err)
+	service := easytest.Start(t, easy.WithAuthN(users), easy.WithAdmin(easy.AdminToken("s3cr3t")))
+	defer service.Close()
+	for _, path := range []string{"/register", "/admin/users"} {
+		assert.Equal(t, http.StatusBadRequest, call(service, path, `{"username":`), path)
+		assert.Equal(t, http.StatusBadRequest, call(service, path, `{"username":"ada"}`), path)
+		assert.Equal(t, http.StatusBadRequest, call(service, path, `{"username":"ada","password":"short"}`), path)
+		assert.Equal(t, http.StatusBadRequest, call(service, path, `{"username":"../ada","password":"long enough"}`), path)
+	}
+
+	// a failing backend is not the fault of the caller
+	broken := easytest.Start(t, easy.WithAuthN(brokenRegister{easytest.NewAuthN()}), easy.WithAdmin(easy.AdminToken("s3cr3t")))
+	defer broken.Close()
+	assert.Equal(t, http.StatusBadGateway, call(broken, "/register", `{"username":"ada","password":"long enough"}`))
+	assert.Equal(t, http.StatusInternalServerError, call(broken, "/admin/users", `{"username":"ada","password":"long enough"}`))
+}
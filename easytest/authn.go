@@ -0,0 +1,301 @@
+package easytest
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/advancedlogic/easy/authn/fs"
+	"github.com/advancedlogic/easy/interfaces"
+)
+
+// AuthN is an in-memory authentication backend, users are returned the way
+// authn/fs does, without their password
+type AuthN struct {
+	sync.Mutex
+	users map[string]fs.User
+}
+
+func NewAuthN() *AuthN {
+	return &AuthN{
+		users: make(map[string]fs.User),
+	}
+}
+
+func (a *AuthN) Health(ctx context.Context) error {
+	return ctx.Err()
+}
+
+func (a *AuthN) Register(username, password string) (interface{}, error) {
+	return a.RegisterContext(context.Background(), username, password)
+}
+
+func (a *AuthN) RegisterContext(ctx context.Context, username, password string) (interface{}, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if username == "" || password == "" {
+		return nil, errors.New("username and password cannot be empty")
+	}
+	a.Lock()
+	defer a.Unlock()
+	if _, exists := a.users[username]; exists {
+		return nil, interfaces.ErrUserExists
+	}
+	a.users[username] = fs.User{
+		Username:  username,
+		Password:  password,
+		Timestamp: time.Now().UnixNano(),
+		Groups:    []string{"user"},
+		Enabled:   true,
+	}
+	return a.public(username), nil
+}
+
+func (a *AuthN) Login(username, password string) (interface{}, error) {
+	return a.LoginContext(context.Background(), username, password)
+}
+
+func (a *AuthN) LoginContext(ctx context.Context, username, password string) (interface{}, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if username == "" || password == "" {
+		return nil, errors.New("username and password cannot be empty")
+	}
+	a.Lock()
+	defer a.Unlock()
+	user, exists := a.users[username]
+	if !exists || user.Password != password {
+		return nil, interfaces.ErrWrongCredentials
+	}
+	if !user.Enabled {
+		return nil, interfaces.ErrUserDisabled
+	}
+	return a.public(username), nil
+}
+
+func (a *AuthN) Logout(username string) error {
+	return a.LogoutContext(context.Background(), username)
+}
+
+func (a *AuthN) LogoutContext(ctx context.Context, username string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if username == "" {
+		return errors.New("username cannot be empty")
+	}
+	return nil
+}
+
+func (a *AuthN) Delete(username string) error {
+	return a.DeleteContext(context.Background(), username)
+}
+
+func (a *AuthN) DeleteContext(ctx context.Context, username string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if username == "" {
+		return errors.New("username cannot be empty")
+	}
+	a.Lock()
+	defer a.Unlock()
+	if _, exists := a.users[username]; !exists {
+		return interfaces.ErrUserNotFound
+	}
+	delete(a.users, username)
+	return nil
+}
+
+func (a *AuthN) Reset(username, password string) (interface{}, error) {
+	return a.ResetContext(context.Background(), username, password)
+}
+
+func (a *AuthN) ResetContext(ctx context.Context, username, password string) (interface{}, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if username == "" || password == "" {
+		return nil, errors.New("username and password cannot be empty")
+	}
+	a.Lock()
+	defer a.Unlock()
+	user, exists := a.users[username]
+	if !exists {
+		return nil, interfaces.ErrUserNotFound
+	}
+	user.Password = password
+	user.PasswordChanged = time.Now().UnixNano()
+	a.users[username] = user
+	return a.public(username), nil
+}
+
+func (a *AuthN) GroupsContext(ctx context.Context, username string) ([]string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	a.Lock()
+	defer a.Unlock()
+	user, exists := a.users[username]
+	if !exists {
+		return nil, interfaces.ErrUserNotFound
+	}
+	return user.Groups, nil
+}
+
+// SetGroups replace the groups of a registered user
+func (a *AuthN) SetGroups(username string, groups ...string) error {
+	a.Lock()
+	defer a.Unlock()
+	user, exists := a.users[username]
+	if !exists {
+		return interfaces.ErrUserNotFound
+	}
+	user.Groups = groups
+	a.users[username] = user
+	return nil
+}
+
+func (a *AuthN) UsersContext(ctx context.Context) (interface{}, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	a.Lock()
+	defer a.Unlock()
+	usernames := make([]string, 0, len(a.users))
+	for username := range a.users {
+		usernames = append(usernames, username)
+	}
+	sort.Strings(usernames)
+	users := make([]fs.User, len(usernames))
+	for i, username := range usernames {
+		users[i] = a.public(username)
+	}
+	return users, nil
+}
+
+func (a *AuthN) UserContext(ctx context.Context, username string) (interface{}, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	a.Lock()
+	defer a.Unlock()
+	if _, exists := a.users[username]; !exists {
+		return nil, interfaces.ErrUserNotFound
+	}
+	return a.public(username), nil
+}
+
+func (a *AuthN) SetEnabledContext(ctx context.Context, username string, enabled bool) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return a.update(username, func(user *fs.User) {
+		user.Enabled = enabled
+	})
+}
+
+func (a *AuthN) EnabledContext(ctx context.Context, username string) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	a.Lock()
+	defer a.Unlock()
+	user, exists := a.users[username]
+	if !exists {
+		return false, interfaces.ErrUserNotFound
+	}
+	return user.Enabled, nil
+}
+
+func (a *AuthN) PasswordChangedContext(ctx context.Context, username string) (time.Time, error) {
+	if err := ctx.Err(); err != nil {
+		return time.Time{}, err
+	}
+	a.Lock()
+	defer a.Unlock()
+	user, exists := a.users[username]
+	if !exists {
+		return time.Time{}, interfaces.ErrUserNotFound
+	}
+	if user.PasswordChanged == 0 {
+		return time.Time{}, nil
+	}
+	return time.Unix(0, user.PasswordChanged), nil
+}
+
+func (a *AuthN) AddGroupsContext(ctx context.Context, username string, groups ...string) ([]string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	var updated []string
+	err := a.update(username, func(user *fs.User) {
+		for _, group := range groups {
+			if !member(user.Groups, group) {
+				user.Groups = append(user.Groups, group)
+			}
+		}
+		updated = user.Groups
+	})
+	return updated, err
+}
+
+func (a *AuthN) RemoveGroupsContext(ctx context.Context, username string, groups ...string) ([]string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	var updated []string
+	err := a.update(username, func(user *fs.User) {
+		kept := make([]string, 0, len(user.Groups))
+		for _, group := range user.Groups {
+			if !member(groups, group) {
+				kept = append(kept, group)
+			}
+		}
+		user.Groups = kept
+		updated = kept
+	})
+	return updated, err
+}
+
+func (a *AuthN) update(username string, fn func(*fs.User)) error {
+	a.Lock()
+	defer a.Unlock()
+	user, exists := a.users[username]
+	if !exists {
+		return interfaces.ErrUserNotFound
+	}
+	fn(&user)
+	a.users[username] = user
+	return nil
+}
+
+func member(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// Users return the registered usernames
+func (a *AuthN) Users() []string {
+	a.Lock()
+	defer a.Unlock()
+	usernames := make([]string, 0, len(a.users))
+	for username := range a.users {
+		usernames = append(usernames, username)
+	}
+	return usernames
+}
+
+func (a *AuthN) public(username string) fs.User {
+	user := a.users[username]
+	user.Password = ""
+	return user
+}
@@ -0,0 +1,206 @@
+package easytest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/advancedlogic/easy/interfaces"
+)
+
+// Broker is an in-memory broker: messages are recorded and delivered
+// synchronously to the handlers subscribed to their topic
+type Broker struct {
+	sync.Mutex
+	running   bool
+	handlers  map[string][]interfaces.MessageHandler
+	published []interfaces.Message
+	errs      []error
+}
+
+func NewBroker() *Broker {
+	return &Broker{
+		handlers: make(map[string][]interfaces.MessageHandler),
+	}
+}
+
+func (b *Broker) Run() error {
+	return b.Connect()
+}
+
+func (b *Broker) Endpoint() string {
+	return "memory"
+}
+
+func (b *Broker) Connect() error {
+	b.Lock()
+	defer b.Unlock()
+	b.running = true
+	return nil
+}
+
+func (b *Broker) Close() error {
+	b.Lock()
+	defer b.Unlock()
+	b.running = false
+	return nil
+}
+
+func (b *Broker) Health(ctx context.Context) error {
+	b.Lock()
+	defer b.Unlock()
+	if !b.running {
+		return errors.New("broker not running")
+	}
+	return nil
+}
+
+func (b *Broker) Publish(topic string, message interface{}) error {
+	return b.PublishContext(context.Background(), topic, message)
+}
+
+func (b *Broker) PublishContext(ctx context.Context, topic string, message interface{}) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	data, err := encode(message)
+	if err != nil {
+		return err
+	}
+	return b.deliver(ctx, &interfaces.Message{Topic: topic, Data: data})
+}
+
+// Send deliver a request/reply message, the handlers answer on reply
+func (b *Broker) Send(topic, reply string, message interface{}) error {
+	data, err := encode(message)
+	if err != nil {
+		return err
+	}
+	return b.deliver(context.Background(), &interfaces.Message{Topic: topic, Reply: reply, Data: data})
+}
+
+// Subscribe accept an interfaces.MessageHandler, a func(context.Context, *interfaces.Message) error
+// or a func(*interfaces.Message)
+func (b *Broker) Subscribe(topic string, handler interface{}) error {
+	var h interfaces.MessageHandler
+	switch handler := handler.(type) {
+	case interfaces.MessageHandler:
+		h = handler
+	case func(context.Context, *interfaces.Message) error:
+		h = handler
+	case func(*interfaces.Message):
+		h = func(ctx context.Context, message *interfaces.Message) error {
+			handler(message)
+			return nil
+		}
+	default:
+		return fmt.Errorf("unsupported handler %T", handler)
+	}
+	b.Lock()
+	defer b.Unlock()
+	b.handlers[topic] = append(b.handlers[topic], h)
+	return nil
+}
+
+func (b *Broker) Unsubscribe(topic string) error {
+	b.Lock()
+	defer b.Unlock()
+	if _, exists := b.handlers[topic]; !exists {
+		return fmt.Errorf("topic %s does not exist", topic)
+	}
+	delete(b.handlers, topic)
+	return nil
+}
+
+// Subscriptions return the sorted topics with a handler
+func (b *Broker) Subscriptions() []string {
+	b.Lock()
+	defer b.Unlock()
+	topics := make([]string, 0, len(b.handlers))
+	for topic := range b.handlers {
+		topics = append(topics, topic)
+	}
+	sort.Strings(topics)
+	return topics
+}
+
+// Published return the payloads published on topic, in order
+func (b *Broker) Published(topic string) [][]byte {
+	b.Lock()
+	defer b.Unlock()
+	payloads := make([][]byte, 0)
+	for _, message := range b.published {
+		if message.Topic == topic {
+			payloads = append(payloads, message.Data)
+		}
+	}
+	return payloads
+}
+
+// Await return the payloads published on topic once there are count of them,
+// or those published until timeout
+func (b *Broker) Await(topic string, count int, timeout time.Duration) [][]byte {
+	deadline := time.Now().Add(timeout)
+	for {
+		payloads := b.Published(topic)
+		if len(payloads) >= count || time.Now().After(deadline) {
+			return payloads
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// Messages return every message published or sent, in order
+func (b *Broker) Messages() []interfaces.Message {
+	b.Lock()
+	defer b.Unlock()
+	return append([]interfaces.Message(nil), b.published...)
+}
+
+// Errors return the errors returned by the handlers
+func (b *Broker) Errors() []error {
+	b.Lock()
+	defer b.Unlock()
+	return append([]error(nil), b.errs...)
+}
+
+// Reset forget the recorded messages and errors, subscriptions are kept
+func (b *Broker) Reset() {
+	b.Lock()
+	defer b.Unlock()
+	b.published = nil
+	b.errs = nil
+}
+
+func (b *Broker) deliver(ctx context.Context, message *interfaces.Message) error {
+	b.Lock()
+	b.published = append(b.published, *message)
+	handlers := append([]interfaces.MessageHandler(nil), b.handlers[message.Topic]...)
+	b.Unlock()
+
+	for _, handler := range handlers {
+		if err := handler(ctx, message); err != nil {
+			b.Lock()
+			b.errs = append(b.errs, err)
+			b.Unlock()
+		}
+	}
+	return nil
+}
+
+// encode turn a message into bytes the way the brokers do: strings and []byte
+// as they are, anything else as JSON
+func encode(message interface{}) ([]byte, error) {
+	switch m := message.(type) {
+	case []byte:
+		return m, nil
+	case string:
+		return []byte(m), nil
+	default:
+		return json.Marshal(m)
+	}
+}
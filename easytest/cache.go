@@ -0,0 +1,202 @@
+package easytest
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Cache is an in-memory cache
+type Cache struct {
+	sync.Mutex
+	values  map[string]interface{}
+	expires map[string]time.Time
+	members map[string]bool
+}
+
+func NewCache() *Cache {
+	return &Cache{
+		values:  make(map[string]interface{}),
+		expires: make(map[string]time.Time),
+		members: make(map[string]bool),
+	}
+}
+
+// TryLock take key for ttl unless it is already taken
+func (c *Cache) TryLock(ctx context.Context, key, owner string, ttl time.Duration) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	c.Lock()
+	defer c.Unlock()
+	c.purge()
+	if _, exists := c.values[key]; exists {
+		return false, nil
+	}
+	c.values[key] = owner
+	c.expires[key] = time.Now().Add(ttl)
+	return true, nil
+}
+
+// Increment add one to the counter of key, a new counter expires after ttl
+func (c *Cache) Increment(ctx context.Context, key string, ttl time.Duration) (int64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	c.Lock()
+	defer c.Unlock()
+	c.purge()
+	value, exists := c.values[key]
+	if !exists {
+		c.values[key] = int64(1)
+		c.expires[key] = time.Now().Add(ttl)
+		return 1, nil
+	}
+	count, ok := value.(int64)
+	if !ok {
+		return 0, fmt.Errorf("key %s is not a counter", key)
+	}
+	c.values[key] = count + 1
+	return count + 1, nil
+}
+
+// purge forget the expired keys, the caller holds the lock
+func (c *Cache) purge() {
+	now := time.Now()
+	for key, expire := range c.expires {
+		if now.After(expire) {
+			delete(c.values, key)
+			delete(c.expires, key)
+		}
+	}
+}
+
+func (c *Cache) Init() error {
+	return nil
+}
+
+func (c *Cache) Close() error {
+	return nil
+}
+
+func (c *Cache) Health(ctx context.Context) error {
+	return ctx.Err()
+}
+
+func (c *Cache) Put(key string, value interface{}) error {
+	return c.PutContext(context.Background(), key, value)
+}
+
+func (c *Cache) PutContext(ctx context.Context, key string, value interface{}) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	c.Lock()
+	defer c.Unlock()
+	c.values[key] = value
+	delete(c.expires, key)
+	return nil
+}
+
+func (c *Cache) Take(key string) (interface{}, error) {
+	return c.TakeContext(context.Background(), key)
+}
+
+func (c *Cache) TakeContext(ctx context.Context, key string) (interface{}, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	c.Lock()
+	defer c.Unlock()
+	c.purge()
+	value, exists := c.values[key]
+	if !exists {
+		return nil, fmt.Errorf("key %s not found", key)
+	}
+	return value, nil
+}
+
+func (c *Cache) Exists(keys ...string) (bool, error) {
+	return c.ExistsContext(context.Background(), keys...)
+}
+
+func (c *Cache) ExistsContext(ctx context.Context, keys ...string) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	c.Lock()
+	defer c.Unlock()
+	c.purge()
+	for _, key := range keys {
+		if _, exists := c.values[key]; exists {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (c *Cache) Keys() (interface{}, error) {
+	return c.KeysContext(context.Background())
+}
+
+// KeysContext return the sorted keys
+func (c *Cache) KeysContext(ctx context.Context) (interface{}, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	c.Lock()
+	defer c.Unlock()
+	c.purge()
+	keys := make([]string, 0, len(c.values))
+	for key := range c.values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+func (c *Cache) Delete(keys ...string) error {
+	return c.DeleteContext(context.Background(), keys...)
+}
+
+func (c *Cache) DeleteContext(ctx context.Context, keys ...string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	c.Lock()
+	defer c.Unlock()
+	for _, key := range keys {
+		delete(c.values, key)
+		delete(c.expires, key)
+	}
+	return nil
+}
+
+func (c *Cache) Set(value string) error {
+	return c.SetContext(context.Background(), value)
+}
+
+func (c *Cache) SetContext(ctx context.Context, value string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	c.Lock()
+	defer c.Unlock()
+	c.members[value] = true
+	return nil
+}
+
+func (c *Cache) IsMember(value string) (bool, error) {
+	return c.IsMemberContext(context.Background(), value)
+}
+
+func (c *Cache) IsMemberContext(ctx context.Context, value string) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	c.Lock()
+	defer c.Unlock()
+	return c.members[value], nil
+}
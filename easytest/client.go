@@ -0,0 +1,98 @@
+package easytest
+
+import (
+	"context"
+	"sync"
+)
+
+// Responder answer a call of the in-memory client. handler is the one given
+// to the call, e.g. a func(*resty.Response) error
+type Responder func(method string, handler interface{}) error
+
+// Client is an in-memory client recording the calls, by default every call
+// succeeds without invoking the handler
+type Client struct {
+	sync.Mutex
+	calls     []string
+	responder Responder
+}
+
+func NewClient() *Client {
+	return &Client{}
+}
+
+// Respond answer the next calls with responder
+func (c *Client) Respond(responder Responder) {
+	c.Lock()
+	defer c.Unlock()
+	c.responder = responder
+}
+
+// Calls return the methods called, in order
+func (c *Client) Calls() []string {
+	c.Lock()
+	defer c.Unlock()
+	return append([]string(nil), c.calls...)
+}
+
+func (c *Client) call(ctx context.Context, method string, handler interface{}) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	c.Lock()
+	c.calls = append(c.calls, method)
+	responder := c.responder
+	c.Unlock()
+	if responder == nil {
+		return nil
+	}
+	return responder(method, handler)
+}
+
+func (c *Client) GET(handler interface{}) error {
+	return c.GETContext(context.Background(), handler)
+}
+
+func (c *Client) POST(handler interface{}) error {
+	return c.POSTContext(context.Background(), handler)
+}
+
+func (c *Client) PUT(handler interface{}) error {
+	return c.PUTContext(context.Background(), handler)
+}
+
+func (c *Client) DELETE(handler interface{}) error {
+	return c.DELETEContext(context.Background(), handler)
+}
+
+func (c *Client) HEAD(handler interface{}) error {
+	return c.HEADContext(context.Background(), handler)
+}
+
+func (c *Client) OPTIONS(handler interface{}) error {
+	return c.OPTIONSContext(context.Background(), handler)
+}
+
+func (c *Client) GETContext(ctx context.Context, handler interface{}) error {
+	return c.call(ctx, "GET", handler)
+}
+
+func (c *Client) POSTContext(ctx context.Context, handler interface{}) error {
+	return c.call(ctx, "POST", handler)
+}
+
+func (c *Client) PUTContext(ctx context.Context, handler interface{}) error {
+	return c.call(ctx, "PUT", handler)
+}
+
+func (c *Client) DELETEContext(ctx context.Context, handler interface{}) error {
+	return c.call(ctx, "DELETE", handler)
+}
+
+func (c *Client) HEADContext(ctx context.Context, handler interface{}) error {
+	return c.call(ctx, "HEAD", handler)
+}
+
+func (c *Client) OPTIONSContext(ctx context.Context, handler interface{}) error {
+	return c.call(ctx, "OPTIONS", handler)
+}
@@ -0,0 +1,108 @@
+package easytest
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// Configuration is an in-memory configuration, keys use the dotted notation
+// of the file based ones (e.g. "log.level"). Set notify the OnChange listeners
+// like an edited file would
+type Configuration struct {
+	*viper.Viper
+	mutex     sync.Mutex
+	listeners []func()
+}
+
+// NewConfiguration create a configuration holding settings
+func NewConfiguration(settings map[string]interface{}) *Configuration {
+	c := &Configuration{Viper: viper.New()}
+	for key, value := range settings {
+		c.Viper.Set(key, value)
+	}
+	return c
+}
+
+func (c *Configuration) Open(...string) error {
+	return nil
+}
+
+func (c *Configuration) Save(interface{}) error {
+	return nil
+}
+
+func (c *Configuration) Set(key string, value interface{}) error {
+	c.mutex.Lock()
+	c.Viper.Set(key, value)
+	listeners := append([]func(){}, c.listeners...)
+	c.mutex.Unlock()
+	for _, listener := range listeners {
+		listener()
+	}
+	return nil
+}
+
+func (c *Configuration) OnChange(fn func()) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.listeners = append(c.listeners, fn)
+}
+
+func (c *Configuration) Get(key string) (interface{}, error) {
+	if !c.IsSet(key) {
+		return nil, fmt.Errorf("key %s not found", key)
+	}
+	return c.Viper.Get(key), nil
+}
+
+func (c *Configuration) GetIntOrDefault(key string, defaultValue int) int {
+	if c.IsSet(key) {
+		return c.GetInt(key)
+	}
+	return defaultValue
+}
+
+func (c *Configuration) GetStringOrDefault(key string, defaultValue string) string {
+	if c.IsSet(key) {
+		return c.GetString(key)
+	}
+	return defaultValue
+}
+
+func (c *Configuration) GetBoolOrDefault(key string, defaultValue bool) bool {
+	if c.IsSet(key) {
+		return c.GetBool(key)
+	}
+	return defaultValue
+}
+
+func (c *Configuration) GetFloat64OrDefault(key string, defaultValue float64) float64 {
+	if c.IsSet(key) {
+		return c.GetFloat64(key)
+	}
+	return defaultValue
+}
+
+func (c *Configuration) GetDurationOrDefault(key string, defaultValue time.Duration) time.Duration {
+	if c.IsSet(key) {
+		return c.GetDuration(key)
+	}
+	return defaultValue
+}
+
+func (c *Configuration) GetMapOfStringOrDefault(key string, defaultValue map[string]string) map[string]string {
+	if c.IsSet(key) {
+		return c.GetStringMapString(key)
+	}
+	return defaultValue
+}
+
+func (c *Configuration) GetArrayOfStringsOrDefault(key string, defaultValue []string) []string {
+	if c.IsSet(key) {
+		return c.GetStringSlice(key)
+	}
+	return defaultValue
+}
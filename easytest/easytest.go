@@ -0,0 +1,210 @@
+// Package easytest provide in-memory implementations of the easy interfaces
+// and helpers to run a whole service inside a unit test:
+//
+//	func TestOrders(t *testing.T) {
+//		service := easytest.Start(t, easy.BindRoute("post", "/orders", easy.PublishTo("orders")),
+//			easy.WithProcessor(orders))
+//		defer service.Close()
+//
+//		response, err := service.Post("/orders", "application/json", strings.NewReader(`{"id":1}`))
+//		...
+//		easytest.AssertPublished(t, service.Broker, "orders", `{"id":1}`)
+//	}
+package easytest
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/advancedlogic/easy/easy"
+	"github.com/advancedlogic/easy/logging"
+	"github.com/advancedlogic/easy/transport/rest"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+// Service is a running service made of in-memory components and of a REST
+// transport listening on a free local port
+type Service struct {
+	*easy.Easy
+	Broker        *Broker
+	Cache         *Cache
+	Store         *Store
+	Registry      *Registry
+	AuthN         *AuthN
+	Client        *Client
+	Configuration *Configuration
+	// URL of the transport, e.g. http://localhost:41234
+	URL  string
+	HTTP *http.Client
+}
+
+// Start boot a service and wait for it to be ready. The in-memory components
+// are set first so options can replace them; logs are discarded unless
+// easy.WithLogger is given. Start fails the test when the service cannot start
+func Start(t testing.TB, options ...easy.Option) *Service {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	port, err := freePort()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// strict: taken in between, the port fails Start instead of moving the
+	// service away from URL
+	transport, err := rest.New(rest.WithPort(port), rest.WithStrictPort())
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &Service{
+		Broker:        NewBroker(),
+		Cache:         NewCache(),
+		Store:         NewStore(),
+		Registry:      NewRegistry(),
+		AuthN:         NewAuthN(),
+		Client:        NewClient(),
+		Configuration: NewConfiguration(nil),
+		URL:           fmt.Sprintf("http://localhost:%d", port),
+		HTTP:          &http.Client{Timeout: 10 * time.Second},
+	}
+	s.Easy, err = easy.New(append([]easy.Option{
+		easy.WithName("easytest"),
+		easy.WithLogger(logging.Discard()),
+		easy.WithConfiguration(s.Configuration),
+		easy.WithBroker(s.Broker),
+		easy.WithCache(s.Cache),
+		easy.WithStore(s.Store),
+		easy.WithRegistry(s.Registry),
+		easy.WithAuthN(s.AuthN),
+		easy.WithClient(s.Client),
+		easy.WithTransport(transport),
+	}, options...)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Easy.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.waitReady(5 * time.Second); err != nil {
+		s.Close()
+		t.Fatal(err)
+	}
+	return s
+}
+
+// Close stop the service
+func (s *Service) Close() error {
+	// a connection dialed but never used keeps the server from shutting down
+	s.HTTP.CloseIdleConnections()
+	return s.Easy.Stop()
+}
+
+func (s *Service) Get(path string) (*http.Response, error) {
+	return s.HTTP.Get(s.URL + path)
+}
+
+func (s *Service) Post(path, contentType string, body io.Reader) (*http.Response, error) {
+	return s.HTTP.Post(s.URL+path, contentType, body)
+}
+
+// Do send a request whose URL is relative to the service URL
+func (s *Service) Do(request *http.Request) (*http.Response, error) {
+	if request.URL.Host == "" {
+		url, err := request.URL.Parse(s.URL + request.URL.String())
+		if err != nil {
+			return nil, err
+		}
+		request.URL = url
+		request.Host = url.Host
+	}
+	return s.HTTP.Do(request)
+}
+
+func (s *Service) waitReady(timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		response, err := s.Get("/health/ready")
+		if err == nil {
+			response.Body.Close()
+			if response.StatusCode == http.StatusOK {
+				return nil
+			}
+		}
+		if time.Now().After(deadline) {
+			if err != nil {
+				return fmt.Errorf("service not ready after %s: %s", timeout, err)
+			}
+			return fmt.Errorf("service not ready after %s: %s", timeout, response.Status)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func freePort() (int, error) {
+	listener, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		return 0, err
+	}
+	defer listener.Close()
+	return listener.Addr().(*net.TCPAddr).Port, nil
+}
+
+// AssertPublished check that a message equal to expected has been published on
+// topic, expected is encoded like the brokers do: strings and []byte as they
+// are, anything else as JSON
+func AssertPublished(t testing.TB, broker *Broker, topic string, expected interface{}) bool {
+	t.Helper()
+	data, err := encode(expected)
+	if !assert.NoError(t, err) {
+		return false
+	}
+	published := broker.Published(topic)
+	for _, payload := range published {
+		if string(payload) == string(data) {
+			return true
+		}
+	}
+	messages := make([]string, len(published))
+	for i, payload := range published {
+		messages[i] = string(payload)
+	}
+	return assert.Fail(t, fmt.Sprintf("%q not published on %s", data, topic), "published: %q", messages)
+}
+
+// AssertNotPublished check that nothing has been published on topic
+func AssertNotPublished(t testing.TB, broker *Broker, topic string) bool {
+	t.Helper()
+	return assert.Empty(t, broker.Published(topic), "messages published on %s", topic)
+}
+
+// AssertStored check that the record under key is equal to expected
+func AssertStored(t testing.TB, store *Store, key string, expected interface{}) bool {
+	t.Helper()
+	value, err := store.Read(key)
+	if !assert.NoError(t, err) {
+		return false
+	}
+	return assert.Equal(t, expected, value, "record %s", key)
+}
+
+// AssertNotStored check that there is no record under key
+func AssertNotStored(t testing.TB, store *Store, key string) bool {
+	t.Helper()
+	_, exists := store.Records()[key]
+	return assert.False(t, exists, "record %s exists", key)
+}
+
+// AssertCached check that the value cached under key is equal to expected
+func AssertCached(t testing.TB, cache *Cache, key string, expected interface{}) bool {
+	t.Helper()
+	value, err := cache.Take(key)
+	if !assert.NoError(t, err) {
+		return false
+	}
+	return assert.Equal(t, expected, value, "cache key %s", key)
+}
@@ -0,0 +1,68 @@
+package easytest_test
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/advancedlogic/easy/easy"
+	"github.com/advancedlogic/easy/easytest"
+	"github.com/advancedlogic/easy/pipeline"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStart(t *testing.T) {
+	upper := pipeline.Func(func(ctx context.Context, data interface{}) (interface{}, error) {
+		return strings.ToUpper(data.(string)), nil
+	})
+	service := easytest.Start(t,
+		easy.WithProcessor(upper),
+		easy.BindRoute("post", "/hello", easy.PublishTo("greetings")),
+		easy.BindTopic("names"))
+	defer service.Close()
+
+	response, err := service.Post("/hello", "text/plain", strings.NewReader("hello"))
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusAccepted, response.StatusCode)
+	easytest.AssertPublished(t, service.Broker, "greetings", "HELLO")
+
+	assert.Nil(t, service.Broker.Send("names", "names.reply", "ada"))
+	easytest.AssertPublished(t, service.Broker, "names.reply", "ADA")
+	easytest.AssertNotPublished(t, service.Broker, "other")
+
+	response, err = service.Get("/health/ready")
+	assert.Nil(t, err)
+	body, _ := ioutil.ReadAll(response.Body)
+	assert.Contains(t, string(body), `"broker":{"status":"up"`)
+	assert.True(t, service.Registry.Registered())
+
+	// the service is deregistered when it stops
+	assert.Nil(t, service.Close())
+	assert.False(t, service.Registry.Registered())
+}
+
+func TestStore(t *testing.T) {
+	store := easytest.NewStore()
+	assert.Nil(t, store.Create("order", "1"))
+	easytest.AssertStored(t, store, "order", "1")
+	assert.Nil(t, store.Delete("order"))
+	easytest.AssertNotStored(t, store, "order")
+	_, err := store.Read("order")
+	assert.NotNil(t, err)
+}
+
+func TestAuthN(t *testing.T) {
+	authn := easytest.NewAuthN()
+	_, err := authn.Register("ada", "secret")
+	assert.Nil(t, err)
+	_, err = authn.Register("ada", "secret")
+	assert.NotNil(t, err)
+	_, err = authn.Login("ada", "wrong")
+	assert.NotNil(t, err)
+	_, err = authn.Reset("ada", "changed")
+	assert.Nil(t, err)
+	_, err = authn.Login("ada", "changed")
+	assert.Nil(t, err)
+}
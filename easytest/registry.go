@@ -0,0 +1,74 @@
+package easytest
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// Registry is an in-memory registry recording the registration of the service
+type Registry struct {
+	sync.Mutex
+	port       int
+	registered bool
+}
+
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+func (r *Registry) Register() error {
+	return r.RegisterContext(context.Background())
+}
+
+func (r *Registry) RegisterContext(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	r.Lock()
+	defer r.Unlock()
+	r.registered = true
+	return nil
+}
+
+func (r *Registry) Deregister() error {
+	return r.DeregisterContext(context.Background())
+}
+
+func (r *Registry) DeregisterContext(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	r.Lock()
+	defer r.Unlock()
+	r.registered = false
+	return nil
+}
+
+func (r *Registry) WithPort(port int) error {
+	if port > -1 {
+		r.Lock()
+		defer r.Unlock()
+		r.port = port
+		return nil
+	}
+	return errors.New("port must be positive")
+}
+
+func (r *Registry) Health(ctx context.Context) error {
+	return ctx.Err()
+}
+
+// Registered tell if the service is registered
+func (r *Registry) Registered() bool {
+	r.Lock()
+	defer r.Unlock()
+	return r.registered
+}
+
+// Port return the port the service has been registered with
+func (r *Registry) Port() int {
+	r.Lock()
+	defer r.Unlock()
+	return r.port
+}
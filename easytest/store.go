@@ -0,0 +1,131 @@
+package easytest
+
+import (
+	"context"
+	"fmt"
+	"github.com/advancedlogic/easy/interfaces"
+	"reflect"
+	"sort"
+	"sync"
+)
+
+// Store is an in-memory store
+type Store struct {
+	sync.Mutex
+	records map[string]interface{}
+}
+
+func NewStore() *Store {
+	return &Store{
+		records: make(map[string]interface{}),
+	}
+}
+
+func (s *Store) Health(ctx context.Context) error {
+	return ctx.Err()
+}
+
+func (s *Store) Create(key string, value interface{}) error {
+	return s.CreateContext(context.Background(), key, value)
+}
+
+func (s *Store) CreateContext(ctx context.Context, key string, value interface{}) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.Lock()
+	defer s.Unlock()
+	s.records[key] = value
+	return nil
+}
+
+func (s *Store) Read(key string) (interface{}, error) {
+	return s.ReadContext(context.Background(), key)
+}
+
+func (s *Store) ReadContext(ctx context.Context, key string) (interface{}, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	s.Lock()
+	defer s.Unlock()
+	value, exists := s.records[key]
+	if !exists {
+		return nil, fmt.Errorf("key %s %w", key, interfaces.ErrKeyNotFound)
+	}
+	return value, nil
+}
+
+func (s *Store) Update(key string, value interface{}) error {
+	return s.UpdateContext(context.Background(), key, value)
+}
+
+func (s *Store) UpdateContext(ctx context.Context, key string, value interface{}) error {
+	return s.CreateContext(ctx, key, value)
+}
+
+// CompareAndSwapContext implement interfaces.Swapper
+func (s *Store) CompareAndSwapContext(ctx context.Context, key string, old, value interface{}) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	s.Lock()
+	defer s.Unlock()
+	current, exists := s.records[key]
+	if exists != (old != nil) || exists && !reflect.DeepEqual(current, old) {
+		return false, nil
+	}
+	s.records[key] = value
+	return true, nil
+}
+
+func (s *Store) Delete(key string) error {
+	return s.DeleteContext(context.Background(), key)
+}
+
+func (s *Store) DeleteContext(ctx context.Context, key string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.Lock()
+	defer s.Unlock()
+	if _, exists := s.records[key]; !exists {
+		return fmt.Errorf("key %s %w", key, interfaces.ErrKeyNotFound)
+	}
+	delete(s.records, key)
+	return nil
+}
+
+func (s *Store) List(params ...interface{}) (interface{}, error) {
+	return s.ListContext(context.Background(), params...)
+}
+
+// ListContext return the sorted keys
+func (s *Store) ListContext(ctx context.Context, params ...interface{}) (interface{}, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	s.Lock()
+	defer s.Unlock()
+	keys := make([]string, 0, len(s.records))
+	for key := range s.records {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	values := make([]interface{}, len(keys))
+	for i, key := range keys {
+		values[i] = key
+	}
+	return values, nil
+}
+
+// Records return a copy of the stored records
+func (s *Store) Records() map[string]interface{} {
+	s.Lock()
+	defer s.Unlock()
+	records := make(map[string]interface{}, len(s.records))
+	for key, value := range s.records {
+		records[key] = value
+	}
+	return records
+}
@@ -0,0 +1,62 @@
+package easytest
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// VaultServer serve the key/value API of vault from memory, to run the vault
+// store without a server. Like vault, it keeps the JSON object of each secret
+// and its numbers as they were written
+func VaultServer() *httptest.Server {
+	var (
+		lock    sync.Mutex
+		secrets = make(map[string]map[string]interface{})
+	)
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		defer lock.Unlock()
+		path := strings.TrimPrefix(r.URL.Path, "/v1/")
+		switch {
+		case r.Method == http.MethodGet && r.URL.Query().Get("list") == "true":
+			keys := make([]string, 0, len(secrets))
+			for key := range secrets {
+				if strings.HasPrefix(key, path) {
+					keys = append(keys, strings.TrimPrefix(key, path))
+				}
+			}
+			if len(keys) == 0 {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			sort.Strings(keys)
+			json.NewEncoder(w).Encode(map[string]interface{}{"data": map[string]interface{}{"keys": keys}})
+		case r.Method == http.MethodGet:
+			data, exists := secrets[path]
+			if !exists {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{"data": data})
+		case r.Method == http.MethodPut || r.Method == http.MethodPost:
+			data := make(map[string]interface{})
+			decoder := json.NewDecoder(r.Body)
+			decoder.UseNumber()
+			if err := decoder.Decode(&data); err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			secrets[path] = data
+			w.WriteHeader(http.StatusNoContent)
+		case r.Method == http.MethodDelete:
+			delete(secrets, path)
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}))
+}
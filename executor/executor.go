@@ -0,0 +1,381 @@
+// Package executor bound the work a service accepts: a fixed number of workers
+// take tasks from a queue of limited size, and each handler (a topic, a route)
+// can be limited to a number of tasks in flight. When the queue or the limit
+// of a handler is full the policy decide: Block wait for room, Drop discard the
+// task and Reject return ErrRejected so the caller can refuse the work
+package executor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/advancedlogic/easy/interfaces"
+	"github.com/advancedlogic/easy/logging"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+)
+
+// Policy is what to do with a task when there is no room for it
+type Policy int
+
+const (
+	Block Policy = iota
+	Drop
+	Reject
+)
+
+var policies = map[string]Policy{"block": Block, "drop": Drop, "reject": Reject}
+
+func (p Policy) String() string {
+	for name, policy := range policies {
+		if policy == p {
+			return name
+		}
+	}
+	return fmt.Sprintf("policy(%d)", int(p))
+}
+
+// ParsePolicy read block, drop or reject
+func ParsePolicy(policy string) (Policy, error) {
+	if p, exists := policies[policy]; exists {
+		return p, nil
+	}
+	return Block, fmt.Errorf("unknown policy %s", policy)
+}
+
+var (
+	//ErrRejected is returned for a task refused by the Reject policy
+	ErrRejected = errors.New("executor is full")
+	//ErrDropped is returned by Run for a task discarded by the Drop policy
+	ErrDropped = errors.New("task dropped")
+	//ErrStopped is returned for a task submitted to a stopped executor
+	ErrStopped = errors.New("executor is stopped")
+)
+
+var (
+	depth = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "easy_executor_queue_depth",
+		Help: "Tasks waiting for a worker",
+	}, []string{"executor"})
+	wait = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name: "easy_executor_wait_seconds",
+		Help: "Time spent by a task in the queue",
+	}, []string{"executor", "handler"})
+	duration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name: "easy_executor_duration_seconds",
+		Help: "Time spent by a worker on a task",
+	}, []string{"executor", "handler"})
+	refused = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "easy_executor_refused_total",
+		Help: "Tasks dropped or rejected, by policy",
+	}, []string{"executor", "handler", "policy"})
+)
+
+func init() {
+	prometheus.MustRegister(depth, wait, duration, refused)
+}
+
+type Option func(*Executor) error
+
+// Task is a unit of work, ctx is cancelled when the executor stops before it is done
+type Task func(ctx context.Context) error
+
+type task struct {
+	ctx     context.Context
+	handler string
+	fn      Task
+	queued  time.Time
+	release func()
+	done    chan error
+}
+
+// Executor run tasks on a bounded pool of workers
+type Executor struct {
+	sync.RWMutex
+	name      string
+	workers   int
+	queueSize int
+	policy    Policy
+	limits    map[string]int
+	slots     map[string]chan struct{}
+	queue     chan *task
+	running   bool
+	abort     context.CancelFunc
+	aborted   context.Context
+	group     sync.WaitGroup
+	interfaces.Logger
+}
+
+// WithName label the metrics of the executor, "default" by default
+func WithName(name string) Option {
+	return func(e *Executor) error {
+		if name != "" {
+			e.name = name
+			return nil
+		}
+		return errors.New("name cannot be empty")
+	}
+}
+
+// WithWorkers set how many tasks run at the same time, the number of CPUs by default
+func WithWorkers(workers int) Option {
+	return func(e *Executor) error {
+		if workers > 0 {
+			e.workers = workers
+			return nil
+		}
+		return errors.New("workers must be positive")
+	}
+}
+
+// WithQueueSize set how many tasks can wait for a worker, 100 by default
+func WithQueueSize(size int) Option {
+	return func(e *Executor) error {
+		if size >= 0 {
+			e.queueSize = size
+			return nil
+		}
+		return errors.New("queue size cannot be negative")
+	}
+}
+
+// WithPolicy set what to do with a task when there is no room, Block by default
+func WithPolicy(policy Policy) Option {
+	return func(e *Executor) error {
+		if _, err := ParsePolicy(policy.String()); err != nil {
+			return err
+		}
+		e.policy = policy
+		return nil
+	}
+}
+
+// WithLimit allow at most limit tasks of handler in flight, queued or running
+func WithLimit(handler string, limit int) Option {
+	return func(e *Executor) error {
+		if handler == "" || limit <= 0 {
+			return errors.New("handler cannot be empty and limit must be positive")
+		}
+		e.limits[handler] = limit
+		return nil
+	}
+}
+
+func WithLogger(logger interfaces.Logger) Option {
+	return func(e *Executor) error {
+		return e.WithLogger(logger)
+	}
+}
+
+func New(options ...Option) (*Executor, error) {
+	e := &Executor{
+		name:      "default",
+		workers:   runtime.NumCPU(),
+		queueSize: 100,
+		policy:    Block,
+		limits:    make(map[string]int),
+		slots:     make(map[string]chan struct{}),
+		Logger:    logging.Logrus(logrus.New()),
+	}
+	for _, option := range options {
+		if err := option(e); err != nil {
+			return nil, err
+		}
+	}
+	for handler, limit := range e.limits {
+		e.slots[handler] = make(chan struct{}, limit)
+	}
+	return e, nil
+}
+
+func (e *Executor) WithLogger(logger interfaces.Logger) error {
+	if logger != nil {
+		e.Logger = logger
+		return nil
+	}
+	return errors.New("logger cannot be nil")
+}
+
+// Start start the workers
+func (e *Executor) Start(ctx context.Context) error {
+	e.Lock()
+	defer e.Unlock()
+	if e.running {
+		return errors.New("executor already started")
+	}
+	e.queue = make(chan *task, e.queueSize)
+	e.aborted, e.abort = context.WithCancel(context.Background())
+	e.running = true
+	for i := 0; i < e.workers; i++ {
+		e.group.Add(1)
+		go e.work(e.queue)
+	}
+	e.Info("executor started", "workers", e.workers, "queue", e.queueSize, "policy", e.policy.String())
+	return nil
+}
+
+// Stop refuse new tasks and wait for the queued ones, cancelling their context
+// when ctx is done
+func (e *Executor) Stop(ctx context.Context) error {
+	e.Lock()
+	if !e.running {
+		e.Unlock()
+		return nil
+	}
+	e.running = false
+	close(e.queue)
+	abort := e.abort
+	e.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		e.group.Wait()
+		close(done)
+	}()
+	defer abort()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		abort()
+		<-done
+		return fmt.Errorf("tasks cancelled: %s", ctx.Err())
+	}
+}
+
+// Submit queue fn and return without waiting for it. The error is ErrRejected
+// or ErrStopped when the task is refused, nil when it is queued or dropped
+func (e *Executor) Submit(ctx context.Context, handler string, fn Task) error {
+	err := e.enqueue(ctx, handler, fn, nil)
+	if err == ErrDropped {
+		return nil
+	}
+	return err
+}
+
+// Run queue fn and wait for its result. With the Drop policy a task without
+// room return ErrDropped
+func (e *Executor) Run(ctx context.Context, handler string, fn Task) error {
+	done := make(chan error, 1)
+	if err := e.enqueue(ctx, handler, fn, done); err != nil {
+		return err
+	}
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Depth return how many tasks wait for a worker
+func (e *Executor) Depth() int {
+	e.RLock()
+	defer e.RUnlock()
+	return len(e.queue)
+}
+
+func (e *Executor) enqueue(ctx context.Context, handler string, fn Task, done chan error) error {
+	t := &task{ctx: ctx, handler: handler, fn: fn, done: done, release: func() {}}
+
+	if slots, limited := e.slots[handler]; limited {
+		if err := e.acquire(ctx, handler, slots); err != nil {
+			return err
+		}
+		t.release = func() { <-slots }
+	}
+
+	// the read lock keep Stop from closing the queue while a task is sent
+	e.RLock()
+	defer e.RUnlock()
+	if !e.running {
+		t.release()
+		return ErrStopped
+	}
+	t.queued = time.Now()
+	select {
+	case e.queue <- t:
+		depth.WithLabelValues(e.name).Set(float64(len(e.queue)))
+		return nil
+	default:
+	}
+	if e.policy != Block {
+		t.release()
+		return e.refuse(handler)
+	}
+	select {
+	case e.queue <- t:
+		depth.WithLabelValues(e.name).Set(float64(len(e.queue)))
+		return nil
+	case <-ctx.Done():
+		t.release()
+		return ctx.Err()
+	}
+}
+
+func (e *Executor) acquire(ctx context.Context, handler string, slots chan struct{}) error {
+	select {
+	case slots <- struct{}{}:
+		return nil
+	default:
+	}
+	if e.policy != Block {
+		return e.refuse(handler)
+	}
+	select {
+	case slots <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (e *Executor) refuse(handler string) error {
+	refused.WithLabelValues(e.name, handler, e.policy.String()).Inc()
+	if e.policy == Drop {
+		e.Warn("task dropped", "handler", handler)
+		return ErrDropped
+	}
+	return ErrRejected
+}
+
+func (e *Executor) work(queue chan *task) {
+	defer e.group.Done()
+	for t := range queue {
+		depth.WithLabelValues(e.name).Set(float64(len(queue)))
+		wait.WithLabelValues(e.name, t.handler).Observe(time.Since(t.queued).Seconds())
+		start := time.Now()
+		err := e.execute(t)
+		duration.WithLabelValues(e.name, t.handler).Observe(time.Since(start).Seconds())
+		t.release()
+		if t.done != nil {
+			t.done <- err
+		} else if err != nil {
+			e.Error("task failed", "handler", t.handler, "error", err)
+		}
+	}
+}
+
+func (e *Executor) execute(t *task) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	ctx, cancel := context.WithCancel(t.ctx)
+	defer cancel()
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		select {
+		case <-e.aborted.Done():
+			cancel()
+		case <-stop:
+		}
+	}()
+	return t.fn(ctx)
+}
@@ -0,0 +1,145 @@
+package executor
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/advancedlogic/easy/logging"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExecutor(t *testing.T) {
+	_, err := New(WithWorkers(0))
+	assert.NotNil(t, err)
+	_, err = New(WithPolicy(Policy(42)))
+	assert.NotNil(t, err)
+	_, err = ParsePolicy("ignore")
+	assert.NotNil(t, err)
+
+	e, err := New(WithWorkers(2), WithLogger(logging.Discard()))
+	assert.Nil(t, err)
+	assert.Equal(t, ErrStopped, e.Submit(context.Background(), "orders", func(context.Context) error { return nil }))
+	assert.Nil(t, e.Start(context.Background()))
+	assert.NotNil(t, e.Start(context.Background()))
+
+	assert.Nil(t, e.Run(context.Background(), "orders", func(context.Context) error { return nil }))
+	assert.Equal(t, "boom", e.Run(context.Background(), "orders", func(context.Context) error {
+		return errors.New("boom")
+	}).Error())
+	assert.Equal(t, "panic: oops", e.Run(context.Background(), "orders", func(context.Context) error {
+		panic("oops")
+	}).Error())
+
+	// at most 2 tasks run at the same time
+	var running, peak int32
+	for i := 0; i < 10; i++ {
+		assert.Nil(t, e.Submit(context.Background(), "orders", func(context.Context) error {
+			current := atomic.AddInt32(&running, 1)
+			for {
+				previous := atomic.LoadInt32(&peak)
+				if current <= previous || atomic.CompareAndSwapInt32(&peak, previous, current) {
+					break
+				}
+			}
+			time.Sleep(5 * time.Millisecond)
+			atomic.AddInt32(&running, -1)
+			return nil
+		}))
+	}
+	// Stop drain the queue
+	assert.Nil(t, e.Stop(context.Background()))
+	assert.Equal(t, int32(2), atomic.LoadInt32(&peak))
+	assert.Equal(t, int32(0), atomic.LoadInt32(&running))
+	assert.Equal(t, ErrStopped, e.Run(context.Background(), "orders", func(context.Context) error { return nil }))
+}
+
+func TestExecutor_Policies(t *testing.T) {
+	for _, policy := range []Policy{Drop, Reject} {
+		e, err := New(WithWorkers(1), WithQueueSize(1), WithPolicy(policy), WithLogger(logging.Discard()))
+		assert.Nil(t, err)
+		assert.Nil(t, e.Start(context.Background()))
+
+		release := make(chan struct{})
+		started := make(chan struct{})
+		assert.Nil(t, e.Submit(context.Background(), "slow", func(context.Context) error {
+			close(started)
+			<-release
+			return nil
+		}))
+		<-started
+		var runs int32
+		count := func(context.Context) error {
+			atomic.AddInt32(&runs, 1)
+			return nil
+		}
+		assert.Nil(t, e.Submit(context.Background(), "fast", count))
+		assert.Equal(t, 1, e.Depth())
+
+		err = e.Submit(context.Background(), "fast", count)
+		if policy == Drop {
+			assert.Nil(t, err)
+			assert.Equal(t, ErrDropped, e.Run(context.Background(), "fast", count))
+		} else {
+			assert.Equal(t, ErrRejected, err)
+		}
+		close(release)
+		assert.Nil(t, e.Stop(context.Background()))
+		assert.Equal(t, int32(1), atomic.LoadInt32(&runs))
+	}
+}
+
+func TestExecutor_Limit(t *testing.T) {
+	e, err := New(WithWorkers(4), WithLimit("orders", 1), WithPolicy(Reject), WithLogger(logging.Discard()))
+	assert.Nil(t, err)
+	assert.Nil(t, e.Start(context.Background()))
+	release := make(chan struct{})
+	assert.Nil(t, e.Submit(context.Background(), "orders", func(context.Context) error {
+		<-release
+		return nil
+	}))
+	assert.Equal(t, ErrRejected, e.Submit(context.Background(), "orders", func(context.Context) error { return nil }))
+	assert.Nil(t, e.Run(context.Background(), "invoices", func(context.Context) error { return nil }))
+	close(release)
+	assert.Nil(t, e.Stop(context.Background()))
+
+	// a blocked submission wait for the slot
+	e, _ = New(WithWorkers(2), WithLimit("orders", 1), WithLogger(logging.Discard()))
+	assert.Nil(t, e.Start(context.Background()))
+	var runs int32
+	for i := 0; i < 3; i++ {
+		assert.Nil(t, e.Submit(context.Background(), "orders", func(context.Context) error {
+			atomic.AddInt32(&runs, 1)
+			time.Sleep(time.Millisecond)
+			return nil
+		}))
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, context.DeadlineExceeded, e.Run(ctx, "orders", func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}))
+	assert.Nil(t, e.Stop(context.Background()))
+	assert.Equal(t, int32(3), atomic.LoadInt32(&runs))
+}
+
+func TestExecutor_StopTimeout(t *testing.T) {
+	e, _ := New(WithWorkers(1), WithLogger(logging.Discard()))
+	assert.Nil(t, e.Start(context.Background()))
+	started := make(chan struct{})
+	cancelled := make(chan error, 1)
+	assert.Nil(t, e.Submit(context.Background(), "stuck", func(ctx context.Context) error {
+		close(started)
+		<-ctx.Done()
+		cancelled <- ctx.Err()
+		return nil
+	}))
+	<-started
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.NotNil(t, e.Stop(ctx))
+	assert.Equal(t, context.Canceled, <-cancelled)
+}
@@ -0,0 +1,72 @@
+package factory
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/advancedlogic/easy/interfaces"
+)
+
+// Kinds of component that can be built by name
+const (
+	Registry  = "registry"
+	Broker    = "broker"
+	Cache     = "cache"
+	Store     = "store"
+	AuthN     = "authn"
+	AuthZ     = "authz"
+	Transport = "transport"
+)
+
+// Factory build a component from its settings
+type Factory func(settings interfaces.Configuration) (interface{}, error)
+
+var (
+	mutex     sync.RWMutex
+	factories = make(map[string]map[string]Factory)
+)
+
+// Register make a factory available under kind and name, it is meant to be
+// called from the init function of the package implementing the component.
+// Register panics when the same kind and name are registered twice
+func Register(kind, name string, factory Factory) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	if kind == "" || name == "" {
+		panic("factory: kind and name cannot be empty")
+	}
+	if factory == nil {
+		panic("factory: factory cannot be nil")
+	}
+	if _, exists := factories[kind]; !exists {
+		factories[kind] = make(map[string]Factory)
+	}
+	if _, exists := factories[kind][name]; exists {
+		panic(fmt.Sprintf("factory: %s %s registered twice", kind, name))
+	}
+	factories[kind][name] = factory
+}
+
+// New build the component registered under kind and name
+func New(kind, name string, settings interfaces.Configuration) (interface{}, error) {
+	mutex.RLock()
+	factory, exists := factories[kind][name]
+	mutex.RUnlock()
+	if !exists {
+		return nil, fmt.Errorf("unknown %s %s, available: %v", kind, name, Names(kind))
+	}
+	return factory(settings)
+}
+
+// Names return the sorted names registered for kind
+func Names(kind string) []string {
+	mutex.RLock()
+	defer mutex.RUnlock()
+	names := make([]string, 0, len(factories[kind]))
+	for name := range factories[kind] {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
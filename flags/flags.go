@@ -0,0 +1,416 @@
+// Package flags evaluate feature flags read from the configuration, below the
+// "flags" key by default:
+//
+//	flags:
+//	  dark-mode: true            # on or off for everybody
+//	  new-checkout:
+//	    enabled: true            # kill switch, true when omitted
+//	    percentage: 20           # share of the subjects, by a stable hash of their ID
+//	    users: [alice]           # always on for these subjects
+//	    groups: [beta]           # always on for the members of these groups
+//
+// A flag with targeting (percentage, users or groups) is on only for the
+// subjects it matches. Flags are reloaded when a configuration implementing
+// interfaces.ConfigurationWatcher changes
+package flags
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/advancedlogic/easy/authn/fs"
+	"github.com/advancedlogic/easy/interfaces"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var evaluations = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "easy_flag_evaluations_total",
+	Help: "Feature flag evaluations, by flag and result",
+}, []string{"flag", "result"})
+
+func init() {
+	prometheus.MustRegister(evaluations)
+}
+
+type Option func(*Flags) error
+
+//Flag is the definition of a feature flag
+type Flag struct {
+	Name       string   `json:"name"`
+	Enabled    bool     `json:"enabled"`
+	Percentage *float64 `json:"percentage,omitempty"`
+	Users      []string `json:"users,omitempty"`
+	Groups     []string `json:"groups,omitempty"`
+}
+
+//Evaluation is a flag together with how often it has been on and off
+type Evaluation struct {
+	Flag
+	On  uint64 `json:"on"`
+	Off uint64 `json:"off"`
+}
+
+type counts struct {
+	on, off uint64
+}
+
+// Flags hold the feature flags of a service
+type Flags struct {
+	sync.RWMutex
+	key       string
+	defaults  map[string]Flag
+	flags     map[string]Flag
+	counts    map[string]*counts
+	listeners []func([]string)
+}
+
+//WithKey set the configuration key holding the flags, "flags" by default
+func WithKey(key string) Option {
+	return func(f *Flags) error {
+		if key != "" {
+			f.key = strings.ToLower(key)
+			return nil
+		}
+		return errors.New("key cannot be empty")
+	}
+}
+
+//WithFlag define a flag used until the configuration defines one with the same name
+func WithFlag(flag Flag) Option {
+	return func(f *Flags) error {
+		if flag.Name == "" {
+			return errors.New("name cannot be empty")
+		}
+		flag.Name = strings.ToLower(flag.Name)
+		f.defaults[flag.Name] = flag
+		f.flags[flag.Name] = flag
+		return nil
+	}
+}
+
+func New(options ...Option) (*Flags, error) {
+	f := &Flags{
+		key:      "flags",
+		defaults: make(map[string]Flag),
+		flags:    make(map[string]Flag),
+		counts:   make(map[string]*counts),
+	}
+	for _, option := range options {
+		if err := option(f); err != nil {
+			return nil, err
+		}
+	}
+	return f, nil
+}
+
+//ForUser return the subject matching a user of the fs authn
+func ForUser(user *fs.User) interfaces.Subject {
+	if user == nil {
+		return interfaces.Subject{}
+	}
+	return interfaces.Subject{ID: user.Username, Groups: user.Groups}
+}
+
+//Watch load the flags from configuration and, when it is an
+//interfaces.ConfigurationWatcher, reload them every time it changes
+func (f *Flags) Watch(configuration interfaces.Configuration) error {
+	if configuration == nil {
+		return errors.New("configuration cannot be nil")
+	}
+	if err := f.Load(configuration); err != nil {
+		return err
+	}
+	if watcher, ok := configuration.(interfaces.ConfigurationWatcher); ok {
+		watcher.OnChange(func() {
+			// a broken edit keep the previous flags
+			_ = f.Load(configuration)
+		})
+	}
+	return nil
+}
+
+//Load replace the flags with the ones of configuration and notify the
+//OnChange listeners of the flags that changed
+func (f *Flags) Load(configuration interfaces.Configuration) error {
+	flags := make(map[string]Flag, len(f.defaults))
+	for name, flag := range f.defaults {
+		flags[name] = flag
+	}
+	if settings, exists := lookup(configuration.AllSettings(), f.key); exists {
+		definitions, ok := toMap(settings)
+		if !ok {
+			return fmt.Errorf("%s must be a map of flags", f.key)
+		}
+		for name, definition := range definitions {
+			flag, err := parse(strings.ToLower(name), definition)
+			if err != nil {
+				return err
+			}
+			flags[flag.Name] = flag
+		}
+	}
+
+	f.Lock()
+	changed := make([]string, 0)
+	for name, flag := range flags {
+		if previous, exists := f.flags[name]; !exists || !equal(previous, flag) {
+			changed = append(changed, name)
+		}
+	}
+	for name := range f.flags {
+		if _, exists := flags[name]; !exists {
+			changed = append(changed, name)
+		}
+	}
+	f.flags = flags
+	listeners := append([]func([]string){}, f.listeners...)
+	f.Unlock()
+
+	if len(changed) > 0 {
+		sort.Strings(changed)
+		for _, listener := range listeners {
+			listener(changed)
+		}
+	}
+	return nil
+}
+
+//OnChange call fn with the sorted names of the flags added, removed or
+//modified by a reload
+func (f *Flags) OnChange(fn func(changed []string)) {
+	f.Lock()
+	defer f.Unlock()
+	f.listeners = append(f.listeners, fn)
+}
+
+//Enabled tell whether the flag is on. A flag with targeting is on only for
+//the subjects it matches, see EnabledFor
+func (f *Flags) Enabled(name string) bool {
+	return f.EnabledFor(name, interfaces.Subject{})
+}
+
+//EnabledFor tell whether the flag is on for subject. Unknown flags are off
+func (f *Flags) EnabledFor(name string, subject interfaces.Subject) bool {
+	name = strings.ToLower(name)
+	f.RLock()
+	flag, exists := f.flags[name]
+	f.RUnlock()
+	on := exists && evaluate(flag, subject)
+	f.count(name, on)
+	return on
+}
+
+//Flags return the flags with their evaluation counts, sorted by name
+func (f *Flags) Flags() []Evaluation {
+	f.RLock()
+	defer f.RUnlock()
+	flags := make([]Evaluation, 0, len(f.flags))
+	for name, flag := range f.flags {
+		evaluation := Evaluation{Flag: flag}
+		if c, exists := f.counts[name]; exists {
+			evaluation.On, evaluation.Off = c.on, c.off
+		}
+		flags = append(flags, evaluation)
+	}
+	sort.Slice(flags, func(i, j int) bool {
+		return flags[i].Name < flags[j].Name
+	})
+	return flags
+}
+
+func (f *Flags) count(name string, on bool) {
+	result := "off"
+	if on {
+		result = "on"
+	}
+	evaluations.WithLabelValues(name, result).Inc()
+
+	f.Lock()
+	defer f.Unlock()
+	c, exists := f.counts[name]
+	if !exists {
+		c = &counts{}
+		f.counts[name] = c
+	}
+	if on {
+		c.on++
+	} else {
+		c.off++
+	}
+}
+
+func evaluate(flag Flag, subject interfaces.Subject) bool {
+	if !flag.Enabled {
+		return false
+	}
+	if flag.Percentage == nil && len(flag.Users) == 0 && len(flag.Groups) == 0 {
+		return true
+	}
+	if subject.ID != "" {
+		for _, user := range flag.Users {
+			if user == subject.ID {
+				return true
+			}
+		}
+	}
+	for _, group := range flag.Groups {
+		for _, member := range subject.Groups {
+			if group == member {
+				return true
+			}
+		}
+	}
+	if flag.Percentage == nil {
+		return false
+	}
+	if *flag.Percentage >= 100 {
+		return true
+	}
+	if subject.ID == "" {
+		return false
+	}
+	return bucket(flag.Name, subject.ID) < *flag.Percentage
+}
+
+//bucket place a subject in [0, 100), the same one every time for a flag
+func bucket(flag, id string) float64 {
+	h := fnv.New32a()
+	h.Write([]byte(flag + "/" + id))
+	return float64(h.Sum32()%10000) / 100
+}
+
+func parse(name string, definition interface{}) (Flag, error) {
+	flag := Flag{Name: name, Enabled: true}
+	switch d := definition.(type) {
+	case bool:
+		flag.Enabled = d
+		return flag, nil
+	case string:
+		enabled, err := strconv.ParseBool(d)
+		if err != nil {
+			return flag, fmt.Errorf("flag %s: %s", name, err)
+		}
+		flag.Enabled = enabled
+		return flag, nil
+	}
+	settings, ok := toMap(definition)
+	if !ok {
+		return flag, fmt.Errorf("flag %s: unsupported definition %T", name, definition)
+	}
+	for key, value := range settings {
+		var err error
+		switch strings.ToLower(key) {
+		case "enabled":
+			flag.Enabled, err = toBool(value)
+		case "percentage":
+			var percentage float64
+			if percentage, err = toFloat(value); err == nil {
+				if percentage < 0 || percentage > 100 {
+					err = errors.New("percentage must be between 0 and 100")
+				}
+				flag.Percentage = &percentage
+			}
+		case "users":
+			flag.Users, err = toStrings(value)
+		case "groups":
+			flag.Groups, err = toStrings(value)
+		default:
+			err = fmt.Errorf("unknown setting %s", key)
+		}
+		if err != nil {
+			return flag, fmt.Errorf("flag %s: %s", name, err)
+		}
+	}
+	return flag, nil
+}
+
+func equal(a, b Flag) bool {
+	if a.Enabled != b.Enabled || (a.Percentage == nil) != (b.Percentage == nil) {
+		return false
+	}
+	if a.Percentage != nil && *a.Percentage != *b.Percentage {
+		return false
+	}
+	return strings.Join(a.Users, "\x00") == strings.Join(b.Users, "\x00") &&
+		strings.Join(a.Groups, "\x00") == strings.Join(b.Groups, "\x00")
+}
+
+//lookup follow a dotted key in nested settings
+func lookup(settings map[string]interface{}, key string) (interface{}, bool) {
+	var value interface{} = settings
+	for _, part := range strings.Split(key, ".") {
+		m, ok := toMap(value)
+		if !ok {
+			return nil, false
+		}
+		if value, ok = m[part]; !ok {
+			return nil, false
+		}
+	}
+	return value, true
+}
+
+func toMap(value interface{}) (map[string]interface{}, bool) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		return v, true
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for key, value := range v {
+			m[fmt.Sprint(key)] = value
+		}
+		return m, true
+	}
+	return nil, false
+}
+
+func toBool(value interface{}) (bool, error) {
+	switch v := value.(type) {
+	case bool:
+		return v, nil
+	case string:
+		return strconv.ParseBool(v)
+	}
+	return false, fmt.Errorf("%v is not a boolean", value)
+}
+
+func toFloat(value interface{}) (float64, error) {
+	switch v := value.(type) {
+	case int:
+		return float64(v), nil
+	case int64:
+		return float64(v), nil
+	case float64:
+		return v, nil
+	case string:
+		return strconv.ParseFloat(strings.TrimSuffix(v, "%"), 64)
+	}
+	return 0, fmt.Errorf("%v is not a number", value)
+}
+
+func toStrings(value interface{}) ([]string, error) {
+	switch v := value.(type) {
+	case []string:
+		return v, nil
+	case string:
+		values := make([]string, 0)
+		for _, s := range strings.Split(v, ",") {
+			if s = strings.TrimSpace(s); s != "" {
+				values = append(values, s)
+			}
+		}
+		return values, nil
+	case []interface{}:
+		values := make([]string, len(v))
+		for i, item := range v {
+			values[i] = fmt.Sprint(item)
+		}
+		return values, nil
+	}
+	return nil, fmt.Errorf("%v is not a list", value)
+}
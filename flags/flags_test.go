@@ -0,0 +1,101 @@
+package flags
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/advancedlogic/easy/authn/fs"
+	"github.com/advancedlogic/easy/interfaces"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+type configuration struct {
+	interfaces.Configuration
+	settings map[string]interface{}
+}
+
+func (c *configuration) AllSettings() map[string]interface{} {
+	return c.settings
+}
+
+func TestFlags(t *testing.T) {
+	_, err := New(WithFlag(Flag{}))
+	assert.NotNil(t, err)
+	f, err := New(WithFlag(Flag{Name: "Legacy", Enabled: true}))
+	assert.Nil(t, err)
+
+	c := &configuration{settings: map[string]interface{}{
+		"flags": map[string]interface{}{
+			"dark-mode": true,
+			"off":       "false",
+			"checkout": map[string]interface{}{
+				"percentage": 50,
+				"users":      []interface{}{"alice"},
+				"groups":     "beta, staff",
+			},
+			"killed": map[string]interface{}{
+				"enabled": false,
+				"users":   []string{"alice"},
+			},
+		},
+	}}
+	assert.Nil(t, f.Load(c))
+
+	assert.True(t, f.Enabled("legacy"))
+	assert.True(t, f.Enabled("DARK-MODE"))
+	assert.False(t, f.Enabled("off"))
+	assert.False(t, f.Enabled("unknown"))
+	assert.False(t, f.Enabled("checkout"))
+	assert.True(t, f.EnabledFor("checkout", interfaces.Subject{ID: "alice"}))
+	assert.True(t, f.EnabledFor("checkout", ForUser(&fs.User{Username: "bob", Groups: []string{"staff"}})))
+	assert.False(t, f.EnabledFor("killed", interfaces.Subject{ID: "alice"}))
+
+	on := 0
+	for i := 0; i < 1000; i++ {
+		subject := interfaces.Subject{ID: fmt.Sprintf("user-%d", i)}
+		enabled := f.EnabledFor("checkout", subject)
+		assert.Equal(t, enabled, f.EnabledFor("checkout", subject))
+		if enabled {
+			on++
+		}
+	}
+	assert.InDelta(t, 500, on, 75)
+
+	evaluations := f.Flags()
+	assert.Equal(t, 5, len(evaluations))
+	assert.Equal(t, "checkout", evaluations[0].Name)
+	assert.Equal(t, 50.0, *evaluations[0].Percentage)
+	assert.True(t, evaluations[0].On > 0 && evaluations[0].Off > 0)
+
+	c.settings["flags"] = map[string]interface{}{"checkout": map[string]interface{}{"percentage": 200}}
+	assert.NotNil(t, f.Load(c))
+	c.settings["flags"] = map[string]interface{}{"checkout": map[string]interface{}{"color": "red"}}
+	assert.NotNil(t, f.Load(c))
+	assert.True(t, f.Enabled("dark-mode"))
+}
+
+func TestFlags_Watch(t *testing.T) {
+	f, err := New(WithKey("features"))
+	assert.Nil(t, err)
+	var changes [][]string
+	f.OnChange(func(changed []string) {
+		changes = append(changes, changed)
+	})
+
+	v := viper.New()
+	v.SetConfigType("yaml")
+	assert.Nil(t, v.ReadConfig(strings.NewReader("features:\n  beta:\n    groups: [beta]\n  new-ui: false\n")))
+	assert.Nil(t, f.Load(&configuration{settings: v.AllSettings()}))
+	assert.Equal(t, [][]string{{"beta", "new-ui"}}, changes)
+	assert.True(t, f.EnabledFor("beta", interfaces.Subject{Groups: []string{"beta"}}))
+
+	assert.Nil(t, f.Load(&configuration{settings: map[string]interface{}{
+		"features": map[string]interface{}{"beta": map[string]interface{}{"groups": []interface{}{"beta"}}, "new-ui": true},
+	}}))
+	assert.Equal(t, []string{"new-ui"}, changes[1])
+	assert.True(t, f.Enabled("new-ui"))
+
+	assert.NotNil(t, f.Watch(nil))
+}
@@ -0,0 +1,176 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/advancedlogic/easy/interfaces"
+)
+
+// Status of a component or of the whole service
+const (
+	Up   = "up"
+	Down = "down"
+)
+
+// Check is the result of the health check of one component
+type Check struct {
+	Status   string `json:"status"`
+	Error    string `json:"error,omitempty"`
+	Duration string `json:"duration"`
+}
+
+// Report aggregate the checks of every component, the service is up when
+// all of them are
+type Report struct {
+	Status     string           `json:"status"`
+	Components map[string]Check `json:"components,omitempty"`
+}
+
+// Func adapt a function to the HealthChecker interface
+type Func func(context.Context) error
+
+func (f Func) Health(ctx context.Context) error {
+	return f(ctx)
+}
+
+type Option func(*Checker) error
+
+// Checker run the health checks of a set of named components
+type Checker struct {
+	sync.Mutex
+	timeout time.Duration
+	checks  map[string]interfaces.HealthChecker
+}
+
+// WithTimeout set the time given to each component to answer, default to 5s
+func WithTimeout(timeout time.Duration) Option {
+	return func(c *Checker) error {
+		if timeout > 0 {
+			c.timeout = timeout
+			return nil
+		}
+		return errors.New("timeout must be positive")
+	}
+}
+
+func New(options ...Option) (*Checker, error) {
+	c := &Checker{
+		timeout: 5 * time.Second,
+		checks:  make(map[string]interfaces.HealthChecker),
+	}
+	for _, option := range options {
+		if err := option(c); err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// Add register the health check of a component under a unique name
+func (c *Checker) Add(name string, checker interfaces.HealthChecker) error {
+	if name == "" {
+		return errors.New("name cannot be empty")
+	}
+	if checker == nil {
+		return errors.New("checker cannot be nil")
+	}
+	c.Lock()
+	defer c.Unlock()
+	if _, exists := c.checks[name]; exists {
+		return fmt.Errorf("health check %s already registered", name)
+	}
+	c.checks[name] = checker
+	return nil
+}
+
+// Has tell if a health check has been registered under name
+func (c *Checker) Has(name string) bool {
+	c.Lock()
+	defer c.Unlock()
+	_, exists := c.checks[name]
+	return exists
+}
+
+// Names return the sorted names of the registered checks
+func (c *Checker) Names() []string {
+	c.Lock()
+	defer c.Unlock()
+	names := make([]string, 0, len(c.checks))
+	for name := range c.checks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Check run every health check concurrently. A check that does not answer
+// within the timeout is reported down
+func (c *Checker) Check(ctx context.Context) Report {
+	c.Lock()
+	checks := make(map[string]interfaces.HealthChecker, len(c.checks))
+	for name, checker := range c.checks {
+		checks[name] = checker
+	}
+	c.Unlock()
+
+	report := Report{
+		Status:     Up,
+		Components: make(map[string]Check, len(checks)),
+	}
+	var (
+		mutex sync.Mutex
+		wg    sync.WaitGroup
+	)
+	for name, checker := range checks {
+		wg.Add(1)
+		go func(name string, checker interfaces.HealthChecker) {
+			defer wg.Done()
+			check := c.run(ctx, checker)
+			mutex.Lock()
+			defer mutex.Unlock()
+			report.Components[name] = check
+			if check.Status != Up {
+				report.Status = Down
+			}
+		}(name, checker)
+	}
+	wg.Wait()
+	return report
+}
+
+func (c *Checker) run(ctx context.Context, checker interfaces.HealthChecker) Check {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	start := time.Now()
+	done := make(chan error, 1)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				done <- fmt.Errorf("health check panicked: %v", r)
+			}
+		}()
+		done <- checker.Health(ctx)
+	}()
+
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	check := Check{
+		Status:   Up,
+		Duration: time.Since(start).String(),
+	}
+	if err != nil {
+		check.Status = Down
+		check.Error = err.Error()
+	}
+	return check
+}
@@ -0,0 +1,33 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChecker_Check(t *testing.T) {
+	checker, err := New(WithTimeout(20 * time.Millisecond))
+	assert.Nil(t, err)
+	assert.Nil(t, checker.Add("cache", Func(func(context.Context) error { return nil })))
+	assert.NotNil(t, checker.Add("cache", Func(func(context.Context) error { return nil })))
+
+	report := checker.Check(context.Background())
+	assert.Equal(t, Up, report.Status)
+	assert.Equal(t, Up, report.Components["cache"].Status)
+
+	assert.Nil(t, checker.Add("broker", Func(func(context.Context) error { return errors.New("not connected") })))
+	assert.Nil(t, checker.Add("store", Func(func(context.Context) error {
+		time.Sleep(time.Second)
+		return nil
+	})))
+	report = checker.Check(context.Background())
+	assert.Equal(t, Down, report.Status)
+	assert.Equal(t, Up, report.Components["cache"].Status)
+	assert.Equal(t, "not connected", report.Components["broker"].Error)
+	assert.Equal(t, Down, report.Components["store"].Status)
+	assert.Equal(t, []string{"broker", "cache", "store"}, checker.Names())
+}
@@ -0,0 +1,352 @@
+package hotswap
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"plugin"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/advancedlogic/easy/interfaces"
+	"github.com/advancedlogic/easy/logging"
+	"github.com/fsnotify/fsnotify"
+	"github.com/sirupsen/logrus"
+)
+
+// Open load the processor exported as symbol by the Go plugin at path
+func Open(path, symbol string) (processor interfaces.Processor, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("plugin %s: %v", path, r)
+		}
+	}()
+	plug, err := plugin.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	sym, err := plug.Lookup(symbol)
+	if err != nil {
+		return nil, err
+	}
+	processor, ok := sym.(interfaces.Processor)
+	if !ok {
+		return nil, fmt.Errorf("plugin %s: symbol %s is a %T, not a processor", path, symbol, sym)
+	}
+	return processor, nil
+}
+
+type Option func(*Processor) error
+
+type version struct {
+	path      string
+	processor interfaces.Processor
+	inflight  sync.WaitGroup
+}
+
+// Processor delegate to the latest plugin found in a folder. Go plugins cannot
+// be unloaded, so every version must be deployed under a new file name
+// (e.g. hello-1.0.1.so): the new version is loaded next to the old one,
+// initialised, and swapped in once ready. The old one is closed when its
+// in-flight calls are done
+type Processor struct {
+	sync.RWMutex
+	folder       string
+	symbol       string
+	settle       time.Duration
+	drainTimeout time.Duration
+	service      interfaces.Service
+	current      *version
+	loaded       map[string]bool
+	open         func(string, string) (interfaces.Processor, error)
+	watcher      *fsnotify.Watcher
+	done         chan struct{}
+	interfaces.Logger
+}
+
+func WithFolder(folder string) Option {
+	return func(p *Processor) error {
+		if folder != "" {
+			p.folder = folder
+			return nil
+		}
+		return errors.New("folder cannot be empty")
+	}
+}
+
+func WithSymbol(symbol string) Option {
+	return func(p *Processor) error {
+		if symbol != "" {
+			p.symbol = symbol
+			return nil
+		}
+		return errors.New("symbol cannot be empty")
+	}
+}
+
+// WithSettle set how long a plugin file must stay unchanged before being loaded
+func WithSettle(settle time.Duration) Option {
+	return func(p *Processor) error {
+		if settle > 0 {
+			p.settle = settle
+			return nil
+		}
+		return errors.New("settle must be positive")
+	}
+}
+
+// WithDrainTimeout set how long in-flight calls are waited for before the
+// previous version is closed anyway
+func WithDrainTimeout(timeout time.Duration) Option {
+	return func(p *Processor) error {
+		if timeout > 0 {
+			p.drainTimeout = timeout
+			return nil
+		}
+		return errors.New("drain timeout must be positive")
+	}
+}
+
+func WithLogger(logger interfaces.Logger) Option {
+	return func(p *Processor) error {
+		return p.WithLogger(logger)
+	}
+}
+
+func New(options ...Option) (*Processor, error) {
+	p := &Processor{
+		symbol:       "Processor",
+		settle:       time.Second,
+		drainTimeout: 30 * time.Second,
+		loaded:       make(map[string]bool),
+		open:         Open,
+		Logger:       logging.Logrus(logrus.New()),
+	}
+	for _, option := range options {
+		if err := option(p); err != nil {
+			return nil, err
+		}
+	}
+	if p.folder == "" {
+		return nil, errors.New("folder cannot be empty")
+	}
+	return p, nil
+}
+
+func (p *Processor) WithLogger(logger interfaces.Logger) error {
+	if logger != nil {
+		p.Logger = logger
+		return nil
+	}
+	return errors.New("logger cannot be nil")
+}
+
+// Init load the most recent plugin of the folder and start watching it
+func (p *Processor) Init(service interfaces.Service) error {
+	p.service = service
+	path, err := p.latest()
+	if err != nil {
+		return err
+	}
+	if err := p.Load(path); err != nil {
+		return err
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	if err := watcher.Add(p.folder); err != nil {
+		watcher.Close()
+		return err
+	}
+	p.watcher = watcher
+	p.done = make(chan struct{})
+	go p.watch(watcher, p.done)
+	return nil
+}
+
+// Close stop watching the folder and close the current version
+func (p *Processor) Close() error {
+	if p.watcher != nil {
+		close(p.done)
+		p.watcher.Close()
+		p.watcher = nil
+	}
+	p.Lock()
+	current := p.current
+	p.current = nil
+	p.Unlock()
+	if current != nil {
+		return p.retire(current)
+	}
+	return nil
+}
+
+func (p *Processor) Process(data interface{}) (interface{}, error) {
+	return p.ProcessContext(context.Background(), data)
+}
+
+func (p *Processor) ProcessContext(ctx context.Context, data interface{}) (interface{}, error) {
+	p.RLock()
+	current := p.current
+	if current != nil {
+		current.inflight.Add(1)
+	}
+	p.RUnlock()
+	if current == nil {
+		return nil, errors.New("no plugin loaded")
+	}
+	defer current.inflight.Done()
+	return current.processor.ProcessContext(ctx, data)
+}
+
+// Version return the path of the plugin currently serving
+func (p *Processor) Version() string {
+	p.RLock()
+	defer p.RUnlock()
+	if p.current == nil {
+		return ""
+	}
+	return p.current.path
+}
+
+// Health report whether a plugin is serving, and the plugin health when it has one
+func (p *Processor) Health(ctx context.Context) error {
+	p.RLock()
+	current := p.current
+	p.RUnlock()
+	if current == nil {
+		return errors.New("no plugin loaded")
+	}
+	if checker, ok := current.processor.(interfaces.HealthChecker); ok {
+		return checker.Health(ctx)
+	}
+	return nil
+}
+
+// Load open and initialise the plugin at path then switch traffic to it.
+// A plugin that cannot be opened or initialised is rejected and the current
+// version keeps serving
+func (p *Processor) Load(path string) error {
+	p.Lock()
+	if p.loaded[path] {
+		p.Unlock()
+		return fmt.Errorf("plugin %s already loaded, deploy new versions under a new name", path)
+	}
+	// reserved against a concurrent load, recorded once opened
+	p.loaded[path] = true
+	p.Unlock()
+
+	processor, err := p.open(path, p.symbol)
+	if err != nil {
+		// a file that cannot be opened yet, e.g. still being copied, can be retried
+		p.Lock()
+		delete(p.loaded, path)
+		p.Unlock()
+		return err
+	}
+	if err := p.init(processor); err != nil {
+		return fmt.Errorf("plugin %s: %s", path, err)
+	}
+
+	p.Lock()
+	previous := p.current
+	p.current = &version{path: path, processor: processor}
+	p.Unlock()
+	p.Info("plugin serving", "plugin", path)
+
+	if previous != nil {
+		go func() {
+			if err := p.retire(previous); err != nil {
+				p.Error("plugin close failed", "plugin", previous.path, "error", err)
+			}
+		}()
+	}
+	return nil
+}
+
+func (p *Processor) init(processor interfaces.Processor) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("init panicked: %v", r)
+		}
+	}()
+	return processor.Init(p.service)
+}
+
+// retire wait for the in-flight calls of a version and close it
+func (p *Processor) retire(v *version) error {
+	drained := make(chan struct{})
+	go func() {
+		v.inflight.Wait()
+		close(drained)
+	}()
+	select {
+	case <-drained:
+	case <-time.After(p.drainTimeout):
+		p.Warn("plugin closing with calls still in flight", "plugin", v.path)
+	}
+	return v.processor.Close()
+}
+
+func (p *Processor) latest() (string, error) {
+	files, err := ioutil.ReadDir(p.folder)
+	if err != nil {
+		return "", err
+	}
+	var (
+		path    string
+		modTime time.Time
+	)
+	for _, file := range files {
+		if file.IsDir() || !strings.HasSuffix(file.Name(), ".so") {
+			continue
+		}
+		if path == "" || file.ModTime().After(modTime) {
+			path = filepath.Join(p.folder, file.Name())
+			modTime = file.ModTime()
+		}
+	}
+	if path == "" {
+		return "", fmt.Errorf("no plugin found in %s", p.folder)
+	}
+	return path, nil
+}
+
+func (p *Processor) watch(watcher *fsnotify.Watcher, done chan struct{}) {
+	pending := make(map[string]time.Time)
+	ticker := time.NewTicker(p.settle / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return
+			}
+			if strings.HasSuffix(event.Name, ".so") && event.Op&(fsnotify.Create|fsnotify.Write) != 0 {
+				pending[event.Name] = time.Now()
+			}
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return
+			}
+			p.Error("plugin folder watch failed", "folder", p.folder, "error", err)
+		case now := <-ticker.C:
+			for path, changed := range pending {
+				if now.Sub(changed) < p.settle {
+					continue
+				}
+				delete(pending, path)
+				if err := p.Load(path); err != nil {
+					p.Error("plugin rejected", "plugin", path, "error", err)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package hotswap
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/advancedlogic/easy/interfaces"
+	"github.com/stretchr/testify/assert"
+)
+
+type fake struct {
+	name    string
+	initErr error
+	release chan struct{}
+	closed  *int32
+}
+
+func (f *fake) Init(service interfaces.Service) error {
+	return f.initErr
+}
+
+func (f *fake) Close() error {
+	atomic.AddInt32(f.closed, 1)
+	return nil
+}
+
+func (f *fake) Process(data interface{}) (interface{}, error) {
+	return f.ProcessContext(context.Background(), data)
+}
+
+func (f *fake) ProcessContext(ctx context.Context, data interface{}) (interface{}, error) {
+	if f.release != nil {
+		<-f.release
+	}
+	return f.name, nil
+}
+
+func TestProcessor_Swap(t *testing.T) {
+	folder, _ := ioutil.TempDir("", "plugins")
+	defer os.RemoveAll(folder)
+	ioutil.WriteFile(filepath.Join(folder, "hello-1.so"), []byte{}, 0644)
+
+	var closed int32
+	release := make(chan struct{})
+	plugins := map[string]*fake{
+		filepath.Join(folder, "hello-1.so"): {name: "v1", release: release, closed: &closed},
+		filepath.Join(folder, "hello-2.so"): {name: "v2", closed: &closed},
+		filepath.Join(folder, "broken.so"):  {name: "broken", initErr: errors.New("boom"), closed: &closed},
+	}
+	p, err := New(WithFolder(folder), WithSettle(10*time.Millisecond), WithDrainTimeout(time.Second))
+	assert.Nil(t, err)
+	p.open = func(path, symbol string) (interfaces.Processor, error) {
+		return plugins[path], nil
+	}
+	assert.Nil(t, p.Init(nil))
+	defer p.Close()
+
+	inflight := make(chan interface{})
+	go func() {
+		output, _ := p.Process("data")
+		inflight <- output
+	}()
+	time.Sleep(10 * time.Millisecond)
+
+	assert.NotNil(t, p.Load(filepath.Join(folder, "broken.so")))
+	assert.Equal(t, filepath.Join(folder, "hello-1.so"), p.Version())
+
+	assert.Nil(t, p.Load(filepath.Join(folder, "hello-2.so")))
+	output, _ := p.Process("data")
+	assert.Equal(t, "v2", output)
+	assert.Equal(t, int32(0), atomic.LoadInt32(&closed))
+
+	close(release)
+	assert.Equal(t, "v1", <-inflight)
+	time.Sleep(10 * time.Millisecond)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&closed))
+}
+
+func TestProcessor_Retry(t *testing.T) {
+	folder, _ := ioutil.TempDir("", "plugins")
+	defer os.RemoveAll(folder)
+	var closed int32
+	p, err := New(WithFolder(folder))
+	assert.Nil(t, err)
+	failures := 1
+	p.open = func(path, symbol string) (interfaces.Processor, error) {
+		if failures > 0 {
+			failures--
+			return nil, errors.New("plugin was built with a different version of package")
+		}
+		return &fake{name: "v1", closed: &closed}, nil
+	}
+
+	// a failed open does not keep the file from being loaded again
+	assert.NotNil(t, p.Load("hello-1.so"))
+	assert.Nil(t, p.Load("hello-1.so"))
+	assert.Equal(t, "hello-1.so", p.Version())
+	assert.NotNil(t, p.Load("hello-1.so"))
+}
@@ -1,11 +1,53 @@
 package interfaces
 
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+var (
+	//ErrUserExists is returned when registering a username already taken
+	ErrUserExists = errors.New("user already exists")
+	//ErrUserNotFound is returned for an unknown username
+	ErrUserNotFound = errors.New("user not found")
+	//ErrUserDisabled is returned when a disabled user logs in
+	ErrUserDisabled = errors.New("user disabled")
+	//ErrWrongCredentials is returned for a wrong username or password
+	ErrWrongCredentials = errors.New("wrong username or password")
+)
+
 type AuthN interface {
 	Register(string, string) (interface{}, error)
 	Login(string, string) (interface{}, error)
 	Logout(string) error
 	Delete(string) error
 	Reset(string, string) (interface{}, error)
+
+	RegisterContext(context.Context, string, string) (interface{}, error)
+	LoginContext(context.Context, string, string) (interface{}, error)
+	LogoutContext(context.Context, string) error
+	DeleteContext(context.Context, string) error
+	ResetContext(context.Context, string, string) (interface{}, error)
 }
 
 type AuthNOption func(AuthN) error
+
+//GroupProvider is implemented by the authn able to tell the groups of a user
+type GroupProvider interface {
+	GroupsContext(context.Context, string) ([]string, error)
+}
+
+//UserManager is implemented by the authn able to administer their users. The
+//users are returned without their password
+type UserManager interface {
+	UsersContext(context.Context) (interface{}, error)
+	UserContext(context.Context, string) (interface{}, error)
+	SetEnabledContext(context.Context, string, bool) error
+	EnabledContext(context.Context, string) (bool, error)
+	//PasswordChangedContext tell when the password of a user was last reset,
+	//the zero time when it never was
+	PasswordChangedContext(context.Context, string) (time.Time, error)
+	AddGroupsContext(context.Context, string, ...string) ([]string, error)
+	RemoveGroupsContext(context.Context, string, ...string) ([]string, error)
+}
@@ -1,8 +1,39 @@
 package interfaces
 
+import "context"
+
 type AuthZ interface {
 	NewToken(string) (string, error)
 	RefreshToken(string) (string, error)
 	RevokeToken(string) error
 	CheckToken(string) error
+
+	NewTokenContext(context.Context, string) (string, error)
+	RefreshTokenContext(context.Context, string) (string, error)
+	RevokeTokenContext(context.Context, string) error
+	CheckTokenContext(context.Context, string) error
+}
+
+//Tokens is the pair issued at login: the access token goes with every request
+//and the refresh token trades it for a new pair when it expires
+type Tokens struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int64  `json:"expires_in"`
+}
+
+//Sessions is implemented by the AuthZ issuing access and refresh token pairs
+type Sessions interface {
+	NewSessionContext(context.Context, string) (*Tokens, error)
+	RefreshSessionContext(context.Context, string) (*Tokens, error)
+	//SubjectContext return who a valid access token was issued to
+	SubjectContext(context.Context, string) (string, error)
+}
+
+//SubjectRevoker is implemented by the AuthZ able to revoke every token issued
+//to a subject, like after a password reset
+type SubjectRevoker interface {
+	//RevokeSubjectContext revoke the tokens issued to subject until now
+	RevokeSubjectContext(context.Context, string) error
 }
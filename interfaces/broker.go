@@ -1,13 +1,27 @@
 package interfaces
 
+import "context"
+
 type Broker interface {
 	Run() error
 	Endpoint() string
 	Connect() error
 	Publish(string, interface{}) error
+	PublishContext(context.Context, string, interface{}) error
 	Subscribe(string, interface{}) error
 	Unsubscribe(string) error
+	Subscriptions() []string
 	Close() error
 }
 
 type BrokerOption func(Broker) error
+
+//Message is what a broker hands to a MessageHandler, whatever its implementation
+type Message struct {
+	Topic string
+	Reply string
+	Data  []byte
+}
+
+//MessageHandler can be subscribed to any broker, next to the broker specific handlers
+type MessageHandler func(context.Context, *Message) error
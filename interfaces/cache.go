@@ -1,5 +1,10 @@
 package interfaces
 
+import (
+	"context"
+	"time"
+)
+
 type Cache interface {
 	Init() error
 	Close() error
@@ -12,6 +17,30 @@ type Cache interface {
 
 	Set(string) error
 	IsMember(string) (bool, error)
+
+	PutContext(context.Context, string, interface{}) error
+	TakeContext(context.Context, string) (interface{}, error)
+	ExistsContext(context.Context, ...string) (bool, error)
+	KeysContext(context.Context) (interface{}, error)
+	DeleteContext(context.Context, ...string) error
+
+	SetContext(context.Context, string) error
+	IsMemberContext(context.Context, string) (bool, error)
 }
 
 type CacheOption func(Cache) error
+
+//Locker is implemented by the caches able to take a lock shared by every
+//instance of a service
+type Locker interface {
+	//TryLock take key for ttl unless it is already taken, owner is stored as its value
+	TryLock(ctx context.Context, key, owner string, ttl time.Duration) (bool, error)
+}
+
+//Counter is implemented by the caches able to count atomically, for the limits
+//shared by every instance of a service
+type Counter interface {
+	//Increment add one to the counter of key and return its value, a new
+	//counter expires after ttl
+	Increment(ctx context.Context, key string, ttl time.Duration) (int64, error)
+}
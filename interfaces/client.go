@@ -1,5 +1,7 @@
 package interfaces
 
+import "context"
+
 type Client interface {
 	GET(interface{}) error
 	POST(interface{}) error
@@ -7,6 +9,13 @@ type Client interface {
 	DELETE(interface{}) error
 	HEAD(interface{}) error
 	OPTIONS(interface{}) error
+
+	GETContext(context.Context, interface{}) error
+	POSTContext(context.Context, interface{}) error
+	PUTContext(context.Context, interface{}) error
+	DELETEContext(context.Context, interface{}) error
+	HEADContext(context.Context, interface{}) error
+	OPTIONSContext(context.Context, interface{}) error
 }
 
 type ClientOption func(Client) error
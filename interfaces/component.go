@@ -0,0 +1,11 @@
+package interfaces
+
+import "context"
+
+// Component is anything whose lifecycle is driven by the service:
+// Start is called once the components it depends on are running,
+// Stop is called in reverse order when the service shuts down
+type Component interface {
+	Start(context.Context) error
+	Stop(context.Context) error
+}
@@ -21,6 +21,14 @@ type Configuration interface {
 	GetDurationOrDefault(string, time.Duration) time.Duration
 	GetMapOfStringOrDefault(string, map[string]string) map[string]string
 	GetArrayOfStringsOrDefault(string, []string) []string
+	// Every setting, as a nested map
+	AllSettings() map[string]interface{}
 }
 
 type ConfigurationOption func(Configuration) error
+
+//ConfigurationWatcher is implemented by the configurations able to tell when
+//their settings change, e.g. when the file is edited
+type ConfigurationWatcher interface {
+	OnChange(func())
+}
@@ -0,0 +1,12 @@
+package interfaces
+
+//Subject is who a feature flag is evaluated for: a user ID and its groups
+type Subject struct {
+	ID     string
+	Groups []string
+}
+
+type FeatureFlags interface {
+	Enabled(string) bool
+	EnabledFor(string, Subject) bool
+}
@@ -0,0 +1,9 @@
+package interfaces
+
+import "context"
+
+// HealthChecker is implemented by components able to tell whether they can
+// serve requests: Health returns nil when the component is healthy
+type HealthChecker interface {
+	Health(context.Context) error
+}
@@ -0,0 +1,15 @@
+package interfaces
+
+// Logger write structured entries, keyvals alternate keys and values:
+//
+//	logger.Info("order created", "order", id, "amount", 42)
+//
+// With return a child logger adding its keyvals to every entry
+type Logger interface {
+	Debug(message interface{}, keyvals ...interface{})
+	Info(message interface{}, keyvals ...interface{})
+	Warn(message interface{}, keyvals ...interface{})
+	Error(message interface{}, keyvals ...interface{})
+	Fatal(message interface{}, keyvals ...interface{})
+	With(keyvals ...interface{}) Logger
+}
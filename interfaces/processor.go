@@ -1,9 +1,12 @@
 package interfaces
 
+import "context"
+
 type Processor interface {
 	Init(service Service) error
 	Close() error
 	Process(interface{}) (interface{}, error)
+	ProcessContext(context.Context, interface{}) (interface{}, error)
 }
 
 type ProcessorOption func(Processor) error
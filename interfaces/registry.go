@@ -1,7 +1,12 @@
 package interfaces
 
+import "context"
+
 type Registry interface {
 	Register() error
+	RegisterContext(context.Context) error
+	Deregister() error
+	DeregisterContext(context.Context) error
 	WithPort(port int) error
 }
 
@@ -1,5 +1,7 @@
 package interfaces
 
+import "context"
+
 //Basic Microservice interface
 // ID()  set/get unique Microservice identifier
 // Name() set/get the Microservice name
@@ -9,8 +11,8 @@ type Service interface {
 	Name() string
 
 	//Init(...ServiceOption)
-	Run()
-	Stop()
+	Run() error
+	Stop() error
 	IsRunning() bool
 	HookShutDown(func())
 
@@ -22,7 +24,9 @@ type Service interface {
 	Processor() Processor
 	Configuration() Configuration
 	AuthN() AuthN
+	AuthZ() AuthZ
 	Cache() Cache
+	Flags() FeatureFlags
 
 	//Transport Handler (rest) Helpers
 	Handler(string, string, interface{}) error
@@ -35,12 +39,14 @@ type Service interface {
 	Subscribe(string, interface{}) error
 	Unsubscribe(string) error
 	Publish(string, interface{}) error
+	PublishContext(context.Context, string, interface{}) error
 	//Store
 
 	//Log
-	Info(interface{})
-	Warn(interface{})
-	Error(interface{})
-	Fatal(interface{})
-	Debug(interface{})
+	Info(interface{}, ...interface{})
+	Warn(interface{}, ...interface{})
+	Error(interface{}, ...interface{})
+	Fatal(interface{}, ...interface{})
+	Debug(interface{}, ...interface{})
+	Logger() Logger
 }
@@ -1,11 +1,34 @@
 package interfaces
 
+import (
+	"context"
+	"errors"
+)
+
+//ErrKeyNotFound is wrapped by the errors of the stores when the key holds no
+//record, tell it apart from a failing backend with errors.Is
+var ErrKeyNotFound = errors.New("not found")
+
 type Store interface {
 	Create(string, interface{}) error
 	Read(string) (interface{}, error)
 	Update(string, interface{}) error
 	Delete(string) error
 	List(...interface{}) (interface{}, error)
+
+	CreateContext(context.Context, string, interface{}) error
+	ReadContext(context.Context, string) (interface{}, error)
+	UpdateContext(context.Context, string, interface{}) error
+	DeleteContext(context.Context, string) error
+	ListContext(context.Context, ...interface{}) (interface{}, error)
 }
 
 type StoreOption func(Store) error
+
+//Swapper is implemented by the stores able to replace a record only when it
+//was not changed since it was read
+type Swapper interface {
+	//CompareAndSwapContext store value under key when the current record is
+	//old, or when there is none and old is nil, and tell whether it did
+	CompareAndSwapContext(ctx context.Context, key string, old, value interface{}) (bool, error)
+}
@@ -1,14 +1,23 @@
 package interfaces
 
+import "context"
+
 type Transport interface {
 	Run() error
 	Stop() error
+	StopContext(context.Context) error
 
 	Handler(string, string, interface{}) error
 	Middleware(interface{}) error
 	StaticFilesFolder(string, string) error
 	Router() (interface{}, error)
 	Port() int
+	Routes() []Route
+}
+
+type Route struct {
+	Mode string `json:"mode"`
+	Path string `json:"path"`
 }
 
 type TransportOption func(Transport) error
@@ -0,0 +1,361 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/advancedlogic/easy/interfaces"
+	"github.com/advancedlogic/easy/logging"
+	"github.com/sirupsen/logrus"
+)
+
+type Option func(*Manager) error
+
+type ComponentOption func(*entry) error
+
+// Errors aggregates the failures of several components
+type Errors []error
+
+func (e Errors) Error() string {
+	messages := make([]string, len(e))
+	for i, err := range e {
+		messages[i] = err.Error()
+	}
+	return strings.Join(messages, "; ")
+}
+
+// ComponentError wraps the error returned by a named component
+type ComponentError struct {
+	Component string
+	Phase     string
+	Err       error
+}
+
+func (e *ComponentError) Error() string {
+	return fmt.Sprintf("%s %s: %s", e.Component, e.Phase, e.Err)
+}
+
+type entry struct {
+	name         string
+	component    interfaces.Component
+	dependencies []string
+	startTimeout time.Duration
+	stopTimeout  time.Duration
+}
+
+// Manager starts components in dependency order and stops them in reverse order
+type Manager struct {
+	mu           sync.Mutex
+	entries      map[string]*entry
+	names        []string
+	started      []*entry
+	startTimeout time.Duration
+	stopTimeout  time.Duration
+	interfaces.Logger
+}
+
+// WithStartTimeout set the default time given to each component to start
+func WithStartTimeout(timeout time.Duration) Option {
+	return func(m *Manager) error {
+		if timeout > 0 {
+			m.startTimeout = timeout
+			return nil
+		}
+		return errors.New("start timeout must be positive")
+	}
+}
+
+// WithStopTimeout set the default time given to each component to stop
+func WithStopTimeout(timeout time.Duration) Option {
+	return func(m *Manager) error {
+		if timeout > 0 {
+			m.stopTimeout = timeout
+			return nil
+		}
+		return errors.New("stop timeout must be positive")
+	}
+}
+
+func WithLogger(logger interfaces.Logger) Option {
+	return func(m *Manager) error {
+		if logger != nil {
+			m.Logger = logger
+			return nil
+		}
+		return errors.New("logger cannot be nil")
+	}
+}
+
+// DependsOn declare the components that must be running before this one
+func DependsOn(names ...string) ComponentOption {
+	return func(e *entry) error {
+		for _, name := range names {
+			if name == "" {
+				return errors.New("dependency cannot be empty")
+			}
+			e.dependencies = append(e.dependencies, name)
+		}
+		return nil
+	}
+}
+
+// StartTimeout override the manager start timeout for this component
+func StartTimeout(timeout time.Duration) ComponentOption {
+	return func(e *entry) error {
+		if timeout > 0 {
+			e.startTimeout = timeout
+			return nil
+		}
+		return errors.New("start timeout must be positive")
+	}
+}
+
+// StopTimeout override the manager stop timeout for this component
+func StopTimeout(timeout time.Duration) ComponentOption {
+	return func(e *entry) error {
+		if timeout > 0 {
+			e.stopTimeout = timeout
+			return nil
+		}
+		return errors.New("stop timeout must be positive")
+	}
+}
+
+func New(options ...Option) (*Manager, error) {
+	m := &Manager{
+		entries:      make(map[string]*entry),
+		names:        make([]string, 0),
+		startTimeout: 30 * time.Second,
+		stopTimeout:  10 * time.Second,
+		Logger:       logging.Logrus(logrus.New()),
+	}
+	for _, option := range options {
+		if err := option(m); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// Add register a component under a unique name
+func (m *Manager) Add(name string, component interfaces.Component, options ...ComponentOption) error {
+	if name == "" {
+		return errors.New("name cannot be empty")
+	}
+	if component == nil {
+		return errors.New("component cannot be nil")
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, exists := m.entries[name]; exists {
+		return fmt.Errorf("component %s already registered", name)
+	}
+	e := &entry{
+		name:      name,
+		component: component,
+	}
+	for _, option := range options {
+		if err := option(e); err != nil {
+			return err
+		}
+	}
+	m.entries[name] = e
+	m.names = append(m.names, name)
+	return nil
+}
+
+// Has tell if a component has been registered under name
+func (m *Manager) Has(name string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, exists := m.entries[name]
+	return exists
+}
+
+// Get return the component registered under name
+func (m *Manager) Get(name string) (interfaces.Component, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	e, exists := m.entries[name]
+	if !exists {
+		return nil, false
+	}
+	return e.component, true
+}
+
+// Order return the component names in start order
+func (m *Manager) Order() ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	entries, err := m.sort()
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, len(entries))
+	for i, e := range entries {
+		names[i] = e.name
+	}
+	return names, nil
+}
+
+// Start run every component in dependency order. When a component fails the
+// ones already started are stopped and the aggregated error is returned
+func (m *Manager) Start(ctx context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.started) > 0 {
+		return errors.New("components already started")
+	}
+	entries, err := m.sort()
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		m.Info("component starting", "component", e.name)
+		if err := m.run(ctx, e, "start", m.timeout(e.startTimeout, m.startTimeout), e.component.Start); err != nil {
+			errs := Errors{err}
+			if stopErr := m.stop(ctx); stopErr != nil {
+				errs = append(errs, stopErr.(Errors)...)
+			}
+			return errs
+		}
+		m.started = append(m.started, e)
+	}
+	return nil
+}
+
+// Stop stop the started components in reverse order, each within its own timeout
+func (m *Manager) Stop(ctx context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.stop(ctx); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (m *Manager) stop(ctx context.Context) error {
+	var errs Errors
+	for i := len(m.started) - 1; i >= 0; i-- {
+		e := m.started[i]
+		m.Info("component stopping", "component", e.name)
+		if err := m.run(ctx, e, "stop", m.timeout(e.stopTimeout, m.stopTimeout), e.component.Stop); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	m.started = nil
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+func (m *Manager) timeout(timeout, fallback time.Duration) time.Duration {
+	if timeout > 0 {
+		return timeout
+	}
+	return fallback
+}
+
+func (m *Manager) run(ctx context.Context, e *entry, phase string, timeout time.Duration, fn func(context.Context) error) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	done := make(chan error, 1)
+	go func() {
+		done <- fn(ctx)
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			return &ComponentError{Component: e.name, Phase: phase, Err: err}
+		}
+		return nil
+	case <-ctx.Done():
+		if phase == "start" {
+			go m.stopLate(e, done)
+		}
+		return &ComponentError{Component: e.name, Phase: phase, Err: ctx.Err()}
+	}
+}
+
+// stopLate stop a component that ignored its start timeout once it is
+// started, as it is not among the started components Stop knows about
+func (m *Manager) stopLate(e *entry, done <-chan error) {
+	if err := <-done; err != nil {
+		return
+	}
+	m.Warn("component started after its timeout, stopping it", "component", e.name)
+	ctx, cancel := context.WithTimeout(context.Background(), m.timeout(e.stopTimeout, m.stopTimeout))
+	defer cancel()
+	if err := e.component.Stop(ctx); err != nil {
+		m.Error("late component stop failed", "component", e.name, "error", err)
+	}
+}
+
+// sort order the entries so that every component comes after its dependencies.
+// Dependencies on components that were never registered are ignored, so that
+// optional components (e.g. a missing cache) do not break the graph
+func (m *Manager) sort() ([]*entry, error) {
+	const (
+		visiting = iota + 1
+		visited
+	)
+	state := make(map[string]int)
+	sorted := make([]*entry, 0, len(m.names))
+	var visit func(name string, path []string) error
+	visit = func(name string, path []string) error {
+		path = append(append([]string(nil), path...), name)
+		e, exists := m.entries[name]
+		if !exists {
+			return nil
+		}
+		switch state[name] {
+		case visited:
+			return nil
+		case visiting:
+			return fmt.Errorf("dependency cycle: %s", strings.Join(path, " -> "))
+		}
+		state[name] = visiting
+		dependencies := append([]string(nil), e.dependencies...)
+		sort.Strings(dependencies)
+		for _, dependency := range dependencies {
+			if err := visit(dependency, path); err != nil {
+				return err
+			}
+		}
+		state[name] = visited
+		sorted = append(sorted, e)
+		return nil
+	}
+	for _, name := range m.names {
+		if err := visit(name, nil); err != nil {
+			return nil, err
+		}
+	}
+	return sorted, nil
+}
+
+// Func adapt a pair of functions to interfaces.Component, nil functions are no-op
+type Func struct {
+	OnStart func(context.Context) error
+	OnStop  func(context.Context) error
+}
+
+func (f Func) Start(ctx context.Context) error {
+	if f.OnStart != nil {
+		return f.OnStart(ctx)
+	}
+	return nil
+}
+
+func (f Func) Stop(ctx context.Context) error {
+	if f.OnStop != nil {
+		return f.OnStop(ctx)
+	}
+	return nil
+}
@@ -0,0 +1,114 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type recorder struct {
+	name  string
+	calls *[]string
+	err   error
+	delay time.Duration
+}
+
+func (r recorder) Start(ctx context.Context) error {
+	*r.calls = append(*r.calls, "start "+r.name)
+	return r.err
+}
+
+func (r recorder) Stop(ctx context.Context) error {
+	select {
+	case <-time.After(r.delay):
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	*r.calls = append(*r.calls, "stop "+r.name)
+	return nil
+}
+
+func TestManager_Order(t *testing.T) {
+	calls := make([]string, 0)
+	m, _ := New()
+	assert.Nil(t, m.Add("transport", recorder{name: "transport", calls: &calls}, DependsOn("broker", "cache")))
+	assert.Nil(t, m.Add("broker", recorder{name: "broker", calls: &calls}, DependsOn("cache")))
+	assert.Nil(t, m.Add("cache", recorder{name: "cache", calls: &calls}))
+	assert.Nil(t, m.Start(context.Background()))
+	assert.Nil(t, m.Stop(context.Background()))
+	assert.Equal(t, []string{
+		"start cache", "start broker", "start transport",
+		"stop transport", "stop broker", "stop cache",
+	}, calls)
+}
+
+func TestManager_StartFailure(t *testing.T) {
+	calls := make([]string, 0)
+	m, _ := New()
+	assert.Nil(t, m.Add("cache", recorder{name: "cache", calls: &calls}))
+	assert.Nil(t, m.Add("broker", recorder{name: "broker", calls: &calls, err: errors.New("boom")}, DependsOn("cache")))
+	err := m.Start(context.Background())
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "broker start: boom")
+	assert.Equal(t, []string{"start cache", "start broker", "stop cache"}, calls)
+}
+
+func TestManager_StopTimeout(t *testing.T) {
+	calls := make([]string, 0)
+	m, _ := New()
+	assert.Nil(t, m.Add("slow", recorder{name: "slow", calls: &calls, delay: time.Second}, StopTimeout(10*time.Millisecond)))
+	assert.Nil(t, m.Start(context.Background()))
+	err := m.Stop(context.Background())
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "deadline exceeded")
+}
+
+// stubborn ignore its start timeout and start anyway
+type stubborn struct {
+	started chan struct{}
+	stopped chan struct{}
+}
+
+func (s stubborn) Start(ctx context.Context) error {
+	<-ctx.Done()
+	time.Sleep(10 * time.Millisecond)
+	close(s.started)
+	return nil
+}
+
+func (s stubborn) Stop(ctx context.Context) error {
+	close(s.stopped)
+	return nil
+}
+
+func TestManager_LateStart(t *testing.T) {
+	m, _ := New()
+	s := stubborn{started: make(chan struct{}), stopped: make(chan struct{})}
+	assert.Nil(t, m.Add("stubborn", s, StartTimeout(10*time.Millisecond)))
+	err := m.Start(context.Background())
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "deadline exceeded")
+
+	// the component starting after its timeout is stopped once started
+	select {
+	case <-s.stopped:
+	case <-time.After(time.Second):
+		t.Fatal("late component not stopped")
+	}
+	select {
+	case <-s.started:
+	default:
+		t.Fatal("stopped before started")
+	}
+}
+
+func TestManager_Cycle(t *testing.T) {
+	m, _ := New()
+	assert.Nil(t, m.Add("a", Func{}, DependsOn("b")))
+	assert.Nil(t, m.Add("b", Func{}, DependsOn("a")))
+	_, err := m.Order()
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,24 @@
+package logging
+
+import "github.com/advancedlogic/easy/interfaces"
+
+type discard struct{}
+
+// Discard drop every entry, Fatal included
+func Discard() interfaces.Logger {
+	return discard{}
+}
+
+func (discard) Debug(interface{}, ...interface{}) {}
+
+func (discard) Info(interface{}, ...interface{}) {}
+
+func (discard) Warn(interface{}, ...interface{}) {}
+
+func (discard) Error(interface{}, ...interface{}) {}
+
+func (discard) Fatal(interface{}, ...interface{}) {}
+
+func (d discard) With(...interface{}) interfaces.Logger {
+	return d
+}
@@ -0,0 +1,82 @@
+package logging
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/advancedlogic/easy/interfaces"
+)
+
+type jsonWriter struct {
+	sync.Mutex
+	writer io.Writer
+	level  int32
+}
+
+type jsonLogger struct {
+	*jsonWriter
+	keyvals []interface{}
+}
+
+// JSON write one JSON object per entry, ready for log pipelines:
+//
+//	{"amount":42,"level":"info","msg":"order created","order":"A-12","time":"2019-06-01T10:00:00Z"}
+//
+// Fields named time, level or msg are overwritten by the entry ones
+func JSON(writer io.Writer, level Level) interfaces.Logger {
+	return &jsonLogger{jsonWriter: &jsonWriter{writer: writer, level: int32(level)}}
+}
+
+func (l *jsonLogger) Debug(m interface{}, keyvals ...interface{}) {
+	l.write(DebugLevel, m, keyvals)
+}
+
+func (l *jsonLogger) Info(m interface{}, keyvals ...interface{}) {
+	l.write(InfoLevel, m, keyvals)
+}
+
+func (l *jsonLogger) Warn(m interface{}, keyvals ...interface{}) {
+	l.write(WarnLevel, m, keyvals)
+}
+
+func (l *jsonLogger) Error(m interface{}, keyvals ...interface{}) {
+	l.write(ErrorLevel, m, keyvals)
+}
+
+func (l *jsonLogger) Fatal(m interface{}, keyvals ...interface{}) {
+	l.write(FatalLevel, m, keyvals)
+	os.Exit(1)
+}
+
+func (l *jsonLogger) With(keyvals ...interface{}) interfaces.Logger {
+	return &jsonLogger{jsonWriter: l.jsonWriter, keyvals: join(l.keyvals, keyvals)}
+}
+
+func (l *jsonLogger) SetLevel(level Level) {
+	atomic.StoreInt32(&l.level, int32(level))
+}
+
+func (l *jsonLogger) write(level Level, m interface{}, keyvals []interface{}) {
+	if int32(level) < atomic.LoadInt32(&l.level) {
+		return
+	}
+	fields := Fields(join(l.keyvals, keyvals)...)
+	fields["time"] = time.Now().UTC().Format(time.RFC3339Nano)
+	fields["level"] = level.String()
+	fields["msg"] = message(m)
+	entry, err := json.Marshal(fields)
+	if err != nil {
+		for key, value := range fields {
+			fields[key] = fmt.Sprint(value)
+		}
+		entry, _ = json.Marshal(fields)
+	}
+	l.Lock()
+	defer l.Unlock()
+	l.writer.Write(append(entry, '\n'))
+}
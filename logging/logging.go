@@ -0,0 +1,110 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/advancedlogic/easy/interfaces"
+)
+
+// Level of a log entry, entries below the level of a logger are discarded
+type Level int
+
+const (
+	DebugLevel Level = iota
+	InfoLevel
+	WarnLevel
+	ErrorLevel
+	FatalLevel
+)
+
+var levels = []string{"debug", "info", "warn", "error", "fatal"}
+
+func (l Level) String() string {
+	if l < DebugLevel || l > FatalLevel {
+		return fmt.Sprintf("level(%d)", int(l))
+	}
+	return levels[l]
+}
+
+// ParseLevel read a level name: debug, info, warn, error or fatal
+func ParseLevel(level string) (Level, error) {
+	for i, name := range levels {
+		if strings.EqualFold(level, name) {
+			return Level(i), nil
+		}
+	}
+	if strings.EqualFold(level, "warning") {
+		return WarnLevel, nil
+	}
+	return InfoLevel, fmt.Errorf("unknown log level %s", level)
+}
+
+// Leveled is implemented by the loggers whose level can be changed at runtime
+type Leveled interface {
+	SetLevel(Level)
+}
+
+// Fields turn keyvals into a map. A key without value is kept with a nil
+// value, keys that are not strings are formatted and errors are replaced by
+// their message
+func Fields(keyvals ...interface{}) map[string]interface{} {
+	fields := make(map[string]interface{}, (len(keyvals)+1)/2)
+	for i := 0; i < len(keyvals); i += 2 {
+		key, ok := keyvals[i].(string)
+		if !ok {
+			key = fmt.Sprint(keyvals[i])
+		}
+		var value interface{}
+		if i+1 < len(keyvals) {
+			value = keyvals[i+1]
+		}
+		if err, ok := value.(error); ok {
+			value = err.Error()
+		}
+		fields[key] = value
+	}
+	return fields
+}
+
+func message(m interface{}) string {
+	switch m := m.(type) {
+	case string:
+		return m
+	case error:
+		return m.Error()
+	default:
+		return fmt.Sprint(m)
+	}
+}
+
+// join return a copy of keyvals followed by more, so that children never share
+// their backing array
+func join(keyvals []interface{}, more []interface{}) []interface{} {
+	joined := make([]interface{}, 0, len(keyvals)+len(more))
+	joined = append(joined, keyvals...)
+	return append(joined, more...)
+}
+
+type contextKey struct{}
+
+// NewContext return a copy of ctx carrying logger
+func NewContext(ctx context.Context, logger interfaces.Logger) context.Context {
+	return context.WithValue(ctx, contextKey{}, logger)
+}
+
+// FromContext return the logger carried by ctx, the request-scoped logger in
+// handlers and processors, or a standard logger writing to stderr
+func FromContext(ctx context.Context) interfaces.Logger {
+	if ctx != nil {
+		if logger, ok := ctx.Value(contextKey{}).(interfaces.Logger); ok {
+			return logger
+		}
+	}
+	return fallback
+}
+
+var fallback = Std(log.New(os.Stderr, "", log.LstdFlags), InfoLevel)
@@ -0,0 +1,59 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJSON(t *testing.T) {
+	var buffer bytes.Buffer
+	logger := JSON(&buffer, InfoLevel)
+	child := logger.With("component", "broker")
+	child.Debug("hidden")
+	child.Info("connected", "endpoint", "nats:4222", "error", errors.New("none"))
+	logger.Warn("no fields")
+
+	lines := strings.Split(strings.TrimSpace(buffer.String()), "\n")
+	assert.Equal(t, 2, len(lines))
+	var entry map[string]interface{}
+	assert.Nil(t, json.Unmarshal([]byte(lines[0]), &entry))
+	assert.Equal(t, "info", entry["level"])
+	assert.Equal(t, "connected", entry["msg"])
+	assert.Equal(t, "broker", entry["component"])
+	assert.Equal(t, "nats:4222", entry["endpoint"])
+	assert.Equal(t, "none", entry["error"])
+	assert.NotContains(t, lines[1], "component")
+
+	logger.(Leveled).SetLevel(DebugLevel)
+	child.Debug("visible")
+	assert.Contains(t, buffer.String(), "visible")
+}
+
+func TestStd(t *testing.T) {
+	var buffer bytes.Buffer
+	logger := Std(log.New(&buffer, "", 0), WarnLevel)
+	logger.Info("hidden")
+	logger.With("request_id", "42").Error("failed", "reason", "timed out")
+	assert.Equal(t, "ERROR failed reason=\"timed out\" request_id=42\n", buffer.String())
+}
+
+func TestParseLevel(t *testing.T) {
+	level, err := ParseLevel("WARN")
+	assert.Nil(t, err)
+	assert.Equal(t, WarnLevel, level)
+	_, err = ParseLevel("verbose")
+	assert.NotNil(t, err)
+}
+
+func TestContext(t *testing.T) {
+	logger := Discard()
+	assert.Equal(t, logger, FromContext(NewContext(context.Background(), logger)))
+	assert.NotNil(t, FromContext(context.Background()))
+}
@@ -0,0 +1,63 @@
+package logging
+
+import (
+	"github.com/advancedlogic/easy/interfaces"
+	"github.com/sirupsen/logrus"
+)
+
+type logrusLogger struct {
+	entry *logrus.Entry
+}
+
+// Logrus adapt a logrus logger, fields become logrus fields
+func Logrus(logger *logrus.Logger) interfaces.Logger {
+	return &logrusLogger{entry: logrus.NewEntry(logger)}
+}
+
+func (l *logrusLogger) Debug(m interface{}, keyvals ...interface{}) {
+	l.with(keyvals).Debug(m)
+}
+
+func (l *logrusLogger) Info(m interface{}, keyvals ...interface{}) {
+	l.with(keyvals).Info(m)
+}
+
+func (l *logrusLogger) Warn(m interface{}, keyvals ...interface{}) {
+	l.with(keyvals).Warn(m)
+}
+
+func (l *logrusLogger) Error(m interface{}, keyvals ...interface{}) {
+	l.with(keyvals).Error(m)
+}
+
+func (l *logrusLogger) Fatal(m interface{}, keyvals ...interface{}) {
+	l.with(keyvals).Fatal(m)
+}
+
+func (l *logrusLogger) With(keyvals ...interface{}) interfaces.Logger {
+	return &logrusLogger{entry: l.with(keyvals)}
+}
+
+// SetLevel change the level of the underlying logrus logger, and so of all
+// the loggers sharing it
+func (l *logrusLogger) SetLevel(level Level) {
+	switch level {
+	case DebugLevel:
+		l.entry.Logger.SetLevel(logrus.DebugLevel)
+	case InfoLevel:
+		l.entry.Logger.SetLevel(logrus.InfoLevel)
+	case WarnLevel:
+		l.entry.Logger.SetLevel(logrus.WarnLevel)
+	case ErrorLevel:
+		l.entry.Logger.SetLevel(logrus.ErrorLevel)
+	default:
+		l.entry.Logger.SetLevel(logrus.FatalLevel)
+	}
+}
+
+func (l *logrusLogger) with(keyvals []interface{}) *logrus.Entry {
+	if len(keyvals) == 0 {
+		return l.entry
+	}
+	return l.entry.WithFields(logrus.Fields(Fields(keyvals...)))
+}
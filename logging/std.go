@@ -0,0 +1,81 @@
+package logging
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/advancedlogic/easy/interfaces"
+)
+
+type stdLogger struct {
+	logger  *log.Logger
+	level   *int32
+	keyvals []interface{}
+}
+
+// Std adapt a standard library logger, entries are written as
+//
+//	INFO order created amount=42 order=A-12
+func Std(logger *log.Logger, level Level) interfaces.Logger {
+	l := int32(level)
+	return &stdLogger{logger: logger, level: &l}
+}
+
+func (l *stdLogger) Debug(m interface{}, keyvals ...interface{}) {
+	l.write(DebugLevel, m, keyvals)
+}
+
+func (l *stdLogger) Info(m interface{}, keyvals ...interface{}) {
+	l.write(InfoLevel, m, keyvals)
+}
+
+func (l *stdLogger) Warn(m interface{}, keyvals ...interface{}) {
+	l.write(WarnLevel, m, keyvals)
+}
+
+func (l *stdLogger) Error(m interface{}, keyvals ...interface{}) {
+	l.write(ErrorLevel, m, keyvals)
+}
+
+func (l *stdLogger) Fatal(m interface{}, keyvals ...interface{}) {
+	l.write(FatalLevel, m, keyvals)
+	os.Exit(1)
+}
+
+func (l *stdLogger) With(keyvals ...interface{}) interfaces.Logger {
+	return &stdLogger{logger: l.logger, level: l.level, keyvals: join(l.keyvals, keyvals)}
+}
+
+func (l *stdLogger) SetLevel(level Level) {
+	atomic.StoreInt32(l.level, int32(level))
+}
+
+func (l *stdLogger) write(level Level, m interface{}, keyvals []interface{}) {
+	if int32(level) < atomic.LoadInt32(l.level) {
+		return
+	}
+	fields := Fields(join(l.keyvals, keyvals)...)
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var line strings.Builder
+	line.WriteString(strings.ToUpper(level.String()))
+	line.WriteString(" ")
+	line.WriteString(message(m))
+	for _, key := range keys {
+		value := fmt.Sprint(fields[key])
+		if strings.ContainsAny(value, " \t\n\"=") {
+			value = strconv.Quote(value)
+		}
+		fmt.Fprintf(&line, " %s=%s", key, value)
+	}
+	l.logger.Output(3, line.String())
+}
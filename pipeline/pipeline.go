@@ -0,0 +1,510 @@
+package pipeline
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/advancedlogic/easy/interfaces"
+	"github.com/advancedlogic/easy/logging"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+)
+
+// ErrDropped is returned by a stage whose message has been dead-lettered:
+// the rest of the chain is skipped and the pipeline returns no output
+var ErrDropped = errors.New("message dropped")
+
+var (
+	processed = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "easy_pipeline_stage_processed_total",
+		Help: "Messages processed by a pipeline stage, by result",
+	}, []string{"pipeline", "stage", "result"})
+	duration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name: "easy_pipeline_stage_duration_seconds",
+		Help: "Time spent in a pipeline stage",
+	}, []string{"pipeline", "stage"})
+)
+
+func init() {
+	prometheus.MustRegister(processed, duration)
+}
+
+type Option func(*Pipeline) error
+
+// Pipeline is a processor made of stages composed with Chain, FanOut and Route
+type Pipeline struct {
+	name string
+	root interfaces.Processor
+	interfaces.Logger
+}
+
+func WithName(name string) Option {
+	return func(p *Pipeline) error {
+		if name != "" {
+			p.name = name
+			return nil
+		}
+		return errors.New("name cannot be empty")
+	}
+}
+
+// WithSteps set the steps run one after the other
+func WithSteps(steps ...interfaces.Processor) Option {
+	return func(p *Pipeline) error {
+		if len(steps) > 0 {
+			p.root = Chain(steps...)
+			return nil
+		}
+		return errors.New("at least one step must be provided")
+	}
+}
+
+func WithLogger(logger interfaces.Logger) Option {
+	return func(p *Pipeline) error {
+		if logger != nil {
+			p.Logger = logger
+			return nil
+		}
+		return errors.New("logger cannot be nil")
+	}
+}
+
+// WithLogger replace the logger of the pipeline and of its stages
+func (p *Pipeline) WithLogger(logger interfaces.Logger) error {
+	if err := WithLogger(logger)(p); err != nil {
+		return err
+	}
+	p.attach()
+	return nil
+}
+
+func New(options ...Option) (*Pipeline, error) {
+	p := &Pipeline{
+		name:   "default",
+		Logger: logging.Logrus(logrus.New()),
+	}
+	for _, option := range options {
+		if err := option(p); err != nil {
+			return nil, err
+		}
+	}
+	if p.root == nil {
+		return nil, errors.New("steps cannot be empty")
+	}
+	p.attach()
+	return p, nil
+}
+
+// attach give the stages the name and the logger of the pipeline
+func (p *Pipeline) attach() {
+	walk(p.root, func(step interfaces.Processor) {
+		if stage, ok := step.(*stage); ok {
+			stage.pipeline = p.name
+			stage.Logger = p.Logger
+		}
+	})
+}
+
+func (p *Pipeline) Name() string {
+	return p.name
+}
+
+func (p *Pipeline) Init(service interfaces.Service) error {
+	return p.root.Init(service)
+}
+
+func (p *Pipeline) Close() error {
+	return p.root.Close()
+}
+
+func (p *Pipeline) Process(data interface{}) (interface{}, error) {
+	return p.ProcessContext(context.Background(), data)
+}
+
+func (p *Pipeline) ProcessContext(ctx context.Context, data interface{}) (interface{}, error) {
+	output, err := p.root.ProcessContext(ctx, data)
+	if err == ErrDropped {
+		return nil, nil
+	}
+	return output, err
+}
+
+// Stats return the counters of every stage by name
+func (p *Pipeline) Stats() map[string]Stats {
+	stats := make(map[string]Stats)
+	walk(p.root, func(step interfaces.Processor) {
+		if stage, ok := step.(*stage); ok {
+			stats[stage.name] = stage.stats()
+		}
+	})
+	return stats
+}
+
+// Stats count the outcome of the messages that went through a stage
+type Stats struct {
+	Processed  uint64 `json:"processed"`
+	Failed     uint64 `json:"failed"`
+	Skipped    uint64 `json:"skipped"`
+	Retried    uint64 `json:"retried"`
+	DeadLetter uint64 `json:"dead_letter"`
+}
+
+type parent interface {
+	children() []interfaces.Processor
+}
+
+func walk(step interfaces.Processor, fn func(interfaces.Processor)) {
+	fn(step)
+	if p, ok := step.(parent); ok {
+		for _, child := range p.children() {
+			walk(child, fn)
+		}
+	}
+}
+
+// group hold the lifecycle shared by the composite steps
+type group []interfaces.Processor
+
+func (g group) children() []interfaces.Processor {
+	return g
+}
+
+func (g group) Init(service interfaces.Service) error {
+	for _, step := range g {
+		if err := step.Init(service); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (g group) Close() error {
+	var last error
+	for _, step := range g {
+		if err := step.Close(); err != nil {
+			last = err
+		}
+	}
+	return last
+}
+
+type chain struct {
+	group
+}
+
+// Chain run the steps in order, the output of one being the input of the next
+func Chain(steps ...interfaces.Processor) interfaces.Processor {
+	return &chain{group: group(steps)}
+}
+
+func (c *chain) Process(data interface{}) (interface{}, error) {
+	return c.ProcessContext(context.Background(), data)
+}
+
+func (c *chain) ProcessContext(ctx context.Context, data interface{}) (interface{}, error) {
+	var err error
+	for _, step := range c.group {
+		if err = ctx.Err(); err != nil {
+			return nil, err
+		}
+		if data, err = step.ProcessContext(ctx, data); err != nil {
+			return nil, err
+		}
+	}
+	return data, nil
+}
+
+// Merge combine the outputs of the branches of a fan-out
+type Merge func([]interface{}) (interface{}, error)
+
+type fanOut struct {
+	group
+	merge Merge
+}
+
+// FanOut run every branch concurrently on the same input and merge their
+// outputs, in branch order. A nil merge return the outputs as []interface{}.
+// Dropped branches are left out of the merge, any other error fails the fan-out
+func FanOut(merge Merge, branches ...interfaces.Processor) interfaces.Processor {
+	if merge == nil {
+		merge = func(outputs []interface{}) (interface{}, error) {
+			return outputs, nil
+		}
+	}
+	return &fanOut{group: group(branches), merge: merge}
+}
+
+func (f *fanOut) Process(data interface{}) (interface{}, error) {
+	return f.ProcessContext(context.Background(), data)
+}
+
+func (f *fanOut) ProcessContext(ctx context.Context, data interface{}) (interface{}, error) {
+	outputs := make([]interface{}, len(f.group))
+	errs := make([]error, len(f.group))
+	wg := sync.WaitGroup{}
+	for i, branch := range f.group {
+		wg.Add(1)
+		go func(i int, branch interfaces.Processor) {
+			defer wg.Done()
+			outputs[i], errs[i] = branch.ProcessContext(ctx, data)
+		}(i, branch)
+	}
+	wg.Wait()
+
+	merged := make([]interface{}, 0, len(outputs))
+	for i, err := range errs {
+		switch err {
+		case nil:
+			merged = append(merged, outputs[i])
+		case ErrDropped:
+		default:
+			return nil, err
+		}
+	}
+	return f.merge(merged)
+}
+
+// Case is a branch of a Route
+type Case struct {
+	condition func(interface{}) bool
+	step      interfaces.Processor
+}
+
+// When select step for the messages matching condition
+func When(condition func(interface{}) bool, step interfaces.Processor) Case {
+	return Case{condition: condition, step: step}
+}
+
+// Otherwise select step for the messages no other case matched
+func Otherwise(step interfaces.Processor) Case {
+	return Case{step: step}
+}
+
+type route struct {
+	group
+	cases []Case
+}
+
+// Route send each message to the first case whose condition matches,
+// messages matching no case go through unchanged
+func Route(cases ...Case) interfaces.Processor {
+	r := &route{cases: cases}
+	for _, c := range cases {
+		r.group = append(r.group, c.step)
+	}
+	return r
+}
+
+func (r *route) Process(data interface{}) (interface{}, error) {
+	return r.ProcessContext(context.Background(), data)
+}
+
+func (r *route) ProcessContext(ctx context.Context, data interface{}) (interface{}, error) {
+	for _, c := range r.cases {
+		if c.condition == nil || c.condition(data) {
+			return c.step.ProcessContext(ctx, data)
+		}
+	}
+	return data, nil
+}
+
+// Func turn a function into a processor with no-op Init and Close
+type Func func(context.Context, interface{}) (interface{}, error)
+
+func (f Func) Init(service interfaces.Service) error {
+	return nil
+}
+
+func (f Func) Close() error {
+	return nil
+}
+
+func (f Func) Process(data interface{}) (interface{}, error) {
+	return f(context.Background(), data)
+}
+
+func (f Func) ProcessContext(ctx context.Context, data interface{}) (interface{}, error) {
+	return f(ctx, data)
+}
+
+type StageOption func(*stage) error
+
+const (
+	policyFail = iota
+	policySkip
+	policyDeadLetter
+)
+
+// OnErrorSkip pass the input of a failing stage to the next one, unchanged
+func OnErrorSkip() StageOption {
+	return func(s *stage) error {
+		s.policy = policySkip
+		return nil
+	}
+}
+
+// OnErrorRetry retry a failing stage up to attempts times, waiting backoff
+// (doubled at every attempt) in between, before applying the other policies
+func OnErrorRetry(attempts int, backoff time.Duration) StageOption {
+	return func(s *stage) error {
+		if attempts > 0 {
+			s.attempts = attempts
+			s.backoff = backoff
+			return nil
+		}
+		return errors.New("attempts must be positive")
+	}
+}
+
+// OnErrorDeadLetter publish the messages a stage failed to process on topic,
+// together with the error, and drop them
+func OnErrorDeadLetter(topic string) StageOption {
+	return func(s *stage) error {
+		if topic != "" {
+			s.policy = policyDeadLetter
+			s.topic = topic
+			return nil
+		}
+		return errors.New("topic cannot be empty")
+	}
+}
+
+type stage struct {
+	name      string
+	pipeline  string
+	processor interfaces.Processor
+	policy    int
+	attempts  int
+	backoff   time.Duration
+	topic     string
+	service   interfaces.Service
+	err       error
+
+	processed  uint64
+	failed     uint64
+	skipped    uint64
+	retried    uint64
+	deadLetter uint64
+	interfaces.Logger
+}
+
+// Stage name a processor so that it gets metrics and an error policy,
+// by default errors stop the pipeline. Invalid options are reported by Init
+func Stage(name string, processor interfaces.Processor, options ...StageOption) interfaces.Processor {
+	s := &stage{
+		name:      name,
+		pipeline:  "default",
+		processor: processor,
+		Logger:    logging.Logrus(logrus.New()),
+	}
+	for _, option := range options {
+		if err := option(s); err != nil {
+			s.err = fmt.Errorf("stage %s: %s", name, err)
+			break
+		}
+	}
+	return s
+}
+
+func (s *stage) children() []interfaces.Processor {
+	return []interfaces.Processor{s.processor}
+}
+
+func (s *stage) Init(service interfaces.Service) error {
+	if s.err != nil {
+		return s.err
+	}
+	s.service = service
+	return s.processor.Init(service)
+}
+
+func (s *stage) Close() error {
+	return s.processor.Close()
+}
+
+func (s *stage) Process(data interface{}) (interface{}, error) {
+	return s.ProcessContext(context.Background(), data)
+}
+
+func (s *stage) ProcessContext(ctx context.Context, data interface{}) (interface{}, error) {
+	start := time.Now()
+	defer func() {
+		duration.WithLabelValues(s.pipeline, s.name).Observe(time.Since(start).Seconds())
+	}()
+
+	output, err := s.processor.ProcessContext(ctx, data)
+	backoff := s.backoff
+	for attempt := 0; err != nil && err != ErrDropped && attempt < s.attempts; attempt++ {
+		s.count(&s.retried, "retried")
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		backoff *= 2
+		output, err = s.processor.ProcessContext(ctx, data)
+	}
+	if err == nil || err == ErrDropped {
+		s.count(&s.processed, "ok")
+		return output, err
+	}
+
+	switch s.policy {
+	case policySkip:
+		s.count(&s.skipped, "skipped")
+		s.Warn("stage skipped", "pipeline", s.pipeline, "stage", s.name, "error", err)
+		return data, nil
+	case policyDeadLetter:
+		if publishErr := s.publish(ctx, data, err); publishErr != nil {
+			s.count(&s.failed, "error")
+			return nil, fmt.Errorf("stage %s: %s (dead letter failed: %s)", s.name, err, publishErr)
+		}
+		s.count(&s.deadLetter, "dead_letter")
+		s.Warn("stage sent message to dead letter", "pipeline", s.pipeline, "stage", s.name, "topic", s.topic, "error", err)
+		return nil, ErrDropped
+	default:
+		s.count(&s.failed, "error")
+		return nil, fmt.Errorf("stage %s: %s", s.name, err)
+	}
+}
+
+func (s *stage) publish(ctx context.Context, data interface{}, cause error) error {
+	if s.service == nil {
+		return errors.New("stage not initialised")
+	}
+	var input interface{} = data
+	switch d := data.(type) {
+	case []byte:
+		input = string(d)
+	}
+	letter, err := json.Marshal(map[string]interface{}{
+		"pipeline": s.pipeline,
+		"stage":    s.name,
+		"error":    cause.Error(),
+		"input":    input,
+	})
+	if err != nil {
+		return err
+	}
+	return s.service.PublishContext(ctx, s.topic, letter)
+}
+
+func (s *stage) count(counter *uint64, result string) {
+	atomic.AddUint64(counter, 1)
+	processed.WithLabelValues(s.pipeline, s.name, result).Inc()
+}
+
+func (s *stage) stats() Stats {
+	return Stats{
+		Processed:  atomic.LoadUint64(&s.processed),
+		Failed:     atomic.LoadUint64(&s.failed),
+		Skipped:    atomic.LoadUint64(&s.skipped),
+		Retried:    atomic.LoadUint64(&s.retried),
+		DeadLetter: atomic.LoadUint64(&s.deadLetter),
+	}
+}
@@ -0,0 +1,113 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/advancedlogic/easy/interfaces"
+	"github.com/stretchr/testify/assert"
+)
+
+type publisher struct {
+	interfaces.Service
+	topic   string
+	message interface{}
+}
+
+func (p *publisher) PublishContext(ctx context.Context, topic string, message interface{}) error {
+	p.topic = topic
+	p.message = message
+	return nil
+}
+
+func upper() interfaces.Processor {
+	return Func(func(ctx context.Context, data interface{}) (interface{}, error) {
+		return strings.ToUpper(data.(string)), nil
+	})
+}
+
+func suffix(s string) interfaces.Processor {
+	return Func(func(ctx context.Context, data interface{}) (interface{}, error) {
+		return data.(string) + s, nil
+	})
+}
+
+func failing(times *int) interfaces.Processor {
+	return Func(func(ctx context.Context, data interface{}) (interface{}, error) {
+		if *times > 0 {
+			*times--
+			return nil, errors.New("boom")
+		}
+		return data, nil
+	})
+}
+
+func TestPipeline_Chain(t *testing.T) {
+	p, err := New(WithSteps(Stage("upper", upper()), Stage("suffix", suffix("!"))))
+	assert.Nil(t, err)
+	assert.Nil(t, p.Init(nil))
+	output, err := p.Process("hello")
+	assert.Nil(t, err)
+	assert.Equal(t, "HELLO!", output)
+	assert.Equal(t, uint64(1), p.Stats()["upper"].Processed)
+}
+
+func TestPipeline_FanOutAndRoute(t *testing.T) {
+	isShort := func(data interface{}) bool { return len(data.(string)) < 4 }
+	p, _ := New(WithSteps(
+		FanOut(nil, upper(), suffix("?")),
+		Route(
+			When(func(data interface{}) bool { return len(data.([]interface{})) == 2 }, Func(
+				func(ctx context.Context, data interface{}) (interface{}, error) {
+					return data.([]interface{})[0].(string) + data.([]interface{})[1].(string), nil
+				})),
+		),
+		Route(When(isShort, suffix("short")), Otherwise(suffix("long"))),
+	))
+	output, err := p.Process("hey")
+	assert.Nil(t, err)
+	assert.Equal(t, "HEYhey?long", output)
+}
+
+func TestPipeline_ErrorPolicies(t *testing.T) {
+	times := 5
+	p, _ := New(WithName("policies"), WithSteps(
+		Stage("skip", failing(&times), OnErrorSkip()),
+		Stage("upper", upper()),
+	))
+	output, err := p.Process("a")
+	assert.Nil(t, err)
+	assert.Equal(t, "A", output)
+	assert.Equal(t, uint64(1), p.Stats()["skip"].Skipped)
+
+	times = 2
+	p, _ = New(WithSteps(Stage("retry", failing(&times), OnErrorRetry(2, time.Millisecond))))
+	output, err = p.Process("b")
+	assert.Nil(t, err)
+	assert.Equal(t, "b", output)
+	assert.Equal(t, uint64(2), p.Stats()["retry"].Retried)
+
+	times = 1
+	service := &publisher{}
+	p, _ = New(WithSteps(Stage("dead", failing(&times), OnErrorDeadLetter("dead.letters")), Stage("upper", upper())))
+	assert.Nil(t, p.Init(service))
+	output, err = p.Process("c")
+	assert.Nil(t, err)
+	assert.Nil(t, output)
+	assert.Equal(t, "dead.letters", service.topic)
+	assert.Contains(t, string(service.message.([]byte)), `"error":"boom"`)
+	assert.Equal(t, uint64(0), p.Stats()["upper"].Processed)
+
+	times = 1
+	p, _ = New(WithSteps(Stage("fail", failing(&times))))
+	_, err = p.Process("d")
+	assert.NotNil(t, err)
+}
+
+func TestStage_InvalidOption(t *testing.T) {
+	p, _ := New(WithSteps(Stage("retry", upper(), OnErrorRetry(0, 0))))
+	assert.NotNil(t, p.Init(nil))
+}
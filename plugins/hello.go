@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"github.com/advancedlogic/easy/interfaces"
 )
@@ -15,6 +16,13 @@ func (h hello) Close() error {
 	return nil
 }
 
+func (h hello) ProcessContext(ctx context.Context, data interface{}) (interface{}, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return h.Process(data)
+}
+
 func (h hello) Process(data interface{}) (interface{}, error) {
 	fmt.Println(data.(string))
 	return data, nil
@@ -1,12 +1,15 @@
 package consul
 
 import (
+	"context"
 	"errors"
 	"fmt"
-	"log"
 	"os"
 
+	"github.com/advancedlogic/easy/commons"
+	"github.com/advancedlogic/easy/factory"
 	"github.com/advancedlogic/easy/interfaces"
+	"github.com/advancedlogic/easy/logging"
 	"github.com/sirupsen/logrus"
 
 	api "github.com/hashicorp/consul/api"
@@ -124,13 +127,37 @@ func WithHealthEndpoint(endpoint string) interfaces.RegistryOption {
 	}
 }
 
-func WithLogger(logger *logrus.Logger) interfaces.RegistryOption {
+func WithLogger(logger interfaces.Logger) interfaces.RegistryOption {
 	return func(i interfaces.Registry) error {
 		c := i.(*Consul)
 		return c.WithLogger(logger)
 	}
 }
 
+//FromEnv configure the registry from the EASY_CONSUL_* variables:
+//ADDRESS, USERNAME, PASSWORD, INTERVAL, TIMEOUT and HEALTH_ENDPOINT
+func FromEnv() interfaces.RegistryOption {
+	return func(i interfaces.Registry) error {
+		settings := map[string]func(string) interfaces.RegistryOption{
+			"address":         WithAddress,
+			"username":        WithUsername,
+			"password":        WithPassword,
+			"interval":        WithInterval,
+			"timeout":         WithTimeout,
+			"health_endpoint": WithHealthEndpoint,
+		}
+		for _, setting := range []string{"address", "username", "password", "interval", "timeout", "health_endpoint"} {
+			option := settings[setting]
+			if err := commons.EnvString("consul", setting, func(value string) error {
+				return option(value)(i)
+			}); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
 type Consul struct {
 	id             string
 	name           string
@@ -141,7 +168,7 @@ type Consul struct {
 	interval       string
 	timeout        string
 	healthEndpoint string
-	*logrus.Logger
+	interfaces.Logger
 }
 
 func New(options ...interfaces.RegistryOption) (*Consul, error) {
@@ -156,7 +183,7 @@ func New(options ...interfaces.RegistryOption) (*Consul, error) {
 		interval:       "3s",
 		timeout:        "5s",
 		healthEndpoint: "",
-		Logger:         logrus.New(),
+		Logger:         logging.Logrus(logrus.New()),
 	}
 	for _, option := range options {
 		err := option(c)
@@ -167,15 +194,7 @@ func New(options ...interfaces.RegistryOption) (*Consul, error) {
 	return c, nil
 }
 
-func (c *Consul) Register() error {
-	hostname := func() string {
-		hn, err := os.Hostname()
-		if err != nil {
-			log.Fatalln(err)
-		}
-		return hn
-	}
-
+func (c *Consul) connect() (*api.Client, error) {
 	config := api.DefaultConfig()
 	config.Address = c.address
 	if c.username != "" && c.password != "" {
@@ -184,14 +203,51 @@ func (c *Consul) Register() error {
 			Password: c.password,
 		}
 	}
-	consul, err := api.NewClient(config)
+	return api.NewClient(config)
+}
+
+//Health check that the agent can reach a cluster leader
+func (c *Consul) Health(ctx context.Context) error {
+	consul, err := c.connect()
+	if err != nil {
+		return err
+	}
+	done := make(chan error, 1)
+	go func() {
+		leader, err := consul.Status().Leader()
+		if err == nil && leader == "" {
+			err = errors.New("no cluster leader")
+		}
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (c *Consul) Register() error {
+	return c.RegisterContext(context.Background())
+}
+
+//RegisterContext register the service, giving up when ctx is done
+func (c *Consul) RegisterContext(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	consul, err := c.connect()
 	if err != nil {
-		log.Fatalln(err)
+		return err
+	}
+	address, err := os.Hostname()
+	if err != nil {
+		return err
 	}
 	registration := new(api.AgentServiceRegistration)
 	registration.ID = c.id
 	registration.Name = c.name
-	address := hostname()
 	registration.Address = address
 	registration.Port = c.port
 	if c.healthEndpoint != "" {
@@ -201,10 +257,44 @@ func (c *Consul) Register() error {
 		registration.Check.Interval = c.interval
 		registration.Check.Timeout = c.timeout
 	}
-	return consul.Agent().ServiceRegister(registration)
+	done := make(chan error, 1)
+	go func() {
+		done <- consul.Agent().ServiceRegister(registration)
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (c *Consul) Deregister() error {
+	return c.DeregisterContext(context.Background())
 }
 
-func (c *Consul) WithLogger(logger *logrus.Logger) error {
+//DeregisterContext remove the service from the catalog, giving up when ctx is done
+func (c *Consul) DeregisterContext(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	consul, err := c.connect()
+	if err != nil {
+		return err
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- consul.Agent().ServiceDeregister(c.id)
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (c *Consul) WithLogger(logger interfaces.Logger) error {
 	if logger != nil {
 		c.Logger = logger
 		return nil
@@ -220,3 +310,24 @@ func (c *Consul) WithPort(port int) error {
 
 	return errors.New("port must be positive")
 }
+
+func init() {
+	factory.Register(factory.Registry, "consul", func(settings interfaces.Configuration) (interface{}, error) {
+		options := make([]interfaces.RegistryOption, 0)
+		for setting, option := range map[string]func(string) interfaces.RegistryOption{
+			"id":              WithID,
+			"name":            WithName,
+			"address":         WithAddress,
+			"username":        WithUsername,
+			"password":        WithPassword,
+			"interval":        WithInterval,
+			"timeout":         WithTimeout,
+			"health_endpoint": WithHealthEndpoint,
+		} {
+			if value := settings.GetStringOrDefault(setting, ""); value != "" {
+				options = append(options, option(value))
+			}
+		}
+		return New(append(options, FromEnv())...)
+	})
+}
@@ -0,0 +1,48 @@
+package scheduler
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParse(t *testing.T) {
+	at := func(value string) time.Time {
+		date, err := time.ParseInLocation("2006-01-02 15:04", value, time.UTC)
+		assert.Nil(t, err)
+		return date
+	}
+	tests := []struct {
+		spec, from, next string
+	}{
+		{"*/15 * * * *", "2019-06-14 10:07", "2019-06-14 10:15"},
+		{"*/15 * * * *", "2019-06-14 10:45", "2019-06-14 11:00"},
+		{"0 3 * * mon-fri", "2019-06-14 04:00", "2019-06-17 03:00"},
+		{"30 8 * jan,jul *", "2019-06-14 04:00", "2019-07-01 08:30"},
+		{"0 0 1,15 * sun", "2019-06-14 04:00", "2019-06-15 00:00"},
+		{"0 0 13 * 5", "2019-06-14 04:00", "2019-06-21 00:00"},
+		{"0 12 * * 7", "2019-06-14 04:00", "2019-06-16 12:00"},
+		{"@monthly", "2019-06-14 04:00", "2019-07-01 00:00"},
+		{"@hourly", "2019-12-31 23:30", "2020-01-01 00:00"},
+		{"0 0 29 2 *", "2019-03-01 00:00", "2020-02-29 00:00"},
+	}
+	for _, test := range tests {
+		schedule, err := Parse(test.spec, time.UTC)
+		assert.Nil(t, err, test.spec)
+		assert.Equal(t, at(test.next), schedule.Next(at(test.from)), test.spec)
+	}
+
+	schedule, err := Parse("0 0 30 2 *", time.UTC)
+	assert.Nil(t, err)
+	assert.True(t, schedule.Next(at("2019-01-01 00:00")).IsZero())
+
+	schedule, err = Parse("@every 10m", nil)
+	assert.Nil(t, err)
+	assert.Equal(t, at("2019-06-14 10:10"), schedule.Next(at("2019-06-14 10:07")))
+
+	for _, spec := range []string{"", "* * * *", "61 * * * *", "* * * * mon-sun/0", "5-1 * * * *", "@every x", "@every -1s"} {
+		_, err := Parse(spec, nil)
+		assert.NotNil(t, err, spec)
+	}
+}
@@ -0,0 +1,380 @@
+// Package scheduler run jobs on cron expressions or fixed intervals. With a
+// locker, usually the cache of the service, each activation runs on a single
+// instance of the service: the instances race for a lock named after the job
+// and the activation time, and the lock expires at the next activation
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/advancedlogic/easy/interfaces"
+	"github.com/advancedlogic/easy/logging"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+type Option func(*Scheduler) error
+
+type JobOption func(*job) error
+
+//Func is the work of a job, ctx is cancelled after the max runtime or when
+//the scheduler cannot wait any longer for it to stop
+type Func func(ctx context.Context) error
+
+//Status is what a scheduler know about a job, the runs are the ones of this instance
+type Status struct {
+	Name         string        `json:"name"`
+	Schedule     string        `json:"schedule"`
+	Running      bool          `json:"running"`
+	NextRun      time.Time     `json:"next_run"`
+	LastRun      time.Time     `json:"last_run"`
+	LastDuration time.Duration `json:"last_duration"`
+	LastError    string        `json:"last_error,omitempty"`
+	Runs         uint64        `json:"runs"`
+	Failures     uint64        `json:"failures"`
+	Skipped      uint64        `json:"skipped"`
+}
+
+type job struct {
+	spec       string
+	schedule   Schedule
+	fn         Func
+	jitter     time.Duration
+	maxRuntime time.Duration
+	local      bool
+	status     Status
+}
+
+// Scheduler is a component running jobs until it is stopped
+type Scheduler struct {
+	sync.Mutex
+	name     string
+	owner    string
+	location *time.Location
+	locker   interfaces.Locker
+	jobs     map[string]*job
+	random   *rand.Rand
+	cancel   context.CancelFunc
+	abort    context.CancelFunc
+	loops    sync.WaitGroup
+	runs     sync.WaitGroup
+	interfaces.Logger
+}
+
+//WithName set the name used in the lock keys, jobs of schedulers with the same
+//name and locker run once across them
+func WithName(name string) Option {
+	return func(s *Scheduler) error {
+		if name != "" {
+			s.name = name
+			return nil
+		}
+		return errors.New("name cannot be empty")
+	}
+}
+
+//WithLocker run every activation on a single instance
+func WithLocker(locker interfaces.Locker) Option {
+	return func(s *Scheduler) error {
+		return s.WithLocker(locker)
+	}
+}
+
+//WithLocation set the time zone of the cron expressions, local time by default
+func WithLocation(location *time.Location) Option {
+	return func(s *Scheduler) error {
+		if location != nil {
+			s.location = location
+			return nil
+		}
+		return errors.New("location cannot be nil")
+	}
+}
+
+func WithLogger(logger interfaces.Logger) Option {
+	return func(s *Scheduler) error {
+		return s.WithLogger(logger)
+	}
+}
+
+//Jitter delay each activation by a random duration up to max, to spread the
+//load of jobs sharing a schedule. Keep it below the period of the job
+func Jitter(max time.Duration) JobOption {
+	return func(j *job) error {
+		if max > 0 {
+			j.jitter = max
+			return nil
+		}
+		return errors.New("jitter must be positive")
+	}
+}
+
+//MaxRuntime cancel the context of a run lasting longer than max
+func MaxRuntime(max time.Duration) JobOption {
+	return func(j *job) error {
+		if max > 0 {
+			j.maxRuntime = max
+			return nil
+		}
+		return errors.New("max runtime must be positive")
+	}
+}
+
+//Local run the job on every instance, without taking the lock
+func Local() JobOption {
+	return func(j *job) error {
+		j.local = true
+		return nil
+	}
+}
+
+func New(options ...Option) (*Scheduler, error) {
+	hostname, _ := os.Hostname()
+	s := &Scheduler{
+		owner:    fmt.Sprintf("%s/%s", hostname, uuid.New().String()),
+		location: time.Local,
+		jobs:     make(map[string]*job),
+		random:   rand.New(rand.NewSource(time.Now().UnixNano())),
+		Logger:   logging.Logrus(logrus.New()),
+	}
+	for _, option := range options {
+		if err := option(s); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+func (s *Scheduler) Name() string {
+	return s.name
+}
+
+//HasLocker tell whether the activations run on a single instance
+func (s *Scheduler) HasLocker() bool {
+	return s.locker != nil
+}
+
+func (s *Scheduler) WithLocker(locker interfaces.Locker) error {
+	if locker != nil {
+		s.locker = locker
+		return nil
+	}
+	return errors.New("locker cannot be nil")
+}
+
+func (s *Scheduler) WithLogger(logger interfaces.Logger) error {
+	if logger != nil {
+		s.Logger = logger
+		return nil
+	}
+	return errors.New("logger cannot be nil")
+}
+
+//Add schedule fn under name, see Parse for the syntax of spec
+func (s *Scheduler) Add(name, spec string, fn Func, options ...JobOption) error {
+	if name == "" {
+		return errors.New("name cannot be empty")
+	}
+	if fn == nil {
+		return errors.New("job cannot be nil")
+	}
+	schedule, err := Parse(spec, s.location)
+	if err != nil {
+		return fmt.Errorf("job %s: %s", name, err)
+	}
+	j := &job{
+		spec:     spec,
+		schedule: schedule,
+		fn:       fn,
+		status:   Status{Name: name, Schedule: spec},
+	}
+	for _, option := range options {
+		if err := option(j); err != nil {
+			return err
+		}
+	}
+	s.Lock()
+	defer s.Unlock()
+	if s.cancel != nil {
+		return errors.New("scheduler already started")
+	}
+	if _, exists := s.jobs[name]; exists {
+		return fmt.Errorf("job %s already exists", name)
+	}
+	s.jobs[name] = j
+	return nil
+}
+
+//Start schedule the jobs
+func (s *Scheduler) Start(ctx context.Context) error {
+	s.Lock()
+	defer s.Unlock()
+	if s.cancel != nil {
+		return errors.New("scheduler already started")
+	}
+	loops, cancel := context.WithCancel(context.Background())
+	runs, abort := context.WithCancel(context.Background())
+	s.cancel, s.abort = cancel, abort
+	for name, j := range s.jobs {
+		s.loops.Add(1)
+		go s.loop(loops, runs, name, j)
+	}
+	s.Info("scheduler started", "jobs", len(s.jobs))
+	return nil
+}
+
+//Stop stop scheduling and wait for the running jobs, whose context is
+//cancelled when ctx is done
+func (s *Scheduler) Stop(ctx context.Context) error {
+	s.Lock()
+	cancel, abort := s.cancel, s.abort
+	s.cancel, s.abort = nil, nil
+	s.Unlock()
+	if cancel == nil {
+		return nil
+	}
+	cancel()
+	s.loops.Wait()
+
+	done := make(chan struct{})
+	go func() {
+		s.runs.Wait()
+		close(done)
+	}()
+	defer abort()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		abort()
+		<-done
+		return fmt.Errorf("jobs cancelled: %s", ctx.Err())
+	}
+}
+
+//Jobs return the status of the jobs sorted by name
+func (s *Scheduler) Jobs() []Status {
+	s.Lock()
+	defer s.Unlock()
+	jobs := make([]Status, 0, len(s.jobs))
+	for _, j := range s.jobs {
+		jobs = append(jobs, j.status)
+	}
+	sort.Slice(jobs, func(i, k int) bool {
+		return jobs[i].Name < jobs[k].Name
+	})
+	return jobs
+}
+
+func (s *Scheduler) loop(loops, runs context.Context, name string, j *job) {
+	defer s.loops.Done()
+	logger := s.With("job", name)
+	for {
+		tick := j.schedule.Next(time.Now())
+		if tick.IsZero() {
+			logger.Warn("job never runs", "schedule", j.spec)
+			return
+		}
+		s.Lock()
+		j.status.NextRun = tick
+		delay := time.Until(tick)
+		if j.jitter > 0 {
+			delay += time.Duration(s.random.Int63n(int64(j.jitter)))
+		}
+		s.Unlock()
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-loops.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		s.Lock()
+		running := j.status.Running
+		if running {
+			j.status.Skipped++
+		}
+		s.Unlock()
+		if running {
+			logger.Warn("job skipped, previous run still running")
+			continue
+		}
+		if !s.acquire(loops, name, j, tick, logger) {
+			continue
+		}
+		s.Lock()
+		j.status.Running = true
+		s.Unlock()
+		s.runs.Add(1)
+		go s.run(runs, name, j, logger)
+	}
+}
+
+//acquire tell whether this instance runs the activation of tick
+func (s *Scheduler) acquire(ctx context.Context, name string, j *job, tick time.Time, logger interfaces.Logger) bool {
+	if j.local || s.locker == nil {
+		return true
+	}
+	ttl := j.schedule.Next(tick).Sub(tick)
+	if ttl <= 0 {
+		ttl = time.Minute
+	}
+	key := fmt.Sprintf("scheduler:%s:%s:%d", s.name, name, tick.UnixNano())
+	locked, err := s.locker.TryLock(ctx, key, s.owner, ttl)
+	if err != nil {
+		logger.Error("job lock failed", "error", err)
+		return false
+	}
+	if !locked {
+		logger.Debug("job run by another instance")
+	}
+	return locked
+}
+
+func (s *Scheduler) run(ctx context.Context, name string, j *job, logger interfaces.Logger) {
+	defer s.runs.Done()
+	if j.maxRuntime > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, j.maxRuntime)
+		defer cancel()
+	}
+	start := time.Now()
+	err := call(ctx, j.fn)
+	duration := time.Since(start)
+
+	s.Lock()
+	j.status.Running = false
+	j.status.LastRun = start
+	j.status.LastDuration = duration
+	j.status.Runs++
+	j.status.LastError = ""
+	if err != nil {
+		j.status.Failures++
+		j.status.LastError = err.Error()
+	}
+	s.Unlock()
+
+	if err != nil {
+		logger.Error("job failed", "duration", duration.String(), "error", err)
+		return
+	}
+	logger.Info("job done", "duration", duration.String())
+}
+
+func call(ctx context.Context, fn Func) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return fn(ctx)
+}
@@ -0,0 +1,120 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/advancedlogic/easy/logging"
+	"github.com/stretchr/testify/assert"
+)
+
+type locker struct {
+	sync.Mutex
+	keys map[string]string
+}
+
+func (l *locker) TryLock(ctx context.Context, key, owner string, ttl time.Duration) (bool, error) {
+	l.Lock()
+	defer l.Unlock()
+	if _, exists := l.keys[key]; exists {
+		return false, nil
+	}
+	l.keys[key] = owner
+	return true, nil
+}
+
+func TestScheduler(t *testing.T) {
+	_, err := New(WithName(""))
+	assert.NotNil(t, err)
+	s, err := New(WithLogger(logging.Discard()))
+	assert.Nil(t, err)
+	assert.NotNil(t, s.Add("", "@hourly", func(context.Context) error { return nil }))
+	assert.NotNil(t, s.Add("broken", "* *", func(context.Context) error { return nil }))
+	assert.NotNil(t, s.Add("nil", "@hourly", nil))
+
+	var runs int32
+	assert.Nil(t, s.Add("count", "@every 20ms", func(context.Context) error {
+		atomic.AddInt32(&runs, 1)
+		return nil
+	}))
+	assert.NotNil(t, s.Add("count", "@hourly", func(context.Context) error { return nil }))
+	assert.Nil(t, s.Add("slow", "@every 20ms", func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}, MaxRuntime(30*time.Millisecond)))
+	assert.Nil(t, s.Add("panic", "@every 20ms", func(context.Context) error {
+		panic("boom")
+	}))
+
+	assert.Nil(t, s.Start(context.Background()))
+	assert.NotNil(t, s.Start(context.Background()))
+	time.Sleep(150 * time.Millisecond)
+	assert.Nil(t, s.Stop(context.Background()))
+
+	assert.True(t, atomic.LoadInt32(&runs) >= 3)
+	jobs := s.Jobs()
+	assert.Equal(t, 3, len(jobs))
+	assert.Equal(t, "count", jobs[0].Name)
+	assert.Equal(t, uint64(0), jobs[0].Failures)
+	assert.Equal(t, "panic: boom", jobs[1].LastError)
+	assert.Equal(t, "context deadline exceeded", jobs[2].LastError)
+	assert.True(t, jobs[2].Skipped > 0)
+	assert.False(t, jobs[2].Running)
+}
+
+func TestScheduler_SingleExecution(t *testing.T) {
+	shared := &locker{keys: make(map[string]string)}
+	var runs, local int32
+	schedulers := make([]*Scheduler, 3)
+	for i := range schedulers {
+		s, err := New(WithName("orders"), WithLocker(shared), WithLogger(logging.Discard()))
+		assert.Nil(t, err)
+		assert.Nil(t, s.Add("cleanup", "@every 50ms", func(context.Context) error {
+			atomic.AddInt32(&runs, 1)
+			return nil
+		}, Jitter(5*time.Millisecond)))
+		assert.Nil(t, s.Add("metrics", "@every 50ms", func(context.Context) error {
+			atomic.AddInt32(&local, 1)
+			return nil
+		}, Local()))
+		assert.Nil(t, s.Start(context.Background()))
+		schedulers[i] = s
+	}
+	time.Sleep(270 * time.Millisecond)
+	for _, s := range schedulers {
+		assert.Nil(t, s.Stop(context.Background()))
+	}
+
+	ticks := int32(len(shared.keys))
+	assert.True(t, ticks >= 4)
+	assert.Equal(t, ticks, atomic.LoadInt32(&runs))
+	assert.True(t, atomic.LoadInt32(&local) >= 3*ticks-3)
+}
+
+func TestScheduler_Stop(t *testing.T) {
+	s, err := New(WithLogger(logging.Discard()))
+	assert.Nil(t, err)
+	started := make(chan bool, 1)
+	assert.Nil(t, s.Add("stuck", "@every 10ms", func(ctx context.Context) error {
+		select {
+		case started <- true:
+		default:
+		}
+		<-ctx.Done()
+		return errors.New("interrupted")
+	}))
+	assert.Nil(t, s.Start(context.Background()))
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	assert.NotNil(t, s.Stop(ctx))
+	jobs := s.Jobs()
+	assert.Equal(t, "interrupted", jobs[0].LastError)
+	assert.False(t, jobs[0].Running)
+	assert.Nil(t, s.Stop(context.Background()))
+}
@@ -1,9 +1,16 @@
 package minio
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"github.com/advancedlogic/easy/commons"
+	"github.com/advancedlogic/easy/factory"
 	"github.com/advancedlogic/easy/interfaces"
 	"github.com/minio/minio-go"
+	"io"
 	"io/ioutil"
 	"strings"
 )
@@ -83,6 +90,29 @@ func WithCredentials(accessKey, secretKey string) interfaces.StoreOption {
 	}
 }
 
+//FromEnv configure the store from the EASY_MINIO_* variables:
+//ENDPOINT, BUCKET, LOCATION, ACCESS_KEY and SECRET_KEY
+func FromEnv() interfaces.StoreOption {
+	return func(i interfaces.Store) error {
+		settings := map[string]func(string) interfaces.StoreOption{
+			"endpoint":   WithEndpoint,
+			"bucket":     WithBucket,
+			"location":   WithLocation,
+			"access_key": WithAccessKey,
+			"secret_key": WithSecretKey,
+		}
+		for _, setting := range []string{"endpoint", "bucket", "location", "access_key", "secret_key"} {
+			option := settings[setting]
+			if err := commons.EnvString("minio", setting, func(value string) error {
+				return option(value)(i)
+			}); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
 func New(options ...interfaces.StoreOption) (*Minio, error) {
 	m := &Minio{
 		location: "default",
@@ -99,13 +129,53 @@ func New(options ...interfaces.StoreOption) (*Minio, error) {
 	return m, nil
 }
 
+//Health check that the bucket can be reached
+func (m *Minio) Health(ctx context.Context) error {
+	client, err := minio.New(m.endpoint, m.accessKey, m.secretKey, false)
+	if err != nil {
+		return err
+	}
+	done := make(chan error, 1)
+	go func() {
+		exists, err := client.BucketExists(m.bucket)
+		if err == nil && !exists {
+			err = fmt.Errorf("bucket %s does not exist", m.bucket)
+		}
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
 func (m *Minio) Create(key string, data interface{}) error {
-	reader := strings.NewReader(data.(string))
+	return m.CreateContext(context.Background(), key, data)
+}
+
+//CreateContext write data as the object, a value other than a string or bytes
+//is stored as its JSON encoding
+func (m *Minio) CreateContext(ctx context.Context, key string, data interface{}) error {
+	var reader io.Reader
+	switch data := data.(type) {
+	case string:
+		reader = strings.NewReader(data)
+	case []byte:
+		reader = bytes.NewReader(data)
+	default:
+		b, err := json.Marshal(data)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(b)
+	}
 	client, err := minio.New(m.endpoint, m.accessKey, m.secretKey, false)
 	if err != nil {
 		return err
 	}
-	_, err = client.PutObject(m.bucket, key, reader, -1, minio.PutObjectOptions{
+	_, err = client.PutObjectWithContext(ctx, m.bucket, key, reader, -1, minio.PutObjectOptions{
 		ContentType: "plain/txt",
 	})
 	if err != nil {
@@ -116,47 +186,97 @@ func (m *Minio) Create(key string, data interface{}) error {
 }
 
 func (m *Minio) Read(key string) (interface{}, error) {
+	return m.ReadContext(context.Background(), key)
+}
+
+func (m *Minio) ReadContext(ctx context.Context, key string) (interface{}, error) {
 	client, err := minio.New(m.endpoint, m.accessKey, m.secretKey, false)
 	if err != nil {
 		return "", err
 	}
 
-	reader, err := client.GetObject(m.bucket, key, minio.GetObjectOptions{})
+	reader, err := client.GetObjectWithContext(ctx, m.bucket, key, minio.GetObjectOptions{})
 	if err != nil {
-		return "", err
+		return "", notFound(key, err)
 	}
 	defer reader.Close()
 
 	if value, err := ioutil.ReadAll(reader); err == nil {
 		return string(value), nil
 	} else {
-		return nil, err
+		return nil, notFound(key, err)
+	}
+}
+
+func notFound(key string, err error) error {
+	if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+		return fmt.Errorf("key %s %w", key, interfaces.ErrKeyNotFound)
 	}
+	return err
 }
 
 func (m *Minio) Update(key string, data interface{}) error {
-	return m.Create(key, data)
+	return m.UpdateContext(context.Background(), key, data)
+}
+
+func (m *Minio) UpdateContext(ctx context.Context, key string, data interface{}) error {
+	return m.CreateContext(ctx, key, data)
 }
 
 func (m *Minio) Delete(key string) error {
+	return m.DeleteContext(context.Background(), key)
+}
+
+func (m *Minio) DeleteContext(ctx context.Context, key string) error {
 	client, err := minio.New(m.endpoint, m.accessKey, m.secretKey, false)
 	if err != nil {
 		return err
 	}
 
-	return client.RemoveObject(m.bucket, key)
+	keys := make(chan string, 1)
+	keys <- key
+	close(keys)
+	for result := range client.RemoveObjectsWithContext(ctx, m.bucket, keys) {
+		if result.Err != nil {
+			return result.Err
+		}
+	}
+	return ctx.Err()
 }
 
 func (m *Minio) List(params ...interface{}) (interface{}, error) {
+	return m.ListContext(context.Background(), params...)
+}
+
+func (m *Minio) ListContext(ctx context.Context, params ...interface{}) (interface{}, error) {
 	client, err := minio.New(m.endpoint, m.accessKey, m.secretKey, false)
 	if err != nil {
 		return nil, err
 	}
-	doneCh := make(chan struct{})
-	defer close(doneCh)
 	values := make([]interface{}, 0)
-	for value := range client.ListObjectsV2(m.bucket, "", true, doneCh) {
+	for value := range client.ListObjectsV2(m.bucket, "", true, ctx.Done()) {
 		values = append(values, value)
 	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 	return values, nil
 }
+
+func init() {
+	factory.Register(factory.Store, "minio", func(settings interfaces.Configuration) (interface{}, error) {
+		options := make([]interfaces.StoreOption, 0)
+		for setting, option := range map[string]func(string) interfaces.StoreOption{
+			"endpoint":   WithEndpoint,
+			"bucket":     WithBucket,
+			"location":   WithLocation,
+			"access_key": WithAccessKey,
+			"secret_key": WithSecretKey,
+		} {
+			if value := settings.GetStringOrDefault(setting, ""); value != "" {
+				options = append(options, option(value))
+			}
+		}
+		return New(append(options, FromEnv())...)
+	})
+}
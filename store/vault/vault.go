@@ -1,8 +1,11 @@
 package vault
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
 	"github.com/advancedlogic/easy/commons"
+	"github.com/advancedlogic/easy/factory"
 	"github.com/advancedlogic/easy/interfaces"
 	"github.com/hashicorp/vault/api"
 	"github.com/pkg/errors"
@@ -61,6 +64,31 @@ func SkipTLSVerification(skip bool) interfaces.StoreOption {
 	}
 }
 
+//FromEnv configure the store from the EASY_VAULT_* variables:
+//SERVERS (comma separated), TOKEN, NAMESPACE and SKIP_TLS_VERIFICATION
+func FromEnv() interfaces.StoreOption {
+	return func(s interfaces.Store) error {
+		if err := commons.EnvStrings("vault", "servers", func(servers []string) error {
+			return WithServers(servers...)(s)
+		}); err != nil {
+			return err
+		}
+		if err := commons.EnvString("vault", "token", func(token string) error {
+			return WithToken(token)(s)
+		}); err != nil {
+			return err
+		}
+		if err := commons.EnvString("vault", "namespace", func(namespace string) error {
+			return WithNamespace(namespace)(s)
+		}); err != nil {
+			return err
+		}
+		return commons.EnvBool("vault", "skip_tls_verification", func(skip bool) error {
+			return SkipTLSVerification(skip)(s)
+		})
+	}
+}
+
 func New(options ...interfaces.StoreOption) (*Vault, error) {
 	v := &Vault{
 		id:                  commons.UUID(),
@@ -97,58 +125,152 @@ func (v *Vault) connect() (*api.Client, error) {
 	return client, nil
 }
 
-func (v *Vault) Create(key string, value interface{}) error {
+func (v *Vault) request(ctx context.Context, method, key string, data map[string]interface{}) (*api.Secret, error) {
+	client, err := v.connect()
+	if err != nil {
+		return nil, err
+	}
+
+	r := client.NewRequest(method, fmt.Sprintf("/v1/%s/%s", v.namespace, key))
+	if method == "LIST" {
+		r.Method = "GET"
+		r.Params.Set("list", "true")
+	}
+	if data != nil {
+		if err := r.SetJSONBody(data); err != nil {
+			return nil, err
+		}
+	}
+	response, err := client.RawRequestWithContext(ctx, r)
+	if response != nil {
+		defer response.Body.Close()
+	}
+	if response != nil && response.StatusCode == 404 {
+		return nil, fmt.Errorf("key %s %w", key, interfaces.ErrKeyNotFound)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if response.StatusCode == 204 {
+		return nil, nil
+	}
+	return api.ParseSecret(response.Body)
+}
+
+//Health query the health endpoint of the server, a sealed server is unhealthy
+func (v *Vault) Health(ctx context.Context) error {
 	client, err := v.connect()
 	if err != nil {
 		return err
 	}
+	r := client.NewRequest("GET", "/v1/sys/health")
+	r.Params.Set("standbyok", "true")
+	response, err := client.RawRequestWithContext(ctx, r)
+	if response != nil {
+		defer response.Body.Close()
+	}
+	return err
+}
 
-	_, err = client.Logical().Write(fmt.Sprintf("/%s/%s", v.namespace, key), value.(map[string]interface{}))
+func (v *Vault) Create(key string, value interface{}) error {
+	return v.CreateContext(context.Background(), key, value)
+}
+
+//CreateContext write value as the data of the secret, a value other than a map
+//is stored as the map it encodes to in JSON
+func (v *Vault) CreateContext(ctx context.Context, key string, value interface{}) error {
+	data, err := secretData(value)
 	if err != nil {
 		return err
 	}
-	return nil
+	_, err = v.request(ctx, "PUT", key, data)
+	return err
 }
 
-func (v *Vault) Read(key string) (interface{}, error) {
-	client, err := v.connect()
+func secretData(value interface{}) (map[string]interface{}, error) {
+	switch value := value.(type) {
+	case map[string]interface{}:
+		return value, nil
+	case string:
+		return decodeData([]byte(value))
+	case []byte:
+		return decodeData(value)
+	}
+	b, err := json.Marshal(value)
 	if err != nil {
 		return nil, err
 	}
+	return decodeData(b)
+}
+
+func decodeData(b []byte) (map[string]interface{}, error) {
+	data := make(map[string]interface{})
+	if err := json.Unmarshal(b, &data); err != nil {
+		return nil, errors.New("value must encode to a JSON object")
+	}
+	return data, nil
+}
+
+func (v *Vault) Read(key string) (interface{}, error) {
+	return v.ReadContext(context.Background(), key)
+}
 
-	secret, err := client.Logical().Read(fmt.Sprintf("/%s/%s", v.namespace, key))
+func (v *Vault) ReadContext(ctx context.Context, key string) (interface{}, error) {
+	secret, err := v.request(ctx, "GET", key, nil)
 	if err != nil {
 		return nil, err
 	}
-
+	if secret == nil {
+		return nil, fmt.Errorf("key %s %w", key, interfaces.ErrKeyNotFound)
+	}
 	return secret.Data, nil
 }
 
 func (v *Vault) Update(key string, value interface{}) error {
-	return v.Create(key, value)
+	return v.UpdateContext(context.Background(), key, value)
+}
+
+func (v *Vault) UpdateContext(ctx context.Context, key string, value interface{}) error {
+	return v.CreateContext(ctx, key, value)
 }
 
 func (v *Vault) Delete(key string) error {
-	client, err := v.connect()
-	if err != nil {
-		return err
-	}
+	return v.DeleteContext(context.Background(), key)
+}
 
-	_, err = client.Logical().Delete(fmt.Sprintf("/%s/%s", v.namespace, key))
-	if err != nil {
-		return err
-	}
-	return nil
+func (v *Vault) DeleteContext(ctx context.Context, key string) error {
+	_, err := v.request(ctx, "DELETE", key, nil)
+	return err
 }
 
 func (v *Vault) List(params ...interface{}) (interface{}, error) {
-	client, err := v.connect()
+	return v.ListContext(context.Background(), params...)
+}
+
+func (v *Vault) ListContext(ctx context.Context, params ...interface{}) (interface{}, error) {
+	secret, err := v.request(ctx, "LIST", "", nil)
 	if err != nil {
 		return nil, err
 	}
-	secret, err := client.Logical().List(fmt.Sprintf("/%s", v.namespace))
-	if err != nil {
-		return nil, err
+	if secret == nil {
+		return map[string]interface{}{}, nil
 	}
 	return secret.Data, nil
 }
+
+func init() {
+	factory.Register(factory.Store, "vault", func(settings interfaces.Configuration) (interface{}, error) {
+		options := make([]interfaces.StoreOption, 0)
+		if servers := settings.GetArrayOfStringsOrDefault("servers", nil); len(servers) > 0 {
+			options = append(options, WithServers(servers...))
+		}
+		if token := settings.GetStringOrDefault("token", ""); token != "" {
+			options = append(options, WithToken(token))
+		}
+		if namespace := settings.GetStringOrDefault("namespace", ""); namespace != "" {
+			options = append(options, WithNamespace(namespace))
+		}
+		options = append(options, SkipTLSVerification(settings.GetBoolOrDefault("skip_tls_verification", true)))
+		return New(append(options, FromEnv())...)
+	})
+}
@@ -78,3 +78,20 @@ func TestVault_Delete(t *testing.T) {
 	err = vault.Delete("test2")
 	assert.Equal(t, err, nil)
 }
+
+func TestVault_SecretData(t *testing.T) {
+	for _, value := range []interface{}{
+		map[string]interface{}{"name": "test"},
+		`{"name":"test"}`,
+		[]byte(`{"name":"test"}`),
+		struct {
+			Name string `json:"name"`
+		}{"test"},
+	} {
+		data, err := secretData(value)
+		assert.Equal(t, err, nil)
+		assert.Equal(t, data, map[string]interface{}{"name": "test"})
+	}
+	_, err := secretData("test")
+	assert.Equal(t, err != nil, true)
+}
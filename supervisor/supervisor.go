@@ -0,0 +1,318 @@
+// Package supervisor run several easy services in one process. Each service
+// keeps its own configuration and logger; the supervisor restarts the ones
+// failing to start or whose health stays down, with an exponential backoff,
+// and stops them all together on SIGINT or SIGTERM.
+// Combined with transport/local the services call each other in process
+package supervisor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/advancedlogic/easy/easy"
+	"github.com/advancedlogic/easy/health"
+	"github.com/advancedlogic/easy/interfaces"
+	"github.com/advancedlogic/easy/lifecycle"
+	"github.com/advancedlogic/easy/logging"
+	"github.com/sirupsen/logrus"
+)
+
+type Option func(*Supervisor) error
+
+type supervised struct {
+	service  *easy.Easy
+	running  bool
+	restarts int
+}
+
+// Supervisor start, watch and stop a set of services
+type Supervisor struct {
+	sync.Mutex
+	services         []*supervised
+	minBackoff       time.Duration
+	maxBackoff       time.Duration
+	healthInterval   time.Duration
+	failureThreshold int
+	cancel           context.CancelFunc
+	done             sync.WaitGroup
+	errs             lifecycle.Errors
+	interfaces.Logger
+}
+
+//WithBackoff set the delays between two attempts, doubled from min up to max
+func WithBackoff(min, max time.Duration) Option {
+	return func(s *Supervisor) error {
+		if min <= 0 || max < min {
+			return errors.New("backoff must be positive and min cannot exceed max")
+		}
+		s.minBackoff = min
+		s.maxBackoff = max
+		return nil
+	}
+}
+
+//WithHealthInterval set how often the health of the running services is checked
+func WithHealthInterval(interval time.Duration) Option {
+	return func(s *Supervisor) error {
+		if interval > 0 {
+			s.healthInterval = interval
+			return nil
+		}
+		return errors.New("interval must be positive")
+	}
+}
+
+//WithFailureThreshold set how many health checks in a row must fail before a restart
+func WithFailureThreshold(threshold int) Option {
+	return func(s *Supervisor) error {
+		if threshold > 0 {
+			s.failureThreshold = threshold
+			return nil
+		}
+		return errors.New("threshold must be positive")
+	}
+}
+
+func WithLogger(logger interfaces.Logger) Option {
+	return func(s *Supervisor) error {
+		if logger != nil {
+			s.Logger = logger
+			return nil
+		}
+		return errors.New("logger cannot be nil")
+	}
+}
+
+func New(options ...Option) (*Supervisor, error) {
+	s := &Supervisor{
+		minBackoff:       time.Second,
+		maxBackoff:       time.Minute,
+		healthInterval:   10 * time.Second,
+		failureThreshold: 3,
+		Logger:           logging.Logrus(logrus.New()),
+	}
+	for _, option := range options {
+		if err := option(s); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+//Add put services under supervision, their names must be unique
+func (s *Supervisor) Add(services ...*easy.Easy) error {
+	s.Lock()
+	defer s.Unlock()
+	if s.cancel != nil {
+		return errors.New("supervisor already started")
+	}
+	for _, service := range services {
+		if service == nil {
+			return errors.New("service cannot be nil")
+		}
+		for _, sv := range s.services {
+			if sv.service.Name() == service.Name() {
+				return fmt.Errorf("service %s already supervised", service.Name())
+			}
+		}
+		s.services = append(s.services, &supervised{service: service})
+	}
+	return nil
+}
+
+//Start start every service in the background and keep them running until Stop
+func (s *Supervisor) Start() error {
+	s.Lock()
+	defer s.Unlock()
+	if s.cancel != nil {
+		return errors.New("supervisor already started")
+	}
+	if len(s.services) == 0 {
+		return errors.New("no service to supervise")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancel = cancel
+	s.errs = nil
+	for _, sv := range s.services {
+		s.done.Add(1)
+		go s.supervise(ctx, sv)
+	}
+	return nil
+}
+
+//Stop stop every service together and return the aggregated errors. It gives
+//up waiting when ctx is done
+func (s *Supervisor) Stop(ctx context.Context) error {
+	s.Lock()
+	cancel := s.cancel
+	s.Unlock()
+	if cancel == nil {
+		return errors.New("supervisor not started")
+	}
+	cancel()
+
+	stopped := make(chan struct{})
+	go func() {
+		s.done.Wait()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	s.Lock()
+	defer s.Unlock()
+	s.cancel = nil
+	if len(s.errs) > 0 {
+		return s.errs
+	}
+	return nil
+}
+
+//Run start the services and block until SIGINT or SIGTERM, then stop them
+func (s *Supervisor) Run() error {
+	if err := s.Start(); err != nil {
+		return err
+	}
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(signals)
+	received := <-signals
+	s.Warn("shutting down", "signal", received.String())
+	return s.Stop(context.Background())
+}
+
+//Running tell whether the service named name is up
+func (s *Supervisor) Running(name string) bool {
+	s.Lock()
+	defer s.Unlock()
+	for _, sv := range s.services {
+		if sv.service.Name() == name {
+			return sv.running
+		}
+	}
+	return false
+}
+
+//Restarts return how many times the service named name has been restarted
+func (s *Supervisor) Restarts(name string) int {
+	s.Lock()
+	defer s.Unlock()
+	for _, sv := range s.services {
+		if sv.service.Name() == name {
+			return sv.restarts
+		}
+	}
+	return 0
+}
+
+func (s *Supervisor) supervise(ctx context.Context, sv *supervised) {
+	defer s.done.Done()
+	name := sv.service.Name()
+	logger := s.With("service", name)
+	backoff := s.minBackoff
+	for attempt := 0; ; attempt++ {
+		if attempt > 0 {
+			logger.Warn("service restarting", "backoff", backoff.String())
+			if !sleep(ctx, backoff) {
+				return
+			}
+			backoff = s.next(backoff)
+			s.Lock()
+			sv.restarts++
+			s.Unlock()
+		}
+
+		if err := sv.service.Start(ctx); err != nil {
+			logger.Error("service failed to start", "error", err)
+			if ctx.Err() != nil {
+				return
+			}
+			continue
+		}
+		s.setRunning(sv, true)
+		logger.Info("service started")
+
+		if s.watch(ctx, sv, logger) {
+			backoff = s.minBackoff
+		}
+		s.setRunning(sv, false)
+		if err := sv.service.Stop(); err != nil {
+			logger.Error("service failed to stop", "error", err)
+			if ctx.Err() != nil {
+				s.Lock()
+				s.errs = append(s.errs, fmt.Errorf("%s: %s", name, err))
+				s.Unlock()
+			}
+		}
+		if ctx.Err() != nil {
+			logger.Info("service stopped")
+			return
+		}
+	}
+}
+
+//watch check the health of a running service until ctx is done or the service
+//is down failureThreshold times in a row. It tell whether the service has been
+//healthy at least once, to reset the backoff
+func (s *Supervisor) watch(ctx context.Context, sv *supervised, logger interfaces.Logger) bool {
+	ticker := time.NewTicker(s.healthInterval)
+	defer ticker.Stop()
+	healthy := false
+	failures := 0
+	for {
+		select {
+		case <-ctx.Done():
+			return healthy
+		case <-ticker.C:
+		}
+		report := sv.service.Health(ctx)
+		if ctx.Err() != nil {
+			return healthy
+		}
+		if report.Status == health.Down {
+			failures++
+			logger.Warn("service unhealthy", "failures", failures)
+			if failures >= s.failureThreshold {
+				return healthy
+			}
+			continue
+		}
+		failures = 0
+		healthy = true
+	}
+}
+
+func (s *Supervisor) setRunning(sv *supervised, running bool) {
+	s.Lock()
+	defer s.Unlock()
+	sv.running = running
+}
+
+func (s *Supervisor) next(backoff time.Duration) time.Duration {
+	backoff *= 2
+	if backoff > s.maxBackoff {
+		return s.maxBackoff
+	}
+	return backoff
+}
+
+//sleep wait for d, it return false when ctx is done first
+func sleep(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
@@ -0,0 +1,126 @@
+package supervisor
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/advancedlogic/easy/easy"
+	"github.com/advancedlogic/easy/health"
+	"github.com/advancedlogic/easy/lifecycle"
+	"github.com/advancedlogic/easy/logging"
+	"github.com/advancedlogic/easy/transport/local"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func service(t *testing.T, name string, options ...easy.Option) *easy.Easy {
+	transport, err := local.New(local.WithName(name))
+	assert.Nil(t, err)
+	service, err := easy.New(append([]easy.Option{
+		easy.WithName(name),
+		easy.WithLogger(logging.Discard()),
+		easy.WithTransport(transport),
+	}, options...)...)
+	assert.Nil(t, err)
+	return service
+}
+
+//eventually wait for condition to hold, it fail the test after timeout
+func eventually(t *testing.T, condition func() bool, timeout, tick time.Duration) {
+	t.Helper()
+	deadline := time.Now().Add(timeout)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatalf("condition not met after %s", timeout)
+		}
+		time.Sleep(tick)
+	}
+}
+
+func TestSupervisor(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	client := local.Client()
+	billing := service(t, "billing", easy.WithHandler("get", "/invoice", func(c *gin.Context) {
+		c.String(http.StatusOK, "paid")
+	}))
+	orders := service(t, "orders", easy.WithHandler("get", "/order", func(c *gin.Context) {
+		response, err := client.Get("http://billing/invoice")
+		if err != nil {
+			c.String(http.StatusBadGateway, err.Error())
+			return
+		}
+		defer response.Body.Close()
+		body, _ := ioutil.ReadAll(response.Body)
+		c.String(response.StatusCode, "order "+string(body))
+	}))
+
+	s, err := New(WithLogger(logging.Discard()), WithHealthInterval(10*time.Millisecond))
+	assert.Nil(t, err)
+	assert.NotNil(t, s.Start())
+	assert.Nil(t, s.Add(billing, orders))
+	assert.NotNil(t, s.Add(service(t, "orders")))
+
+	assert.Nil(t, s.Start())
+	assert.NotNil(t, s.Start())
+	eventually(t, func() bool {
+		return s.Running("billing") && s.Running("orders")
+	}, time.Second, 10*time.Millisecond)
+
+	response, err := client.Get("http://orders/order")
+	assert.Nil(t, err)
+	body, _ := ioutil.ReadAll(response.Body)
+	assert.Equal(t, "order paid", string(body))
+
+	assert.Nil(t, s.Stop(context.Background()))
+	assert.False(t, billing.IsRunning())
+	assert.False(t, orders.IsRunning())
+	_, exists := local.Lookup("orders")
+	assert.False(t, exists)
+	assert.NotNil(t, s.Stop(context.Background()))
+}
+
+func TestSupervisorRestart(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	var sick, starts int32
+	flaky := service(t, "flaky",
+		easy.WithComponent("starter", lifecycle.Func{
+			OnStart: func(context.Context) error {
+				if atomic.AddInt32(&starts, 1) == 1 {
+					return errors.New("not yet")
+				}
+				return nil
+			},
+		}),
+		easy.WithHealthCheck("sick", health.Func(func(context.Context) error {
+			if atomic.LoadInt32(&sick) == 1 {
+				return errors.New("sick")
+			}
+			return nil
+		})))
+
+	s, err := New(WithLogger(logging.Discard()),
+		WithBackoff(5*time.Millisecond, 20*time.Millisecond),
+		WithHealthInterval(5*time.Millisecond),
+		WithFailureThreshold(2))
+	assert.Nil(t, err)
+	assert.Nil(t, s.Add(flaky))
+	assert.Nil(t, s.Start())
+	defer s.Stop(context.Background())
+
+	// the first start fails and is retried
+	eventually(t, func() bool { return s.Running("flaky") }, time.Second, 5*time.Millisecond)
+	assert.Equal(t, 1, s.Restarts("flaky"))
+
+	// a service down for too long is restarted
+	atomic.StoreInt32(&sick, 1)
+	eventually(t, func() bool { return s.Restarts("flaky") > 1 }, time.Second, 5*time.Millisecond)
+	atomic.StoreInt32(&sick, 0)
+	eventually(t, func() bool {
+		return s.Running("flaky") && flaky.Health(context.Background()).Status == health.Up
+	}, time.Second, 5*time.Millisecond)
+}
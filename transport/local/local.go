@@ -0,0 +1,277 @@
+// Package local is an in-process transport: services running in the same
+// process call each other through an http.Client whose requests never leave
+// the process. A request to http://orders/items is served by the running
+// local transport named orders
+package local
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"sync"
+
+	"github.com/advancedlogic/easy/commons"
+	"github.com/advancedlogic/easy/factory"
+	"github.com/advancedlogic/easy/interfaces"
+	"github.com/advancedlogic/easy/logging"
+	"github.com/gin-gonic/gin"
+)
+
+var (
+	mutex      sync.RWMutex
+	transports = make(map[string]*Local)
+)
+
+// Local is a transport served in process, under its name
+type Local struct {
+	sync.RWMutex
+	name          string
+	handlers      map[string]map[string][]gin.HandlerFunc
+	middleware    []gin.HandlerFunc
+	websiteFolder map[string]string
+	router        *gin.Engine
+	running       bool
+	interfaces.Logger
+}
+
+func WithName(name string) interfaces.TransportOption {
+	return func(t interfaces.Transport) error {
+		if name != "" {
+			l := t.(*Local)
+			l.name = name
+			return nil
+		}
+		return errors.New("name cannot be empty")
+	}
+}
+
+func WithLogger(logger interfaces.Logger) interfaces.TransportOption {
+	return func(t interfaces.Transport) error {
+		l := t.(*Local)
+		return l.WithLogger(logger)
+	}
+}
+
+func New(options ...interfaces.TransportOption) (*Local, error) {
+	l := &Local{
+		handlers: map[string]map[string][]gin.HandlerFunc{
+			commons.ModeGet:    make(map[string][]gin.HandlerFunc),
+			commons.ModePost:   make(map[string][]gin.HandlerFunc),
+			commons.ModePut:    make(map[string][]gin.HandlerFunc),
+			commons.ModeDelete: make(map[string][]gin.HandlerFunc),
+		},
+		websiteFolder: make(map[string]string),
+		Logger:        logging.Discard(),
+	}
+	for _, option := range options {
+		if err := option(l); err != nil {
+			return nil, err
+		}
+	}
+	if l.name == "" {
+		return nil, errors.New("name cannot be empty")
+	}
+	return l, nil
+}
+
+func (l *Local) Name() string {
+	return l.name
+}
+
+func (l *Local) Handler(mode, route string, handler interface{}) error {
+	h, ok := handler.(func(*gin.Context))
+	if !ok {
+		return fmt.Errorf("unsupported handler %T", handler)
+	}
+	l.Lock()
+	defer l.Unlock()
+	handlers, exists := l.handlers[mode]
+	if !exists {
+		return fmt.Errorf("unsupported mode %s", mode)
+	}
+	handlers[route] = append(handlers[route], h)
+	return nil
+}
+
+func (l *Local) Middleware(middleware interface{}) error {
+	m, ok := middleware.(func(*gin.Context))
+	if !ok {
+		return fmt.Errorf("unsupported middleware %T", middleware)
+	}
+	l.Lock()
+	defer l.Unlock()
+	l.middleware = append(l.middleware, m)
+	return nil
+}
+
+func (l *Local) StaticFilesFolder(uri, folder string) error {
+	l.Lock()
+	defer l.Unlock()
+	l.websiteFolder[uri] = folder
+	return nil
+}
+
+func (l *Local) Router() (interface{}, error) {
+	l.RLock()
+	defer l.RUnlock()
+	if l.router != nil {
+		return l.router, nil
+	}
+	return nil, errors.New("transport is not running")
+}
+
+// Port is always 0, a local transport does not listen
+func (l *Local) Port() int {
+	return 0
+}
+
+func (l *Local) Routes() []interfaces.Route {
+	l.RLock()
+	defer l.RUnlock()
+	routes := make([]interfaces.Route, 0)
+	for mode, handlers := range l.handlers {
+		for path := range handlers {
+			routes = append(routes, interfaces.Route{Mode: mode, Path: path})
+		}
+	}
+	sort.Slice(routes, func(i, j int) bool {
+		if routes[i].Path == routes[j].Path {
+			return routes[i].Mode < routes[j].Mode
+		}
+		return routes[i].Path < routes[j].Path
+	})
+	return routes
+}
+
+// Run build the router and make the transport reachable under its name
+func (l *Local) Run() error {
+	l.Lock()
+	defer l.Unlock()
+	router := gin.New()
+	router.Use(gin.Recovery())
+	router.Use(l.middleware...)
+	for path, handlers := range l.handlers[commons.ModeGet] {
+		router.GET(path, handlers...)
+	}
+	for path, handlers := range l.handlers[commons.ModePost] {
+		router.POST(path, handlers...)
+	}
+	for path, handlers := range l.handlers[commons.ModePut] {
+		router.PUT(path, handlers...)
+	}
+	for path, handlers := range l.handlers[commons.ModeDelete] {
+		router.DELETE(path, handlers...)
+	}
+	for uri, folder := range l.websiteFolder {
+		router.Static(uri, folder)
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	if _, exists := transports[l.name]; exists {
+		return fmt.Errorf("local transport %s already running", l.name)
+	}
+	transports[l.name] = l
+	l.router = router
+	l.running = true
+	l.Info("local transport running", "name", l.name)
+	return nil
+}
+
+func (l *Local) Stop() error {
+	return l.StopContext(context.Background())
+}
+
+// StopContext make the transport unreachable, requests already being served complete
+func (l *Local) StopContext(ctx context.Context) error {
+	l.Lock()
+	defer l.Unlock()
+	if !l.running {
+		return errors.New("transport is not running")
+	}
+	mutex.Lock()
+	delete(transports, l.name)
+	mutex.Unlock()
+	l.running = false
+	return nil
+}
+
+func (l *Local) Health(ctx context.Context) error {
+	l.RLock()
+	defer l.RUnlock()
+	if !l.running {
+		return errors.New("transport is not running")
+	}
+	return nil
+}
+
+func (l *Local) WithLogger(logger interfaces.Logger) error {
+	if logger != nil {
+		l.Logger = logger
+		return nil
+	}
+	return errors.New("logger cannot be nil")
+}
+
+// ServeHTTP serve a request with the handlers of the transport
+func (l *Local) ServeHTTP(w http.ResponseWriter, request *http.Request) {
+	l.RLock()
+	router, running := l.router, l.running
+	l.RUnlock()
+	if !running {
+		http.Error(w, fmt.Sprintf("%s is not running", l.name), http.StatusServiceUnavailable)
+		return
+	}
+	router.ServeHTTP(w, request)
+}
+
+// Lookup return the running local transport named name
+func Lookup(name string) (*Local, bool) {
+	mutex.RLock()
+	defer mutex.RUnlock()
+	l, exists := transports[name]
+	return l, exists
+}
+
+// RoundTripper send the requests whose host is the name of a running local
+// transport to it, and the others to Fallback or, when nil, http.DefaultTransport
+type RoundTripper struct {
+	Fallback http.RoundTripper
+}
+
+func (rt *RoundTripper) RoundTrip(request *http.Request) (*http.Response, error) {
+	host := request.URL.Host
+	if name, _, err := net.SplitHostPort(host); err == nil {
+		host = name
+	}
+	l, exists := Lookup(host)
+	if !exists {
+		if rt.Fallback != nil {
+			return rt.Fallback.RoundTrip(request)
+		}
+		return http.DefaultTransport.RoundTrip(request)
+	}
+	if request.Body != nil {
+		defer request.Body.Close()
+	}
+	recorder := httptest.NewRecorder()
+	l.ServeHTTP(recorder, request)
+	response := recorder.Result()
+	response.Request = request
+	return response, nil
+}
+
+// Client return an http.Client reaching the local transports by name
+func Client() *http.Client {
+	return &http.Client{Transport: &RoundTripper{}}
+}
+
+func init() {
+	factory.Register(factory.Transport, "local", func(settings interfaces.Configuration) (interface{}, error) {
+		return New(WithName(settings.GetStringOrDefault("name", "")))
+	})
+}
@@ -0,0 +1,54 @@
+package local
+
+import (
+	"io/ioutil"
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLocal(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	_, err := New()
+	assert.NotNil(t, err)
+
+	l, err := New(WithName("billing"))
+	assert.Nil(t, err)
+	assert.Equal(t, 0, l.Port())
+	assert.Nil(t, l.Handler("get", "/invoices/:id", func(c *gin.Context) {
+		c.String(http.StatusOK, "invoice "+c.Param("id"))
+	}))
+	assert.NotNil(t, l.Handler("get", "/wrong", func() {}))
+	assert.NotNil(t, l.Health(nil))
+
+	client := Client()
+	assert.Nil(t, l.Run())
+	assert.Nil(t, l.Health(nil))
+
+	twin, _ := New(WithName("billing"))
+	assert.NotNil(t, twin.Run())
+
+	response, err := client.Get("http://billing:8080/invoices/42")
+	assert.Nil(t, err)
+	body, _ := ioutil.ReadAll(response.Body)
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	assert.Equal(t, "invoice 42", string(body))
+
+	response, err = client.Get("http://billing/missing")
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusNotFound, response.StatusCode)
+
+	assert.Nil(t, l.Stop())
+	_, exists := Lookup("billing")
+	assert.False(t, exists)
+	assert.NotNil(t, l.Stop())
+
+	// a stopped transport can run again
+	assert.Nil(t, l.Run())
+	response, err = client.Get("http://billing/invoices/7")
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	assert.Nil(t, l.Stop())
+}
@@ -6,18 +6,28 @@ import (
 	"fmt"
 	"net"
 	"net/http"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/advancedlogic/easy/commons"
+	"github.com/advancedlogic/easy/factory"
 	"github.com/advancedlogic/easy/interfaces"
+	"github.com/advancedlogic/easy/logging"
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 	"github.com/sirupsen/logrus"
-	ginlogrus "github.com/toorop/gin-logrus"
 	ginprometheus "github.com/zsais/go-gin-prometheus"
 )
 
+// the gin metrics are registered once per process and shared by the transports
+var (
+	metricsOnce sync.Once
+	metrics     *ginprometheus.Prometheus
+)
+
 func WithPort(port int) interfaces.TransportOption {
 	return func(t interfaces.Transport) error {
 		if port > 0 {
@@ -89,13 +99,89 @@ func WithStaticFilesFolder(route, folder string) interfaces.TransportOption {
 	}
 }
 
-func WithLogger(logger *logrus.Logger) interfaces.TransportOption {
+//WithRequestTimeout bound the context of every request, handlers should pass
+//c.Request.Context() to downstream calls so that they stop when it is done
+func WithRequestTimeout(timeout time.Duration) interfaces.TransportOption {
+	return func(t interfaces.Transport) error {
+		if timeout > 0 {
+			rest := t.(*Rest)
+			rest.requestTimeout = timeout
+			return nil
+		}
+		return errors.New("timeout must be positive")
+	}
+}
+
+func WithLogger(logger interfaces.Logger) interfaces.TransportOption {
 	return func(t interfaces.Transport) error {
 		rest := t.(*Rest)
 		return rest.WithLogger(logger)
 	}
 }
 
+//WithStrictPort fail to start when the port is busy instead of moving to the next free one
+func WithStrictPort() interfaces.TransportOption {
+	return func(t interfaces.Transport) error {
+		rest := t.(*Rest)
+		rest.strictPort = true
+		return nil
+	}
+}
+
+//WithTLS serve https with the given certificate and key files
+func WithTLS(cert, key string) interfaces.TransportOption {
+	return func(t interfaces.Transport) error {
+		if cert != "" && key != "" {
+			rest := t.(*Rest)
+			rest.cert = cert
+			rest.key = key
+			return nil
+		}
+		return errors.New("cert and key cannot be empty")
+	}
+}
+
+//FromEnv configure the transport from the EASY_REST_* variables:
+//PORT, STRICT_PORT, CORS, TLS_CERT, TLS_KEY and REQUEST_TIMEOUT
+func FromEnv() interfaces.TransportOption {
+	return func(t interfaces.Transport) error {
+		if err := commons.EnvInt("rest", "port", func(port int) error {
+			return WithPort(port)(t)
+		}); err != nil {
+			return err
+		}
+		if err := commons.EnvBool("rest", "strict_port", func(strict bool) error {
+			t.(*Rest).strictPort = strict
+			return nil
+		}); err != nil {
+			return err
+		}
+		if err := commons.EnvBool("rest", "cors", func(cors bool) error {
+			t.(*Rest).cors = cors
+			return nil
+		}); err != nil {
+			return err
+		}
+		if err := commons.EnvDuration("rest", "request_timeout", func(timeout time.Duration) error {
+			return WithRequestTimeout(timeout)(t)
+		}); err != nil {
+			return err
+		}
+		if commons.EnvIsSet("rest", "tls_cert") || commons.EnvIsSet("rest", "tls_key") {
+			cert, _, err := commons.Env("rest", "tls_cert")
+			if err != nil {
+				return err
+			}
+			key, _, err := commons.Env("rest", "tls_key")
+			if err != nil {
+				return err
+			}
+			return WithTLS(cert, key)(t)
+		}
+		return nil
+	}
+}
+
 // Rest Server
 type Rest struct {
 	// Port bound to server
@@ -103,6 +189,7 @@ type Rest struct {
 	cors           bool
 	readTimeout    time.Duration
 	writeTimeout   time.Duration
+	requestTimeout time.Duration
 	getHandlers    map[string][]gin.HandlerFunc
 	postHandlers   map[string][]gin.HandlerFunc
 	putHandlers    map[string][]gin.HandlerFunc
@@ -111,9 +198,11 @@ type Rest struct {
 	websiteFolder  map[string]string
 	cert           string
 	key            string
+	strictPort     bool
+	served         bool
 	server         *http.Server
 	router         *gin.Engine
-	*logrus.Logger
+	interfaces.Logger
 }
 
 func New(options ...interfaces.TransportOption) (*Rest, error) {
@@ -126,7 +215,7 @@ func New(options ...interfaces.TransportOption) (*Rest, error) {
 		middleware:     make([]func(ctx *gin.Context), 0),
 		websiteFolder:  make(map[string]string),
 		router:         gin.New(),
-		Logger:         logrus.New(),
+		Logger:         logging.Logrus(logrus.New()),
 	}
 
 	for _, option := range options {
@@ -180,20 +269,32 @@ func (r *Rest) StaticFilesFolder(uri, folder string) error {
 }
 
 func (r *Rest) Run() error {
+	if r.served {
+		// a gin engine cannot register the same routes twice, a restarted
+		// transport needs a fresh one
+		r.router = gin.New()
+	}
+	r.served = true
 	router := r.router
-	router.Use(ginlogrus.Logger(r.Logger), gin.Recovery())
-	router.GET("/healthcheck", func(c *gin.Context) {
-		c.String(200, "product service is good")
-	})
-
+	router.Use(r.requestLogger, gin.Recovery())
+	if r.requestTimeout > 0 {
+		router.Use(func(c *gin.Context) {
+			ctx, cancel := context.WithTimeout(c.Request.Context(), r.requestTimeout)
+			defer cancel()
+			c.Request = c.Request.WithContext(ctx)
+			c.Next()
+		})
+	}
 	if r.cors {
 		config := cors.DefaultConfig()
 		config.AllowOrigins = []string{"*"}
 		router.Use(cors.New(config))
 	}
 
-	p := ginprometheus.NewPrometheus("gin")
-	p.Use(router)
+	metricsOnce.Do(func() {
+		metrics = ginprometheus.NewPrometheus("gin")
+	})
+	metrics.Use(router)
 
 	for _, middleware := range r.middleware {
 		router.Use(gin.HandlerFunc(middleware))
@@ -220,72 +321,125 @@ func (r *Rest) Run() error {
 		}
 	}
 
-	if err := r.findAlternativePort(); err != nil {
-		r.Fatal(err)
+	listener, err := r.listen()
+	if err != nil {
+		return err
 	}
 
 	s := &http.Server{
-		Addr:           fmt.Sprintf(":%d", r.port),
 		Handler:        router,
 		ReadTimeout:    r.readTimeout,
 		WriteTimeout:   r.writeTimeout,
 		MaxHeaderBytes: 1 << 20,
 	}
 	r.server = s
-	httpHeader := "http"
 	go func() {
+		var err error
 		if r.cert != "" && r.key != "" {
-			if err := s.ListenAndServeTLS(r.cert, r.key); err != nil {
-				r.Fatal(err)
-			}
-			httpHeader += "s"
-		} else if err := s.ListenAndServe(); err != nil {
-			r.Fatal(err)
+			err = s.ServeTLS(listener, r.cert, r.key)
+		} else {
+			err = s.Serve(listener)
+		}
+		if err != nil && err != http.ErrServerClosed {
+			r.Error("http(s) server stopped", "error", err)
 		}
-
 	}()
-	r.Info(fmt.Sprintf("Http(s) server listening on port %d", r.port))
+	r.Info("http(s) server listening", "port", r.port)
 	return nil
 }
 
-func (r *Rest) scanPort(ip string, port int, timeout time.Duration) error {
-	target := fmt.Sprintf("%s:%d", ip, port)
-	conn, err := net.DialTimeout("tcp", target, timeout)
+//requestLogger give every request a logger carrying its request and trace IDs,
+//available in handlers through logging.FromContext, and log the request once served.
+//The request ID is read from X-Request-ID or generated and echoed in the response,
+//the trace ID is read from the W3C traceparent header or X-Trace-ID
+func (r *Rest) requestLogger(c *gin.Context) {
+	start := time.Now()
+	requestID := c.GetHeader("X-Request-ID")
+	if requestID == "" {
+		requestID = uuid.New().String()
+	}
+	c.Header("X-Request-ID", requestID)
+	keyvals := []interface{}{"request_id", requestID}
+	if traceID := traceID(c.Request); traceID != "" {
+		keyvals = append(keyvals, "trace_id", traceID)
+	}
+	logger := r.Logger.With(keyvals...)
+	c.Request = c.Request.WithContext(logging.NewContext(c.Request.Context(), logger))
 
-	if err != nil {
-		if strings.Contains(err.Error(), "too many open files") {
-			time.Sleep(timeout)
-			err = r.scanPort(ip, port, timeout)
-		}
-		return err
+	c.Next()
+
+	keyvals = []interface{}{
+		"method", c.Request.Method,
+		"path", c.Request.URL.Path,
+		"status", c.Writer.Status(),
+		"latency", time.Since(start).String(),
+		"client_ip", c.ClientIP(),
+	}
+	switch status := c.Writer.Status(); {
+	case status >= http.StatusInternalServerError:
+		logger.Error("request served", keyvals...)
+	case status >= http.StatusBadRequest:
+		logger.Warn("request served", keyvals...)
+	default:
+		logger.Info("request served", keyvals...)
 	}
+}
 
-	if err = conn.Close(); err != nil {
-		return err
+func traceID(request *http.Request) string {
+	if parent := strings.Split(request.Header.Get("traceparent"), "-"); len(parent) == 4 {
+		return parent[1]
 	}
-	r.Warn(fmt.Sprintf("port %s is busy", port))
-	return nil
+	return request.Header.Get("X-Trace-ID")
 }
 
-func (r *Rest) findAlternativePort() error {
-	currentPort := r.port
-	for port := currentPort; port < 32000; port++ {
-		err := r.scanPort("localhost", port, 10*time.Second)
-		if err != nil {
-			r.port = port
-			return nil
-		}
+//listen bind the port, or with a busy port and without WithStrictPort the
+//next free one. The port is bound before Run returns, so a busy port is an
+//error of Run and no other process can take it in between
+func (r *Rest) listen() (net.Listener, error) {
+	listener, err := net.Listen("tcp", fmt.Sprintf(":%d", r.port))
+	if err != nil && r.strictPort {
+		return nil, fmt.Errorf("port %d is busy: %v", r.port, err)
 	}
-	return errors.New("no alternatives port found")
+	for port := r.port + 1; err != nil && r.port > 0 && port <= 65535; port++ {
+		r.Warn("port is busy", "port", port-1)
+		listener, err = net.Listen("tcp", fmt.Sprintf(":%d", port))
+	}
+	if err != nil {
+		return nil, errors.New("no alternatives port found")
+	}
+	r.port = listener.Addr().(*net.TCPAddr).Port
+	return listener, nil
+}
+
+//Health report whether the server is running
+func (r *Rest) Health(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if r.server == nil {
+		return errors.New("server not running")
+	}
+	return nil
 }
 
 func (r *Rest) Stop() error {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
-	return r.server.Shutdown(ctx)
+	return r.StopContext(ctx)
 }
 
-func (r *Rest) WithLogger(logger *logrus.Logger) error {
+//StopContext gracefully shut down the server, waiting for in-flight requests until ctx is done
+func (r *Rest) StopContext(ctx context.Context) error {
+	server := r.server
+	if server == nil {
+		return errors.New("server is not running")
+	}
+	// a stopped server is no longer healthy
+	r.server = nil
+	return server.Shutdown(ctx)
+}
+
+func (r *Rest) WithLogger(logger interfaces.Logger) error {
 	if logger != nil {
 		r.Logger = logger
 		return nil
@@ -303,3 +457,48 @@ func (r *Rest) Router() (interface{}, error) {
 func (r *Rest) Port() int {
 	return r.port
 }
+
+//Routes return the registered handlers sorted by path and mode
+func (r *Rest) Routes() []interfaces.Route {
+	routes := make([]interfaces.Route, 0)
+	for mode, handlers := range map[string]map[string][]gin.HandlerFunc{
+		commons.ModeGet:    r.getHandlers,
+		commons.ModePost:   r.postHandlers,
+		commons.ModePut:    r.putHandlers,
+		commons.ModeDelete: r.deleteHandlers,
+	} {
+		for path := range handlers {
+			routes = append(routes, interfaces.Route{Mode: mode, Path: path})
+		}
+	}
+	sort.Slice(routes, func(i, j int) bool {
+		if routes[i].Path == routes[j].Path {
+			return routes[i].Mode < routes[j].Mode
+		}
+		return routes[i].Path < routes[j].Path
+	})
+	return routes
+}
+
+func init() {
+	factory.Register(factory.Transport, "rest", func(settings interfaces.Configuration) (interface{}, error) {
+		options := make([]interfaces.TransportOption, 0)
+		if port := settings.GetIntOrDefault("port", 0); port > 0 {
+			options = append(options, WithPort(port))
+		}
+		if settings.GetBoolOrDefault("strict_port", false) {
+			options = append(options, WithStrictPort())
+		}
+		if settings.GetBoolOrDefault("cors", false) {
+			options = append(options, EnableCORS())
+		}
+		if timeout := settings.GetDurationOrDefault("request_timeout", 0); timeout > 0 {
+			options = append(options, WithRequestTimeout(timeout))
+		}
+		cert, key := settings.GetStringOrDefault("tls_cert", ""), settings.GetStringOrDefault("tls_key", "")
+		if cert != "" || key != "" {
+			options = append(options, WithTLS(cert, key))
+		}
+		return New(append(options, FromEnv())...)
+	})
+}
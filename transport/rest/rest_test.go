@@ -0,0 +1,42 @@
+package rest
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// freePort return a port nobody listens on
+func freePort(t *testing.T) int {
+	l, err := net.Listen("tcp", ":0")
+	assert.Nil(t, err)
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port
+}
+
+func TestRest_Health(t *testing.T) {
+	r, err := New(WithPort(freePort(t)), WithStrictPort())
+	assert.Nil(t, err)
+	assert.NotNil(t, r.Health(context.Background()))
+	assert.Nil(t, r.Run())
+	assert.Nil(t, r.Health(context.Background()))
+	assert.Nil(t, r.Stop())
+	assert.NotNil(t, r.Health(context.Background()))
+	assert.NotNil(t, r.Stop())
+}
+
+func TestRest_BusyPort(t *testing.T) {
+	busy, err := net.Listen("tcp", ":0")
+	assert.Nil(t, err)
+	defer busy.Close()
+	port := busy.Addr().(*net.TCPAddr).Port
+
+	strict, _ := New(WithPort(port), WithStrictPort())
+	assert.NotNil(t, strict.Run())
+	r, _ := New(WithPort(port))
+	assert.Nil(t, r.Run())
+	defer r.Stop()
+	assert.NotEqual(t, port, r.Port())
+}